@@ -0,0 +1,21 @@
+package drafts
+
+import "time"
+
+//Draft is an unsent message that a user has started
+//writing in a channel
+type Draft struct {
+	ChannelID string    `json:"channelID"`
+	Body      string    `json:"body"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+//DraftUpdates represents the fields a client can set on a draft
+type DraftUpdates struct {
+	Body string `json:"body"`
+}
+
+//key returns the key a user's draft for a channel is stored under
+func key(userID string, channelID string) string {
+	return userID + ":" + channelID
+}
@@ -0,0 +1,51 @@
+package drafts
+
+import (
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+//MemStore represents an in-memory drafts store.
+//This should be used only for testing and prototyping.
+//Production systems should use a shared server store like redis
+type MemStore struct {
+	entries *cache.Cache
+}
+
+//NewMemStore constructs and returns a new MemStore
+func NewMemStore(draftDuration time.Duration) *MemStore {
+	if draftDuration < 0 {
+		draftDuration = DefaultDraftDuration
+	}
+	return &MemStore{
+		entries: cache.New(draftDuration, time.Minute),
+	}
+}
+
+//Store implementation
+
+//Save saves the draft for the user, replacing any previous draft
+//for the same channel, and resets its time to live.
+func (ms *MemStore) Save(userID string, draft *Draft) error {
+	// store a copy so callers can't change the saved draft
+	saved := *draft
+	ms.entries.Set(key(userID, draft.ChannelID), &saved, cache.DefaultExpiration)
+	return nil
+}
+
+//Get returns the user's draft for the channel
+func (ms *MemStore) Get(userID string, channelID string) (*Draft, error) {
+	d, found := ms.entries.Get(key(userID, channelID))
+	if !found {
+		return nil, ErrDraftNotFound
+	}
+	draft := *d.(*Draft)
+	return &draft, nil
+}
+
+//Delete deletes the user's draft for the channel
+func (ms *MemStore) Delete(userID string, channelID string) error {
+	ms.entries.Delete(key(userID, channelID))
+	return nil
+}
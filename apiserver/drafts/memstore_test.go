@@ -0,0 +1,55 @@
+package drafts
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemStore(t *testing.T) {
+	store := NewMemStore(-1)
+
+	draft := &Draft{
+		ChannelID: "channel1",
+		Body:      "half written",
+		UpdatedAt: time.Now(),
+	}
+	if err := store.Save("user1", draft); err != nil {
+		t.Fatalf("error saving draft: %v", err)
+	}
+
+	d2, err := store.Get("user1", "channel1")
+	if err != nil {
+		t.Fatalf("error getting draft: %v", err)
+	}
+	if d2.Body != draft.Body {
+		t.Errorf("incorrect draft body: expected `%s` but got `%s`", draft.Body, d2.Body)
+	}
+
+	// drafts are per user and per channel
+	if _, err := store.Get("user2", "channel1"); err != ErrDraftNotFound {
+		t.Errorf("expected ErrDraftNotFound for another user but got %v", err)
+	}
+	if _, err := store.Get("user1", "channel2"); err != ErrDraftNotFound {
+		t.Errorf("expected ErrDraftNotFound for another channel but got %v", err)
+	}
+
+	// saving again replaces the draft
+	draft.Body = "fully written"
+	if err := store.Save("user1", draft); err != nil {
+		t.Fatalf("error saving draft: %v", err)
+	}
+	d2, err = store.Get("user1", "channel1")
+	if err != nil {
+		t.Fatalf("error getting draft: %v", err)
+	}
+	if d2.Body != "fully written" {
+		t.Errorf("draft not replaced: expected `fully written` but got `%s`", d2.Body)
+	}
+
+	if err := store.Delete("user1", "channel1"); err != nil {
+		t.Fatalf("error deleting draft: %v", err)
+	}
+	if _, err := store.Get("user1", "channel1"); err != ErrDraftNotFound {
+		t.Errorf("expected ErrDraftNotFound after delete but got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package drafts
+
+import (
+	"encoding/json"
+	"time"
+
+	"gopkg.in/redis.v5"
+)
+
+//redisKeyPrefix is the prefix we will use for keys
+//related to drafts. This keeps draft keys separate
+//from other keys in the shared redis key namespace.
+const redisKeyPrefix = "draft:"
+const defaultAddr = "127.0.0.1:6379"
+
+//RedisStore represents a drafts.Store backed by redis.
+type RedisStore struct {
+	//Redis client used to talk to redis server.
+	Client *redis.Client
+	//Used for key expiry time on redis.
+	DraftDuration time.Duration
+}
+
+//NewRedisStore constructs a new RedisStore, using the provided client and
+//draft duration. If the `client` is nil, it will be set to redis.NewClient()
+//pointing at a local redis instance. If `draftDuration` is negative, it will
+//be set to `DefaultDraftDuration`.
+func NewRedisStore(client *redis.Client, draftDuration time.Duration) *RedisStore {
+	if client == nil {
+		client = redis.NewClient(&redis.Options{
+			Addr: defaultAddr,
+		})
+	}
+	if draftDuration < 0 {
+		draftDuration = DefaultDraftDuration
+	}
+	return &RedisStore{
+		Client:        client,
+		DraftDuration: draftDuration,
+	}
+}
+
+//Store implementation
+
+//Save saves the draft for the user, replacing any previous draft
+//for the same channel, and resets its time to live.
+func (rs *RedisStore) Save(userID string, draft *Draft) error {
+	jbuf, err := json.Marshal(draft)
+	if err != nil {
+		return err
+	}
+	return rs.Client.Set(redisKeyPrefix+key(userID, draft.ChannelID), jbuf, rs.DraftDuration).Err()
+}
+
+//Get returns the user's draft for the channel
+func (rs *RedisStore) Get(userID string, channelID string) (*Draft, error) {
+	jbuf, err := rs.Client.Get(redisKeyPrefix + key(userID, channelID)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrDraftNotFound
+		}
+		return nil, err
+	}
+
+	draft := &Draft{}
+	if err := json.Unmarshal(jbuf, draft); err != nil {
+		return nil, err
+	}
+	return draft, nil
+}
+
+//Delete deletes the user's draft for the channel
+func (rs *RedisStore) Delete(userID string, channelID string) error {
+	return rs.Client.Del(redisKeyPrefix + key(userID, channelID)).Err()
+}
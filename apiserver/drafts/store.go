@@ -0,0 +1,29 @@
+package drafts
+
+import (
+	"errors"
+	"time"
+)
+
+//DefaultDraftDuration is the default duration for saving drafts
+//in the store. Drafts that haven't been touched in this time
+//are automatically deleted.
+const DefaultDraftDuration = time.Hour * 24 * 7
+
+//ErrDraftNotFound is returned from Store.Get() when there is no
+//draft saved for the user and channel
+var ErrDraftNotFound = errors.New("draft not found")
+
+//Store represents a store of unsent message drafts,
+//keyed by the user who wrote them and the channel they are for.
+type Store interface {
+	//Save saves the draft for the user, replacing any previous draft
+	//for the same channel, and resets its time to live.
+	Save(userID string, draft *Draft) error
+
+	//Get returns the user's draft for the channel
+	Get(userID string, channelID string) (*Draft, error)
+
+	//Delete deletes the user's draft for the channel
+	Delete(userID string, channelID string) error
+}
@@ -0,0 +1,97 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+)
+
+// ChannelLookup gets the channels events are sent about,
+// so the Notifier can check who is allowed to see them
+type ChannelLookup interface {
+	GetChannelByID(id interface{}) (*messages.Channel, error)
+}
+
+// audience is who can see a channel's events
+type audience struct {
+	private bool
+	members map[string]bool
+}
+
+// canView reports whether the user can see the channel's events
+func (a *audience) canView(userID string) bool {
+	return !a.private || a.members[userID]
+}
+
+// newAudience returns the audience of the channel
+func newAudience(channel *messages.Channel) *audience {
+	a := &audience{
+		private: channel.Private,
+		members: make(map[string]bool, len(channel.Members)),
+	}
+	for _, m := range channel.Members {
+		a.members[messages.IDString(m)] = true
+	}
+	return a
+}
+
+// audiences caches the audience of each channel so the store isn't
+// asked for every event, the handlers keep it up to date as users
+// join and leave channels
+type audiences struct {
+	channels ChannelLookup
+	cache    map[string]*audience
+	// changes counts the updates, so a channel loaded while one
+	// happened isn't cached with the change missing
+	changes int
+	mu      sync.Mutex
+}
+
+// get returns the audience of the channel, loading it from the store if it isn't cached
+func (as *audiences) get(channelID string) (*audience, error) {
+	as.mu.Lock()
+	a, found := as.cache[channelID]
+	changes := as.changes
+	as.mu.Unlock()
+	if found {
+		return a, nil
+	}
+
+	channel, err := as.channels.GetChannelByID(channelID)
+	if err != nil {
+		return nil, err
+	}
+	a = newAudience(channel)
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	// someone may have joined or left while we were loading it
+	if as.changes == changes {
+		as.cache[channelID] = a
+	}
+	return a, nil
+}
+
+// update changes a cached audience, channels that aren't cached
+// are loaded with the change the next time they're needed
+func (as *audiences) update(channelID string, change func(a *audience)) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.changes++
+	if a, found := as.cache[channelID]; found {
+		// copy it so events being delivered keep a consistent view
+		updated := &audience{private: a.private, members: make(map[string]bool, len(a.members)+1)}
+		for m := range a.members {
+			updated.members[m] = true
+		}
+		change(updated)
+		as.cache[channelID] = updated
+	}
+}
+
+// forget drops the cached audience of the channel
+func (as *audiences) forget(channelID string) {
+	as.mu.Lock()
+	as.changes++
+	delete(as.cache, channelID)
+	as.mu.Unlock()
+}
@@ -0,0 +1,110 @@
+package events
+
+import (
+	"log"
+)
+
+// the changes that are shared between servers
+const (
+	controlJoined  = "joined"
+	controlLeft    = "left"
+	controlChanged = "changed"
+	// controlSessionEnded closes the connections opened with a session
+	controlSessionEnded = "session ended"
+)
+
+// Control is a change made on one server and passed on to the others, either
+// to who can see a channel so their audiences stay up to date, or a session
+// ending so they close the connections opened with it
+type Control struct {
+	Op        string `json:"op"`
+	ChannelID string `json:"channelID,omitempty"`
+	UserID    string `json:"userID,omitempty"`
+	SessionID string `json:"sessionID,omitempty"`
+}
+
+// Bus carries records between the Notifiers of every server,
+// so users get the events of servers they aren't connected to
+type Bus interface {
+	// Publish sends the record to every Notifier on the bus, this one included.
+	// Records of events that aren't ephemeral are logged first, which gives them their sequence number
+	Publish(record *Record) error
+	// Receive returns the records published on the bus by every server,
+	// the logged ones in the order of their sequence numbers
+	Receive() <-chan *Record
+	// Log returns the log the bus keeps recent events in
+	Log() Log
+}
+
+// LocalBus is a Bus for a single server, it is the default
+type LocalBus struct {
+	log     Log
+	records chan *Record
+}
+
+// NewLocalBus returns a LocalBus that logs events in the log
+func NewLocalBus(log Log) *LocalBus {
+	return &LocalBus{
+		log:     log,
+		records: make(chan *Record, EventQueueSize),
+	}
+}
+
+// Publish logs the record if it should be, and sends it to this server's Notifier
+func (b *LocalBus) Publish(record *Record) error {
+	// there are no other servers to tell about changes to channels
+	if record.Control != nil {
+		return nil
+	}
+	if record.logged() {
+		if err := b.log.Append(record); err != nil {
+			return err
+		}
+	}
+	b.records <- record
+	return nil
+}
+
+// Receive returns the records published on the bus
+func (b *LocalBus) Receive() <-chan *Record {
+	return b.records
+}
+
+// Log returns the log the bus keeps recent events in
+func (b *LocalBus) Log() Log {
+	return b.log
+}
+
+// sequencer passes on the records received from a bus, dropping logged records
+// it has already passed on and catching up from the log on ones it missed,
+// so they are passed on once each and in the order of their sequence numbers
+type sequencer struct {
+	log Log
+	// last is the sequence number of the last logged record passed on
+	last uint64
+	out  chan<- *Record
+}
+
+// receive passes on the record, after any it missed
+func (s *sequencer) receive(record *Record) {
+	if record.Seq == 0 {
+		s.out <- record
+		return
+	}
+	if record.Seq <= s.last {
+		return
+	}
+	if record.Seq > s.last+1 {
+		missed, err := s.log.Since(s.last)
+		if err != nil {
+			log.Printf("error catching up on events %d to %d: %v", s.last+1, record.Seq-1, err)
+		}
+		for _, r := range missed {
+			if r.Seq < record.Seq {
+				s.out <- r
+			}
+		}
+	}
+	s.out <- record
+	s.last = record.Seq
+}
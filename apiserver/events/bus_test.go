@@ -0,0 +1,119 @@
+package events
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
+)
+
+// sharedBus is a Bus shared by Notifiers in the same process,
+// the way a RedisBus is shared by servers
+type sharedBus struct {
+	log   *MemLog
+	views []chan *Record
+	mu    sync.Mutex
+}
+
+// busView is one Notifier's view of a sharedBus
+type busView struct {
+	*sharedBus
+	records chan *Record
+}
+
+// view returns a Bus for another Notifier on the shared bus
+func (b *sharedBus) view() Bus {
+	v := &busView{sharedBus: b, records: make(chan *Record, 100)}
+	b.mu.Lock()
+	b.views = append(b.views, v.records)
+	b.mu.Unlock()
+	return v
+}
+
+func (v *busView) Publish(record *Record) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if record.logged() {
+		v.log.Append(record)
+	}
+	for _, records := range v.views {
+		records <- record
+	}
+	return nil
+}
+
+func (v *busView) Receive() <-chan *Record {
+	return v.records
+}
+
+func (v *busView) Log() Log {
+	return v.log
+}
+
+func TestNotifierBus(t *testing.T) {
+	channels := fakeChannels{
+		"private": &messages.Channel{ID: "private", Private: true, Members: []users.UserID{"member"}},
+	}
+	bus := &sharedBus{log: NewMemLog(DefaultLogSize)}
+	a := NewNotifier(channels)
+	a.UseBus(bus.view())
+	b := NewNotifier(channels)
+	b.UseBus(bus.view())
+	serveNotifier(t, a, nil)
+	connect := serveNotifier(t, b, nil)
+	member := eventTypes(connect("member"))
+	joiner := eventTypes(connect("joiner"))
+
+	// events notified on one server reach the users on the other
+	a.Notify(&Event{Type: "everyone"})
+	a.Notify(&Event{Type: "private", ChannelID: "private"})
+	if got := strings.Join(received(t, member), ","); got != "everyone,private" {
+		t.Errorf("expected the member to get both events but got %q", got)
+	}
+	if got := strings.Join(received(t, joiner), ","); got != "everyone" {
+		t.Errorf("expected the non-member to only get the public event but got %q", got)
+	}
+
+	// and so do changes to who can see a channel
+	a.Joined("private", "joiner")
+	a.Notify(&Event{Type: "after joining", ChannelID: "private"})
+	if got := strings.Join(received(t, joiner), ","); got != "after joining" {
+		t.Errorf("expected the user who joined on the other server to get the channel's events but got %q", got)
+	}
+}
+
+func TestSequencer(t *testing.T) {
+	l := NewMemLog(DefaultLogSize)
+	records := make([]*Record, 5)
+	for i := range records {
+		records[i] = &Record{Event: []byte(`{}`)}
+		l.Append(records[i])
+	}
+	out := make(chan *Record, 10)
+	s := &sequencer{log: l, out: out}
+
+	// duplicates are dropped, missed records are caught up on from
+	// the log, and records that aren't logged are passed straight on
+	s.receive(records[0])
+	s.receive(records[0])
+	s.receive(records[3])
+	s.receive(&Record{Ephemeral: true})
+	s.receive(records[2])
+	s.receive(records[4])
+	close(out)
+	got := []uint64{}
+	for r := range out {
+		got = append(got, r.Seq)
+	}
+	expected := []uint64{1, 2, 3, 4, 0, 5}
+	if len(got) != len(expected) {
+		t.Fatalf("expected records %v but got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("expected records %v but got %v", expected, got)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TypeResponse is the type of the frames that answer commands
+const TypeResponse = "response"
+
+// the limits on how many commands a connection may send, it can send
+// CommandBurst commands at once and then CommandRate commands a second
+var (
+	CommandRate  = 10.0
+	CommandBurst = 20.0
+)
+
+// Command is a request a client sends over its websocket, such as posting a message.
+// The client picks the ID and the response to the command carries the same ID.
+type Command struct {
+	ID   string          `json:"id"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Response answers a command, the status is the HTTP status
+// the same request would get from the REST API
+type Response struct {
+	Version int         `json:"version"`
+	Type    string      `json:"type"`
+	ID      string      `json:"id"`
+	Status  int         `json:"status"`
+	Error   string      `json:"error,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// NewResponse returns a successful response with the data
+func NewResponse(data interface{}) *Response {
+	return &Response{Status: http.StatusOK, Data: data}
+}
+
+// NewErrorResponse returns a response for a command that failed
+func NewErrorResponse(status int, err string) *Response {
+	return &Response{Status: status, Error: err}
+}
+
+// CommandHandler carries out the commands clients send over their websockets
+type CommandHandler interface {
+	HandleCommand(client *Client, cmd *Command) *Response
+}
+
+// Client is a websocket or event stream that has been added to the Notifier
+type Client struct {
+	// id identifies the connection among all the servers
+	id string
+	// conn is the websocket or event stream the client's frames are sent over
+	conn   transport
+	userID string
+	// sessionID is the session the connection was opened with,
+	// it is closed when the session ends
+	sessionID string
+	commands  CommandHandler
+	limiter   *limiter
+	// channels and types are the channels and event types
+	// the client has subscribed to, see Subscribe
+	channels filter
+	types    filter
+	mu       sync.RWMutex
+	// seq is the sequence number of the last event the client was sent or told about,
+	// it is only used by the Notifier's broadcast and while greeting the client
+	seq uint64
+	// greeting holds the frames the client's writer sends before the queued
+	// ones, the connected event and any replayed events, see greet
+	greeting []*outbound
+	// queue holds the frames waiting for the client's writer
+	queue chan *outbound
+	// done is closed when the client is removed, to stop its writer
+	done chan struct{}
+}
+
+// ConnectionObserver is told when clients connect and disconnect,
+// along with the ID of the connection
+type ConnectionObserver interface {
+	Connected(userID string, connID string)
+	Disconnected(userID string, connID string)
+}
+
+// Listener is given the events a Notifier publishes, it must not block
+type Listener interface {
+	Published(record *Record)
+}
+
+// newClientID returns a random ID for a connection
+func newClientID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// newClient returns a client for the user that sends its frames over the connection
+func newClient(conn transport, userID string, sessionID string, commands CommandHandler) *Client {
+	return &Client{
+		id:        newClientID(),
+		conn:      conn,
+		userID:    userID,
+		sessionID: sessionID,
+		commands:  commands,
+		limiter:   newLimiter(CommandRate, CommandBurst),
+		queue:     make(chan *outbound, ClientQueueSize),
+		done:      make(chan struct{}),
+	}
+}
+
+// UserID returns the ID of the user who opened the connection
+func (c *Client) UserID() string {
+	return c.userID
+}
+
+// greet sets the greeting event and the replayed frames that follow it, which the
+// client's writer sends before the queued frames. It must be called before the writer is started
+func (c *Client) greet(greeting *Event, replay ...*outbound) error {
+	buf, err := json.Marshal(greeting)
+	if err != nil {
+		return err
+	}
+	c.greeting = append([]*outbound{{data: buf}}, replay...)
+	return nil
+}
+
+// limiter is a token bucket that limits how often a client can send commands
+type limiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate float64, burst float64) *limiter {
+	return &limiter{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// allow reports whether another command can be sent now, and uses up a token if it can.
+// It is only called from the connection's read loop, so it doesn't need a lock.
+func (l *limiter) allow(now time.Time) bool {
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
@@ -1,43 +1,283 @@
 package events
 
+import (
+	"github.com/aethanol/challenges-aethanol/apiserver/drafts"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
+	"github.com/aethanol/challenges-aethanol/apiserver/presence"
+	"github.com/aethanol/challenges-aethanol/apiserver/readmarkers"
+)
+
+// SchemaVersion is the version of the event schema in schema.json,
+// it is bumped whenever an event type or payload changes shape
+const SchemaVersion = 1
+
+// the types of events, each is sent with the payload of the same name below
+const (
+	TypeNewUser        = "new user"
+	TypeNewChannel     = "new channel"
+	TypeChannelUpdate  = "updated channel"
+	TypeChannelDelete  = "channel deleted"
+	TypeUserJoin       = "user joined"
+	TypeUserLeft       = "user left"
+	TypeNewMessage     = "new message"
+	TypeMessageUpdate  = "message update"
+	TypeMessageDelete  = "message deleted"
+	TypeMessagesDelete = "messages deleted"
+	TypeMessagesMove   = "messages moved"
+	TypePollUpdate     = "poll updated"
+	TypeDraftUpdate    = "draft updated"
+	TypeChannelRead    = "channel read"
+	TypeUserTyping     = "user typing"
+	TypePresenceChange = "presence changed"
+	TypeConnected      = "connected"
+	TypeResyncRequired = "resync required"
+)
+
+// Types are the types of events about changes in the workspace, leaving
+// out the ones that are only sent to a single connection
+var Types = []string{
+	TypeNewUser,
+	TypeNewChannel,
+	TypeChannelUpdate,
+	TypeChannelDelete,
+	TypeUserJoin,
+	TypeUserLeft,
+	TypeNewMessage,
+	TypeMessageUpdate,
+	TypeMessageDelete,
+	TypeMessagesDelete,
+	TypeMessagesMove,
+	TypePollUpdate,
+	TypeDraftUpdate,
+	TypeChannelRead,
+	TypeUserTyping,
+	TypePresenceChange,
+}
+
+// Payload is the data of an event, each payload knows the type of event it is sent in
+type Payload interface {
+	EventType() string
+}
+
 // Event defines a event that is transmitted via websocket to a client
 type Event struct {
-	Type string      `json:"type"`
-	Data interface{} `json:"data"`
+	Version int    `json:"version"`
+	Type    string `json:"type"`
+	// Seq is the event's place in the event log, it goes up by one for
+	// every logged event so clients can tell which ones they missed.
+	// It is left out of ephemeral events and ones sent to a single connection
+	Seq  uint64  `json:"seq,omitempty"`
+	Data Payload `json:"data"`
+	// ChannelID restricts delivery to the users who can see the channel,
+	// its members if it is private or everyone if it is public
+	ChannelID string `json:"-"`
+	// UserIDs restricts delivery to the connections of these users,
+	// as well as the channel's audience if ChannelID is set.
+	// If neither is set the event goes to everyone
+	UserIDs []string `json:"-"`
+	// ExcludeUserIDs are users the event is never sent to, even if
+	// they can see its channel, such as the user who caused it
+	ExcludeUserIDs []string `json:"-"`
+	// Ephemeral events aren't worth catching up on after reconnecting,
+	// so they aren't logged or given a sequence number
+	Ephemeral bool `json:"-"`
+}
+
+// deliverTo reports whether the event should be sent to the user's connections,
+// given the audience of the event's channel (nil if it couldn't be found)
+func (e *Event) deliverTo(userID string, channel *audience) bool {
+	for _, id := range e.ExcludeUserIDs {
+		if id == userID {
+			return false
+		}
+	}
+	if len(e.ChannelID) == 0 && len(e.UserIDs) == 0 {
+		return true
+	}
+	if channel != nil && channel.canView(userID) {
+		return true
+	}
+	return e.names(userID)
+}
+
+// names reports whether the user is one of the users the event is addressed to
+func (e *Event) names(userID string) bool {
+	for _, id := range e.UserIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// New returns an event carrying the payload, that goes to everyone
+func New(data Payload) *Event {
+	return &Event{
+		Version: SchemaVersion,
+		Type:    data.EventType(),
+		Data:    data,
+	}
+}
+
+// NewUser is sent when a user signs up
+type NewUser struct {
+	User *users.User `json:"user"`
+}
+
+// NewChannel is sent when a channel is created
+type NewChannel struct {
+	Channel *messages.Channel `json:"channel"`
+}
+
+// ChannelUpdate is sent when a channel's name or description changes
+type ChannelUpdate struct {
+	Channel *messages.Channel `json:"channel"`
+}
+
+// ChannelDelete is sent when a channel is deleted
+type ChannelDelete struct {
+	ChannelID messages.ChannelID `json:"channelID"`
+}
+
+// UserJoin is sent when a user is added to a channel
+type UserJoin struct {
+	UserID    users.UserID       `json:"userID"`
+	ChannelID messages.ChannelID `json:"channelID"`
+}
+
+// UserLeft is sent when a user is removed from a channel
+type UserLeft struct {
+	UserID    users.UserID       `json:"userID"`
+	ChannelID messages.ChannelID `json:"channelID"`
+}
+
+// NewMessage is sent when a message is posted or forwarded to a channel
+type NewMessage struct {
+	Message *messages.Message `json:"message"`
+}
+
+// MessageUpdate is sent when a message is edited
+type MessageUpdate struct {
+	Message *messages.Message `json:"message"`
+}
+
+// MessageDelete is sent when a message is deleted
+type MessageDelete struct {
+	MessageID messages.MessageID `json:"messageID"`
+	ChannelID messages.ChannelID `json:"channelID"`
+}
+
+// MessagesDelete is sent when a moderator deletes messages in bulk
+type MessagesDelete struct {
+	MessageIDs []messages.MessageID `json:"messageIDs"`
+	ChannelIDs []string             `json:"channelIDs"`
+}
+
+// MessagesMove is sent when a moderator moves messages in bulk to another channel
+type MessagesMove struct {
+	MessageIDs      []messages.MessageID `json:"messageIDs"`
+	ChannelIDs      []string             `json:"channelIDs"`
+	TargetChannelID messages.ChannelID   `json:"targetChannelID"`
+}
+
+// PollUpdate is sent when someone votes in a poll
+type PollUpdate struct {
+	Message *messages.Message `json:"message"`
+}
+
+// DraftUpdate is sent to a user when their draft for a channel
+// changes on another of their connections, or is cleared
+type DraftUpdate struct {
+	Draft *drafts.Draft `json:"draft"`
+}
+
+// ChannelRead is sent to a user when they mark a channel
+// as read, so their other connections can clear it too
+type ChannelRead struct {
+	Marker *readmarkers.Marker `json:"marker"`
+}
+
+// UserTyping is sent to the other users in a channel when a user starts typing
+// in it, and again when they stop, either by posting or by going quiet for
+// TypingTimeout, so clients never have to time out indicators themselves
+type UserTyping struct {
+	UserID    users.UserID       `json:"userID"`
+	ChannelID messages.ChannelID `json:"channelID"`
+	Typing    bool               `json:"typing"`
+}
+
+// PresenceChange is sent when a user comes online, goes away or offline,
+// or chooses a status
+type PresenceChange struct {
+	Presence *presence.Presence `json:"presence"`
+}
+
+// Connected is sent first on every websocket. Seq is the sequence number of the
+// latest event when it connected, and Replayed is how many of the events it missed
+// are sent straight after, when it reconnected with `since`
+type Connected struct {
+	Seq      uint64 `json:"seq"`
+	Replayed int    `json:"replayed"`
+}
+
+// ResyncRequired is sent instead of Connected to a websocket that reconnected
+// with `since` when some of the events it missed are no longer kept. The client
+// should fetch everything again, and carry on from the events after Seq
+type ResyncRequired struct {
+	Seq uint64 `json:"seq"`
 }
 
-// type NewUser struct{
+// EventType returns TypeNewUser
+func (*NewUser) EventType() string { return TypeNewUser }
 
-// }
+// EventType returns TypeNewChannel
+func (*NewChannel) EventType() string { return TypeNewChannel }
 
-// type NewChannel struct{
+// EventType returns TypeChannelUpdate
+func (*ChannelUpdate) EventType() string { return TypeChannelUpdate }
 
-// }
+// EventType returns TypeChannelDelete
+func (*ChannelDelete) EventType() string { return TypeChannelDelete }
 
-// type ChannelUpdate struct{
+// EventType returns TypeUserJoin
+func (*UserJoin) EventType() string { return TypeUserJoin }
 
-// }
+// EventType returns TypeUserLeft
+func (*UserLeft) EventType() string { return TypeUserLeft }
 
-// type ChannelDelete struct {
+// EventType returns TypeNewMessage
+func (*NewMessage) EventType() string { return TypeNewMessage }
 
-// }
+// EventType returns TypeMessageUpdate
+func (*MessageUpdate) EventType() string { return TypeMessageUpdate }
 
-// type UserJoin struct {
+// EventType returns TypeMessageDelete
+func (*MessageDelete) EventType() string { return TypeMessageDelete }
 
-// }
+// EventType returns TypeMessagesDelete
+func (*MessagesDelete) EventType() string { return TypeMessagesDelete }
 
-// type UserLeft struct {
+// EventType returns TypeMessagesMove
+func (*MessagesMove) EventType() string { return TypeMessagesMove }
 
-// }
+// EventType returns TypePollUpdate
+func (*PollUpdate) EventType() string { return TypePollUpdate }
 
-// type NewMessage struct {
+// EventType returns TypeDraftUpdate
+func (*DraftUpdate) EventType() string { return TypeDraftUpdate }
 
-// }
+// EventType returns TypeChannelRead
+func (*ChannelRead) EventType() string { return TypeChannelRead }
 
-// type MessageUpdate struct {
+// EventType returns TypeUserTyping
+func (*UserTyping) EventType() string { return TypeUserTyping }
 
-// }
+// EventType returns TypePresenceChange
+func (*PresenceChange) EventType() string { return TypePresenceChange }
 
-// type MessageDelete struct {
+// EventType returns TypeConnected
+func (*Connected) EventType() string { return TypeConnected }
 
-// }
+// EventType returns TypeResyncRequired
+func (*ResyncRequired) EventType() string { return TypeResyncRequired }
@@ -0,0 +1,149 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// DefaultLogSize is how many events a log keeps for clients to catch up on
+const DefaultLogSize = 1000
+
+// ErrGapTooOld is returned when events after the sequence number a client
+// asked for have already been dropped from the log, so it has to resync
+var ErrGapTooOld = errors.New("the events since that sequence number are no longer kept")
+
+// Record is an event as it is passed between servers and kept in the log,
+// already encoded, with who it goes to so it can be routed again when it is replayed
+type Record struct {
+	// Seq is the record's place in the log, 0 if it isn't logged
+	Seq uint64 `json:"seq,omitempty"`
+	// Event is the encoded event, without its sequence number
+	Event          json.RawMessage `json:"event,omitempty"`
+	ChannelID      string          `json:"channelID,omitempty"`
+	UserIDs        []string        `json:"userIDs,omitempty"`
+	ExcludeUserIDs []string        `json:"excludeUserIDs,omitempty"`
+	Ephemeral      bool            `json:"ephemeral,omitempty"`
+	// Origin is the ID of the Notifier that published the record
+	Origin string `json:"origin,omitempty"`
+	// Control is a change to who can see a channel for the other servers to make,
+	// records with one have no event and aren't sent to clients
+	Control *Control `json:"control,omitempty"`
+}
+
+// newRecord encodes the event into a record
+func newRecord(event *Event) (*Record, error) {
+	buf, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	return &Record{
+		Event:          buf,
+		ChannelID:      event.ChannelID,
+		UserIDs:        event.UserIDs,
+		ExcludeUserIDs: event.ExcludeUserIDs,
+		Ephemeral:      event.Ephemeral,
+	}, nil
+}
+
+// Type returns the type of the record's event, or the empty string if it doesn't have one
+func (r *Record) Type() string {
+	event := &struct {
+		Type string `json:"type"`
+	}{}
+	if r.Event == nil || json.Unmarshal(r.Event, event) != nil {
+		return ""
+	}
+	return event.Type
+}
+
+// logged reports whether the record goes in the log
+func (r *Record) logged() bool {
+	return r.Event != nil && !r.Ephemeral
+}
+
+// route returns an event addressed to the same users as the record,
+// to check who it is sent to
+func (r *Record) route() *Event {
+	return &Event{ChannelID: r.ChannelID, UserIDs: r.UserIDs, ExcludeUserIDs: r.ExcludeUserIDs}
+}
+
+// Frame returns the event as it is sent to clients, with its sequence number
+func (r *Record) Frame() []byte {
+	if r.Seq == 0 {
+		return r.Event
+	}
+	// the event is always an object, so the sequence number can go first
+	frame := []byte(`{"seq":` + strconv.FormatUint(r.Seq, 10) + ",")
+	return append(frame, r.Event[1:]...)
+}
+
+// Log is a bounded log of the most recent events, so clients that
+// reconnect can be sent the events they missed
+type Log interface {
+	// Append gives the record the next sequence number and adds it to the log
+	Append(record *Record) error
+	// Since returns the events after the sequence number, oldest first,
+	// and ErrGapTooOld if some of them are no longer kept
+	Since(seq uint64) ([]*Record, error)
+	// Last returns the sequence number of the latest event, 0 if there are none
+	Last() (uint64, error)
+}
+
+// MemLog is a Log kept in memory, it only works for a single server
+// and starts again from the first sequence number when it restarts
+type MemLog struct {
+	// records is a ring of the latest events, next is where the next one goes
+	records []*Record
+	next    int
+	last    uint64
+	mu      sync.RWMutex
+}
+
+// NewMemLog returns a MemLog that keeps the latest `size` events,
+// or DefaultLogSize if size isn't positive
+func NewMemLog(size int) *MemLog {
+	if size <= 0 {
+		size = DefaultLogSize
+	}
+	return &MemLog{records: make([]*Record, size)}
+}
+
+// Append gives the record the next sequence number and adds it to the log
+func (l *MemLog) Append(record *Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.last++
+	record.Seq = l.last
+	l.records[l.next] = record
+	l.next = (l.next + 1) % len(l.records)
+	return nil
+}
+
+// Since returns the events after the sequence number, oldest first,
+// and ErrGapTooOld if some of them are no longer kept
+func (l *MemLog) Since(seq uint64) ([]*Record, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	// a sequence number from before a restart can't be caught up on either
+	if seq > l.last {
+		return nil, ErrGapTooOld
+	}
+	missed := l.last - seq
+	if missed > uint64(len(l.records)) {
+		return nil, ErrGapTooOld
+	}
+	records := make([]*Record, 0, missed)
+	for i := len(l.records) - int(missed); i < len(l.records); i++ {
+		records = append(records, l.records[(l.next+i)%len(l.records)])
+	}
+	return records, nil
+}
+
+// Last returns the sequence number of the latest event, 0 if there are none
+func (l *MemLog) Last() (uint64, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.last, nil
+}
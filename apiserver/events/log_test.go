@@ -0,0 +1,155 @@
+package events
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
+	"github.com/gorilla/websocket"
+)
+
+func TestMemLog(t *testing.T) {
+	l := NewMemLog(3)
+	if last, _ := l.Last(); last != 0 {
+		t.Errorf("expected an empty log to be at 0 but got %d", last)
+	}
+	if records, err := l.Since(0); err != nil || len(records) != 0 {
+		t.Errorf("expected nothing to catch up on in an empty log but got %v, %v", records, err)
+	}
+	for i := 1; i <= 5; i++ {
+		record, err := newRecord(&Event{Type: strconv.Itoa(i)})
+		if err != nil {
+			t.Fatalf("error encoding event: %v", err)
+		}
+		if err := l.Append(record); err != nil {
+			t.Fatalf("error appending event: %v", err)
+		}
+		if record.Seq != uint64(i) {
+			t.Errorf("expected sequence number %d but got %d", i, record.Seq)
+		}
+	}
+
+	cases := []struct {
+		since    uint64
+		expected []uint64
+		err      error
+	}{
+		{5, []uint64{}, nil},
+		{4, []uint64{5}, nil},
+		{2, []uint64{3, 4, 5}, nil},
+		{1, nil, ErrGapTooOld},
+		{9, nil, ErrGapTooOld},
+	}
+	for _, c := range cases {
+		records, err := l.Since(c.since)
+		if err != c.err {
+			t.Errorf("since %d: expected error %v but got %v", c.since, c.err, err)
+			continue
+		}
+		if len(records) != len(c.expected) {
+			t.Errorf("since %d: expected %d events but got %d", c.since, len(c.expected), len(records))
+			continue
+		}
+		for i, r := range records {
+			if r.Seq != c.expected[i] || !strings.Contains(string(r.Frame()), `"seq":`+strconv.FormatUint(r.Seq, 10)) {
+				t.Errorf("since %d: expected event %d but got %d %s", c.since, c.expected[i], r.Seq, r.Frame())
+			}
+		}
+	}
+}
+
+func TestNotifierResume(t *testing.T) {
+	channels := fakeChannels{
+		"private": &messages.Channel{ID: "private", Private: true, Members: []users.UserID{"member"}},
+	}
+	n := NewNotifier(channels)
+	n.UseBus(NewLocalBus(NewMemLog(3)))
+	go n.Start()
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		since, _ := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+		n.Resume(conn, r.URL.Query().Get("user"), "", nil, since)
+	}))
+	defer srv.Close()
+
+	// resume returns the frames a user gets when they reconnect
+	resume := func(userID string, since uint64, count int) []*frame {
+		url := "ws" + strings.TrimPrefix(srv.URL, "http") + "?user=" + userID + "&since=" + strconv.FormatUint(since, 10)
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("error connecting websocket: %v", err)
+		}
+		defer conn.Close()
+		frames := []*frame{}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		for len(frames) < count {
+			f := &frame{}
+			if err := conn.ReadJSON(f); err != nil {
+				t.Fatalf("error reading frame: %v", err)
+			}
+			frames = append(frames, f)
+		}
+		return frames
+	}
+
+	n.Notify(&Event{Type: "first"})
+	n.Notify(&Event{Type: "private", ChannelID: "private"})
+	n.Notify(&Event{Type: "typing", Ephemeral: true})
+	n.Notify(&Event{Type: "third"})
+	n.Notify(&Event{Type: "fourth"})
+	for last, _ := n.bus.Log().Last(); last < 4; last, _ = n.bus.Log().Last() {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the ephemeral event isn't replayed, the private one only to the member,
+	// and the first has been dropped from the log
+	cases := []struct {
+		userID   string
+		since    uint64
+		expected string
+	}{
+		{"member", 1, "connected 4,private 2,third 3,fourth 4"},
+		{"outsider", 1, "connected 4,third 3,fourth 4"},
+		{"outsider", 4, "connected 4"},
+		{"outsider", 0, "resync required 4"},
+	}
+	for _, c := range cases {
+		got := []string{}
+		for _, f := range resume(c.userID, c.since, strings.Count(c.expected, ",")+1) {
+			seq := f.Seq
+			if f.Type == TypeConnected || f.Type == TypeResyncRequired {
+				seq = greetingSeq(t, f)
+			}
+			got = append(got, f.Type+" "+strconv.FormatUint(seq, 10))
+		}
+		if strings.Join(got, ",") != c.expected {
+			t.Errorf("%s since %d: expected %q but got %q", c.userID, c.since, c.expected, strings.Join(got, ","))
+		}
+	}
+
+	// a replay that doesn't fit in the client's queue is a resync instead
+	defer func(size int) { ClientQueueSize = size }(ClientQueueSize)
+	ClientQueueSize = 1
+	if f := resume("member", 1, 1)[0]; f.Type != TypeResyncRequired || greetingSeq(t, f) != 4 {
+		t.Errorf("expected a resync at 4 for a replay bigger than the queue but got %s %d", f.Type, greetingSeq(t, f))
+	}
+}
+
+// greetingSeq returns the sequence number a connected or resync required event carries
+func greetingSeq(t *testing.T, f *frame) uint64 {
+	data := &Connected{}
+	if err := json.Unmarshal(f.Data, data); err != nil {
+		t.Fatalf("error decoding %q event: %v", f.Type, err)
+	}
+	return data.Seq
+}
@@ -1,7 +1,11 @@
 package events
 
 import (
+	"errors"
+	"log"
+	"net/http"
 	"sync"
+	"time"
 
 	"encoding/json"
 
@@ -10,8 +14,24 @@ import (
 
 //Notifier represents a web sockets notifier
 type Notifier struct {
-	eventq  chan interface{}
-	clients map[*websocket.Conn]bool
+	eventq chan *Event
+	// clients maps each connection to the client it belongs to
+	clients map[*Client]bool
+	// channels is who can see each channel's events
+	channels *audiences
+	// typing is who is typing in each channel
+	typing *typists
+	// observers are told when clients connect and disconnect
+	observers []ConnectionObserver
+	// listeners are given the events this server publishes
+	listeners []Listener
+	// slow is what happens to events for clients that fall behind
+	slow SlowClientPolicy
+	// id identifies the Notifier among all the servers
+	id string
+	// bus carries events between the Notifiers of every server,
+	// and logs the latest ones for clients that reconnect
+	bus Bus
 	sync.RWMutex
 	//TODO: add other fields you might need
 	//such as another channel or a mutex
@@ -21,76 +41,444 @@ type Notifier struct {
 	//to protect the `clients` map
 }
 
-//NewNotifier constructs a new Notifer.
-func NewNotifier() *Notifier {
+//NewNotifier constructs a new Notifer, that looks up
+//who can see channel events in the channels store.
+func NewNotifier(channels ChannelLookup) *Notifier {
 	//create, initialize and return a Notifier struct
 
-	return &Notifier{
-		eventq:  make(chan interface{}, 10),
-		clients: make(map[*websocket.Conn]bool),
+	n := &Notifier{
+		eventq:  make(chan *Event, EventQueueSize),
+		clients: make(map[*Client]bool),
+		id:      newClientID(),
+		bus:     NewLocalBus(NewMemLog(DefaultLogSize)),
+		channels: &audiences{
+			channels: channels,
+			cache:    make(map[string]*audience),
+		},
 	}
+	n.typing = &typists{
+		notify: n.Notify,
+		timers: make(map[string]*time.Timer),
+	}
+	return n
 }
 
 //Start begins a loop that checks for new events
-//and broadcasts them to all web socket clients.
+//and publishes them on the bus, and another that
+//broadcasts the events every server publishes
+//to all web socket clients.
 //This function should be called on a new goroutine
 //e.g., `go mynotifer.Start()`
 func (n *Notifier) Start() {
+	go func() {
+		for record := range n.bus.Receive() {
+			n.receive(record)
+		}
+	}()
 	//check for new events written
-	//to the `eventq` channel, and broadcast
-	//them to all of the web socket clients
+	//to the `eventq` channel, and publish
+	//them for every server to broadcast
 	for {
 		event := <-n.eventq
-		n.broadcast(event)
+		record, err := newRecord(event)
+		if err != nil {
+			log.Printf("error encoding %q event: %v", event.Type, err)
+			continue
+		}
+		record.Origin = n.id
+		if err := n.bus.Publish(record); err != nil {
+			log.Printf("error publishing %q event: %v", event.Type, err)
+		}
 	}
 }
 
-//AddClient adds a new web socket client to the Notifer
-func (n *Notifier) AddClient(client *websocket.Conn) {
+//receive broadcasts a record from the bus and hands the events
+//this server published to the listeners, or makes the change
+//another server made
+func (n *Notifier) receive(record *Record) {
+	if record.Control != nil {
+		if record.Origin != n.id {
+			n.apply(record.Control)
+		}
+		return
+	}
+	n.broadcast(record)
+	if record.Origin != n.id {
+		return
+	}
+	n.RLock()
+	listeners := n.listeners
+	n.RUnlock()
+	for _, l := range listeners {
+		l.Published(record)
+	}
+}
+
+//Listen adds a listener that is given every event this server publishes,
+//once it has been logged, so each event goes to the listeners of only one server
+func (n *Notifier) Listen(l Listener) {
+	n.Lock()
+	n.listeners = append(n.listeners, l)
+	n.Unlock()
+}
+
+//CanSee reports whether the user is allowed to see the record's event,
+//the same check as for sending it to the user's websockets
+func (n *Notifier) CanSee(record *Record, userID string) bool {
+	event := record.route()
+	var channel *audience
+	if len(event.ChannelID) != 0 {
+		var err error
+		if channel, err = n.channels.get(event.ChannelID); err != nil {
+			log.Printf("error finding the audience of channel %s: %v", event.ChannelID, err)
+		}
+	}
+	return event.deliverTo(userID, channel)
+}
+
+//AddClient adds a new web socket client to the Notifer,
+//opened by the user with the given ID. The commands the
+//client sends are carried out by the command handler,
+//if it is nil they are ignored.
+func (n *Notifier) AddClient(conn *websocket.Conn, userID string, sessionID string, commands CommandHandler) {
+	n.addClient(conn, userID, sessionID, commands, nil)
+}
+
+//Resume adds a web socket client like AddClient, for a client that was
+//connected before and has seen the events up to the sequence number.
+//It is sent the events it missed, or told to resync if they are too old.
+func (n *Notifier) Resume(conn *websocket.Conn, userID string, sessionID string, commands CommandHandler, since uint64) {
+	n.addClient(conn, userID, sessionID, commands, &since)
+}
+
+//addClient greets the new client and adds it to the Notifier,
+//catching it up on the events since the sequence number if it isn't nil
+func (n *Notifier) addClient(conn *websocket.Conn, userID string, sessionID string, commands CommandHandler, since *uint64) {
 	//TODO: implement this
 	//But remember that this will be called from
 	//an HTTP handler, and each HTTP request is
 	//processed on its own goroutine, so your
 	//implementation here MUST be safe for concurrent use
-	n.Lock()
-	n.clients[client] = true
-	n.Unlock()
+	client := newClient(&wsTransport{conn: conn}, userID, sessionID, commands)
+	if !n.register(client, since) {
+		return
+	}
 
 	//after you add the client to the map,
-	//call n.readPump() on its own goroutine
-	go n.readPump(client)
+	//start its writer and call n.readPump()
+	//on its own goroutine
+	go client.writePump()
+	go n.readPump(client, conn)
 	//to proces all of the control messages sent
 	//by the client to the server.
 	//see https://godoc.org/github.com/gorilla/websocket#hdr-Control_Messages
 
 }
 
-//Notify will add a new event to the event queue
-func (n *Notifier) Notify(event interface{}) {
-	// add the `event` to the `eventq`
-	n.eventq <- event
+//Stream sends the user's events to them as server-sent events, a client
+//for HTTP clients that can't use websockets. If since isn't nil it catches
+//up on the events after it like Resume. It blocks until the request is
+//cancelled or the stream is closed for falling behind, so it must be
+//called from the request's handler, which shouldn't write to w.
+func (n *Notifier) Stream(w http.ResponseWriter, r *http.Request, userID string, sessionID string, since *uint64) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.New("streaming is not supported")
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// stop proxies like nginx from holding on to events
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	t := &sseTransport{w: w, flusher: flusher, rc: http.NewResponseController(w), closed: make(chan struct{})}
+	client := newClient(t, userID, sessionID, nil)
+	if !n.register(client, since) {
+		return nil
+	}
+	// remove the client when the request goes away or the stream is closed,
+	// which stops its writer
+	go func() {
+		select {
+		case <-r.Context().Done():
+		case <-t.closed:
+		}
+		n.removeClient(client)
+	}()
+	client.writePump()
+	// don't leave the deadline behind for the next request on the connection
+	t.rc.SetWriteDeadline(time.Time{})
+	return nil
+}
+
+//register adds the client to the Notifier and greets it. If it can't be
+//greeted its connection is closed and register reports false. The greeting
+//is sent by the client's writer, before any events queued after it was added
+func (n *Notifier) register(client *Client, since *uint64) bool {
+	// events are broadcast with the Notifier locked, so taking the snapshot of
+	// the log and adding the client with the lock held means it can't miss any in
+	// between. Only the log is read with the lock held, the rest of the greeting
+	// is done without it so a client that is slow to greet can't hold up the others
+	n.Lock()
+	last, missed, err := n.snapshot(since)
+	if err != nil && err != ErrGapTooOld {
+		n.Unlock()
+		log.Printf("error greeting client: %v", err)
+		client.conn.Close()
+		return false
+	}
+	// events up to the last one are either replayed or left for the client to fetch,
+	// so they aren't sent when they come off the bus
+	client.seq = last
+	n.clients[client] = true
+	observers := n.observers
+	n.Unlock()
+
+	if err == ErrGapTooOld {
+		err = client.greet(New(&ResyncRequired{Seq: last}))
+	} else {
+		err = n.greet(client, last, missed)
+	}
+	if err != nil {
+		log.Printf("error greeting client: %v", err)
+		n.Lock()
+		delete(n.clients, client)
+		n.Unlock()
+		client.conn.Close()
+		return false
+	}
+	for _, o := range observers {
+		o.Connected(client.userID, client.id)
+	}
+	return true
+}
+
+//snapshot returns the sequence number of the latest event, and if the client is
+//resuming the events it missed. It returns ErrGapTooOld along with the latest
+//sequence number if they are no longer in the log. It must be called with the
+//Notifier locked.
+func (n *Notifier) snapshot(since *uint64) (uint64, []*Record, error) {
+	last, err := n.bus.Log().Last()
+	if err != nil || since == nil {
+		return last, nil, err
+	}
+	missed, err := n.bus.Log().Since(*since)
+	if err != nil {
+		return last, nil, err
+	}
+	if len(missed) > 0 {
+		last = missed[len(missed)-1].Seq
+	}
+	return last, missed, nil
+}
+
+//greet tells the client the sequence number of the latest event, and sends it
+//the events it missed that it can still see. If there are more of them than fit
+//in its queue it is told to resync instead.
+func (n *Notifier) greet(client *Client, last uint64, missed []*Record) error {
+	// the user may have left channels since, so check who each event goes to again
+	replay := []*outbound{}
+	for _, r := range missed {
+		event := r.route()
+		var channel *audience
+		var err error
+		if len(event.ChannelID) != 0 {
+			if channel, err = n.channels.get(event.ChannelID); err != nil {
+				log.Printf("error finding the audience of channel %s: %v", event.ChannelID, err)
+			}
+		}
+		if event.deliverTo(client.userID, channel) {
+			replay = append(replay, &outbound{data: r.Frame(), seq: r.Seq})
+		}
+	}
+	if len(replay) > cap(client.queue) {
+		return client.greet(New(&ResyncRequired{Seq: last}))
+	}
+	return client.greet(New(&Connected{Seq: last, Replayed: len(replay)}), replay...)
+}
+
+//SetSlowClientPolicy sets what happens to events for clients that aren't
+//reading them fast enough, it should be called before clients are added
+func (n *Notifier) SetSlowClientPolicy(policy SlowClientPolicy) {
+	n.Lock()
+	n.slow = policy
+	n.Unlock()
+}
+
+//UseBus replaces the bus events are carried between servers on,
+//it should be called before the Notifier is started
+func (n *Notifier) UseBus(bus Bus) {
+	n.Lock()
+	n.bus = bus
+	n.Unlock()
+}
+
+//Online reports whether the user has at least one open web socket
+func (n *Notifier) Online(userID string) bool {
+	n.RLock()
+	defer n.RUnlock()
+	for c := range n.clients {
+		if c.userID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+//Observe adds an observer that is told when clients connect and disconnect
+func (n *Notifier) Observe(o ConnectionObserver) {
+	n.Lock()
+	n.observers = append(n.observers, o)
+	n.Unlock()
+}
+
+//Notify will add a new event to the event queue. It is called from the
+//handlers so it must not block, events that can't be queued are dropped and logged
+func (n *Notifier) Notify(event *Event) {
+	// add the `event` to the `eventq` if there is room
+	select {
+	case n.eventq <- event:
+	default:
+		log.Printf("event queue full, dropping %q event", event.Type)
+	}
+}
+
+//Joined lets the Notifier know the user joined the channel,
+//so they get its events from now on
+func (n *Notifier) Joined(channelID string, userID string) {
+	n.change(&Control{Op: controlJoined, ChannelID: channelID, UserID: userID})
+}
+
+//Left lets the Notifier know the user left the channel,
+//so they stop getting its events if it is private
+func (n *Notifier) Left(channelID string, userID string) {
+	n.change(&Control{Op: controlLeft, ChannelID: channelID, UserID: userID})
+}
+
+//ChannelChanged lets the Notifier know the channel was
+//changed or deleted, so its audience is looked up again
+func (n *Notifier) ChannelChanged(channelID string) {
+	n.change(&Control{Op: controlChanged, ChannelID: channelID})
+}
+
+//change makes the change, and tells the other servers to make it too
+func (n *Notifier) change(c *Control) {
+	n.apply(c)
+	if err := n.bus.Publish(&Record{Control: c, Origin: n.id}); err != nil {
+		log.Printf("error publishing %q change: %v", c.Op, err)
+	}
+}
+
+//apply makes the change to a channel's audience, or closes
+//the connections of the session that ended
+func (n *Notifier) apply(c *Control) {
+	switch c.Op {
+	case controlJoined:
+		n.channels.update(c.ChannelID, func(a *audience) {
+			a.members[c.UserID] = true
+		})
+	case controlLeft:
+		n.channels.update(c.ChannelID, func(a *audience) {
+			delete(a.members, c.UserID)
+		})
+	case controlChanged:
+		n.channels.forget(c.ChannelID)
+	case controlSessionEnded:
+		n.closeSession(c.SessionID)
+	}
+}
+
+//Typing lets the other users in the channel know the user is typing in it,
+//until they stop or haven't said they're typing again for TypingTimeout
+func (n *Notifier) Typing(channelID string, userID string) {
+	n.typing.start(channelID, userID)
+}
+
+//StoppedTyping lets the other users in the channel know the user stopped typing,
+//if they were typing in it
+func (n *Notifier) StoppedTyping(channelID string, userID string) {
+	n.typing.stop(channelID, userID)
 }
 
 //readPump will read all messages (including control messages)
-//send by the client and ignore them. This is necessary in order
-//process the control messages. If you don't do this, the
-//websocket will get stuck and start producing errors.
+//send by the client, and answer the commands among them. Reading
+//is also necessary in order process the control messages. If you
+//don't do this, the websocket will get stuck and start producing errors.
 //see https://godoc.org/github.com/gorilla/websocket#hdr-Control_Messages
-func (n *Notifier) readPump(client *websocket.Conn) {
-	//TODO: implement this according to the notes in the
-	//Control Message section of the Gorilla Web Socket docs:
-	//https://godoc.org/github.com/gorilla/websocket#hdr-Control_Messages
+//The client must answer the pings its writer sends within PongWait.
+func (n *Notifier) readPump(client *Client, conn *websocket.Conn) {
+	defer n.removeClient(client)
+	conn.SetReadLimit(MaxCommandSize)
+	conn.SetReadDeadline(time.Now().Add(PongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(PongWait))
+	})
 	for {
-		if _, _, err := client.NextReader(); err != nil {
-			client.Close()
+		_, buf, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		if client.commands == nil {
+			continue
+		}
+		// a client that isn't reading its responses is too slow whatever the policy
+		queued, err := client.enqueueJSON(n.answer(client, buf))
+		if err != nil {
+			log.Printf("error encoding response: %v", err)
+			continue
+		}
+		if !queued {
+			client.conn.closeWith(websocket.CloseTryAgainLater, closeSlowReason)
 			break
 		}
 	}
+}
+
+//answer carries out the command in the frame and returns the response to it
+func (n *Notifier) answer(client *Client, buf []byte) *Response {
+	cmd := &Command{}
+	var resp *Response
+	if err := json.Unmarshal(buf, cmd); err != nil || len(cmd.Type) == 0 {
+		resp = NewErrorResponse(http.StatusBadRequest, "invalid command")
+	} else if !client.limiter.allow(time.Now()) {
+		resp = NewErrorResponse(http.StatusTooManyRequests, "too many commands, slow down")
+	} else {
+		resp = n.handle(client, cmd)
+	}
+	resp.Version = SchemaVersion
+	resp.Type = TypeResponse
+	resp.ID = cmd.ID
+	return resp
+}
+
+//handle carries out the command, a command that panics is answered with an
+//error instead of taking the whole server down with it
+func (n *Notifier) handle(client *Client, cmd *Command) (resp *Response) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("panic handling %q command: %v", cmd.Type, r)
+			resp = NewErrorResponse(http.StatusInternalServerError, "error handling command")
+		}
+	}()
+	return client.commands.HandleCommand(client, cmd)
+}
 
+//removeClient closes the client's connection and stops sending it events
+func (n *Notifier) removeClient(client *Client) {
+	client.conn.Close()
+	close(client.done)
+	n.Lock()
+	delete(n.clients, client)
+	observers := n.observers
+	n.Unlock()
+	for _, o := range observers {
+		o.Disconnected(client.userID, client.id)
+	}
 }
 
-//broadcast sends the event to all client as a JSON-encoded object
-func (n *Notifier) broadcast(event interface{}) error {
+//broadcast sends the record's event to all clients it should be delivered to
+func (n *Notifier) broadcast(record *Record) error {
 	// Loop over all of the web socket clients in
 	//n.clients and write the `event` parameter to the client
 	//as a JSON-encoded object.
@@ -98,28 +486,53 @@ func (n *Notifier) broadcast(event interface{}) error {
 	//and for even better performance, try using a PreparedMessage:
 	//https://godoc.org/github.com/gorilla/websocket#PreparedMessage
 	//https://godoc.org/github.com/gorilla/websocket#Conn.WritePreparedMessage
+	var err error
+	event := record.route()
 
-	// marshall the event to a buffer
-	buf, err := json.Marshal(event)
-	if err != nil {
-		return err
+	// find who can see the event's channel, if the channel can't be
+	// found the event only goes to the users it names
+	var channel *audience
+	if len(event.ChannelID) != 0 {
+		if channel, err = n.channels.get(event.ChannelID); err != nil {
+			log.Printf("error finding the audience of channel %s: %v", event.ChannelID, err)
+		}
 	}
+
 	// create a prepared message to write to the clients
-	pm, err := websocket.NewPreparedMessage(websocket.TextMessage, buf)
-	if err != nil {
+	frame := &outbound{data: record.Frame(), seq: record.Seq}
+	if frame.prepared, err = websocket.NewPreparedMessage(websocket.TextMessage, frame.data); err != nil {
 		return err
 	}
-	// write it all the clients
-	n.Lock()
-	defer n.Unlock()
+	// the clients' subscriptions filter on the type
+	eventType := record.Type()
+
+	// queue it for all the clients, with the Notifier locked
+	// so no clients are being greeted at the same time
+	n.RLock()
+	defer n.RUnlock()
 	for c := range n.clients {
-		//If you get an error while writing to a client,
-		//the client has wandered off, so you should call
-		//the `.Close()` method on the client, and delete
-		//it from the n.clients map
-		if err := c.WritePreparedMessage(pm); err != nil {
-			c.Close()
-			delete(n.clients, c)
+		// skip the clients that the event isn't meant for, that
+		// haven't subscribed to its channel or type, or that were
+		// already sent the event when they were greeted
+		if !event.deliverTo(c.userID, channel) {
+			continue
+		}
+		if !c.wants(eventType, event) {
+			continue
+		}
+		if record.Seq != 0 && record.Seq <= c.seq {
+			continue
+		}
+		if record.Seq != 0 {
+			c.seq = record.Seq
+		}
+		//If the client's queue is full it isn't keeping up, so
+		//either drop the event or close it and its read pump
+		//will remove it from the n.clients map. Writing to the
+		//client is left to its writer, so a slow client can't
+		//hold up the others
+		if !c.enqueue(frame) && n.slow == DisconnectSlowClients {
+			go c.conn.closeWith(websocket.CloseTryAgainLater, closeSlowReason)
 		}
 	}
 	return nil
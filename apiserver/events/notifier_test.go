@@ -0,0 +1,278 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
+	"github.com/gorilla/websocket"
+)
+
+// fakeChannels is a ChannelLookup over a fixed set of channels
+type fakeChannels map[string]*messages.Channel
+
+func (fc fakeChannels) GetChannelByID(id interface{}) (*messages.Channel, error) {
+	channel, found := fc[messages.IDString(id)]
+	if !found {
+		return nil, errors.New("channel not found")
+	}
+	return channel, nil
+}
+
+// frame is an event as a client reads it
+type frame struct {
+	Type string          `json:"type"`
+	Seq  uint64          `json:"seq"`
+	Data json.RawMessage `json:"data"`
+}
+
+// newTestNotifier starts a notifier over the channels and returns
+// a function that connects a websocket for a user, the types
+// of the events the user gets are sent on the returned channel
+func newTestNotifier(t *testing.T, channels fakeChannels) (*Notifier, func(userID string) <-chan string) {
+	n, connect := newCommandNotifier(t, channels, nil)
+	return n, func(userID string) <-chan string {
+		return eventTypes(connect(userID))
+	}
+}
+
+// eventTypes sends the types of the events read from the connection on the returned channel
+func eventTypes(conn *websocket.Conn) <-chan string {
+	types := make(chan string, 10)
+	go func() {
+		for {
+			event := &frame{}
+			if err := conn.ReadJSON(event); err != nil {
+				return
+			}
+			types <- event.Type
+		}
+	}()
+	return types
+}
+
+// newCommandNotifier starts a notifier that hands commands to the handler and
+// returns a function that connects a websocket for a user
+func newCommandNotifier(t *testing.T, channels fakeChannels, commands CommandHandler) (*Notifier, func(userID string) *websocket.Conn) {
+	n := NewNotifier(channels)
+	return n, serveNotifier(t, n, commands)
+}
+
+// serveNotifier starts the notifier and returns a function that connects a websocket to it for a user
+func serveNotifier(t *testing.T, n *Notifier, commands CommandHandler) func(userID string) *websocket.Conn {
+	go n.Start()
+
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		n.AddClient(conn, r.URL.Query().Get("user"), r.URL.Query().Get("session"), commands)
+	}))
+	t.Cleanup(srv.Close)
+
+	connect := func(userID string) *websocket.Conn {
+		url := "ws" + strings.TrimPrefix(srv.URL, "http") + "?user=" + userID
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("error connecting websocket: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		// every client is greeted first
+		greeting := &frame{}
+		if err := conn.ReadJSON(greeting); err != nil || greeting.Type != TypeConnected {
+			t.Fatalf("expected a %q event but got %q (%v)", TypeConnected, greeting.Type, err)
+		}
+		// wait for the server to add the client
+		for !n.Online(userID) {
+			time.Sleep(time.Millisecond)
+		}
+		return conn
+	}
+	return connect
+}
+
+// received returns the types of the events the user got before it went quiet
+func received(t *testing.T, events <-chan string) []string {
+	types := []string{}
+	for {
+		select {
+		case dType := <-events:
+			types = append(types, dType)
+		case <-time.After(200 * time.Millisecond):
+			return types
+		}
+	}
+}
+
+func TestNotifierRouting(t *testing.T) {
+	channels := fakeChannels{
+		"public":  &messages.Channel{ID: "public", Members: []users.UserID{}},
+		"private": &messages.Channel{ID: "private", Private: true, Members: []users.UserID{"member"}},
+	}
+	n, connect := newTestNotifier(t, channels)
+	member := connect("member")
+	outsider := connect("outsider")
+
+	n.Notify(&Event{Type: "everyone"})
+	n.Notify(&Event{Type: "public", ChannelID: "public"})
+	n.Notify(&Event{Type: "private", ChannelID: "private"})
+	n.Notify(&Event{Type: "private and outsider", ChannelID: "private", UserIDs: []string{"outsider"}})
+	n.Notify(&Event{Type: "only outsider", UserIDs: []string{"outsider"}})
+	n.Notify(&Event{Type: "missing channel", ChannelID: "missing"})
+
+	cases := []struct {
+		name     string
+		events   <-chan string
+		expected string
+	}{
+		{"member", member, "everyone,public,private,private and outsider"},
+		{"outsider", outsider, "everyone,public,private and outsider,only outsider"},
+	}
+	for _, c := range cases {
+		if got := strings.Join(received(t, c.events), ","); got != c.expected {
+			t.Errorf("%s: expected events %q but got %q", c.name, c.expected, got)
+		}
+	}
+}
+
+func TestNotifierMembership(t *testing.T) {
+	channels := fakeChannels{
+		"private": &messages.Channel{ID: "private", Private: true, Members: []users.UserID{"member"}},
+	}
+	n, connect := newTestNotifier(t, channels)
+	member := connect("member")
+	joiner := connect("joiner")
+
+	// load the audience into the cache before anyone joins
+	n.Notify(&Event{Type: "before", ChannelID: "private"})
+	if got := received(t, joiner); len(got) != 0 {
+		t.Errorf("expected a non-member not to get the channel's events but got %v", got)
+	}
+	received(t, member)
+
+	n.Joined("private", "joiner")
+	n.Left("private", "member")
+	n.Notify(&Event{Type: "after", ChannelID: "private"})
+	if got := received(t, joiner); len(got) != 1 {
+		t.Errorf("expected the user who joined to get the channel's events but got %v", got)
+	}
+	if got := received(t, member); len(got) != 0 {
+		t.Errorf("expected the user who left not to get the channel's events but got %v", got)
+	}
+
+	// once the channel is deleted its events go nowhere
+	delete(channels, "private")
+	n.ChannelChanged("private")
+	n.Notify(&Event{Type: "deleted", ChannelID: "private"})
+	if got := received(t, joiner); len(got) != 0 {
+		t.Errorf("expected no events for a deleted channel but got %v", got)
+	}
+}
+
+func TestNotifierFullQueue(t *testing.T) {
+	defer func(size int) { EventQueueSize = size }(EventQueueSize)
+	EventQueueSize = 1
+
+	// nothing is publishing the events, so the queue fills up
+	// and the events that don't fit are dropped
+	n := NewNotifier(fakeChannels{})
+	done := make(chan bool)
+	go func() {
+		n.Notify(&Event{Type: "kept"})
+		n.Notify(&Event{Type: "dropped"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected Notify not to block when the queue is full")
+	}
+	if event := <-n.eventq; event.Type != "kept" || len(n.eventq) != 0 {
+		t.Errorf("expected only the first event to be queued but got %q and %d more", event.Type, len(n.eventq))
+	}
+}
+
+// echoCommands answers every command with the user who sent it, and panics on a panic command
+type echoCommands struct{}
+
+func (echoCommands) HandleCommand(client *Client, cmd *Command) *Response {
+	if cmd.Type == "subscribe" {
+		client.Subscribe(&Subscriptions{ChannelIDs: []string{"subscribed"}})
+	}
+	if cmd.Type == "panic" {
+		panic("bad command")
+	}
+	return NewResponse(client.UserID())
+}
+
+func TestNotifierCommands(t *testing.T) {
+	defer func(rate, burst float64) { CommandRate, CommandBurst = rate, burst }(CommandRate, CommandBurst)
+	CommandRate, CommandBurst = 0, 2
+	_, connect := newCommandNotifier(t, fakeChannels{}, echoCommands{})
+	conn := connect("user")
+
+	send := func(frame string) *Response {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+			t.Fatalf("error sending command: %v", err)
+		}
+		resp := &Response{}
+		if err := conn.ReadJSON(resp); err != nil {
+			t.Fatalf("error reading response: %v", err)
+		}
+		return resp
+	}
+
+	// responses carry the ID of the command they answer
+	resp := send(`{"id":"abc","type":"echo"}`)
+	if resp.Type != TypeResponse || resp.ID != "abc" || resp.Status != 200 || resp.Data != "user" {
+		t.Errorf("unexpected response to a command: %+v", resp)
+	}
+	if resp := send(`not json`); resp.Status != 400 {
+		t.Errorf("expected status 400 for a bad frame but got %d", resp.Status)
+	}
+	// a command that panics is answered with an error and the connection carries on
+	if resp := send(`{"id":"def","type":"panic"}`); resp.Status != 500 || resp.ID != "def" {
+		t.Errorf("expected status 500 for a command that panics but got %+v", resp)
+	}
+	// the burst is used up and the rate is zero, so the next command is refused
+	if resp := send(`{"id":"ghi","type":"echo"}`); resp.Status != 429 || resp.ID != "ghi" {
+		t.Errorf("expected status 429 once over the rate limit but got %+v", resp)
+	}
+}
+
+func TestNotifierSubscriptions(t *testing.T) {
+	channels := fakeChannels{
+		"subscribed": &messages.Channel{ID: "subscribed"},
+		"other":      &messages.Channel{ID: "other"},
+	}
+	n, connect := newCommandNotifier(t, channels, echoCommands{})
+	conn := connect("user")
+	if err := conn.WriteJSON(&Command{ID: "1", Type: "subscribe"}); err != nil {
+		t.Fatalf("error subscribing: %v", err)
+	}
+	resp := &Response{}
+	if err := conn.ReadJSON(resp); err != nil {
+		t.Fatalf("error reading response: %v", err)
+	}
+
+	n.Notify(&Event{Type: "other", ChannelID: "other"})
+	n.Notify(&Event{Type: "named", ChannelID: "other", UserIDs: []string{"user"}})
+	n.Notify(&Event{Type: "subscribed", ChannelID: "subscribed"})
+	for _, expected := range []string{"named", "subscribed"} {
+		event := &Event{}
+		if err := conn.ReadJSON(event); err != nil {
+			t.Fatalf("error reading event: %v", err)
+		}
+		if event.Type != expected {
+			t.Errorf("expected a %q event but got %q", expected, event.Type)
+		}
+	}
+}
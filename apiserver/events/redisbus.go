@@ -0,0 +1,94 @@
+package events
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"gopkg.in/redis.v5"
+)
+
+// redisBusChannel is the redis pub/sub channel records are published on
+const redisBusChannel = "events"
+
+// RedisBus is a Bus over redis pub/sub, for running more than one server.
+// Events are logged in a RedisLog and published in the same step, so
+// every server gets them in the same order
+type RedisBus struct {
+	// Client is used to talk to the redis server
+	Client  *redis.Client
+	log     *RedisLog
+	records chan *Record
+	once    sync.Once
+}
+
+// NewRedisBus returns a RedisBus that logs events in the log
+func NewRedisBus(client *redis.Client, log *RedisLog) *RedisBus {
+	return &RedisBus{
+		Client:  client,
+		log:     log,
+		records: make(chan *Record, EventQueueSize),
+	}
+}
+
+// Publish logs the record if it should be, and publishes it to every server
+func (b *RedisBus) Publish(record *Record) error {
+	if record.logged() {
+		return b.log.append(record, redisBusChannel)
+	}
+	buf, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return b.Client.Publish(redisBusChannel, string(buf)).Err()
+}
+
+// Receive returns the records published on the bus, it subscribes
+// to the redis channel the first time it is called
+func (b *RedisBus) Receive() <-chan *Record {
+	b.once.Do(func() {
+		go b.receive()
+	})
+	return b.records
+}
+
+// Log returns the log the bus keeps recent events in
+func (b *RedisBus) Log() Log {
+	return b.log
+}
+
+// receive passes on the records published on the redis channel,
+// subscribing again whenever the subscription fails
+func (b *RedisBus) receive() {
+	s := &sequencer{log: b.log, out: b.records}
+	// only the events after the ones logged before the server started are passed on,
+	// any logged before it subscribed are caught up on from the log
+	last, err := b.log.Last()
+	if err != nil {
+		log.Printf("error getting the latest event: %v", err)
+	}
+	s.last = last
+	for {
+		pubsub, err := b.Client.Subscribe(redisBusChannel)
+		if err != nil {
+			log.Printf("error subscribing to events: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		for {
+			msg, err := pubsub.ReceiveMessage()
+			if err != nil {
+				log.Printf("error receiving events: %v", err)
+				break
+			}
+			record := &Record{}
+			if err := json.Unmarshal([]byte(msg.Payload), record); err != nil {
+				log.Printf("error decoding event: %v", err)
+				continue
+			}
+			s.receive(record)
+		}
+		pubsub.Close()
+	}
+}
@@ -0,0 +1,66 @@
+package events
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"gopkg.in/redis.v5"
+)
+
+//NOTE: tests in this file will use the REDISADDR
+//environment variable for the redis server address.
+//If not defined, it will default to a local instance of redis.
+
+func TestRedisBus(t *testing.T) {
+	redisAddr := os.Getenv("REDISADDR")
+	if len(redisAddr) == 0 {
+		redisAddr = "127.0.0.1:6379"
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr: redisAddr,
+	})
+	if err := client.Del(redisLogSeqKey, redisLogKey).Err(); err != nil {
+		t.Fatalf("error clearing the log: %v", err)
+	}
+	// two servers on the same bus
+	a := NewRedisBus(client, NewRedisLog(client, 2))
+	b := NewRedisBus(client, NewRedisLog(client, 2))
+	received := b.Receive()
+	a.Receive()
+	// wait for the subscriptions
+	time.Sleep(100 * time.Millisecond)
+
+	for _, event := range []*Event{{Type: "first"}, {Type: "typing", Ephemeral: true}, {Type: "second"}, {Type: "third"}} {
+		record, err := newRecord(event)
+		if err != nil {
+			t.Fatalf("error encoding event: %v", err)
+		}
+		if err := a.Publish(record); err != nil {
+			t.Fatalf("error publishing event: %v", err)
+		}
+	}
+	expected := []string{`{"seq":1,"version":0,"type":"first","data":null}`,
+		`{"version":0,"type":"typing","data":null}`,
+		`{"seq":2,"version":0,"type":"second","data":null}`,
+		`{"seq":3,"version":0,"type":"third","data":null}`}
+	for _, e := range expected {
+		select {
+		case record := <-received:
+			if string(record.Frame()) != e {
+				t.Errorf("expected %s but got %s", e, record.Frame())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %s", e)
+		}
+	}
+
+	// only the latest events are kept
+	if _, err := b.Log().Since(0); err != ErrGapTooOld {
+		t.Errorf("expected ErrGapTooOld for dropped events but got %v", err)
+	}
+	records, err := b.Log().Since(1)
+	if err != nil || len(records) != 2 || records[1].Seq != 3 {
+		t.Errorf("expected to catch up on the last two events but got %v, %v", records, err)
+	}
+}
@@ -0,0 +1,122 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"gopkg.in/redis.v5"
+)
+
+// the keys the redis log is kept in
+const (
+	// the sequence number of the latest event
+	redisLogSeqKey = "events:seq"
+	// a sorted set of the latest events, scored by sequence number
+	redisLogKey = "events:log"
+)
+
+// RedisLog is a Log kept in redis, so the sequence numbers
+// carry on when servers restart and are shared between them.
+// When there is more than one server use it through a RedisBus,
+// so events are published in the order they are logged
+type RedisLog struct {
+	// Client is used to talk to the redis server
+	Client *redis.Client
+	size   int64
+}
+
+// NewRedisLog returns a RedisLog that keeps the latest `size` events,
+// or DefaultLogSize if size isn't positive
+func NewRedisLog(client *redis.Client, size int) *RedisLog {
+	if size <= 0 {
+		size = DefaultLogSize
+	}
+	return &RedisLog{Client: client, size: int64(size)}
+}
+
+// appendScript logs a record and, if a channel is given, publishes it there,
+// all at once so records are published in the order of their sequence numbers.
+// The record is passed in without its sequence number, which goes first.
+// KEYS: the sequence key and the log key. ARGV: the record, the log size and the channel
+var appendScript = `
+local seq = redis.call('INCR', KEYS[1])
+local record = '{"seq":' .. seq .. ',' .. string.sub(ARGV[1], 2)
+redis.call('ZADD', KEYS[2], seq, record)
+redis.call('ZREMRANGEBYRANK', KEYS[2], 0, -tonumber(ARGV[2]) - 1)
+if ARGV[3] ~= '' then
+	redis.call('PUBLISH', ARGV[3], record)
+end
+return seq
+`
+
+// Append gives the record the next sequence number and adds it to the log
+func (l *RedisLog) Append(record *Record) error {
+	return l.append(record, "")
+}
+
+// append logs the record, and publishes it on the redis channel if it isn't empty
+func (l *RedisLog) append(record *Record, channel string) error {
+	record.Seq = 0
+	buf, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	result, err := l.Client.Eval(appendScript, []string{redisLogSeqKey, redisLogKey}, string(buf), l.size, channel).Result()
+	if err != nil {
+		return err
+	}
+	seq, ok := result.(int64)
+	if !ok {
+		return fmt.Errorf("unexpected sequence number %v", result)
+	}
+	record.Seq = uint64(seq)
+	return nil
+}
+
+// Since returns the events after the sequence number, oldest first,
+// and ErrGapTooOld if some of them are no longer kept
+func (l *RedisLog) Since(seq uint64) ([]*Record, error) {
+	last, err := l.Last()
+	if err != nil {
+		return nil, err
+	}
+	if seq > last {
+		return nil, ErrGapTooOld
+	}
+	if seq == last {
+		return []*Record{}, nil
+	}
+	members, err := l.Client.ZRangeByScore(redisLogKey, redis.ZRangeBy{
+		Min: "(" + strconv.FormatUint(seq, 10),
+		Max: strconv.FormatUint(last, 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*Record, 0, len(members))
+	for _, m := range members {
+		record := &Record{}
+		if err := json.Unmarshal([]byte(m), record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	// the event after `seq` must still be there for none to be missing
+	if len(records) == 0 || records[0].Seq != seq+1 {
+		return nil, ErrGapTooOld
+	}
+	return records, nil
+}
+
+// Last returns the sequence number of the latest event, 0 if there are none
+func (l *RedisLog) Last() (uint64, error) {
+	seq, err := l.Client.Get(redisLogSeqKey).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return uint64(seq), nil
+}
@@ -0,0 +1,154 @@
+package events
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// schema is the part of a JSON schema the tests check
+type schema struct {
+	Ref         string             `json:"$ref"`
+	Const       interface{}        `json:"const"`
+	Enum        []string           `json:"enum"`
+	Properties  map[string]*schema `json:"properties"`
+	Items       *schema            `json:"items"`
+	OneOf       []*schema          `json:"oneOf"`
+	Definitions map[string]*schema `json:"definitions"`
+}
+
+// payloads is every payload in the catalog
+var payloads = []Payload{
+	&NewUser{},
+	&NewChannel{},
+	&ChannelUpdate{},
+	&ChannelDelete{},
+	&UserJoin{},
+	&UserLeft{},
+	&NewMessage{},
+	&MessageUpdate{},
+	&MessageDelete{},
+	&MessagesDelete{},
+	&MessagesMove{},
+	&PollUpdate{},
+	&DraftUpdate{},
+	&ChannelRead{},
+	&UserTyping{},
+	&PresenceChange{},
+	&Connected{},
+	&ResyncRequired{},
+}
+
+func loadSchema(t *testing.T) *schema {
+	buf, err := os.ReadFile("schema.json")
+	if err != nil {
+		t.Fatalf("error reading schema: %v", err)
+	}
+	s := &schema{}
+	if err := json.Unmarshal(buf, s); err != nil {
+		t.Fatalf("error parsing schema: %v", err)
+	}
+	return s
+}
+
+// definitionName returns the name of the definition a $ref points to
+func definitionName(ref string) string {
+	return strings.TrimPrefix(ref, "#/definitions/")
+}
+
+func TestSchemaCatalog(t *testing.T) {
+	s := loadSchema(t)
+	if v, ok := s.Properties["version"].Const.(float64); !ok || int(v) != SchemaVersion {
+		t.Errorf("expected the schema to be version %d but got %v", SchemaVersion, s.Properties["version"].Const)
+	}
+	if len(s.OneOf) != len(payloads) || len(s.Properties["type"].Enum) != len(payloads) {
+		t.Errorf("expected %d event types in the schema but got %d", len(payloads), len(s.OneOf))
+	}
+
+	// the schema must describe every field of an event
+	eventType := reflect.TypeOf(Event{})
+	for i := 0; i < eventType.NumField(); i++ {
+		tag := strings.Split(eventType.Field(i).Tag.Get("json"), ",")[0]
+		if _, found := s.Properties[tag]; tag != "-" && !found {
+			t.Errorf("the event's %s field is missing from the schema", tag)
+		}
+	}
+
+	// each event type in the schema must carry the payload of the same name
+	refs := map[string]string{}
+	for _, event := range s.OneOf {
+		refs[event.Properties["type"].Const.(string)] = definitionName(event.Properties["data"].Ref)
+	}
+	for _, p := range payloads {
+		name := reflect.TypeOf(p).Elem().Name()
+		if refs[p.EventType()] != name {
+			t.Errorf("expected %q events to carry %s in the schema but got %q", p.EventType(), name, refs[p.EventType()])
+		}
+		checkDefinition(t, s.Definitions, name, reflect.TypeOf(p).Elem(), map[string]bool{})
+	}
+}
+
+// checkDefinition checks the JSON fields of the type match the properties of its definition,
+// along with the definitions of any structs it contains
+func checkDefinition(t *testing.T, definitions map[string]*schema, name string, typ reflect.Type, checked map[string]bool) {
+	if checked[name] {
+		return
+	}
+	checked[name] = true
+	def, found := definitions[name]
+	if !found {
+		t.Errorf("no definition for %s in the schema", name)
+		return
+	}
+
+	fields := map[string]bool{}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		fields[tag] = true
+		prop, found := def.Properties[tag]
+		if !found {
+			t.Errorf("%s.%s is missing from the schema", name, tag)
+			continue
+		}
+
+		// follow structs to their own definitions
+		ft := field.Type
+		for ft.Kind() == reflect.Ptr || ft.Kind() == reflect.Slice {
+			if ft.Kind() == reflect.Slice && prop.Items != nil {
+				prop = prop.Items
+			}
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && ft != reflect.TypeOf(time.Time{}) {
+			if definitionName(prop.Ref) != ft.Name() {
+				t.Errorf("expected %s.%s to refer to %s in the schema but got %q", name, tag, ft.Name(), prop.Ref)
+				continue
+			}
+			checkDefinition(t, definitions, ft.Name(), ft, checked)
+		}
+	}
+	for prop := range def.Properties {
+		if !fields[prop] {
+			t.Errorf("%s.%s is in the schema but not sent", name, prop)
+		}
+	}
+}
+
+func TestNewEvent(t *testing.T) {
+	event := New(&UserJoin{UserID: "user", ChannelID: "channel"})
+	buf, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("error encoding event: %v", err)
+	}
+	expected := `{"version":1,"type":"user joined","data":{"userID":"user","channelID":"channel"}}`
+	if string(buf) != expected {
+		t.Errorf("expected event %s but got %s", expected, buf)
+	}
+}
@@ -0,0 +1,74 @@
+package events
+
+import (
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// SessionCheckPeriod is how often the sessions of the open connections
+// are checked, so connections are closed soon after their session expires
+var SessionCheckPeriod = time.Minute
+
+// SessionChecker reports whether a session still exists. It must not
+// keep the session alive, or sessions with open connections never expire
+type SessionChecker func(sessionID string) (bool, error)
+
+// EndSession closes the connections opened with the session on every server,
+// with a policy violation close frame. It should be called when the session is
+// deleted or revoked, expired sessions are found by WatchSessions
+func (n *Notifier) EndSession(sessionID string) {
+	if len(sessionID) == 0 {
+		return
+	}
+	n.change(&Control{Op: controlSessionEnded, SessionID: sessionID})
+}
+
+// WatchSessions checks the sessions of this server's connections every
+// SessionCheckPeriod and closes the connections whose session has gone,
+// which is how connections find out their session expired.
+// This function should be called on a new goroutine
+func (n *Notifier) WatchSessions(exists SessionChecker) {
+	ticker := time.NewTicker(SessionCheckPeriod)
+	defer ticker.Stop()
+	for range ticker.C {
+		n.checkSessions(exists)
+	}
+}
+
+// checkSessions closes the connections whose session no longer exists,
+// a session that can't be checked is left alone until the next time
+func (n *Notifier) checkSessions(exists SessionChecker) {
+	sessionIDs := map[string]bool{}
+	n.RLock()
+	for c := range n.clients {
+		if len(c.sessionID) != 0 {
+			sessionIDs[c.sessionID] = true
+		}
+	}
+	n.RUnlock()
+
+	for sessionID := range sessionIDs {
+		found, err := exists(sessionID)
+		if err != nil {
+			log.Printf("error checking session: %v", err)
+			continue
+		}
+		if !found {
+			n.closeSession(sessionID)
+		}
+	}
+}
+
+// closeSession closes this server's connections that were opened with the session,
+// their read pumps or streams then remove them
+func (n *Notifier) closeSession(sessionID string) {
+	n.RLock()
+	defer n.RUnlock()
+	for c := range n.clients {
+		if c.sessionID == sessionID {
+			go c.conn.closeWith(websocket.ClosePolicyViolation, closeSessionEndedReason)
+		}
+	}
+}
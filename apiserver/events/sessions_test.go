@@ -0,0 +1,122 @@
+package events
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// serveSessions starts the notifier and returns a function that
+// connects a websocket to it for a user with a session
+func serveSessions(t *testing.T, n *Notifier) func(userID string, sessionID string) *websocket.Conn {
+	go n.Start()
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		n.AddClient(conn, r.URL.Query().Get("user"), r.URL.Query().Get("session"), nil)
+	}))
+	t.Cleanup(srv.Close)
+
+	return func(userID string, sessionID string) *websocket.Conn {
+		url := "ws" + strings.TrimPrefix(srv.URL, "http") + "?user=" + userID + "&session=" + sessionID
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("error connecting websocket: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		if err := conn.ReadJSON(&frame{}); err != nil {
+			t.Fatalf("error reading greeting: %v", err)
+		}
+		for !n.Online(userID) {
+			time.Sleep(time.Millisecond)
+		}
+		return conn
+	}
+}
+
+// expectSessionEnded fails the test unless the connection is closed for its session ending
+func expectSessionEnded(t *testing.T, name string, conn *websocket.Conn) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+			t.Errorf("%s: expected a policy violation close frame but got %v", name, err)
+		}
+		return
+	}
+}
+
+// expectOpen fails the test unless the connection still gets events
+func expectOpen(t *testing.T, name string, n *Notifier, conn *websocket.Conn) {
+	t.Helper()
+	n.Notify(&Event{Type: "still open"})
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	event := &frame{}
+	if err := conn.ReadJSON(event); err != nil || event.Type != "still open" {
+		t.Errorf("%s: expected the connection to stay open but got %q (%v)", name, event.Type, err)
+	}
+}
+
+func TestNotifierEndSession(t *testing.T) {
+	// the session ends on another server than the one its connections are on
+	bus := &sharedBus{log: NewMemLog(DefaultLogSize)}
+	a := NewNotifier(fakeChannels{})
+	a.UseBus(bus.view())
+	b := NewNotifier(fakeChannels{})
+	b.UseBus(bus.view())
+	serveSessions(t, a)
+	connect := serveSessions(t, b)
+
+	ended := connect("alice", "session1")
+	endedToo := connect("alice", "session1")
+	otherSession := connect("alice", "session2")
+	otherUser := connect("bob", "session3")
+
+	a.EndSession("session1")
+	expectSessionEnded(t, "ended", ended)
+	expectSessionEnded(t, "same session", endedToo)
+	expectOpen(t, "other session", b, otherSession)
+	expectOpen(t, "other user", b, otherUser)
+}
+
+func TestNotifierCheckSessions(t *testing.T) {
+	n := NewNotifier(fakeChannels{})
+	connect := serveSessions(t, n)
+	live := connect("alice", "live")
+	expired := connect("alice", "expired")
+	unknown := connect("bob", "unknown")
+	checked := map[string]int{}
+	exists := func(sessionID string) (bool, error) {
+		checked[sessionID]++
+		switch sessionID {
+		case "live":
+			return true, nil
+		case "expired":
+			return false, nil
+		}
+		return false, errors.New("store is down")
+	}
+
+	// each session is only checked once however many connections it has,
+	// and connections aren't closed when their session can't be checked
+	connect("alice", "live")
+	n.checkSessions(exists)
+	if checked["live"] != 1 || checked["expired"] != 1 || checked["unknown"] != 1 {
+		t.Errorf("expected each session to be checked once but got %v", checked)
+	}
+	expectSessionEnded(t, "expired", expired)
+	expectOpen(t, "live", n, live)
+	expectOpen(t, "unknown", n, unknown)
+}
@@ -0,0 +1,165 @@
+package events
+
+import "sort"
+
+// alwaysDelivered are the types of events about which channels there are and
+// who is in them. Clients get them whatever they have subscribed to, so
+// their lists of channels and members stay right
+var alwaysDelivered = map[string]bool{
+	TypeNewChannel:    true,
+	TypeChannelUpdate: true,
+	TypeChannelDelete: true,
+	TypeUserJoin:      true,
+	TypeUserLeft:      true,
+}
+
+// Subscriptions are the channels and event types a client subscribes
+// to or unsubscribes from
+type Subscriptions struct {
+	ChannelIDs []string `json:"channelIDs,omitempty"`
+	EventTypes []string `json:"eventTypes,omitempty"`
+}
+
+// Filter is what a client's subscriptions to channels or to event types
+// let through. If Only is nil that is everything but Except, otherwise
+// it is just what is in Only
+type Filter struct {
+	Only   []string `json:"only"`
+	Except []string `json:"except"`
+}
+
+// Filters are the filters a client's subscriptions add up to
+type Filters struct {
+	Channels   *Filter `json:"channels"`
+	EventTypes *Filter `json:"eventTypes"`
+}
+
+// the modes a filter can be in
+const (
+	// filterDefault lets everything through until
+	// the first subscribe narrows it down
+	filterDefault = iota
+	// filterExcept lets everything but except through
+	filterExcept
+	// filterOnly lets just the ones in only through
+	filterOnly
+)
+
+// filter is a set of channels or event types a client gets events for
+type filter struct {
+	mode   int
+	only   map[string]bool
+	except map[string]bool
+}
+
+// subscribe lets the IDs through. A filter that hasn't been
+// changed yet is narrowed to just them, otherwise they are added
+func (f *filter) subscribe(ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+	if f.mode == filterDefault {
+		f.mode = filterOnly
+		f.only = make(map[string]bool, len(ids))
+	}
+	for _, id := range ids {
+		if f.mode == filterOnly {
+			f.only[id] = true
+		} else {
+			delete(f.except, id)
+		}
+	}
+}
+
+// unsubscribe stops letting the IDs through. A filter that hasn't been
+// changed yet then lets everything through but them
+func (f *filter) unsubscribe(ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+	if f.mode == filterDefault {
+		f.mode = filterExcept
+		f.except = make(map[string]bool, len(ids))
+	}
+	for _, id := range ids {
+		if f.mode == filterOnly {
+			delete(f.only, id)
+		} else {
+			f.except[id] = true
+		}
+	}
+}
+
+// allows reports whether the filter lets the ID through
+func (f *filter) allows(id string) bool {
+	if f.mode == filterOnly {
+		return f.only[id]
+	}
+	return !f.except[id]
+}
+
+// export returns the filter with its IDs in order
+func (f *filter) export() *Filter {
+	exported := &Filter{Except: sortedKeys(f.except)}
+	if f.mode == filterOnly {
+		exported.Only = sortedKeys(f.only)
+	}
+	return exported
+}
+
+// sortedKeys returns the keys of the set in order, never nil
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Subscribe lets the events of the channels and types through to the client.
+// The first channels or types subscribed to narrow it down from every channel
+// it can see or every type to just them, later ones are added. Subscribing to
+// nothing resets the client to getting everything
+func (c *Client) Subscribe(s *Subscriptions) *Filters {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(s.ChannelIDs) == 0 && len(s.EventTypes) == 0 {
+		c.channels = filter{}
+		c.types = filter{}
+	}
+	c.channels.subscribe(s.ChannelIDs)
+	c.types.subscribe(s.EventTypes)
+	return c.filters()
+}
+
+// Unsubscribe stops the events of the channels and types going to the client
+func (c *Client) Unsubscribe(s *Subscriptions) *Filters {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.channels.unsubscribe(s.ChannelIDs)
+	c.types.unsubscribe(s.EventTypes)
+	return c.filters()
+}
+
+// filters returns the client's filters, it must be called with the client locked
+func (c *Client) filters() *Filters {
+	return &Filters{
+		Channels:   c.channels.export(),
+		EventTypes: c.types.export(),
+	}
+}
+
+// wants reports whether the client's subscriptions let the event of the type through.
+// Events addressed to the user get through whatever channel they are about
+func (c *Client) wants(eventType string, event *Event) bool {
+	if alwaysDelivered[eventType] {
+		return true
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.types.allows(eventType) {
+		return false
+	}
+	return len(event.ChannelID) == 0 || c.channels.allows(event.ChannelID) || event.names(c.userID)
+}
@@ -0,0 +1,54 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClientSubscriptions(t *testing.T) {
+	c := newClient(nil, "user", "", nil)
+	message := func(channelID string) *Event {
+		return &Event{Type: TypeNewMessage, ChannelID: channelID}
+	}
+	check := func(step string, eventType string, event *Event, expected bool) {
+		if got := c.wants(eventType, event); got != expected {
+			t.Errorf("%s: expected wants %q in %q to be %t", step, eventType, event.ChannelID, expected)
+		}
+	}
+
+	check("default", TypeNewMessage, message("a"), true)
+
+	filters := c.Subscribe(&Subscriptions{ChannelIDs: []string{"b", "a"}})
+	expected := &Filters{
+		Channels:   &Filter{Only: []string{"a", "b"}, Except: []string{}},
+		EventTypes: &Filter{Except: []string{}},
+	}
+	if !reflect.DeepEqual(filters, expected) {
+		t.Errorf("expected filters %+v but got %+v", expected, filters)
+	}
+	check("subscribed", TypeNewMessage, message("a"), true)
+	check("not subscribed", TypeNewMessage, message("c"), false)
+	check("membership", TypeUserJoin, &Event{ChannelID: "c"}, true)
+	check("named", TypeNewMessage, &Event{ChannelID: "c", UserIDs: []string{"user"}}, true)
+
+	c.Unsubscribe(&Subscriptions{ChannelIDs: []string{"a"}, EventTypes: []string{TypeUserTyping}})
+	check("unsubscribed channel", TypeNewMessage, message("a"), false)
+	check("still subscribed", TypeNewMessage, message("b"), true)
+	check("unsubscribed type", TypeUserTyping, message("b"), false)
+	check("channelless", TypePresenceChange, &Event{}, true)
+
+	c.Subscribe(&Subscriptions{EventTypes: []string{TypeUserTyping}})
+	check("resubscribed type", TypeUserTyping, message("b"), true)
+
+	// subscribing to nothing lets everything through again
+	c.Subscribe(&Subscriptions{})
+	check("reset", TypeNewMessage, message("c"), true)
+
+	// once unsubscribed from a channel, subscribing adds
+	// back to everything instead of narrowing it down
+	c.Unsubscribe(&Subscriptions{ChannelIDs: []string{"x"}})
+	c.Subscribe(&Subscriptions{ChannelIDs: []string{"x"}})
+	c.Subscribe(&Subscriptions{ChannelIDs: []string{"y"}})
+	check("resubscribed channel", TypeNewMessage, message("x"), true)
+	check("other channel after resubscribing", TypeNewMessage, message("z"), true)
+}
@@ -0,0 +1,120 @@
+package events
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// outbound is an encoded event or response waiting to be written to a client
+type outbound struct {
+	data []byte
+	// seq is the event's sequence number, 0 if it doesn't have one
+	seq uint64
+	// prepared is the frame ready to write to websockets, if it has been prepared
+	prepared *websocket.PreparedMessage
+}
+
+// the reasons connections are closed, sent in the close frame
+const (
+	closeSlowReason         = "too slow, reconnect to catch up"
+	closeSessionEndedReason = "session ended"
+)
+
+// transport is how a client's frames get to it, a websocket or an event stream
+type transport interface {
+	// send writes the frame to the client
+	send(o *outbound) error
+	// ping keeps the connection alive through proxies
+	ping() error
+	// closeWith tells the client why its connection is being closed, with a
+	// websocket close code, then closes it
+	closeWith(code int, reason string)
+	// Close closes the connection
+	Close() error
+}
+
+// wsTransport sends frames over a websocket
+type wsTransport struct {
+	conn *websocket.Conn
+}
+
+func (t *wsTransport) send(o *outbound) error {
+	t.conn.SetWriteDeadline(time.Now().Add(WriteWait))
+	if o.prepared != nil {
+		return t.conn.WritePreparedMessage(o.prepared)
+	}
+	return t.conn.WriteMessage(websocket.TextMessage, o.data)
+}
+
+func (t *wsTransport) ping() error {
+	t.conn.SetWriteDeadline(time.Now().Add(WriteWait))
+	return t.conn.WriteMessage(websocket.PingMessage, nil)
+}
+
+// closeWith sends a close frame before closing,
+// the read pump then removes the client
+func (t *wsTransport) closeWith(code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	t.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(WriteWait))
+	t.conn.Close()
+}
+
+func (t *wsTransport) Close() error {
+	return t.conn.Close()
+}
+
+// sseTransport sends frames as server-sent events, each with the event's
+// sequence number as its id so the browser sends it back as Last-Event-ID
+// when it reconnects. It is only written to from the request's handler
+type sseTransport struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	// rc sets the write deadlines, so a reader that stalls can't hold up the writer forever
+	rc *http.ResponseController
+	// closed is closed when the stream should end
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (t *sseTransport) send(o *outbound) error {
+	t.rc.SetWriteDeadline(time.Now().Add(WriteWait))
+	if o.seq != 0 {
+		if _, err := fmt.Fprintf(t.w, "id: %s\n", strconv.FormatUint(o.seq, 10)); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(t.w, "data: %s\n\n", o.data); err != nil {
+		return err
+	}
+	t.flusher.Flush()
+	return nil
+}
+
+// ping sends a comment, which clients ignore
+func (t *sseTransport) ping() error {
+	t.rc.SetWriteDeadline(time.Now().Add(WriteWait))
+	if _, err := fmt.Fprint(t.w, ": ping\n\n"); err != nil {
+		return err
+	}
+	t.flusher.Flush()
+	return nil
+}
+
+// closeWith ends the stream, there is no way to say why. The browser
+// reconnects with the Last-Event-ID it got to and catches up from there,
+// or is turned away if its session ended
+func (t *sseTransport) closeWith(code int, reason string) {
+	t.Close()
+}
+
+func (t *sseTransport) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.closed)
+	})
+	return nil
+}
@@ -0,0 +1,62 @@
+package events
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNotifierStream(t *testing.T) {
+	n := NewNotifier(fakeChannels{})
+	go n.Start()
+	n.Notify(&Event{Type: "missed"})
+	for last, _ := n.bus.Log().Last(); last < 1; last, _ = n.bus.Log().Last() {
+		time.Sleep(time.Millisecond)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		since := uint64(0)
+		if err := n.Stream(w, r, "user", "", &since); err != nil {
+			t.Errorf("error streaming: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("error getting stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected content type text/event-stream but got %q", ct)
+	}
+	for !n.Online("user") {
+		time.Sleep(time.Millisecond)
+	}
+	n.Notify(&Event{Type: "live"})
+
+	// the greeting has no id, the events carry their sequence numbers
+	expected := []string{
+		`data: {"version":1,"type":"connected","data":{"seq":1,"replayed":1}}`, ``,
+		`id: 1`, `data: {"seq":1,"version":0,"type":"missed","data":null}`, ``,
+		`id: 2`, `data: {"seq":2,"version":0,"type":"live","data":null}`, ``,
+	}
+	lines := bufio.NewScanner(resp.Body)
+	for _, e := range expected {
+		if !lines.Scan() {
+			t.Fatalf("expected %q but the stream ended: %v", e, lines.Err())
+		}
+		if lines.Text() != e {
+			t.Errorf("expected %q but got %q", e, lines.Text())
+		}
+	}
+
+	// the client is removed when the request goes away
+	resp.Body.Close()
+	for start := time.Now(); n.Online("user"); time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatal("expected the client to be removed when the request ended")
+		}
+	}
+}
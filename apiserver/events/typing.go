@@ -0,0 +1,81 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// TypingTimeout is how long a user is shown as typing after the last time their
+// client said they were typing. Clients should say so again within this time
+// while the user keeps typing.
+var TypingTimeout = 6 * time.Second
+
+// typists tracks who is typing in each channel, so repeated signals
+// are coalesced into one event and a user who stops signalling is
+// shown as having stopped. Nothing is persisted, it only lives as
+// long as the server.
+type typists struct {
+	notify func(event *Event)
+	// timers holds a timer for each user typing in a channel, keyed by
+	// typingKey, that sends the event saying they stopped
+	timers map[string]*time.Timer
+	mu     sync.Mutex
+}
+
+func typingKey(channelID string, userID string) string {
+	return channelID + ":" + userID
+}
+
+// typingEvent returns the event telling the other users who can see
+// the channel that the user started or stopped typing in it
+func typingEvent(channelID string, userID string, typing bool) *Event {
+	event := New(&UserTyping{UserID: userID, ChannelID: channelID, Typing: typing})
+	event.ChannelID = channelID
+	event.ExcludeUserIDs = []string{userID}
+	event.Ephemeral = true
+	return event
+}
+
+// start marks the user as typing in the channel, the other users are
+// only told when they weren't already typing
+func (ts *typists) start(channelID string, userID string) {
+	key := typingKey(channelID, userID)
+	ts.mu.Lock()
+	if timer, found := ts.timers[key]; found && timer.Stop() {
+		timer.Reset(TypingTimeout)
+		ts.mu.Unlock()
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(TypingTimeout, func() {
+		ts.mu.Lock()
+		// a newer signal may have replaced the timer while this one fired
+		stale := ts.timers[key] != timer
+		if !stale {
+			delete(ts.timers, key)
+		}
+		ts.mu.Unlock()
+		if !stale {
+			ts.notify(typingEvent(channelID, userID, false))
+		}
+	})
+	ts.timers[key] = timer
+	ts.mu.Unlock()
+	// tell the others once the lock is released, so notifying never holds up other typists
+	ts.notify(typingEvent(channelID, userID, true))
+}
+
+// stop marks the user as no longer typing in the channel,
+// such as when they post the message they were typing
+func (ts *typists) stop(channelID string, userID string) {
+	key := typingKey(channelID, userID)
+	ts.mu.Lock()
+	timer, found := ts.timers[key]
+	if found {
+		delete(ts.timers, key)
+	}
+	ts.mu.Unlock()
+	if found && timer.Stop() {
+		ts.notify(typingEvent(channelID, userID, false))
+	}
+}
@@ -0,0 +1,75 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+	"github.com/gorilla/websocket"
+)
+
+// readTyping sends whether each "user typing" event the connection gets
+// said the user was typing on the returned channel
+func readTyping(conn *websocket.Conn) <-chan bool {
+	got := make(chan bool, 10)
+	go func() {
+		for {
+			event := &struct {
+				Type string      `json:"type"`
+				Data *UserTyping `json:"data"`
+			}{}
+			if err := conn.ReadJSON(event); err != nil {
+				return
+			}
+			got <- event.Data.Typing
+		}
+	}()
+	return got
+}
+
+// typingEvents returns the typing events received before the wait is over
+func typingEvents(got <-chan bool, wait time.Duration) []bool {
+	typing := []bool{}
+	deadline := time.After(wait)
+	for {
+		select {
+		case v := <-got:
+			typing = append(typing, v)
+		case <-deadline:
+			return typing
+		}
+	}
+}
+
+func TestNotifierTyping(t *testing.T) {
+	defer func(timeout time.Duration) { TypingTimeout = timeout }(TypingTimeout)
+	TypingTimeout = 300 * time.Millisecond
+	channels := fakeChannels{"channel": &messages.Channel{ID: "channel"}}
+	n, connect := newCommandNotifier(t, channels, nil)
+	typist := readTyping(connect("typist"))
+	reader := readTyping(connect("reader"))
+
+	// signals while the user is still typing are coalesced,
+	// and they stop typing once the signals stop
+	n.Typing("channel", "typist")
+	time.Sleep(100 * time.Millisecond)
+	n.Typing("channel", "typist")
+	got := typingEvents(reader, time.Second)
+	if len(got) != 2 || !got[0] || got[1] {
+		t.Errorf("expected the reader to see one start and one stop but got %v", got)
+	}
+
+	// stopping sends the stop straight away, and only once
+	n.Typing("channel", "typist")
+	n.StoppedTyping("channel", "typist")
+	n.StoppedTyping("channel", "typist")
+	got = typingEvents(reader, 500*time.Millisecond)
+	if len(got) != 2 || !got[0] || got[1] {
+		t.Errorf("expected the reader to see one start and one stop but got %v", got)
+	}
+
+	// the typist doesn't hear about their own typing
+	if got := typingEvents(typist, 100*time.Millisecond); len(got) != 0 {
+		t.Errorf("expected the typist not to get their own typing events but got %v", got)
+	}
+}
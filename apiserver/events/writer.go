@@ -0,0 +1,88 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// the limits on websocket connections, following the gorilla chat example
+var (
+	// WriteWait is how long a write to a client can take
+	WriteWait = 10 * time.Second
+	// PongWait is how long a client can go without answering a ping
+	PongWait = 60 * time.Second
+	// PingPeriod is how often clients are pinged, it must be less than PongWait
+	PingPeriod = PongWait * 9 / 10
+	// MaxCommandSize is the largest frame a client can send
+	MaxCommandSize int64 = 64 * 1024
+	// ClientQueueSize is how many frames can be waiting to be written to a client
+	// before it counts as too slow
+	ClientQueueSize = 256
+	// EventQueueSize is how many events can be waiting to be published
+	// before Notify drops them
+	EventQueueSize = 1024
+)
+
+// SlowClientPolicy is what the Notifier does with events for a client
+// whose queue is full because it isn't reading them fast enough
+type SlowClientPolicy int
+
+const (
+	// DisconnectSlowClients closes the connection, the client can
+	// reconnect with `since` to catch up on what it missed. It is the default
+	DisconnectSlowClients SlowClientPolicy = iota
+	// DropEventsForSlowClients drops the events until the client catches up
+	DropEventsForSlowClients
+)
+
+// enqueue queues the frame for the client's writer,
+// it reports false if the queue is full
+func (c *Client) enqueue(o *outbound) bool {
+	select {
+	case c.queue <- o:
+		return true
+	default:
+		return false
+	}
+}
+
+// enqueueJSON queues the value for the client's writer as JSON
+func (c *Client) enqueueJSON(v interface{}) (bool, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return false, err
+	}
+	return c.enqueue(&outbound{data: buf}), nil
+}
+
+// writePump writes the client's greeting and then the queued frames to the client
+// until it is removed, and pings it so connections that went away without closing
+// are noticed. It is the only goroutine that writes events to the connection.
+// It returns when the client is removed or can't be written to, closing the connection
+func (c *Client) writePump() {
+	ticker := time.NewTicker(PingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+	for _, o := range c.greeting {
+		if err := c.conn.send(o); err != nil {
+			return
+		}
+	}
+	c.greeting = nil
+	for {
+		select {
+		case o := <-c.queue:
+			if err := c.conn.send(o); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.ping(); err != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package events
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// stalledClient adds a client to the notifier whose writer never runs, so its
+// queue fills up, and returns the other end of its connection
+func stalledClient(t *testing.T, n *Notifier) *websocket.Conn {
+	conns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("error connecting websocket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	server := <-conns
+	client := newClient(&wsTransport{conn: server}, "slow", "", nil)
+	client.queue = make(chan *outbound, 1)
+	n.clients[client] = true
+	return conn
+}
+
+func TestNotifierSlowClient(t *testing.T) {
+	record, err := newRecord(&Event{Type: "event"})
+	if err != nil {
+		t.Fatalf("error encoding event: %v", err)
+	}
+
+	// dropping events leaves the connection open
+	n := NewNotifier(fakeChannels{})
+	n.SetSlowClientPolicy(DropEventsForSlowClients)
+	conn := stalledClient(t, n)
+	n.broadcast(record)
+	n.broadcast(record)
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, _, err := conn.ReadMessage(); !strings.Contains(fmt.Sprint(err), "timeout") {
+		t.Errorf("expected the connection to stay open but got %v", err)
+	}
+
+	// otherwise it is closed once the queue is full
+	n = NewNotifier(fakeChannels{})
+	conn = stalledClient(t, n)
+	n.broadcast(record)
+	n.broadcast(record)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+		t.Errorf("expected the connection to be closed for being too slow but got %v", err)
+	}
+}
+
+func BenchmarkBroadcast(b *testing.B) {
+	for _, clients := range []int{10, 100, 1000, 3000} {
+		b.Run(fmt.Sprintf("%d clients", clients), func(b *testing.B) {
+			benchmarkBroadcast(b, clients)
+		})
+	}
+}
+
+// benchmarkBroadcast measures how fast events are delivered to every one of the clients.
+// Events are sent in batches that fit in the clients' queues, waiting for every client
+// to get each batch, since clients that fall further behind are disconnected
+func benchmarkBroadcast(b *testing.B, clients int) {
+	n := NewNotifier(fakeChannels{})
+	go n.Start()
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		n.AddClient(conn, r.URL.Query().Get("user"), "", nil)
+	}))
+	defer srv.Close()
+
+	// each client reads the greeting, then counts the events it gets
+	var delivered, disconnected int64
+	for i := 0; i < clients; i++ {
+		url := fmt.Sprintf("ws%s?user=user%d", strings.TrimPrefix(srv.URL, "http"), i)
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			b.Fatalf("error connecting websocket %d: %v", i, err)
+		}
+		defer conn.Close()
+		if _, _, err := conn.ReadMessage(); err != nil {
+			b.Fatalf("error reading greeting: %v", err)
+		}
+		go func() {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					atomic.AddInt64(&disconnected, 1)
+					return
+				}
+				atomic.AddInt64(&delivered, 1)
+			}
+		}()
+	}
+
+	batch := ClientQueueSize / 2
+	b.ResetTimer()
+	start := time.Now()
+	for sent := 0; sent < b.N; {
+		for i := 0; i < batch && sent < b.N; i++ {
+			n.Notify(&Event{Type: "event"})
+			sent++
+		}
+		for atomic.LoadInt64(&delivered)+atomic.LoadInt64(&disconnected)*int64(b.N) < int64(sent*clients) {
+			time.Sleep(50 * time.Microsecond)
+		}
+	}
+	elapsed := time.Since(start)
+	b.StopTimer()
+	b.ReportMetric(float64(b.N*clients)/elapsed.Seconds(), "deliveries/s")
+	b.ReportMetric(float64(atomic.LoadInt64(&disconnected)), "disconnected")
+}
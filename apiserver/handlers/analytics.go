@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+)
+
+// channelAnalyticsHandler handles requests to /v1/channels/<channel-id>/analytics
+// and allows a user to (GET) a summary of the activity in a channel they can view:
+// messages per day, busiest hours, top posters, and each member's post count and
+// last post time including the members who never posted. The query can contain
+// `since` and `until` as RFC 3339 times to limit the range, and `top` for the number
+// of top posters.
+func (ctx *Context) channelAnalyticsHandler(w http.ResponseWriter, r *http.Request, state *SessionState, cID string) {
+	if r.Method != "GET" {
+		http.Error(w, "method must be GET", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// build the analytics query from the query string
+	params := r.URL.Query()
+	query := &messages.AnalyticsQuery{}
+	var err error
+	if query.Since, err = timeParam(params.Get("since")); err != nil {
+		http.Error(w, "error getting analytics: invalid since time", http.StatusBadRequest)
+		return
+	}
+	if query.Until, err = timeParam(params.Get("until")); err != nil {
+		http.Error(w, "error getting analytics: invalid until time", http.StatusBadRequest)
+		return
+	}
+	if len(params.Get("top")) > 0 {
+		top, err := strconv.Atoi(params.Get("top"))
+		if err != nil {
+			http.Error(w, "error getting analytics: invalid top", http.StatusBadRequest)
+			return
+		}
+		query.Top = top
+	}
+	if err := query.Validate(); err != nil {
+		http.Error(w, "error getting analytics: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// only people who can see the channel can see its analytics
+	channel, err := ctx.MessageStore.GetChannelByID(cID)
+	if err == messages.ErrChannelNotFound {
+		http.Error(w, "error getting analytics: "+err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "error getting analytics: "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	if !channel.CanView(state.User.ID) {
+		http.Error(w, "error getting analytics: "+messages.ErrUnauthorized.Error(),
+			http.StatusForbidden)
+		return
+	}
+
+	analytics, err := ctx.MessageStore.GetChannelAnalytics(channel, query)
+	if err != nil {
+		http.Error(w, "error getting analytics: "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	Respond(w, analytics, contentTypeJSONUTF8)
+}
+
+// timeParam parses an optional RFC 3339 time from the query string
+func timeParam(value string) (*time.Time, error) {
+	if len(value) == 0 {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -7,6 +7,7 @@ import (
 
 	"time"
 
+	"github.com/aethanol/challenges-aethanol/apiserver/events"
 	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
 	"github.com/aethanol/challenges-aethanol/apiserver/sessions"
 )
@@ -76,7 +77,7 @@ func (ctx *Context) UsersHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// notify the clients of the new user
-		ctx.notify("new user", user)
+		ctx.notify(&events.NewUser{User: user})
 		// Respond to the client with the models.User struct encoded as a JSON object
 		Respond(w, user, contentTypeJSONUTF8)
 	case "GET":
@@ -163,6 +164,8 @@ func (ctx *Context) SessionsMineHandler(w http.ResponseWriter, r *http.Request)
 			http.StatusInternalServerError)
 		return
 	}
+	// and close the websockets and event streams it opened, on every server
+	ctx.Notifier.EndSession(sid.String())
 	// Respond to the client with a simple message saying that the user has been signed out
 	io.WriteString(w, "user signed out\n")
 }
@@ -183,6 +186,7 @@ func (ctx *Context) UsersMeHanlder(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Respond to the client with the session state's User field, encoded as a JSON object
+		ctx.addLastSeen(state.User)
 		Respond(w, state.User, contentTypeJSONUTF8)
 	case "PATCH":
 		// allow the client to set the FirstName and/or LastName fields for the currently-authenticated user.
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/events"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+	"github.com/aethanol/challenges-aethanol/apiserver/readmarkers"
+)
+
+// the commands clients can send over their websockets
+const (
+	commandPostMessage = "post message"
+	commandEditMessage = "edit message"
+	commandMarkRead    = "mark read"
+	commandSubscribe   = "subscribe"
+	commandUnsubscribe = "unsubscribe"
+	commandTyping      = "typing"
+	commandHeartbeat   = "heartbeat"
+)
+
+// editMessageCommand is the data of an "edit message" command,
+// the version is the one the client last saw, like an If-Match header
+type editMessageCommand struct {
+	MessageID string `json:"messageID"`
+	Version   int    `json:"version"`
+	Body      string `json:"body"`
+}
+
+// markReadCommand is the data of a "mark read" command
+type markReadCommand struct {
+	ChannelID string `json:"channelID"`
+	MessageID string `json:"messageID"`
+}
+
+// subscribeCommand is the data of a "subscribe" or "unsubscribe" command,
+// subscribing to no channels or types means everything the user can see
+type subscribeCommand struct {
+	ChannelIDs []string `json:"channelIDs"`
+	EventTypes []string `json:"eventTypes"`
+}
+
+// typingCommand is the data of a "typing" command
+type typingCommand struct {
+	ChannelID string `json:"channelID"`
+}
+
+// socketCommands carries out the commands sent over a websocket, as
+// the user who opened it, using the same store calls as the REST API
+type socketCommands struct {
+	ctx   *Context
+	state *SessionState
+}
+
+// HandleCommand carries out the command and returns the response to send back
+func (sc *socketCommands) HandleCommand(client *events.Client, cmd *events.Command) *events.Response {
+	switch cmd.Type {
+	case commandPostMessage:
+		newMessage := &messages.NewMessage{}
+		if err := json.Unmarshal(cmd.Data, newMessage); err != nil {
+			return events.NewErrorResponse(http.StatusBadRequest, "invalid JSON")
+		}
+		// the nonce doubles as the idempotency key, like the REST API
+		message, err := sc.ctx.postMessage(sc.state, newMessage, "")
+		if err != nil {
+			return events.NewErrorResponse(err.status, err.Error())
+		}
+		return events.NewResponse(message)
+
+	case commandEditMessage:
+		edit := &editMessageCommand{}
+		if err := json.Unmarshal(cmd.Data, edit); err != nil || len(edit.MessageID) == 0 {
+			return events.NewErrorResponse(http.StatusBadRequest, "invalid JSON")
+		}
+		updates := &messages.MessageUpdates{Body: edit.Body, Version: edit.Version}
+		message, err := sc.ctx.editMessage(sc.state, edit.MessageID, updates)
+		if err != nil {
+			return events.NewErrorResponse(err.status, err.Error())
+		}
+		sc.ctx.redactForwards(sc.state.User, message)
+		return events.NewResponse(message)
+
+	case commandMarkRead:
+		read := &markReadCommand{}
+		if err := json.Unmarshal(cmd.Data, read); err != nil || len(read.ChannelID) == 0 {
+			return events.NewErrorResponse(http.StatusBadRequest, "invalid JSON")
+		}
+		marker, err := sc.ctx.markRead(sc.state, read.ChannelID, &readmarkers.MarkerUpdates{MessageID: read.MessageID})
+		if err != nil {
+			return events.NewErrorResponse(err.status, err.Error())
+		}
+		return events.NewResponse(marker)
+
+	case commandSubscribe, commandUnsubscribe:
+		sub := &subscribeCommand{}
+		if err := json.Unmarshal(cmd.Data, sub); err != nil {
+			return events.NewErrorResponse(http.StatusBadRequest, "invalid JSON")
+		}
+		// only allow the types of events there are
+		for _, eventType := range sub.EventTypes {
+			if !isEventType(eventType) {
+				return events.NewErrorResponse(http.StatusBadRequest, "unknown event type "+eventType)
+			}
+		}
+		subscriptions := &events.Subscriptions{ChannelIDs: sub.ChannelIDs, EventTypes: sub.EventTypes}
+		if cmd.Type == commandUnsubscribe {
+			return events.NewResponse(client.Unsubscribe(subscriptions))
+		}
+		// only allow subscribing to channels the user can see
+		for _, cID := range sub.ChannelIDs {
+			if _, err := sc.ctx.viewableChannel(sc.state, cID); err != nil {
+				return events.NewErrorResponse(err.status, "error subscribing: "+err.Error())
+			}
+		}
+		return events.NewResponse(client.Subscribe(subscriptions))
+
+	case commandTyping:
+		typing := &typingCommand{}
+		if err := json.Unmarshal(cmd.Data, typing); err != nil || len(typing.ChannelID) == 0 {
+			return events.NewErrorResponse(http.StatusBadRequest, "invalid JSON")
+		}
+		if err := sc.ctx.typing(sc.state, typing.ChannelID); err != nil {
+			return events.NewErrorResponse(err.status, err.Error())
+		}
+		return events.NewResponse(nil)
+
+	case commandHeartbeat:
+		// the user is active, so they aren't shown as away
+		sc.ctx.Presence.Heartbeat(messages.IDString(sc.state.User.ID))
+		return events.NewResponse(nil)
+
+	default:
+		return events.NewErrorResponse(http.StatusBadRequest, "unknown command "+cmd.Type)
+	}
+}
+
+// isEventType reports whether there are events of the type
+func isEventType(eventType string) bool {
+	for _, t := range events.Types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// viewableChannel returns the channel if the user can see it
+func (ctx *Context) viewableChannel(state *SessionState, cID string) (*messages.Channel, *statusError) {
+	channel, err := ctx.MessageStore.GetChannelByID(cID)
+	if err == messages.ErrChannelNotFound {
+		return nil, newStatusError(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return nil, newStatusError(http.StatusInternalServerError, err.Error())
+	}
+	if !channel.CanView(state.User.ID) {
+		return nil, newStatusError(http.StatusForbidden, messages.ErrUnauthorized.Error())
+	}
+	return channel, nil
+}
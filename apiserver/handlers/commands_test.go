@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/drafts"
+	"github.com/aethanol/challenges-aethanol/apiserver/events"
+	"github.com/aethanol/challenges-aethanol/apiserver/idempotency"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/sqldb"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
+	"github.com/aethanol/challenges-aethanol/apiserver/readmarkers"
+)
+
+// newCommandsContext returns a context backed by in-memory stores
+func newCommandsContext(t *testing.T) *Context {
+	db, err := sqldb.Open(sqldb.SQLite, ":memory:")
+	if err != nil {
+		t.Fatalf("error opening database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store, err := messages.NewSQLStore(db)
+	if err != nil {
+		t.Fatalf("error creating message store: %v", err)
+	}
+	notifier := events.NewNotifier(store)
+	go notifier.Start()
+	return &Context{
+		MessageStore:     store,
+		DraftStore:       drafts.NewMemStore(-1),
+		ReadMarkerStore:  readmarkers.NewMemStore(),
+		IdempotencyStore: idempotency.NewMemStore(time.Hour),
+		Notifier:         notifier,
+	}
+}
+
+// command sends a command as the user and returns the response
+func command(ctx *Context, user *users.User, client *events.Client, cType string, data interface{}) *events.Response {
+	buf, _ := json.Marshal(data)
+	sc := &socketCommands{ctx: ctx, state: &SessionState{User: user}}
+	return sc.HandleCommand(client, &events.Command{ID: "1", Type: cType, Data: buf})
+}
+
+func TestSocketCommands(t *testing.T) {
+	ctx := newCommandsContext(t)
+	creator := &users.User{ID: "creator"}
+	outsider := &users.User{ID: "outsider"}
+	channel, err := ctx.MessageStore.InsertChannel(&messages.NewChannel{Name: "private", Private: true}, creator)
+	if err != nil {
+		t.Fatalf("error inserting channel: %v", err)
+	}
+	cID := messages.IDString(channel.ID)
+	client := &events.Client{}
+
+	// posting goes through the same validation and idempotency as the REST API
+	post := &messages.NewMessage{ChannelID: cID, Body: "hello", Nonce: "nonce1"}
+	resp := command(ctx, creator, client, commandPostMessage, post)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("expected posting to succeed but got %d: %s", resp.Status, resp.Error)
+	}
+	message := resp.Data.(*messages.Message)
+	retry := command(ctx, creator, client, commandPostMessage, post)
+	if retry.Status != http.StatusOK || messages.IDString(retry.Data.(*messages.Message).ID) != messages.IDString(message.ID) {
+		t.Errorf("expected a retry with the same nonce to return the same message but got %d: %v", retry.Status, retry.Data)
+	}
+	mID := messages.IDString(message.ID)
+
+	cases := []struct {
+		name     string
+		user     *users.User
+		cType    string
+		data     interface{}
+		expected int
+	}{
+		{"empty message", creator, commandPostMessage, &messages.NewMessage{ChannelID: cID}, http.StatusBadRequest},
+		{"post outside channel", outsider, commandPostMessage, &messages.NewMessage{ChannelID: cID, Body: "hi"}, http.StatusForbidden},
+		{"edit stale version", creator, commandEditMessage, &editMessageCommand{MessageID: mID, Version: message.Version + 1, Body: "edited"}, http.StatusPreconditionFailed},
+		{"edit", creator, commandEditMessage, &editMessageCommand{MessageID: mID, Version: message.Version, Body: "edited"}, http.StatusOK},
+		{"edit someone else's", outsider, commandEditMessage, &editMessageCommand{MessageID: mID, Body: "mine"}, http.StatusForbidden},
+		{"mark read", creator, commandMarkRead, &markReadCommand{ChannelID: cID, MessageID: mID}, http.StatusOK},
+		{"mark read outside channel", outsider, commandMarkRead, &markReadCommand{ChannelID: cID, MessageID: mID}, http.StatusForbidden},
+		{"subscribe", creator, commandSubscribe, &subscribeCommand{ChannelIDs: []string{cID}}, http.StatusOK},
+		{"subscribe outside channel", outsider, commandSubscribe, &subscribeCommand{ChannelIDs: []string{cID}}, http.StatusForbidden},
+		{"subscribe to event types", creator, commandSubscribe, &subscribeCommand{EventTypes: []string{events.TypeNewMessage}}, http.StatusOK},
+		{"subscribe to unknown event type", creator, commandSubscribe, &subscribeCommand{EventTypes: []string{"gossip"}}, http.StatusBadRequest},
+		{"unsubscribe", outsider, commandUnsubscribe, &subscribeCommand{ChannelIDs: []string{cID}, EventTypes: []string{events.TypeUserTyping}}, http.StatusOK},
+		{"typing", creator, commandTyping, &typingCommand{ChannelID: cID}, http.StatusOK},
+		{"typing outside channel", outsider, commandTyping, &typingCommand{ChannelID: cID}, http.StatusForbidden},
+		{"unknown command", creator, "shout", nil, http.StatusBadRequest},
+		// malformed IDs are answered like any other missing ID
+		{"edit malformed ID", creator, commandEditMessage, &editMessageCommand{MessageID: "not-an-id", Body: "edited"}, http.StatusForbidden},
+		{"mark read malformed channel", creator, commandMarkRead, &markReadCommand{ChannelID: "not-an-id", MessageID: mID}, http.StatusNotFound},
+		{"mark read malformed message", creator, commandMarkRead, &markReadCommand{ChannelID: cID, MessageID: "not-an-id"}, http.StatusBadRequest},
+		{"subscribe malformed channel", creator, commandSubscribe, &subscribeCommand{ChannelIDs: []string{"not-an-id"}}, http.StatusNotFound},
+		{"typing malformed channel", creator, commandTyping, &typingCommand{ChannelID: "not-an-id"}, http.StatusNotFound},
+	}
+	for _, c := range cases {
+		if resp := command(ctx, c.user, client, c.cType, c.data); resp.Status != c.expected {
+			t.Errorf("%s: expected status %d but got %d: %s", c.name, c.expected, resp.Status, resp.Error)
+		}
+	}
+
+	marker, err := ctx.ReadMarkerStore.Get("creator", cID)
+	if err != nil || marker.MessageID != mID {
+		t.Errorf("expected the channel to be marked read up to %s but got %v, %v", mID, marker, err)
+	}
+}
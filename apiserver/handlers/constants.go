@@ -2,6 +2,10 @@ package handlers
 
 const (
 	headerContentType = "Content-Type"
+	headerETag        = "ETag"
+	headerIfMatch     = "If-Match"
+
+	headerIdempotencyKey = "Idempotency-Key"
 )
 
 const (
@@ -11,10 +15,22 @@ const (
 	apiSessions     = apiRoot + "sessions"
 	apiSessionsMine = apiSessions + "/mine"
 	apiUsersMe      = apiUsers + "/me"
+
+	apiChannels        = apiRoot + "channels"
+	apiSpecificChannel = apiRoot + "channels/"
+	apiMessages        = apiRoot + "messages"
+	apiSpecificMessage = apiRoot + "messages/"
+	apiModeration      = apiRoot + "moderation/"
+	apiSpecificWebhook = apiRoot + "webhooks/"
+	apiHooks           = apiRoot + "hooks/"
 )
 
 const (
 	charsetUTF8         = "charset=utf-8"
 	contentTypeJSON     = "application/json"
 	contentTypeJSONUTF8 = contentTypeJSON + "; " + charsetUTF8
+	contentTypeHTML     = "text/html"
+	contentTypeHTMLUTF8 = contentTypeHTML + "; " + charsetUTF8
+	contentTypeText     = "text/plain"
+	contentTypeTextUTF8 = contentTypeText + "; " + charsetUTF8
 )
@@ -1,11 +1,18 @@
 package handlers
 
 import (
+	"github.com/aethanol/challenges-aethanol/apiserver/drafts"
 	"github.com/aethanol/challenges-aethanol/apiserver/events"
+	"github.com/aethanol/challenges-aethanol/apiserver/hooks"
+	"github.com/aethanol/challenges-aethanol/apiserver/idempotency"
+	"github.com/aethanol/challenges-aethanol/apiserver/jobs"
 	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
 	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
 	"github.com/aethanol/challenges-aethanol/apiserver/passwordreset"
+	"github.com/aethanol/challenges-aethanol/apiserver/presence"
+	"github.com/aethanol/challenges-aethanol/apiserver/readmarkers"
 	"github.com/aethanol/challenges-aethanol/apiserver/sessions"
+	"github.com/aethanol/challenges-aethanol/apiserver/webhooks"
 )
 
 // Context contains the stores for the server
@@ -15,7 +22,21 @@ type Context struct {
 	UserStore    users.Store
 	MessageStore messages.Store
 	ResetStore   passwordreset.Store
-	EmailPass    string
-	Notifier     *events.Notifier
-	SvcAddr      string
+	DraftStore   drafts.Store
+	// ReadMarkerStore remembers the last message each user read in each channel
+	ReadMarkerStore readmarkers.Store
+	EmailPass       string
+	Notifier        *events.Notifier
+	// Presence tracks who is online, away or offline
+	Presence *presence.Tracker
+	SvcAddr  string
+	// Moderators are the IDs of the users allowed to use the moderation APIs
+	Moderators []string
+	Jobs       *jobs.Registry
+	// IdempotencyStore remembers the messages created by retried POSTs
+	IdempotencyStore idempotency.Store
+	// WebhookStore keeps the webhooks users subscribed and their delivery logs
+	WebhookStore webhooks.Store
+	// HookStore keeps the incoming webhooks that post into channels
+	HookStore hooks.Store
 }
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/drafts"
+	"github.com/aethanol/challenges-aethanol/apiserver/events"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+)
+
+// channelDraftHandler handles requests to /v1/channels/<channel-id>/draft
+// and allows a user to (PUT) save, (GET) get and (DELETE) delete their
+// unsent draft for the channel. Changes are sent as "draft updated" events
+// to the user's other connections so the draft follows them across devices,
+// a deleted draft is sent with an empty body.
+func (ctx *Context) channelDraftHandler(w http.ResponseWriter, r *http.Request, state *SessionState, cID string) {
+	userID := messages.IDString(state.User.ID)
+	switch r.Method {
+	// get the user's draft for the channel
+	case "GET":
+		draft, err := ctx.DraftStore.Get(userID, cID)
+		if err == drafts.ErrDraftNotFound {
+			http.Error(w, "error getting draft: "+err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "error getting draft: "+err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+		Respond(w, draft, contentTypeJSONUTF8)
+	// save the user's draft for the channel
+	case "PUT":
+		// decode the request body into a DraftUpdates struct
+		decoder := json.NewDecoder(r.Body)
+		updates := &drafts.DraftUpdates{}
+		if err := decoder.Decode(updates); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		// only allow drafts for channels the user can see
+		channel, err := ctx.MessageStore.GetChannelByID(cID)
+		if err == messages.ErrChannelNotFound {
+			http.Error(w, "error saving draft: "+err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "error saving draft: "+err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+		if !channel.CanView(state.User.ID) {
+			http.Error(w, "error saving draft: "+messages.ErrUnauthorized.Error(),
+				http.StatusForbidden)
+			return
+		}
+
+		draft := &drafts.Draft{
+			ChannelID: cID,
+			Body:      updates.Body,
+			UpdatedAt: time.Now(),
+		}
+		if err := ctx.DraftStore.Save(userID, draft); err != nil {
+			http.Error(w, "error saving draft: "+err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+
+		// let the user's other devices know about the draft
+		ctx.notifyUsers(&events.DraftUpdate{Draft: draft}, userID)
+		Respond(w, draft, contentTypeJSONUTF8)
+	// delete the user's draft for the channel
+	case "DELETE":
+		if err := ctx.DraftStore.Delete(userID, cID); err != nil {
+			http.Error(w, "error deleting draft: "+err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+
+		// let the user's other devices clear the draft
+		ctx.notifyUsers(&events.DraftUpdate{Draft: &drafts.Draft{ChannelID: cID}}, userID)
+		io.WriteString(w, "draft deleted\n")
+	}
+}
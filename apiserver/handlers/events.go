@@ -2,10 +2,13 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
 
 	"log"
 
 	"github.com/gorilla/websocket"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
 )
 
 // get the upgrader for websocket upgrading
@@ -16,16 +19,26 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin:     func(r *http.Request) bool { return true },
 }
 
-//WebSocketUpgradeHandler handles websocket upgrade requests
+//WebSocketUpgradeHandler handles websocket upgrade requests. A client that is reconnecting
+//can set the `since` query parameter to the seq of the last event it got, to be sent the ones it missed
 func (ctx *Context) WebSocketUpgradeHandler(w http.ResponseWriter, r *http.Request) {
 
-	// ensure the user is authenticated
-	_, err := ctx.authenticated(w, r)
+	// ensure the user is authenticated, the connection
+	// is closed when the session ends
+	state, sid, err := ctx.authenticatedSession(w, r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
 
+	// check the sequence number to resume from before upgrading,
+	// so a bad one can still get an error response
+	since, err := parseSince(r.URL.Query().Get("since"))
+	if err != nil {
+		http.Error(w, "error parsing since: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	//upgrade this request to a web socket connection
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -34,6 +47,60 @@ func (ctx *Context) WebSocketUpgradeHandler(w http.ResponseWriter, r *http.Reque
 	}
 	//after upgrading, use the `.AddClient()` method on your notifier
 	//to add the new client to your notifier's map of clients
-	ctx.Notifier.AddClient(conn)
+	//the commands the client sends are carried out as the user who opened it
+	userID := messages.IDString(state.User.ID)
+	commands := &socketCommands{ctx: ctx, state: state}
+	if since != nil {
+		ctx.Notifier.Resume(conn, userID, sid.String(), commands, *since)
+		return
+	}
+	ctx.Notifier.AddClient(conn, userID, sid.String(), commands)
+
+}
+
+// EventStreamHandler handles requests to /v1/events, and streams the same events as the
+// websocket as server-sent events, for clients behind proxies that break websockets.
+// Browsers resume with the Last-Event-ID header when they reconnect, other clients can
+// set it or the `since` query parameter to the seq of the last event they got
+func (ctx *Context) EventStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "request method must be GET", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// ensure the user is authenticated, the stream
+	// ends when the session does
+	state, sid, err := ctx.authenticatedSession(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// the header wins, since it is what the browser sends when it reconnects
+	resumeFrom := r.Header.Get("Last-Event-ID")
+	if len(resumeFrom) == 0 {
+		resumeFrom = r.URL.Query().Get("since")
+	}
+	since, err := parseSince(resumeFrom)
+	if err != nil {
+		http.Error(w, "error parsing Last-Event-ID: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// stream events until the client goes away
+	if err := ctx.Notifier.Stream(w, r, messages.IDString(state.User.ID), sid.String(), since); err != nil {
+		http.Error(w, "error streaming events: "+err.Error(), http.StatusInternalServerError)
+	}
+}
 
+// parseSince parses the sequence number a client wants to resume from, nil if it is empty
+func parseSince(value string) (*uint64, error) {
+	if len(value) == 0 {
+		return nil, nil
+	}
+	since, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &since, nil
 }
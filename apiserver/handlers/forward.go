@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/events"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
+)
+
+// messageForwardHandler handles requests to /v1/messages/<message-id>/forward
+// and allows a user to (POST) share a message they can see into another
+// channel they are a member of, with an optional comment
+func (ctx *Context) messageForwardHandler(w http.ResponseWriter, r *http.Request, state *SessionState, mID string) {
+	if r.Method != "POST" {
+		http.Error(w, "request method must be POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// decode the request body into a ForwardMessage struct
+	decoder := json.NewDecoder(r.Body)
+	forward := &messages.ForwardMessage{}
+	if err := decoder.Decode(forward); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	// get the original message and make sure the user can see it
+	original, err := ctx.MessageStore.GetMessageByID(mID)
+	if err != nil {
+		http.Error(w, "error forwarding message: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	source, err := ctx.MessageStore.GetChannelByID(original.ChannelID)
+	if err != nil {
+		http.Error(w, "error forwarding message: "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	if !source.CanView(state.User.ID) {
+		http.Error(w, "error forwarding message: "+messages.ErrUnauthorized.Error(),
+			http.StatusForbidden)
+		return
+	}
+
+	// validate the new message
+	newMessage := forward.ToNewMessage(original)
+	if err := newMessage.Validate(); err != nil {
+		http.Error(w, "error validating message: "+err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+
+	// insert the message, the store checks the user is a member of the target channel
+	message, err := ctx.MessageStore.InsertMessage(newMessage, state.User)
+	if err == messages.ErrUnauthorized {
+		http.Error(w, "error forwarding message: "+err.Error(),
+			http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, "error forwarding message: "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	ctx.resolveMarkup(message)
+
+	ctx.notifyChannel(&events.NewMessage{Message: redactedForEvent(message)}, message.ChannelID)
+
+	// the user could see the original, so respond with the whole message
+	Respond(w, message, contentTypeJSONUTF8)
+}
+
+// redactedForEvent returns a copy of the message that is safe to send as an event.
+// Events go out to everyone, so they never carry a forwarded body,
+// clients that can see the source channel can GET the message for it.
+func redactedForEvent(message *messages.Message) *messages.Message {
+	if message.Forward == nil {
+		return message
+	}
+	event := *message
+	forward := *message.Forward
+	forward.Redact()
+	event.Forward = &forward
+	return &event
+}
+
+// redactForwards hides the original body of any forwarded messages
+// that were shared from a channel the user can't see
+func (ctx *Context) redactForwards(user *users.User, msgs ...*messages.Message) {
+	// remember which channels the user can see, since a page of messages
+	// will often contain several forwards from the same channel
+	canView := map[string]bool{}
+	for _, m := range msgs {
+		if m.Forward == nil {
+			continue
+		}
+		cID := messages.IDString(m.Forward.ChannelID)
+		visible, checked := canView[cID]
+		if !checked {
+			// if the source channel is gone there is no one left who can see it
+			channel, err := ctx.MessageStore.GetChannelByID(m.Forward.ChannelID)
+			visible = err == nil && channel.CanView(user.ID)
+			canView[cID] = visible
+		}
+		if !visible {
+			m.Forward.Redact()
+		}
+	}
+}
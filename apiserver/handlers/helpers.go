@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/aethanol/challenges-aethanol/apiserver/events"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
 	"github.com/aethanol/challenges-aethanol/apiserver/sessions"
 )
 
@@ -18,25 +21,104 @@ func Respond(w http.ResponseWriter, data interface{}, contentType string) {
 }
 
 func (ctx *Context) authenticated(w http.ResponseWriter, r *http.Request) (*SessionState, error) {
+	state, _, err := ctx.authenticatedSession(w, r)
+	return state, err
+}
+
+// authenticatedSession is authenticated for handlers that also need the ID of the session,
+// such as the event streams, whose connections are closed when the session ends
+func (ctx *Context) authenticatedSession(w http.ResponseWriter, r *http.Request) (*SessionState, sessions.SessionID, error) {
 	// Get the session state
 	state := &SessionState{}
 
 	// get the state of the browser that is accessing their page
-	_, err := sessions.GetState(r, ctx.SessionKey, ctx.SessionStore, &state)
+	sid, err := sessions.GetState(r, ctx.SessionKey, ctx.SessionStore, &state)
 	if err != nil {
 		// http.Error(w, "error getting session state "+err.Error(),
 		// 	http.StatusUnauthorized)
-		return nil, errors.New(http.StatusText(http.StatusUnauthorized))
+		return nil, sessions.InvalidSessionID, errors.New(http.StatusText(http.StatusUnauthorized))
 	}
-	return state, nil
+	return state, sid, nil
 }
 
-func (ctx *Context) notify(dType string, data interface{}) {
+// notify sends an event with the payload to everyone's websocket connections
+func (ctx *Context) notify(data events.Payload) {
 	// create a new event so we can add it to the notifications queue
-	event := &events.Event{
-		Type: dType,
-		Data: data,
-	}
+	event := events.New(data)
+
+	ctx.Notifier.Notify(event)
+}
+
+// notifyUsers sends an event only to the websocket connections of the given users
+func (ctx *Context) notifyUsers(data events.Payload, userIDs ...string) {
+	event := events.New(data)
+	event.UserIDs = userIDs
 
 	ctx.Notifier.Notify(event)
 }
+
+// notifyChannel sends an event only to the websocket connections of the users
+// who can see the channel, as well as any other users given
+func (ctx *Context) notifyChannel(data events.Payload, channelID interface{}, userIDs ...string) {
+	event := events.New(data)
+	event.ChannelID = messages.IDString(channelID)
+	event.UserIDs = userIDs
+
+	ctx.Notifier.Notify(event)
+}
+
+// etag formats a channel or message version as an ETag header value
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// ifMatchVersion returns the version from the request's If-Match header,
+// or 0 if the header is missing or is * so the write is unconditional
+func ifMatchVersion(r *http.Request) (int, error) {
+	match := strings.TrimSpace(r.Header.Get(headerIfMatch))
+	if len(match) == 0 || match == "*" {
+		return 0, nil
+	}
+	// we only ever hand out a single ETag so a weak one is the same thing
+	match = strings.TrimPrefix(match, "W/")
+	version, err := strconv.Atoi(strings.Trim(match, `"`))
+	if err != nil || version < 1 {
+		return 0, errors.New("invalid If-Match header")
+	}
+	return version, nil
+}
+
+// statusError is an error from an action shared by the REST and websocket
+// handlers, along with the HTTP status it should be reported with
+type statusError struct {
+	status int
+	msg    string
+}
+
+func newStatusError(status int, msg string) *statusError {
+	return &statusError{status: status, msg: msg}
+}
+
+func (e *statusError) Error() string {
+	return e.msg
+}
+
+// writeStatus picks the status to respond with for a store write error,
+// a stale If-Match is a failed precondition rather than the usual status
+func writeStatus(err error, status int) int {
+	if err == messages.ErrVersionMismatch {
+		return http.StatusPreconditionFailed
+	}
+	return status
+}
+
+// splitResource splits a path like /v1/channels/<id>/<sub-resource>
+// into the resource id and the sub-resource, which is empty when the
+// path only names the resource itself
+func splitResource(urlPath string, prefix string) (string, string) {
+	parts := strings.SplitN(strings.Trim(strings.TrimPrefix(urlPath, prefix), "/"), "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestIfMatchVersion(t *testing.T) {
+	cases := []struct {
+		header   string
+		expected int
+		valid    bool
+	}{
+		{header: "", expected: 0, valid: true},
+		{header: "*", expected: 0, valid: true},
+		{header: `"3"`, expected: 3, valid: true},
+		{header: `W/"12"`, expected: 12, valid: true},
+		{header: "7", expected: 7, valid: true},
+		{header: `"abc"`, valid: false},
+		{header: `"0"`, valid: false},
+	}
+
+	for _, c := range cases {
+		req, err := http.NewRequest("PATCH", "/v1/messages/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(c.header) > 0 {
+			req.Header.Set(headerIfMatch, c.header)
+		}
+		version, err := ifMatchVersion(req)
+		if c.valid && err != nil {
+			t.Errorf("unexpected error for If-Match `%s`: %v", c.header, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("expected error for If-Match `%s`", c.header)
+		}
+		if c.valid && version != c.expected {
+			t.Errorf("incorrect version for If-Match `%s`: expected %d but got %d", c.header, c.expected, version)
+		}
+	}
+
+	if actual := etag(4); actual != `"4"` {
+		t.Errorf("incorrect ETag: expected `\"4\"` but got `%s`", actual)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected uint64
+		resume   bool
+		valid    bool
+	}{
+		{value: "", valid: true},
+		{value: "0", expected: 0, resume: true, valid: true},
+		{value: "42", expected: 42, resume: true, valid: true},
+		{value: "-1", valid: false},
+		{value: "abc", valid: false},
+	}
+
+	for _, c := range cases {
+		since, err := parseSince(c.value)
+		if c.valid != (err == nil) {
+			t.Errorf("since `%s`: expected valid to be %t but got error %v", c.value, c.valid, err)
+			continue
+		}
+		if c.resume != (since != nil) || (since != nil && *since != c.expected) {
+			t.Errorf("since `%s`: expected %d (resume %t) but got %v", c.value, c.expected, c.resume, since)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/events"
+	"github.com/aethanol/challenges-aethanol/apiserver/hooks"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
+)
+
+// maxHookPayloadSize is the largest body a tool can POST to an incoming webhook
+const maxHookPayloadSize = 64 << 10
+
+// ownedChannel gets the channel and checks the user is its owner,
+// the only user who may manage its incoming webhooks
+func (ctx *Context) ownedChannel(state *SessionState, cID string) (*messages.Channel, *statusError) {
+	channel, serr := ctx.viewableChannel(state, cID)
+	if serr != nil {
+		return nil, serr
+	}
+	if messages.IDString(channel.CreatorID) != messages.IDString(state.User.ID) {
+		return nil, newStatusError(http.StatusForbidden, "only the channel owner can manage its webhooks")
+	}
+	return channel, nil
+}
+
+// channelHooksHandler handles requests to /v1/channels/<channel-id>/hooks and
+// allows the channel owner to (GET) get the channel's incoming webhooks and
+// (POST) create a new one. The new hook's token is only shown in the POST response.
+func (ctx *Context) channelHooksHandler(w http.ResponseWriter, r *http.Request, state *SessionState, cID string) {
+	if _, serr := ctx.ownedChannel(state, cID); serr != nil {
+		http.Error(w, "error getting channel: "+serr.Error(), serr.status)
+		return
+	}
+
+	switch r.Method {
+	// get the channel's hooks, without their tokens
+	case "GET":
+		hs, err := ctx.HookStore.GetByChannel(cID)
+		if err != nil {
+			http.Error(w, "error getting hooks: "+err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+		for _, hook := range hs {
+			hook.Token = ""
+		}
+		Respond(w, hs, contentTypeJSONUTF8)
+	// create a new hook
+	case "POST":
+		decoder := json.NewDecoder(r.Body)
+		nh := &hooks.NewHook{}
+		if err := decoder.Decode(nh); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := nh.Validate(); err != nil {
+			http.Error(w, "error creating hook: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		hook, err := nh.ToHook(cID, messages.IDString(state.User.ID))
+		if err != nil {
+			http.Error(w, "error creating hook: "+err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+		if err := ctx.HookStore.Insert(hook); err != nil {
+			http.Error(w, "error creating hook: "+err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+		Respond(w, hook, contentTypeJSONUTF8)
+	}
+}
+
+// channelHookHandler handles requests to /v1/channels/<channel-id>/hooks/<hook-id>
+// and allows the channel owner to (DELETE) revoke the hook
+func (ctx *Context) channelHookHandler(w http.ResponseWriter, r *http.Request, state *SessionState, cID string, hookID string) {
+	if r.Method != "DELETE" {
+		http.Error(w, "request method must be DELETE", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, serr := ctx.ownedChannel(state, cID); serr != nil {
+		http.Error(w, "error getting channel: "+serr.Error(), serr.status)
+		return
+	}
+
+	// make sure the hook posts into this channel
+	hook, err := ctx.HookStore.Get(hookID)
+	if err == nil && hook.ChannelID != cID {
+		err = hooks.ErrHookNotFound
+	}
+	if err == hooks.ErrHookNotFound {
+		http.Error(w, "error revoking hook: "+err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "error revoking hook: "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	if err := ctx.HookStore.Delete(hookID); err != nil {
+		http.Error(w, "error revoking hook: "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	io.WriteString(w, "hook revoked\n")
+}
+
+// IncomingHookHandler handles requests to /v1/hooks/<token>. It needs no session,
+// the token is the credential. It (POST)s a message into the hook's channel from
+// a JSON payload with `text`, an optional `username` to post under instead of the
+// hook's name, and `attachments`. The message is inserted as the hook creator's
+// with a bot author, and sent to the channel as a "new message" event.
+func (ctx *Context) IncomingHookHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "request method must be POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// look up the hook from the token in the URL
+	token := strings.Trim(strings.TrimPrefix(r.URL.Path, apiHooks), "/")
+	hook, err := ctx.HookStore.GetByToken(token)
+	if err == hooks.ErrHookNotFound {
+		http.Error(w, "error posting to hook: "+err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "error posting to hook: "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	// decode the request body into a Payload struct
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxHookPayloadSize))
+	payload := &hooks.Payload{}
+	if err := decoder.Decode(payload); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	newMessage := payload.ToNewMessage(hook)
+	if err := newMessage.Validate(); err != nil {
+		http.Error(w, "error validating message: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the creator must still be able to post to the channel
+	message, err := ctx.MessageStore.InsertMessage(newMessage, &users.User{ID: hook.CreatorID})
+	if err == messages.ErrUnauthorized {
+		http.Error(w, "error posting to hook: the hook's creator is no longer a member of the channel",
+			http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, "error inserting message: "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	// notify the clients of the new message
+	ctx.resolveMarkup(message)
+	ctx.notifyChannel(&events.NewMessage{Message: message}, message.ChannelID)
+	Respond(w, message, contentTypeJSONUTF8)
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/hooks"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
+)
+
+func TestIncomingHooks(t *testing.T) {
+	ctx := newCommandsContext(t)
+	ctx.HookStore = hooks.NewMemStore()
+	owner := &users.User{ID: "owner"}
+	member := &users.User{ID: "member"}
+	channel, err := ctx.MessageStore.InsertChannel(&messages.NewChannel{Name: "builds"}, owner)
+	if err != nil {
+		t.Fatalf("error inserting channel: %v", err)
+	}
+	cID := messages.IDString(channel.ID)
+	if err := ctx.MessageStore.AddUserToChannel(member.ID, channel.ID, owner.ID); err != nil {
+		t.Fatalf("error adding member: %v", err)
+	}
+
+	manage := func(user *users.User, method string, path string, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest(method, apiSpecificChannel+cID+"/"+path, strings.NewReader(body))
+		if hook := strings.TrimPrefix(path, "hooks/"); hook != path {
+			ctx.channelHookHandler(rr, r, &SessionState{User: user}, cID, hook)
+		} else {
+			ctx.channelHooksHandler(rr, r, &SessionState{User: user}, cID)
+		}
+		return rr
+	}
+	post := func(token string, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		ctx.IncomingHookHandler(rr, httptest.NewRequest("POST", apiHooks+token, strings.NewReader(body)))
+		return rr
+	}
+
+	// only the channel owner can create hooks
+	if rr := manage(member, "POST", "hooks", `{"name": "CI"}`); rr.Code != http.StatusForbidden {
+		t.Errorf("expected a member creating a hook to be forbidden but got %d", rr.Code)
+	}
+	rr := manage(owner, "POST", "hooks", `{"name": "CI"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected creating a hook to succeed but got %d: %s", rr.Code, rr.Body)
+	}
+	hook := &hooks.Hook{}
+	json.Unmarshal(rr.Body.Bytes(), hook)
+	if len(hook.Token) == 0 {
+		t.Fatal("expected the new hook's token in the response")
+	}
+
+	// the token is only shown once
+	rr = manage(owner, "GET", "hooks", "")
+	listed := []*hooks.Hook{}
+	json.Unmarshal(rr.Body.Bytes(), &listed)
+	if len(listed) != 1 || listed[0].ID != hook.ID || len(listed[0].Token) != 0 {
+		t.Errorf("expected the hook to be listed without its token but got %s", rr.Body)
+	}
+
+	// posting needs no session
+	rr = post(hook.Token, `{"text": "build *passed*", "username": "Jenkins", "attachments": [{"title": "#12", "titleLink": "https://ci.example.com/12"}]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected posting to the hook to succeed but got %d: %s", rr.Code, rr.Body)
+	}
+	recent, err := ctx.MessageStore.GetRecentMessages(channel.ID, owner, 10)
+	if err != nil || len(recent) != 1 {
+		t.Fatalf("expected 1 message in the channel but got %d, %v", len(recent), err)
+	}
+	m := recent[0]
+	if m.Body != "build *passed*" || m.Bot == nil || m.Bot.Name != "Jenkins" || m.Bot.HookID != hook.ID || len(m.Attachments) != 1 {
+		t.Errorf("expected a bot message with an attachment but got %+v", m)
+	}
+	if messages.IDString(m.CreatorID) != "owner" {
+		t.Errorf("expected the message to be created by the hook's creator but got %v", m.CreatorID)
+	}
+
+	cases := []struct {
+		name     string
+		token    string
+		body     string
+		expected int
+	}{
+		{"unknown token", "nope", `{"text": "hi"}`, http.StatusNotFound},
+		{"no token", "", `{"text": "hi"}`, http.StatusNotFound},
+		{"invalid JSON", hook.Token, `{"text":`, http.StatusBadRequest},
+		{"empty", hook.Token, `{}`, http.StatusBadRequest},
+		{"bad attachment", hook.Token, `{"attachments": [{"imageURL": "javascript:x"}]}`, http.StatusBadRequest},
+		{"too large", hook.Token, `{"text": "` + strings.Repeat("a", maxHookPayloadSize) + `"}`, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		if rr := post(c.token, c.body); rr.Code != c.expected {
+			t.Errorf("%s: expected %d but got %d: %s", c.name, c.expected, rr.Code, rr.Body)
+		}
+	}
+
+	// only the owner can revoke, and a revoked token stops working
+	if rr := manage(member, "DELETE", "hooks/"+hook.ID, ""); rr.Code != http.StatusForbidden {
+		t.Errorf("expected a member revoking a hook to be forbidden but got %d", rr.Code)
+	}
+	if rr := manage(owner, "DELETE", "hooks/"+hook.ID, ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected revoking the hook to succeed but got %d: %s", rr.Code, rr.Body)
+	}
+	if rr := post(hook.Token, `{"text": "hi"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("expected posting to a revoked hook to be not found but got %d", rr.Code)
+	}
+	if rr := manage(owner, "DELETE", "hooks/"+hook.ID, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected revoking twice to be not found but got %d", rr.Code)
+	}
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+)
+
+// resolveMarkup fills in the display names of any mentions and public channel
+// references in the message blocks, and sets the plain text fallback
+// that is sent along with notifications
+func (ctx *Context) resolveMarkup(message *messages.Message) {
+	// messages posted before we parsed markup won't have any blocks
+	if message.Blocks == nil {
+		message.Blocks = messages.ParseMarkup(message.Body)
+	}
+
+	messages.WalkBlocks(message.Blocks, func(b *messages.Block) {
+		// leave any label the author gave alone
+		if len(b.Text) > 0 {
+			return
+		}
+		switch b.Type {
+		case messages.BlockMention:
+			if user, err := ctx.UserStore.GetByID(b.ID); err == nil {
+				b.Text = user.UserName
+			}
+		case messages.BlockChannel:
+			// everyone who can read the message sees the blocks, so
+			// only fill in the names of channels anyone can see
+			if channel, err := ctx.MessageStore.GetChannelByID(b.ID); err == nil && !channel.Private {
+				b.Text = channel.Name
+			}
+		}
+	})
+	message.PlainText = messages.RenderPlainText(message.Blocks)
+}
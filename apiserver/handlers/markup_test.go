@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
+)
+
+func TestResolveMarkup(t *testing.T) {
+	ctx := newCommandsContext(t)
+	owner := &users.User{ID: "owner"}
+	public, err := ctx.MessageStore.InsertChannel(&messages.NewChannel{Name: "random"}, owner)
+	if err != nil {
+		t.Fatalf("error inserting channel: %v", err)
+	}
+	private, err := ctx.MessageStore.InsertChannel(&messages.NewChannel{Name: "secret-plans", Private: true}, owner)
+	if err != nil {
+		t.Fatalf("error inserting channel: %v", err)
+	}
+
+	// the private channel's name isn't shown to everyone who can read the message
+	message := &messages.Message{Body: "see <#" + messages.IDString(public.ID) + "> and <#" + messages.IDString(private.ID) + ">"}
+	ctx.resolveMarkup(message)
+	if message.PlainText != "see #random and #"+messages.IDString(private.ID) {
+		t.Errorf("expected only the public channel's name to be filled in but got %q", message.PlainText)
+	}
+
+	// references that aren't channel IDs are left as they are
+	message = &messages.Message{Body: "hi <#general>"}
+	ctx.resolveMarkup(message)
+	if message.PlainText != "hi #general" {
+		t.Errorf("expected a non-ID channel reference to be left alone but got %q", message.PlainText)
+	}
+}
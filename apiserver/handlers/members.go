@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+	"github.com/aethanol/challenges-aethanol/apiserver/presence"
+)
+
+// limits on the page size when listing channel members
+const (
+	defaultMembersLimit = 50
+	maxMembersLimit     = 200
+)
+
+// MembersPage is a page of channel members along with the total number
+// of members that matched, so clients know whether to ask for more
+type MembersPage struct {
+	Members []*messages.ChannelMember `json:"members"`
+	Total   int                       `json:"total"`
+	Offset  int                       `json:"offset"`
+	Limit   int                       `json:"limit"`
+}
+
+// channelMembersHandler handles requests to /v1/channels/<channel-id>/members
+// and allows a user to (GET) a page of the channel's members with their profiles,
+// sorted by user name. The query can contain `prefix` to only get members whose
+// names start with it (for mention autocomplete), and `offset` and `limit` to page.
+func (ctx *Context) channelMembersHandler(w http.ResponseWriter, r *http.Request, state *SessionState, cID string) {
+	if r.Method != "GET" {
+		http.Error(w, "method must be GET", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// get the paging parameters
+	query := r.URL.Query()
+	offset, limit := 0, defaultMembersLimit
+	if len(query.Get("offset")) > 0 {
+		n, err := strconv.Atoi(query.Get("offset"))
+		if err != nil || n < 0 {
+			http.Error(w, "error getting members: invalid offset", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+	if len(query.Get("limit")) > 0 {
+		n, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || n < 1 || n > maxMembersLimit {
+			http.Error(w, "error getting members: limit must be between 1 and "+strconv.Itoa(maxMembersLimit),
+				http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	// only members can see who is in a private channel
+	channel, err := ctx.MessageStore.GetChannelByID(cID)
+	if err == messages.ErrChannelNotFound {
+		http.Error(w, "error getting members: "+err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "error getting members: "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	if !channel.CanView(state.User.ID) {
+		http.Error(w, "error getting members: "+messages.ErrUnauthorized.Error(),
+			http.StatusForbidden)
+		return
+	}
+
+	// look up the profiles of all the members
+	ids := make([]interface{}, len(channel.Members))
+	for i, m := range channel.Members {
+		ids[i] = m
+	}
+	profiles, err := ctx.UserStore.GetByIDs(ids)
+	if err != nil {
+		http.Error(w, "error getting members: "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	// filter by the prefix before paging so the total is the number that matched
+	prefix := query.Get("prefix")
+	members := []*messages.ChannelMember{}
+	for _, u := range profiles {
+		m := channel.Member(u)
+		if m.MatchesPrefix(prefix) {
+			members = append(members, m)
+		}
+	}
+	messages.SortMembers(members)
+
+	page := &MembersPage{
+		Members: []*messages.ChannelMember{},
+		Total:   len(members),
+		Offset:  offset,
+		Limit:   limit,
+	}
+	if offset < len(members) {
+		end := offset + limit
+		if end > len(members) {
+			end = len(members)
+		}
+		page.Members = members[offset:end]
+	}
+	// only look up presence for the members we are sending back
+	memberIDs := make([]string, len(page.Members))
+	for i, m := range page.Members {
+		memberIDs[i] = messages.IDString(m.ID)
+	}
+	presences, err := ctx.Presence.Get(memberIDs...)
+	if err != nil {
+		http.Error(w, "error getting members: "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	for i, m := range page.Members {
+		m.Online = presences[i].Status != presence.StatusOffline
+		m.Status = presences[i].Status
+		m.LastSeenAt = presences[i].LastSeenAt
+	}
+
+	Respond(w, page, contentTypeJSONUTF8)
+}
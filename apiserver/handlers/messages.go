@@ -3,12 +3,13 @@ package handlers
 import (
 	"encoding/json"
 	"io"
+	"log"
 	"net/http"
 
-	"path"
-
+	"github.com/aethanol/challenges-aethanol/apiserver/drafts"
+	"github.com/aethanol/challenges-aethanol/apiserver/events"
+	"github.com/aethanol/challenges-aethanol/apiserver/idempotency"
 	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
-	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
 )
 
 // ChannelsHandler allows a user to (GET) their valid channels and (POST) add a channel to the store
@@ -62,7 +63,7 @@ func (ctx *Context) ChannelsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// notify the clients of the new channel
-		ctx.notify("new channel", channel)
+		ctx.notifyChannel(&events.NewChannel{Channel: channel}, channel.ID)
 		// write the channel to the user
 		Respond(w, channel, contentTypeJSONUTF8)
 	}
@@ -76,8 +77,37 @@ func (ctx *Context) SpecificChannelHandler(w http.ResponseWriter, r *http.Reques
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
-	// get the channelID
-	_, cID := path.Split(r.URL.Path)
+	// get the channelID and hand sub-resources off to their own handlers
+	cID, sub := splitResource(r.URL.Path, apiSpecificChannel)
+	switch sub {
+	case "":
+	case "draft":
+		ctx.channelDraftHandler(w, r, state, cID)
+		return
+	case "members":
+		ctx.channelMembersHandler(w, r, state, cID)
+		return
+	case "analytics":
+		ctx.channelAnalyticsHandler(w, r, state, cID)
+		return
+	case "read":
+		ctx.channelReadHandler(w, r, state, cID)
+		return
+	case "typing":
+		ctx.channelTypingHandler(w, r, state, cID)
+		return
+	case "hooks":
+		ctx.channelHooksHandler(w, r, state, cID)
+		return
+	default:
+		// hooks/<hook-id> is a single incoming webhook
+		if resource, hookID := splitResource(sub, ""); resource == "hooks" {
+			ctx.channelHookHandler(w, r, state, cID, hookID)
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
 	switch r.Method {
 	// get the most recent 500 recent messages of a specific channel
 	case "GET":
@@ -87,11 +117,26 @@ func (ctx *Context) SpecificChannelHandler(w http.ResponseWriter, r *http.Reques
 			http.Error(w, "Error getting messages: "+err.Error(), http.StatusForbidden)
 			return
 		}
+		ctx.redactForwards(state.User, messages...)
+
+		// tag the response with the channel version so it can be sent back in If-Match
+		channel, err := ctx.MessageStore.GetChannelByID(cID)
+		if err != nil {
+			http.Error(w, "Error getting messages: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(headerETag, etag(channel.Version))
 
 		// Write the messages to the user
 		Respond(w, messages, contentTypeJSONUTF8)
 	// update the specified channel if the current user is the channel creator
 	case "PATCH":
+		// get the version the client last saw
+		version, err := ifMatchVersion(r)
+		if err != nil {
+			http.Error(w, "error updating channel: "+err.Error(), http.StatusPreconditionFailed)
+			return
+		}
 		// Decode the request body into a messages.ChannelUpdate struct
 		decoder := json.NewDecoder(r.Body)
 		updates := &messages.ChannelUpdates{}
@@ -99,13 +144,14 @@ func (ctx *Context) SpecificChannelHandler(w http.ResponseWriter, r *http.Reques
 			http.Error(w, "invalid JSON", http.StatusBadRequest)
 			return
 		}
+		updates.Version = version
 
 		// update the channel with the channelID, the updates and the current user
-		err := ctx.MessageStore.UpdateChannel(updates, cID, state.User)
+		err = ctx.MessageStore.UpdateChannel(updates, cID, state.User)
 		// if we got an error write it back to the user that they are unauthorized
 		if err != nil {
 			http.Error(w, "error updating channel: "+err.Error(),
-				http.StatusForbidden)
+				writeStatus(err, http.StatusForbidden))
 			return
 		}
 		// write the updated channel back to the user
@@ -117,19 +163,46 @@ func (ctx *Context) SpecificChannelHandler(w http.ResponseWriter, r *http.Reques
 		}
 
 		// notify the clients of the updated channel
-		ctx.notify("updated channel", channel)
+		ctx.notifyChannel(&events.ChannelUpdate{Channel: channel}, channel.ID)
 
 		// respond
+		w.Header().Set(headerETag, etag(channel.Version))
 		Respond(w, channel, contentTypeJSONUTF8)
 	// delete the channel specified
 	case "DELETE":
-		// delete the channel and check the id
-		err := ctx.MessageStore.DeleteChannel(cID, state.User)
+		// get the version the client last saw
+		version, err := ifMatchVersion(r)
+		if err != nil {
+			http.Error(w, "error deleting channel: "+err.Error(), http.StatusPreconditionFailed)
+			return
+		}
+		// get the channel first so we know who to tell it was deleted
+		channel, err := ctx.MessageStore.GetChannelByID(cID)
 		if err != nil {
 			http.Error(w, "error deleting channel: "+err.Error(),
 				http.StatusForbidden)
 			return
 		}
+		// delete the channel and check the id
+		err = ctx.MessageStore.DeleteChannel(cID, state.User, version)
+		if err != nil {
+			http.Error(w, "error deleting channel: "+err.Error(),
+				writeStatus(err, http.StatusForbidden))
+			return
+		}
+		// the channel is gone, so stop routing its events
+		// and tell whoever could see it directly
+		ctx.Notifier.ChannelChanged(messages.IDString(cID))
+		deleted := &events.ChannelDelete{ChannelID: channel.ID}
+		if channel.Private {
+			members := make([]string, 0, len(channel.Members))
+			for _, m := range channel.Members {
+				members = append(members, messages.IDString(m))
+			}
+			ctx.notifyUsers(deleted, members...)
+		} else {
+			ctx.notify(deleted)
+		}
 		// otherwise respond with a simple message that the channel was deleted
 		io.WriteString(w, "channel deleted\n")
 	// add a user to a channel
@@ -144,14 +217,9 @@ func (ctx *Context) SpecificChannelHandler(w http.ResponseWriter, r *http.Reques
 				return
 			}
 			// notify the clients of the new user joining the channel
-			d := struct {
-				UserID    users.UserID       `json:"userid"`
-				ChannelID messages.ChannelID `json:"channelid"`
-			}{
-				headLink,
-				cID,
-			}
-			ctx.notify("user joined", d)
+			d := &events.UserJoin{UserID: headLink, ChannelID: cID}
+			ctx.Notifier.Joined(messages.IDString(cID), headLink)
+			ctx.notifyChannel(d, cID)
 
 			// user is adding themselves to a channel
 		} else {
@@ -161,14 +229,9 @@ func (ctx *Context) SpecificChannelHandler(w http.ResponseWriter, r *http.Reques
 				return
 			}
 			// notify the clients of the new user joining the channel
-			d := struct {
-				UserID    users.UserID       `json:"userid"`
-				ChannelID messages.ChannelID `json:"channelid"`
-			}{
-				state.User.ID,
-				cID,
-			}
-			ctx.notify("user joined", d)
+			d := &events.UserJoin{UserID: state.User.ID, ChannelID: cID}
+			ctx.Notifier.Joined(messages.IDString(cID), messages.IDString(state.User.ID))
+			ctx.notifyChannel(d, cID)
 		}
 
 		// otherwise respond with a simple message that the channel was deleted
@@ -179,37 +242,28 @@ func (ctx *Context) SpecificChannelHandler(w http.ResponseWriter, r *http.Reques
 		headLink := r.Header.Get("Link")
 		// case where someone is adding a user to a channel
 		if len(headLink) != 0 {
-			if err := ctx.MessageStore.AddUserToChannel(headLink, cID, state.User.ID); err != nil {
-				http.Error(w, "error linking user: "+err.Error(),
+			if err := ctx.MessageStore.RemoveUserFromChannel(headLink, cID, state.User.ID); err != nil {
+				http.Error(w, "error unlinking user: "+err.Error(),
 					http.StatusForbidden)
 				return
 			}
-			// notify the clients of the new user joining the channel
-			d := struct {
-				UserID    users.UserID       `json:"userid"`
-				ChannelID messages.ChannelID `json:"channelid"`
-			}{
-				headLink,
-				cID,
-			}
-			ctx.notify("user left", d)
+			// notify the channel and the user who left
+			d := &events.UserLeft{UserID: headLink, ChannelID: cID}
+			ctx.Notifier.Left(messages.IDString(cID), headLink)
+			ctx.notifyChannel(d, cID, headLink)
 
 			// user is adding themselves to a channel
 		} else {
-			if err := ctx.MessageStore.AddUserToChannel(state.User.ID, cID, state.User.ID); err != nil {
-				http.Error(w, "error linking user: "+err.Error(),
+			if err := ctx.MessageStore.RemoveUserFromChannel(state.User.ID, cID, state.User.ID); err != nil {
+				http.Error(w, "error unlinking user: "+err.Error(),
 					http.StatusForbidden)
 				return
 			}
-			// notify the clients of the new user joining the channel
-			d := struct {
-				UserID    users.UserID       `json:"userid"`
-				ChannelID messages.ChannelID `json:"channelid"`
-			}{
-				state.User.ID,
-				cID,
-			}
-			ctx.notify("user left", d)
+			// notify the channel and the user who left
+			d := &events.UserLeft{UserID: state.User.ID, ChannelID: cID}
+			userID := messages.IDString(state.User.ID)
+			ctx.Notifier.Left(messages.IDString(cID), userID)
+			ctx.notifyChannel(d, cID, userID)
 		}
 		// otherwise respond with a simple message that the channel was deleted
 		io.WriteString(w, "user removed from channel\n")
@@ -236,35 +290,89 @@ func (ctx *Context) MessagesHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// validate the message
-		if err := newMessage.Validate(); err != nil {
-			http.Error(w, "error validating message: "+err.Error(),
-				http.StatusBadRequest)
+		// retries carry the same Idempotency-Key header or nonce as the original request
+		key := r.Header.Get(headerIdempotencyKey)
+		message, serr := ctx.postMessage(state, newMessage, key)
+		if serr != nil {
+			http.Error(w, serr.Error(), serr.status)
 			return
 		}
 
-		// insert the message to the store and check if it was
-		message, err := ctx.MessageStore.InsertMessage(newMessage, state.User)
-		if err == messages.ErrUnauthorized {
-			http.Error(w, "Error adding message: "+err.Error(),
-				http.StatusForbidden)
-			return
+		// write the message to the user
+		Respond(w, message, contentTypeJSONUTF8)
+	}
+}
+
+// postMessage validates the new message and inserts it, for both the REST and
+// websocket APIs. Retries carry the same idempotency key or nonce as the original,
+// so they get back the message the original created instead of a second one.
+func (ctx *Context) postMessage(state *SessionState, newMessage *messages.NewMessage, key string) (*messages.Message, *statusError) {
+	// validate the message
+	if err := newMessage.Validate(); err != nil {
+		return nil, newStatusError(http.StatusBadRequest, "error validating message: "+err.Error())
+	}
+
+	userID := messages.IDString(state.User.ID)
+	if len(key) == 0 {
+		key = newMessage.Nonce
+	} else if len(newMessage.Nonce) == 0 {
+		newMessage.Nonce = key
+	}
+	if len(key) > idempotency.MaxKeyLength {
+		return nil, newStatusError(http.StatusBadRequest, "error validating message: idempotency key is too long")
+	}
+	if len(key) > 0 {
+		messageID, err := ctx.IdempotencyStore.Reserve(userID, key)
+		if err == idempotency.ErrInProgress {
+			return nil, newStatusError(http.StatusConflict, "error adding message: "+err.Error())
 		} else if err != nil {
-			http.Error(w, "error inserting message: "+err.Error(),
-				http.StatusInternalServerError)
-			return
+			return nil, newStatusError(http.StatusInternalServerError, "error adding message: "+err.Error())
 		}
+		if len(messageID) > 0 {
+			message, err := ctx.MessageStore.GetMessageByID(messageID)
+			if err != nil {
+				return nil, newStatusError(http.StatusNotFound, "error getting message: "+err.Error())
+			}
+			ctx.resolveMarkup(message)
+			return message, nil
+		}
+	}
 
-		// notify the clients of the new message
-		ctx.notify("new message", message)
+	// insert the message to the store and check if it was
+	message, err := ctx.MessageStore.InsertMessage(newMessage, state.User)
+	if err != nil && len(key) > 0 {
+		// nothing was created so let the client retry with the same key
+		ctx.IdempotencyStore.Release(userID, key)
+	}
+	if err == messages.ErrUnauthorized {
+		return nil, newStatusError(http.StatusForbidden, "Error adding message: "+err.Error())
+	} else if err != nil {
+		return nil, newStatusError(http.StatusInternalServerError, "error inserting message: "+err.Error())
+	}
+	if len(key) > 0 {
+		if err := ctx.IdempotencyStore.Complete(userID, key, messages.IDString(message.ID)); err != nil {
+			// don't leave the key reserved, so retries aren't turned away until the lease is up
+			log.Printf("error saving idempotency key: %v", err)
+			ctx.IdempotencyStore.Release(userID, key)
+		}
+	}
 
-		// write the message to the user
-		Respond(w, message, contentTypeJSONUTF8)
+	// notify the clients of the new message
+	ctx.resolveMarkup(message)
+	ctx.notifyChannel(&events.NewMessage{Message: message}, message.ChannelID)
+
+	// the message has been sent so the user is done typing
+	// and their draft for the channel is done with
+	channelID := messages.IDString(message.ChannelID)
+	ctx.Notifier.StoppedTyping(channelID, userID)
+	if err := ctx.DraftStore.Delete(userID, channelID); err == nil {
+		ctx.notifyUsers(&events.DraftUpdate{Draft: &drafts.Draft{ChannelID: channelID}}, userID)
 	}
+	return message, nil
 }
 
-// SpecificMessageHandler handles all requests made to the /v1/messages/<message-id> (PATCH) updates messages
-// (DELETE) deletes messages authed
+// SpecificMessageHandler handles all requests made to the /v1/messages/<message-id> (GET) gets a message
+// rendered as JSON, HTML or plain text, (PATCH) updates messages (DELETE) deletes messages authed
 func (ctx *Context) SpecificMessageHandler(w http.ResponseWriter, r *http.Request) {
 	// check the authentication
 	state, err := ctx.authenticated(w, r)
@@ -272,11 +380,63 @@ func (ctx *Context) SpecificMessageHandler(w http.ResponseWriter, r *http.Reques
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
-	// get the message id
-	_, mID := path.Split(r.URL.Path)
+	// get the message id and hand sub-resources off to their own handlers
+	mID, sub := splitResource(r.URL.Path, apiSpecificMessage)
+	switch sub {
+	case "":
+	case "votes":
+		ctx.messageVotesHandler(w, r, state, mID)
+		return
+	case "forward":
+		ctx.messageForwardHandler(w, r, state, mID)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
 	switch r.Method {
+	// get a message if the user can see the channel it was posted to
+	case "GET":
+		message, err := ctx.MessageStore.GetMessageByID(mID)
+		if err != nil {
+			http.Error(w, "error getting message: "+err.Error(),
+				http.StatusNotFound)
+			return
+		}
+		channel, err := ctx.MessageStore.GetChannelByID(message.ChannelID)
+		if err != nil {
+			http.Error(w, "error getting message: "+err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+		if !channel.CanView(state.User.ID) {
+			http.Error(w, "error getting message: "+messages.ErrUnauthorized.Error(),
+				http.StatusForbidden)
+			return
+		}
+
+		// respond with the format the client asked for, JSON by default
+		w.Header().Set(headerETag, etag(message.Version))
+		ctx.redactForwards(state.User, message)
+		ctx.resolveMarkup(message)
+		switch r.URL.Query().Get("format") {
+		case "html":
+			w.Header().Add(headerContentType, contentTypeHTMLUTF8)
+			io.WriteString(w, messages.RenderHTML(message.Blocks))
+		case "text":
+			w.Header().Add(headerContentType, contentTypeTextUTF8)
+			io.WriteString(w, message.PlainText)
+		default:
+			Respond(w, message, contentTypeJSONUTF8)
+		}
 	// allow a user to update a specified message if they are the creator
 	case "PATCH":
+		// get the version the client last saw
+		version, err := ifMatchVersion(r)
+		if err != nil {
+			http.Error(w, "error updating message: "+err.Error(), http.StatusPreconditionFailed)
+			return
+		}
 		// Decode the request body into a messages.MessageUpdate struct
 		decoder := json.NewDecoder(r.Body)
 		updates := &messages.MessageUpdates{}
@@ -284,42 +444,67 @@ func (ctx *Context) SpecificMessageHandler(w http.ResponseWriter, r *http.Reques
 			http.Error(w, "invalid JSON", http.StatusBadRequest)
 			return
 		}
+		updates.Version = version
 
-		// update the message with the channelID, the updates and the current user
-		err := ctx.MessageStore.UpdateMessage(updates, mID, state.User)
-		// if we got an error write it back to the user that they are unauthorized
-		if err != nil {
-			http.Error(w, "error updating message: "+err.Error(),
-				http.StatusForbidden)
-			return
-		}
-		// write the updated message back to the user
-		message, err := ctx.MessageStore.GetMessageByID(mID)
-		if err != nil {
-			http.Error(w, "error updating message: "+err.Error(),
-				http.StatusInternalServerError)
+		// update the message and let the clients know
+		message, serr := ctx.editMessage(state, mID, updates)
+		if serr != nil {
+			http.Error(w, serr.Error(), serr.status)
 			return
 		}
 
-		// notify the clients of the message update
-		ctx.notify("message update", message)
-
 		// respond
+		w.Header().Set(headerETag, etag(message.Version))
+		ctx.redactForwards(state.User, message)
 		Respond(w, message, contentTypeJSONUTF8)
 
 	// allow a user to delete a message if they are the message creator
 	case "DELETE":
-		// delete the message and check the id
-		err := ctx.MessageStore.DeleteMessage(mID, state.User)
+		// get the version the client last saw
+		version, err := ifMatchVersion(r)
+		if err != nil {
+			http.Error(w, "error deleting message: "+err.Error(), http.StatusPreconditionFailed)
+			return
+		}
+		// get the message's channel first so we know who to tell it was deleted
+		message, err := ctx.MessageStore.GetMessageByID(mID)
 		if err != nil {
 			http.Error(w, "error deleting message: "+err.Error(),
 				http.StatusForbidden)
 			return
 		}
+		// delete the message and check the id
+		err = ctx.MessageStore.DeleteMessage(mID, state.User, version)
+		if err != nil {
+			http.Error(w, "error deleting message: "+err.Error(),
+				writeStatus(err, http.StatusForbidden))
+			return
+		}
 
 		// notify the clients of the message update
-		ctx.notify("message deleted", mID)
+		ctx.notifyChannel(&events.MessageDelete{MessageID: message.ID, ChannelID: message.ChannelID}, message.ChannelID)
 		// otherwise respond with a simple message that the message was deleted
 		io.WriteString(w, "message deleted\n")
 	}
 }
+
+// editMessage updates a message if the user is its creator and the updates
+// are based on its current version, for both the REST and websocket APIs
+func (ctx *Context) editMessage(state *SessionState, mID interface{}, updates *messages.MessageUpdates) (*messages.Message, *statusError) {
+	// update the message with the channelID, the updates and the current user
+	err := ctx.MessageStore.UpdateMessage(updates, mID, state.User)
+	// if we got an error write it back to the user that they are unauthorized
+	if err != nil {
+		return nil, newStatusError(writeStatus(err, http.StatusForbidden), "error updating message: "+err.Error())
+	}
+	// get the updated message to send back to the user
+	message, err := ctx.MessageStore.GetMessageByID(mID)
+	if err != nil {
+		return nil, newStatusError(http.StatusInternalServerError, "error updating message: "+err.Error())
+	}
+
+	// notify the clients of the message update
+	ctx.resolveMarkup(message)
+	ctx.notifyChannel(&events.MessageUpdate{Message: redactedForEvent(message)}, message.ChannelID)
+	return message, nil
+}
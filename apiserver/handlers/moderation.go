@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/events"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+)
+
+// bulk message actions
+const (
+	bulkActionDelete = "delete"
+	bulkActionMove   = "move"
+)
+
+// bulkBatchSize is how many messages a bulk job deletes or moves at a time
+const bulkBatchSize = 100
+
+// BulkMessageOperation is a moderator request to delete or move
+// all of the messages that match a query
+type BulkMessageOperation struct {
+	Action          string                 `json:"action"`
+	Query           *messages.MessageQuery `json:"query"`
+	TargetChannelID messages.ChannelID     `json:"targetChannelID,omitempty"`
+}
+
+// BulkMessageResult is the result of a bulk job, and is also the data
+// of the single event that is sent to clients when the job is done
+type BulkMessageResult struct {
+	Action          string               `json:"action"`
+	MessageIDs      []messages.MessageID `json:"messageIDs"`
+	ChannelIDs      []string             `json:"channelIDs"`
+	TargetChannelID messages.ChannelID   `json:"targetChannelID,omitempty"`
+}
+
+// Validate validates the bulk operation
+func (op *BulkMessageOperation) Validate() error {
+	if op.Action != bulkActionDelete && op.Action != bulkActionMove {
+		return errors.New("Error: action must be delete or move")
+	}
+	if op.Action == bulkActionMove && op.TargetChannelID == nil {
+		return errors.New("Error: no target channel specified")
+	}
+	if op.Query == nil {
+		return errors.New("Error: no query specified")
+	}
+	return op.Query.Validate()
+}
+
+// ModerationHandler handles requests to /v1/moderation/messages to (POST) start
+// a bulk delete or move of messages, and /v1/moderation/jobs/<job-id> to (GET)
+// check the progress of a bulk job. Only moderators may use it.
+func (ctx *Context) ModerationHandler(w http.ResponseWriter, r *http.Request) {
+	// check the authentication
+	state, err := ctx.authenticated(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !ctx.isModerator(state) {
+		http.Error(w, "user is not a moderator", http.StatusForbidden)
+		return
+	}
+
+	resource, id := splitResource(r.URL.Path, apiModeration)
+	switch {
+	case resource == "messages" && id == "":
+		if r.Method != "POST" {
+			http.Error(w, "request method must be POST", http.StatusMethodNotAllowed)
+			return
+		}
+		// decode the request body into a BulkMessageOperation struct
+		decoder := json.NewDecoder(r.Body)
+		op := &BulkMessageOperation{}
+		if err := decoder.Decode(op); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := op.Validate(); err != nil {
+			http.Error(w, "error validating operation: "+err.Error(),
+				http.StatusBadRequest)
+			return
+		}
+		// make sure the target channel exists before starting a move,
+		// so a bad target fails the request instead of the job
+		if op.Action == bulkActionMove {
+			_, err := ctx.MessageStore.GetChannelByID(op.TargetChannelID)
+			if err == messages.ErrChannelNotFound {
+				http.Error(w, "error getting target channel: "+err.Error(), http.StatusNotFound)
+				return
+			} else if err != nil {
+				http.Error(w, "error getting target channel: "+err.Error(),
+					http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// start the job and let it run in the background
+		job, err := ctx.Jobs.Start("bulk "+op.Action, messages.IDString(state.User.ID))
+		if err != nil {
+			http.Error(w, "error starting job: "+err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+		go ctx.runBulkMessageJob(job.ID, op)
+
+		// respond with the job so the client can check its progress
+		w.Header().Add(headerContentType, contentTypeJSONUTF8)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job)
+	case resource == "jobs" && id != "":
+		if r.Method != "GET" {
+			http.Error(w, "request method must be GET", http.StatusMethodNotAllowed)
+			return
+		}
+		job, err := ctx.Jobs.Get(id)
+		if err != nil {
+			http.Error(w, "error getting job: "+err.Error(), http.StatusNotFound)
+			return
+		}
+		Respond(w, job, contentTypeJSONUTF8)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// runBulkMessageJob finds the messages matching the operation's query and
+// deletes or moves them in batches, reporting progress to the job registry.
+// Clients get one event for the whole job instead of one per message.
+func (ctx *Context) runBulkMessageJob(jobID string, op *BulkMessageOperation) {
+	refs, err := ctx.MessageStore.FindMessageRefs(op.Query)
+	if err != nil {
+		ctx.Jobs.Finish(jobID, nil, err)
+		return
+	}
+	ctx.Jobs.SetTotal(jobID, len(refs))
+
+	result := &BulkMessageResult{
+		Action:          op.Action,
+		MessageIDs:      []messages.MessageID{},
+		ChannelIDs:      []string{},
+		TargetChannelID: op.TargetChannelID,
+	}
+	channels := map[string]bool{}
+	for start := 0; start < len(refs); start += bulkBatchSize {
+		end := start + bulkBatchSize
+		if end > len(refs) {
+			end = len(refs)
+		}
+		ids := make([]messages.MessageID, 0, end-start)
+		for _, ref := range refs[start:end] {
+			ids = append(ids, ref.ID)
+			if cID := messages.IDString(ref.ChannelID); !channels[cID] {
+				channels[cID] = true
+				result.ChannelIDs = append(result.ChannelIDs, cID)
+			}
+		}
+
+		if op.Action == bulkActionDelete {
+			_, err = ctx.MessageStore.DeleteMessages(ids)
+		} else {
+			_, err = ctx.MessageStore.MoveMessages(ids, op.TargetChannelID)
+		}
+		if err != nil {
+			break
+		}
+		result.MessageIDs = append(result.MessageIDs, ids...)
+		ctx.Jobs.Progress(jobID, len(ids))
+	}
+
+	// let the clients know about whatever was done, even if the job failed part way,
+	// each channel's audience only hears about that channel's messages
+	if len(result.MessageIDs) > 0 {
+		ctx.notifyBulkResult(refs, result)
+	}
+	ctx.Jobs.Finish(jobID, result, err)
+}
+
+// notifyBulkResult sends an event for each channel the job changed messages in,
+// to the users who can see that channel. Moves are also sent to the target channel.
+func (ctx *Context) notifyBulkResult(refs []*messages.MessageRef, result *BulkMessageResult) {
+	done := make(map[string]bool, len(result.MessageIDs))
+	for _, id := range result.MessageIDs {
+		done[messages.IDString(id)] = true
+	}
+	byChannel := map[string][]messages.MessageID{}
+	for _, ref := range refs {
+		if done[messages.IDString(ref.ID)] {
+			cID := messages.IDString(ref.ChannelID)
+			byChannel[cID] = append(byChannel[cID], ref.ID)
+		}
+	}
+
+	for _, cID := range result.ChannelIDs {
+		if len(byChannel[cID]) == 0 {
+			continue
+		}
+		if result.Action == bulkActionDelete {
+			ctx.notifyChannel(&events.MessagesDelete{MessageIDs: byChannel[cID], ChannelIDs: []string{cID}}, cID)
+		} else {
+			ctx.notifyChannel(&events.MessagesMove{
+				MessageIDs:      byChannel[cID],
+				ChannelIDs:      []string{cID},
+				TargetChannelID: result.TargetChannelID,
+			}, cID)
+		}
+	}
+	// the target channel's audience can see all the moved messages now,
+	// but not which channels they came from
+	if result.Action != bulkActionDelete {
+		ctx.notifyChannel(&events.MessagesMove{
+			MessageIDs:      result.MessageIDs,
+			ChannelIDs:      []string{},
+			TargetChannelID: result.TargetChannelID,
+		}, result.TargetChannelID)
+	}
+}
+
+// isModerator reports whether the user is allowed to use the moderation APIs
+func (ctx *Context) isModerator(state *SessionState) bool {
+	userID := messages.IDString(state.User.ID)
+	for _, id := range ctx.Moderators {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
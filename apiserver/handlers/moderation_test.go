@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/jobs"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
+	"github.com/aethanol/challenges-aethanol/apiserver/sessions"
+)
+
+func TestModerationMoveTarget(t *testing.T) {
+	ctx := newCommandsContext(t)
+	ctx.SessionKey = "supersecret"
+	ctx.SessionStore = sessions.NewMemStore(-1)
+	ctx.Jobs = jobs.NewRegistry(-1)
+	ctx.Moderators = []string{"moderator"}
+
+	// begin a session for the moderator
+	rr := httptest.NewRecorder()
+	state := &SessionState{User: &users.User{ID: "moderator"}}
+	if _, err := sessions.BeginSession(ctx.SessionKey, ctx.SessionStore, state, rr); err != nil {
+		t.Fatalf("error beginning session: %v", err)
+	}
+	auth := rr.Header().Get("Authorization")
+
+	// a move to a target that isn't a channel fails before any job is started
+	for _, target := range []string{`"not-a-channel"`, `"0123456789abcdef01234567"`} {
+		body := `{"action": "move", "targetChannelID": ` + target + `, "query": {"creatorID": "someone"}}`
+		req := httptest.NewRequest("POST", apiModeration+"messages", strings.NewReader(body))
+		req.Header.Add("Authorization", auth)
+		rr := httptest.NewRecorder()
+		ctx.ModerationHandler(rr, req)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected %d moving to %s but got %d: %s", http.StatusNotFound, target, rr.Code, rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/events"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+)
+
+// messageVotesHandler handles requests to /v1/messages/<message-id>/votes
+// and allows channel members to (POST) cast or change their vote on a poll.
+// The new results are sent to clients as a "poll updated" event.
+func (ctx *Context) messageVotesHandler(w http.ResponseWriter, r *http.Request, state *SessionState, mID string) {
+	if r.Method != "POST" {
+		http.Error(w, "request method must be POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// decode the request body into a Vote struct
+	decoder := json.NewDecoder(r.Body)
+	vote := &messages.Vote{}
+	if err := decoder.Decode(vote); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	// cast the vote and check why it failed if it did
+	message, err := ctx.MessageStore.CastVote(mID, state.User, vote)
+	switch err {
+	case nil:
+	case messages.ErrMessageNotFound:
+		http.Error(w, "error voting: "+err.Error(), http.StatusNotFound)
+		return
+	case messages.ErrUnauthorized:
+		http.Error(w, "error voting: "+err.Error(), http.StatusForbidden)
+		return
+	case messages.ErrPollClosed:
+		http.Error(w, "error voting: "+err.Error(), http.StatusConflict)
+		return
+	case messages.ErrNotAPoll, messages.ErrSingleChoice, messages.ErrNoSuchOption, messages.ErrOptionRepeated:
+		http.Error(w, "error voting: "+err.Error(), http.StatusBadRequest)
+		return
+	default:
+		http.Error(w, "error casting vote: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// notify the clients of the new results
+	ctx.notifyChannel(&events.PollUpdate{Message: message}, message.ChannelID)
+
+	// respond with the updated poll
+	Respond(w, message, contentTypeJSONUTF8)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
+	"github.com/aethanol/challenges-aethanol/apiserver/presence"
+)
+
+// maxPresenceIDs is the most users whose presence can be asked for at once
+const maxPresenceIDs = 100
+
+// PresenceUpdates is the status a user chooses for themselves,
+// away or dnd, or empty to go back to their automatic status
+type PresenceUpdates struct {
+	Status string `json:"status"`
+}
+
+// PresenceHandler handles requests to /v1/users/presence and allows a user to
+// (GET) get the presence of the users in the comma separated `ids` query parameter
+// and (PUT) choose their own status. Changes are sent as "presence changed" events.
+func (ctx *Context) PresenceHandler(w http.ResponseWriter, r *http.Request) {
+	// check the authentication
+	state, err := ctx.authenticated(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	// get the presence of the users asked for
+	case "GET":
+		ids := []string{}
+		for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+			if id = strings.TrimSpace(id); len(id) > 0 {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) == 0 || len(ids) > maxPresenceIDs {
+			http.Error(w, "error getting presence: ids must list between 1 and 100 user IDs",
+				http.StatusBadRequest)
+			return
+		}
+		presences, err := ctx.Presence.Get(ids...)
+		if err != nil {
+			http.Error(w, "error getting presence: "+err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+		Respond(w, presences, contentTypeJSONUTF8)
+	// choose the user's own status
+	case "PUT":
+		decoder := json.NewDecoder(r.Body)
+		updates := &PresenceUpdates{}
+		if err := decoder.Decode(updates); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		userID := messages.IDString(state.User.ID)
+		if err := ctx.Presence.SetOverride(userID, updates.Status); err == presence.ErrInvalidStatus {
+			http.Error(w, "error setting presence: "+err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, "error setting presence: "+err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+		presences, err := ctx.Presence.Get(userID)
+		if err != nil {
+			http.Error(w, "error getting presence: "+err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+		Respond(w, presences[0], contentTypeJSONUTF8)
+	default:
+		http.Error(w, "request method must be GET or PUT", http.StatusMethodNotAllowed)
+	}
+}
+
+// addLastSeen fills in when each of the users was last active from the presence store,
+// a failure only leaves it out since it isn't worth failing the request over
+func (ctx *Context) addLastSeen(profiles ...*users.User) {
+	if len(profiles) == 0 {
+		return
+	}
+	ids := make([]string, len(profiles))
+	for i, u := range profiles {
+		ids[i] = messages.IDString(u.ID)
+	}
+	presences, err := ctx.Presence.Get(ids...)
+	if err != nil {
+		return
+	}
+	for i, p := range presences {
+		profiles[i].LastSeenAt = p.LastSeenAt
+	}
+}
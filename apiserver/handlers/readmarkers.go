@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/events"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+	"github.com/aethanol/challenges-aethanol/apiserver/readmarkers"
+)
+
+// channelReadHandler handles requests to /v1/channels/<channel-id>/read
+// and allows a user to (GET) get the last message they read in the channel
+// and (PUT) mark the channel as read up to a message. Changes are sent as
+// "channel read" events to the user's other connections.
+func (ctx *Context) channelReadHandler(w http.ResponseWriter, r *http.Request, state *SessionState, cID string) {
+	userID := messages.IDString(state.User.ID)
+	switch r.Method {
+	// get the user's read marker for the channel
+	case "GET":
+		marker, err := ctx.ReadMarkerStore.Get(userID, cID)
+		if err == readmarkers.ErrMarkerNotFound {
+			http.Error(w, "error getting read marker: "+err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "error getting read marker: "+err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+		Respond(w, marker, contentTypeJSONUTF8)
+	// mark the channel as read up to a message
+	case "PUT":
+		// decode the request body into a MarkerUpdates struct
+		decoder := json.NewDecoder(r.Body)
+		updates := &readmarkers.MarkerUpdates{}
+		if err := decoder.Decode(updates); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		marker, err := ctx.markRead(state, cID, updates)
+		if err != nil {
+			http.Error(w, err.Error(), err.status)
+			return
+		}
+		Respond(w, marker, contentTypeJSONUTF8)
+	default:
+		http.Error(w, "request method must be GET or PUT", http.StatusMethodNotAllowed)
+	}
+}
+
+// markRead marks the channel as read up to the message, for both the
+// REST and websocket APIs. The message must be in a channel the user can see.
+func (ctx *Context) markRead(state *SessionState, cID string, updates *readmarkers.MarkerUpdates) (*readmarkers.Marker, *statusError) {
+	channel, serr := ctx.viewableChannel(state, cID)
+	if serr != nil {
+		return nil, newStatusError(serr.status, "error marking channel read: "+serr.Error())
+	}
+	message, err := ctx.MessageStore.GetMessageByID(updates.MessageID)
+	if err != nil {
+		return nil, newStatusError(http.StatusBadRequest, "error marking channel read: "+err.Error())
+	}
+	if messages.IDString(message.ChannelID) != messages.IDString(channel.ID) {
+		return nil, newStatusError(http.StatusBadRequest, "error marking channel read: the message isn't in the channel")
+	}
+
+	userID := messages.IDString(state.User.ID)
+	marker := &readmarkers.Marker{
+		ChannelID: messages.IDString(channel.ID),
+		MessageID: messages.IDString(message.ID),
+		ReadAt:    time.Now(),
+	}
+	if err := ctx.ReadMarkerStore.Save(userID, marker); err != nil {
+		return nil, newStatusError(http.StatusInternalServerError, "error marking channel read: "+err.Error())
+	}
+
+	// let the user's other devices clear the channel
+	ctx.notifyUsers(&events.ChannelRead{Marker: marker}, userID)
+	return marker, nil
+}
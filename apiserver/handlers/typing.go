@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+)
+
+// channelTypingHandler handles requests to /v1/channels/<channel-id>/typing
+// and allows a user to (POST) say they are typing in the channel. The other
+// users in the channel get a "user typing" event, and another when the user
+// stops, so clients should POST again while the user keeps typing.
+func (ctx *Context) channelTypingHandler(w http.ResponseWriter, r *http.Request, state *SessionState, cID string) {
+	if r.Method != "POST" {
+		http.Error(w, "request method must be POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := ctx.typing(state, cID); err != nil {
+		http.Error(w, err.Error(), err.status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// typing marks the user as typing in the channel, for both the REST
+// and websocket APIs. Only members of the channel, who can post in it,
+// can type in it.
+func (ctx *Context) typing(state *SessionState, cID string) *statusError {
+	channel, err := ctx.viewableChannel(state, cID)
+	if err != nil {
+		return newStatusError(err.status, "error sending typing: "+err.Error())
+	}
+	if !channel.IsMember(state.User.ID) {
+		return newStatusError(http.StatusForbidden, "error sending typing: "+messages.ErrUnauthorized.Error())
+	}
+	ctx.Notifier.Typing(messages.IDString(channel.ID), messages.IDString(state.User.ID))
+	return nil
+}
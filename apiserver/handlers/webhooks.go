@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+	"github.com/aethanol/challenges-aethanol/apiserver/webhooks"
+)
+
+// WebhooksHandler handles requests to /v1/webhooks and allows a user to
+// (GET) get the webhooks they subscribed and (POST) subscribe a new one.
+// The new webhook's secret is only ever shown in the POST response.
+func (ctx *Context) WebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	// check the authentication
+	state, err := ctx.authenticated(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	userID := messages.IDString(state.User.ID)
+
+	switch r.Method {
+	// get the user's webhooks, without their secrets
+	case "GET":
+		subs, err := ctx.WebhookStore.GetByOwner(userID)
+		if err != nil {
+			http.Error(w, "error getting webhooks: "+err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+		for _, sub := range subs {
+			sub.Secret = ""
+		}
+		Respond(w, subs, contentTypeJSONUTF8)
+	// subscribe a new webhook
+	case "POST":
+		// decode the request body into a NewSubscription struct
+		decoder := json.NewDecoder(r.Body)
+		ns := &webhooks.NewSubscription{}
+		if err := decoder.Decode(ns); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := ns.Validate(); err != nil {
+			http.Error(w, "error subscribing webhook: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// only allow webhooks for channels the user can see
+		for _, cID := range ns.ChannelIDs {
+			if _, serr := ctx.viewableChannel(state, cID); serr != nil {
+				http.Error(w, "error subscribing webhook: "+serr.Error(), serr.status)
+				return
+			}
+		}
+
+		sub, err := ns.ToSubscription(userID)
+		if err != nil {
+			http.Error(w, "error subscribing webhook: "+err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+		if err := ctx.WebhookStore.Insert(sub); err != nil {
+			http.Error(w, "error subscribing webhook: "+err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+		Respond(w, sub, contentTypeJSONUTF8)
+	}
+}
+
+// SpecificWebhookHandler handles requests to /v1/webhooks/<webhook-id> and
+// allows the user who subscribed the webhook to (GET) get it and (DELETE)
+// unsubscribe it. /v1/webhooks/<webhook-id>/deliveries gets its latest delivery
+// attempts and /v1/webhooks/<webhook-id>/deadletters the deliveries that ran out
+// of attempts. Other users' webhooks are not found.
+func (ctx *Context) SpecificWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	// check the authentication
+	state, err := ctx.authenticated(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// get the webhook and make sure it's the user's
+	id, resource := splitResource(r.URL.Path, apiSpecificWebhook)
+	sub, err := ctx.WebhookStore.Get(id)
+	if err == nil && sub.OwnerID != messages.IDString(state.User.ID) {
+		err = webhooks.ErrSubscriptionNotFound
+	}
+	if err == webhooks.ErrSubscriptionNotFound {
+		http.Error(w, "error getting webhook: "+err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "error getting webhook: "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	switch resource {
+	case "":
+	case "deliveries":
+		if r.Method != "GET" {
+			http.Error(w, "request method must be GET", http.StatusMethodNotAllowed)
+			return
+		}
+		attempts, err := ctx.WebhookStore.Attempts(id)
+		if err != nil {
+			http.Error(w, "error getting deliveries: "+err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+		Respond(w, attempts, contentTypeJSONUTF8)
+		return
+	case "deadletters":
+		if r.Method != "GET" {
+			http.Error(w, "request method must be GET", http.StatusMethodNotAllowed)
+			return
+		}
+		letters, err := ctx.WebhookStore.DeadLetters(id)
+		if err != nil {
+			http.Error(w, "error getting dead letters: "+err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+		Respond(w, letters, contentTypeJSONUTF8)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	// get the webhook, without its secret
+	case "GET":
+		sub.Secret = ""
+		Respond(w, sub, contentTypeJSONUTF8)
+	// unsubscribe the webhook
+	case "DELETE":
+		if err := ctx.WebhookStore.Delete(id); err != nil {
+			http.Error(w, "error deleting webhook: "+err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, "webhook deleted\n")
+	}
+}
@@ -0,0 +1,95 @@
+//Package hooks keeps the incoming webhooks that let tools such as CI
+//and monitoring post into a channel without a user session. Each hook
+//belongs to one channel and is called with a secret token in its URL.
+package hooks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+)
+
+//ErrHookNotFound is returned when there is no hook with the ID or token
+var ErrHookNotFound = errors.New("hook not found")
+
+//Hook is an incoming webhook that posts into a channel
+type Hook struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channelID"`
+	//CreatorID is the channel owner who created the hook, the messages
+	//posted through it are inserted as theirs with a bot author
+	CreatorID string `json:"creatorID"`
+	//Name is the bot name messages are posted under, unless overridden
+	Name string `json:"name"`
+	//Token is the secret part of the hook's URL, it is only shown when the hook is created
+	Token     string    `json:"token,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+//NewHook represents a new incoming webhook
+type NewHook struct {
+	Name string `json:"name"`
+}
+
+//Validate validates the new hook
+func (nh *NewHook) Validate() error {
+	if len(nh.Name) == 0 || len([]rune(nh.Name)) > messages.MaxBotNameLength {
+		return errors.New("name must be between 1 and 80 characters")
+	}
+	return nil
+}
+
+//ToHook returns the hook for the channel, created by the user,
+//with a new ID and token
+func (nh *NewHook) ToHook(channelID string, creatorID string) (*Hook, error) {
+	id, err := randomHex(12)
+	if err != nil {
+		return nil, err
+	}
+	token, err := randomHex(24)
+	if err != nil {
+		return nil, err
+	}
+	return &Hook{
+		ID:        id,
+		ChannelID: channelID,
+		CreatorID: creatorID,
+		Name:      nh.Name,
+		Token:     token,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+//Payload is what tools POST to a hook
+type Payload struct {
+	Text string `json:"text"`
+	//Username overrides the hook's name for this message
+	Username    string                 `json:"username,omitempty"`
+	Attachments []*messages.Attachment `json:"attachments,omitempty"`
+}
+
+//ToNewMessage converts the payload to a message from the hook's bot
+func (p *Payload) ToNewMessage(hook *Hook) *messages.NewMessage {
+	name := hook.Name
+	if len(p.Username) > 0 {
+		name = p.Username
+	}
+	return &messages.NewMessage{
+		ChannelID:   hook.ChannelID,
+		Body:        p.Text,
+		Bot:         &messages.BotAuthor{HookID: hook.ID, Name: name},
+		Attachments: p.Attachments,
+	}
+}
+
+//randomHex returns n random bytes as hex
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,85 @@
+package hooks
+
+import (
+	"sort"
+	"sync"
+)
+
+//MemStore represents an in-memory hooks store.
+//This should be used only for testing and prototyping.
+//Production systems should use a shared server store like redis
+type MemStore struct {
+	hooks map[string]*Hook
+	mu    sync.RWMutex
+}
+
+//NewMemStore constructs and returns a new MemStore
+func NewMemStore() *MemStore {
+	return &MemStore{
+		hooks: make(map[string]*Hook),
+	}
+}
+
+//Store implementation
+
+//Insert saves a new hook
+func (ms *MemStore) Insert(hook *Hook) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	copied := *hook
+	ms.hooks[hook.ID] = &copied
+	return nil
+}
+
+//Get returns the hook with the ID, or ErrHookNotFound
+func (ms *MemStore) Get(id string) (*Hook, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	hook, found := ms.hooks[id]
+	if !found {
+		return nil, ErrHookNotFound
+	}
+	copied := *hook
+	return &copied, nil
+}
+
+//GetByToken returns the hook with the token, or ErrHookNotFound
+func (ms *MemStore) GetByToken(token string) (*Hook, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	for _, hook := range ms.hooks {
+		if hook.Token == token {
+			copied := *hook
+			return &copied, nil
+		}
+	}
+	return nil, ErrHookNotFound
+}
+
+//GetByChannel returns the hooks that post into the channel, oldest first
+func (ms *MemStore) GetByChannel(channelID string) ([]*Hook, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	hooks := []*Hook{}
+	for _, hook := range ms.hooks {
+		if hook.ChannelID == channelID {
+			copied := *hook
+			hooks = append(hooks, &copied)
+		}
+	}
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].CreatedAt.Before(hooks[j].CreatedAt)
+	})
+	return hooks, nil
+}
+
+//Delete revokes the hook, its token stops working straight away
+func (ms *MemStore) Delete(id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, found := ms.hooks[id]; !found {
+		return ErrHookNotFound
+	}
+	delete(ms.hooks, id)
+	return nil
+}
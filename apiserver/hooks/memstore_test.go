@@ -0,0 +1,80 @@
+package hooks
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMemStore(t *testing.T) {
+	store := NewMemStore()
+
+	nh := &NewHook{Name: "CI"}
+	if err := nh.Validate(); err != nil {
+		t.Fatalf("error validating hook: %v", err)
+	}
+	hook, err := nh.ToHook("channel1", "user1")
+	if err != nil {
+		t.Fatalf("error creating hook: %v", err)
+	}
+	if len(hook.ID) == 0 || len(hook.Token) == 0 || hook.ID == hook.Token {
+		t.Fatalf("expected the hook to get an ID and a separate token but got %+v", hook)
+	}
+	if err := store.Insert(hook); err != nil {
+		t.Fatalf("error inserting hook: %v", err)
+	}
+
+	h2, err := store.GetByToken(hook.Token)
+	if err != nil {
+		t.Fatalf("error getting hook by token: %v", err)
+	}
+	if h2.ID != hook.ID || h2.ChannelID != "channel1" || h2.CreatorID != "user1" {
+		t.Errorf("incorrect hook: expected %+v but got %+v", hook, h2)
+	}
+	if _, err := store.Get(hook.ID); err != nil {
+		t.Errorf("error getting hook: %v", err)
+	}
+	if _, err := store.GetByToken(hook.ID); err != ErrHookNotFound {
+		t.Errorf("expected ErrHookNotFound getting by the ID as a token but got %v", err)
+	}
+
+	if hooks, _ := store.GetByChannel("channel1"); len(hooks) != 1 {
+		t.Errorf("expected 1 hook for the channel but got %d", len(hooks))
+	}
+	if hooks, _ := store.GetByChannel("channel2"); len(hooks) != 0 {
+		t.Errorf("expected no hooks for another channel but got %d", len(hooks))
+	}
+
+	// revoking a hook stops its token working
+	if err := store.Delete(hook.ID); err != nil {
+		t.Fatalf("error deleting hook: %v", err)
+	}
+	if _, err := store.GetByToken(hook.Token); err != ErrHookNotFound {
+		t.Errorf("expected ErrHookNotFound after delete but got %v", err)
+	}
+	if err := store.Delete(hook.ID); err != ErrHookNotFound {
+		t.Errorf("expected ErrHookNotFound deleting twice but got %v", err)
+	}
+}
+
+func TestPayloadToNewMessage(t *testing.T) {
+	hook := &Hook{ID: "hook1", ChannelID: "channel1", Name: "CI"}
+
+	nm := (&Payload{Text: "build passed"}).ToNewMessage(hook)
+	if nm.ChannelID != "channel1" || nm.Body != "build passed" || nm.Bot.Name != "CI" || nm.Bot.HookID != "hook1" {
+		t.Errorf("incorrect message from payload: %+v %+v", nm, nm.Bot)
+	}
+
+	// the username overrides the hook's name
+	nm = (&Payload{Text: "deployed", Username: "Deploy Bot"}).ToNewMessage(hook)
+	if nm.Bot.Name != "Deploy Bot" {
+		t.Errorf("expected the username to override the name but got %s", nm.Bot.Name)
+	}
+	nm = (&Payload{Text: "hi", Username: strings.Repeat("a", 81)}).ToNewMessage(hook)
+	if err := nm.Validate(); err == nil {
+		t.Error("expected a too long username to be invalid")
+	}
+
+	if err := (&NewHook{}).Validate(); err == nil {
+		t.Error("expected a hook without a name to be invalid")
+	}
+}
@@ -0,0 +1,116 @@
+package hooks
+
+import (
+	"encoding/json"
+
+	"gopkg.in/redis.v5"
+)
+
+//the prefixes of the keys we keep hooks in. They keep hook
+//keys separate from other keys in the shared redis key namespace.
+const (
+	//each hook, as JSON
+	redisHookPrefix = "hook:"
+	//the ID of the hook with each token
+	redisTokenPrefix = "hook:token:"
+	//a set of the IDs of the hooks that post into each channel
+	redisChannelPrefix = "hook:channel:"
+)
+const defaultAddr = "127.0.0.1:6379"
+
+//RedisStore represents a hooks.Store backed by redis.
+type RedisStore struct {
+	//Redis client used to talk to redis server.
+	Client *redis.Client
+}
+
+//NewRedisStore constructs a new RedisStore, using the provided client.
+//If the `client` is nil, it will be set to redis.NewClient()
+//pointing at a local redis instance.
+func NewRedisStore(client *redis.Client) *RedisStore {
+	if client == nil {
+		client = redis.NewClient(&redis.Options{
+			Addr: defaultAddr,
+		})
+	}
+	return &RedisStore{
+		Client: client,
+	}
+}
+
+//Store implementation
+
+//Insert saves a new hook
+func (rs *RedisStore) Insert(hook *Hook) error {
+	jbuf, err := json.Marshal(hook)
+	if err != nil {
+		return err
+	}
+	pipe := rs.Client.Pipeline()
+	pipe.Set(redisHookPrefix+hook.ID, jbuf, 0)
+	pipe.Set(redisTokenPrefix+hook.Token, hook.ID, 0)
+	pipe.SAdd(redisChannelPrefix+hook.ChannelID, hook.ID)
+	_, err = pipe.Exec()
+	return err
+}
+
+//Get returns the hook with the ID, or ErrHookNotFound
+func (rs *RedisStore) Get(id string) (*Hook, error) {
+	jbuf, err := rs.Client.Get(redisHookPrefix + id).Bytes()
+	if err == redis.Nil {
+		return nil, ErrHookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	hook := &Hook{}
+	if err := json.Unmarshal(jbuf, hook); err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+//GetByToken returns the hook with the token, or ErrHookNotFound
+func (rs *RedisStore) GetByToken(token string) (*Hook, error) {
+	id, err := rs.Client.Get(redisTokenPrefix + token).Result()
+	if err == redis.Nil {
+		return nil, ErrHookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rs.Get(id)
+}
+
+//GetByChannel returns the hooks that post into the channel
+func (rs *RedisStore) GetByChannel(channelID string) ([]*Hook, error) {
+	ids, err := rs.Client.SMembers(redisChannelPrefix + channelID).Result()
+	if err != nil {
+		return nil, err
+	}
+	hooks := []*Hook{}
+	for _, id := range ids {
+		hook, err := rs.Get(id)
+		if err == ErrHookNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+//Delete revokes the hook, its token stops working straight away
+func (rs *RedisStore) Delete(id string) error {
+	hook, err := rs.Get(id)
+	if err != nil {
+		return err
+	}
+	pipe := rs.Client.Pipeline()
+	pipe.Del(redisHookPrefix+id, redisTokenPrefix+hook.Token)
+	pipe.SRem(redisChannelPrefix+hook.ChannelID, id)
+	_, err = pipe.Exec()
+	return err
+}
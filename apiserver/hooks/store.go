@@ -0,0 +1,19 @@
+package hooks
+
+//Store represents a store of incoming webhooks
+type Store interface {
+	//Insert saves a new hook
+	Insert(hook *Hook) error
+
+	//Get returns the hook with the ID, or ErrHookNotFound
+	Get(id string) (*Hook, error)
+
+	//GetByToken returns the hook with the token, or ErrHookNotFound
+	GetByToken(token string) (*Hook, error)
+
+	//GetByChannel returns the hooks that post into the channel
+	GetByChannel(channelID string) ([]*Hook, error)
+
+	//Delete revokes the hook, its token stops working straight away
+	Delete(id string) error
+}
@@ -0,0 +1,58 @@
+package idempotency
+
+import (
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+//MemStore represents an in-memory idempotency store.
+//This should be used only for testing and prototyping.
+//Production systems should use a shared server store like redis
+type MemStore struct {
+	entries *cache.Cache
+}
+
+//NewMemStore constructs and returns a new MemStore
+func NewMemStore(keyDuration time.Duration) *MemStore {
+	if keyDuration < 0 {
+		keyDuration = DefaultKeyDuration
+	}
+	return &MemStore{
+		entries: cache.New(keyDuration, time.Minute),
+	}
+}
+
+//Store implementation
+
+//Reserve claims the key for the user. It returns an empty ID if the key
+//was free, the ID of the resource created with the key if it was already
+//used, or ErrInProgress if the request that claimed it hasn't completed.
+func (ms *MemStore) Reserve(userID string, key string) (string, error) {
+	skey := storeKey(userID, key)
+	// Add only succeeds if the key isn't already there
+	if err := ms.entries.Add(skey, "", LeaseDuration); err == nil {
+		return "", nil
+	}
+	id, found := ms.entries.Get(skey)
+	if !found {
+		return ms.Reserve(userID, key)
+	}
+	if len(id.(string)) == 0 {
+		return "", ErrInProgress
+	}
+	return id.(string), nil
+}
+
+//Complete records the ID of the resource created with the reserved key,
+//keeping it for the full key duration
+func (ms *MemStore) Complete(userID string, key string, resourceID string) error {
+	ms.entries.Set(storeKey(userID, key), resourceID, cache.DefaultExpiration)
+	return nil
+}
+
+//Release frees a reserved key, so that a failed request can be retried
+func (ms *MemStore) Release(userID string, key string) error {
+	ms.entries.Delete(storeKey(userID, key))
+	return nil
+}
@@ -0,0 +1,73 @@
+package idempotency
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemStore(t *testing.T) {
+	store := NewMemStore(-1)
+
+	// the first request gets the key
+	id, err := store.Reserve("user1", "key1")
+	if err != nil || len(id) != 0 {
+		t.Fatalf("expected to reserve a new key but got `%s`, %v", id, err)
+	}
+
+	// a retry while the first is still running is told to back off
+	if _, err := store.Reserve("user1", "key1"); err != ErrInProgress {
+		t.Errorf("expected ErrInProgress for a pending key but got %v", err)
+	}
+
+	// keys are per user
+	if id, err := store.Reserve("user2", "key1"); err != nil || len(id) != 0 {
+		t.Errorf("expected another user to reserve the same key but got `%s`, %v", id, err)
+	}
+
+	// once completed retries get the original ID
+	if err := store.Complete("user1", "key1", "message1"); err != nil {
+		t.Fatalf("error completing key: %v", err)
+	}
+	id, err = store.Reserve("user1", "key1")
+	if err != nil {
+		t.Fatalf("error reserving a completed key: %v", err)
+	}
+	if id != "message1" {
+		t.Errorf("incorrect ID for a completed key: expected `message1` but got `%s`", id)
+	}
+
+	// released keys can be used again
+	if _, err := store.Reserve("user1", "key2"); err != nil {
+		t.Fatalf("error reserving key: %v", err)
+	}
+	if err := store.Release("user1", "key2"); err != nil {
+		t.Fatalf("error releasing key: %v", err)
+	}
+	if id, err := store.Reserve("user1", "key2"); err != nil || len(id) != 0 {
+		t.Errorf("expected to reserve a released key but got `%s`, %v", id, err)
+	}
+}
+
+func TestMemStoreLease(t *testing.T) {
+	defer func(lease time.Duration) { LeaseDuration = lease }(LeaseDuration)
+	LeaseDuration = 10 * time.Millisecond
+	store := NewMemStore(-1)
+
+	// a key whose request never completed can be used again once the lease is up
+	if _, err := store.Reserve("user1", "key1"); err != nil {
+		t.Fatalf("error reserving key: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if id, err := store.Reserve("user1", "key1"); err != nil || len(id) != 0 {
+		t.Errorf("expected to reserve a key whose lease is up but got `%s`, %v", id, err)
+	}
+
+	// completed keys are kept for the key duration
+	if err := store.Complete("user1", "key1", "message1"); err != nil {
+		t.Fatalf("error completing key: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if id, err := store.Reserve("user1", "key1"); err != nil || id != "message1" {
+		t.Errorf("expected the completed key to outlast the lease but got `%s`, %v", id, err)
+	}
+}
@@ -0,0 +1,82 @@
+package idempotency
+
+import (
+	"time"
+
+	"gopkg.in/redis.v5"
+)
+
+//redisKeyPrefix is the prefix we will use for keys
+//related to idempotency keys. This keeps them separate
+//from other keys in the shared redis key namespace.
+const redisKeyPrefix = "idempotency:"
+const defaultAddr = "127.0.0.1:6379"
+
+//RedisStore represents an idempotency.Store backed by redis.
+type RedisStore struct {
+	//Redis client used to talk to redis server.
+	Client *redis.Client
+	//Used for key expiry time on redis.
+	KeyDuration time.Duration
+}
+
+//NewRedisStore constructs a new RedisStore, using the provided client and
+//key duration. If the `client` is nil, it will be set to redis.NewClient()
+//pointing at a local redis instance. If `keyDuration` is negative, it will
+//be set to `DefaultKeyDuration`.
+func NewRedisStore(client *redis.Client, keyDuration time.Duration) *RedisStore {
+	if client == nil {
+		client = redis.NewClient(&redis.Options{
+			Addr: defaultAddr,
+		})
+	}
+	if keyDuration < 0 {
+		keyDuration = DefaultKeyDuration
+	}
+	return &RedisStore{
+		Client:      client,
+		KeyDuration: keyDuration,
+	}
+}
+
+//Store implementation
+
+//Reserve claims the key for the user. It returns an empty ID if the key
+//was free, the ID of the resource created with the key if it was already
+//used, or ErrInProgress if the request that claimed it hasn't completed.
+func (rs *RedisStore) Reserve(userID string, key string) (string, error) {
+	rkey := redisKeyPrefix + storeKey(userID, key)
+	// SETNX makes sure only one of several concurrent retries gets the key,
+	// an empty value marks it as reserved but not yet completed. It is only
+	// held for the lease, Complete keeps it for the full key duration
+	reserved, err := rs.Client.SetNX(rkey, "", LeaseDuration).Result()
+	if err != nil {
+		return "", err
+	}
+	if reserved {
+		return "", nil
+	}
+	id, err := rs.Client.Get(rkey).Result()
+	if err == redis.Nil {
+		// it expired or was released between the two calls, try again
+		return rs.Reserve(userID, key)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(id) == 0 {
+		return "", ErrInProgress
+	}
+	return id, nil
+}
+
+//Complete records the ID of the resource created with the reserved key,
+//keeping it for the full key duration
+func (rs *RedisStore) Complete(userID string, key string, resourceID string) error {
+	return rs.Client.Set(redisKeyPrefix+storeKey(userID, key), resourceID, rs.KeyDuration).Err()
+}
+
+//Release frees a reserved key, so that a failed request can be retried
+func (rs *RedisStore) Release(userID string, key string) error {
+	return rs.Client.Del(redisKeyPrefix + storeKey(userID, key)).Err()
+}
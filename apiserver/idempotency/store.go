@@ -0,0 +1,42 @@
+package idempotency
+
+import (
+	"errors"
+	"time"
+)
+
+//DefaultKeyDuration is the default window during which a retried
+//request with the same key returns the original result.
+const DefaultKeyDuration = time.Hour * 24
+
+//LeaseDuration is how long a reserved key is held for the request that
+//reserved it. If that request hasn't completed by then, because the server
+//crashed or the key couldn't be completed, retries can use the key again
+var LeaseDuration = 30 * time.Second
+
+//MaxKeyLength is the longest idempotency key we will accept
+const MaxKeyLength = 255
+
+//ErrInProgress is returned from Store.Reserve() when the key has been
+//reserved by a request that hasn't finished yet
+var ErrInProgress = errors.New("request with this key is still in progress")
+
+//Store represents a store of idempotency keys, scoped to the user
+//who sent them, mapped to the ID of the resource they created.
+type Store interface {
+	//Reserve claims the key for the user. It returns an empty ID if the key
+	//was free, the ID of the resource created with the key if it was already
+	//used, or ErrInProgress if the request that claimed it hasn't completed.
+	Reserve(userID string, key string) (string, error)
+
+	//Complete records the ID of the resource created with the reserved key
+	Complete(userID string, key string, resourceID string) error
+
+	//Release frees a reserved key, so that a failed request can be retried
+	Release(userID string, key string) error
+}
+
+//storeKey returns the key a user's idempotency key is stored under
+func storeKey(userID string, key string) string {
+	return userID + ":" + key
+}
@@ -0,0 +1,26 @@
+package jobs
+
+import (
+	"time"
+)
+
+// job statuses
+const (
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// Job is a snapshot of a background job's progress
+type Job struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	CreatorID  string      `json:"creatorID"`
+	Status     string      `json:"status"`
+	Total      int         `json:"total"`
+	Processed  int         `json:"processed"`
+	Error      string      `json:"error,omitempty"`
+	Result     interface{} `json:"result,omitempty"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	FinishedAt *time.Time  `json:"finishedAt,omitempty"`
+}
@@ -0,0 +1,117 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultRetention is how long finished jobs are kept around
+// so that clients can still read their final progress
+const DefaultRetention = time.Hour
+
+// ErrJobNotFound is returned when the requested job doesn't exist
+var ErrJobNotFound = errors.New("job not found")
+
+// Registry keeps track of the background jobs running in this process.
+// It is safe for concurrent use.
+type Registry struct {
+	jobs      map[string]*Job
+	retention time.Duration
+	mx        sync.RWMutex
+}
+
+// NewRegistry constructs a new Registry that keeps finished jobs for
+// `retention`. If `retention` is negative it is set to DefaultRetention.
+func NewRegistry(retention time.Duration) *Registry {
+	if retention < 0 {
+		retention = DefaultRetention
+	}
+	return &Registry{
+		jobs:      map[string]*Job{},
+		retention: retention,
+	}
+}
+
+// Start registers a new running job of the given type and returns a snapshot of it
+func (r *Registry) Start(jobType string, creatorID string) (*Job, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	job := &Job{
+		ID:        hex.EncodeToString(buf),
+		Type:      jobType,
+		CreatorID: creatorID,
+		Status:    StatusRunning,
+		CreatedAt: time.Now(),
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.removeExpired()
+	r.jobs[job.ID] = job
+	snapshot := *job
+	return &snapshot, nil
+}
+
+// Get returns a snapshot of the job with the given ID
+func (r *Registry) Get(id string) (*Job, error) {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+	job, found := r.jobs[id]
+	if !found {
+		return nil, ErrJobNotFound
+	}
+	snapshot := *job
+	return &snapshot, nil
+}
+
+// SetTotal sets the total amount of work the job has to do
+func (r *Registry) SetTotal(id string, total int) {
+	r.update(id, func(job *Job) {
+		job.Total = total
+	})
+}
+
+// Progress adds `n` to the amount of work the job has processed
+func (r *Registry) Progress(id string, n int) {
+	r.update(id, func(job *Job) {
+		job.Processed += n
+	})
+}
+
+// Finish marks the job as done with the given result, or as failed if `err` isn't nil
+func (r *Registry) Finish(id string, result interface{}, err error) {
+	r.update(id, func(job *Job) {
+		now := time.Now()
+		job.FinishedAt = &now
+		job.Result = result
+		job.Status = StatusDone
+		if err != nil {
+			job.Status = StatusFailed
+			job.Error = err.Error()
+		}
+	})
+}
+
+func (r *Registry) update(id string, fn func(*Job)) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if job, found := r.jobs[id]; found {
+		fn(job)
+	}
+}
+
+// removeExpired removes the finished jobs that are past their retention,
+// the caller must hold the write lock
+func (r *Registry) removeExpired() {
+	cutoff := time.Now().Add(-r.retention)
+	for id, job := range r.jobs {
+		if job.FinishedAt != nil && job.FinishedAt.Before(cutoff) {
+			delete(r.jobs, id)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package jobs
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry(-1)
+
+	job, err := registry.Start("bulk delete", "moderator")
+	if err != nil {
+		t.Fatalf("error starting job: %v", err)
+	}
+	if job.Status != StatusRunning {
+		t.Errorf("incorrect status for new job: expected %s but got %s", StatusRunning, job.Status)
+	}
+
+	registry.SetTotal(job.ID, 100)
+	// progress is reported from several goroutines at once
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			registry.Progress(job.ID, 10)
+		}()
+	}
+	wg.Wait()
+
+	job2, err := registry.Get(job.ID)
+	if err != nil {
+		t.Fatalf("error getting job: %v", err)
+	}
+	if job2.Total != 100 || job2.Processed != 100 {
+		t.Errorf("incorrect progress: expected 100/100 but got %d/%d", job2.Processed, job2.Total)
+	}
+
+	registry.Finish(job.ID, nil, errors.New("mongo went away"))
+	job2, err = registry.Get(job.ID)
+	if err != nil {
+		t.Fatalf("error getting job: %v", err)
+	}
+	if job2.Status != StatusFailed || job2.Error != "mongo went away" || job2.FinishedAt == nil {
+		t.Errorf("job not finished with its error: got %+v", job2)
+	}
+
+	if _, err := registry.Get("nope"); err != ErrJobNotFound {
+		t.Errorf("expected ErrJobNotFound but got %v", err)
+	}
+}
+
+func TestRegistryRetention(t *testing.T) {
+	registry := NewRegistry(0)
+
+	job, err := registry.Start("bulk delete", "moderator")
+	if err != nil {
+		t.Fatalf("error starting job: %v", err)
+	}
+	registry.Finish(job.ID, nil, nil)
+
+	// starting another job cleans up the finished ones
+	if _, err := registry.Start("bulk move", "moderator"); err != nil {
+		t.Fatalf("error starting job: %v", err)
+	}
+	if _, err := registry.Get(job.ID); err != ErrJobNotFound {
+		t.Errorf("finished job wasn't removed after its retention: got %v", err)
+	}
+}
@@ -5,21 +5,33 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 
 	mgo "gopkg.in/mgo.v2"
 	redis "gopkg.in/redis.v5"
 
+	"github.com/aethanol/challenges-aethanol/apiserver/drafts"
 	"github.com/aethanol/challenges-aethanol/apiserver/events"
 	"github.com/aethanol/challenges-aethanol/apiserver/handlers"
+	"github.com/aethanol/challenges-aethanol/apiserver/hooks"
+	"github.com/aethanol/challenges-aethanol/apiserver/idempotency"
+	"github.com/aethanol/challenges-aethanol/apiserver/jobs"
 	"github.com/aethanol/challenges-aethanol/apiserver/middleware"
 	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/sqldb"
 	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
 	"github.com/aethanol/challenges-aethanol/apiserver/passwordreset"
+	"github.com/aethanol/challenges-aethanol/apiserver/presence"
+	"github.com/aethanol/challenges-aethanol/apiserver/readmarkers"
 	"github.com/aethanol/challenges-aethanol/apiserver/sessions"
+	"github.com/aethanol/challenges-aethanol/apiserver/webhooks"
 )
 
 const defaultPort = "443"
 
+// webhookWorkers is how many webhooks are delivered at once
+const webhookWorkers = 8
+
 const (
 	//     /v1/users: UsersHandler
 	//     /v1/sessions: SessionsHandler
@@ -31,6 +43,7 @@ const (
 	apiSessions        = apiRoot + "sessions"
 	apiSessionsMine    = apiSessions + "/mine"
 	apiUsersMe         = apiUsers + "/me"
+	apiUsersPresence   = apiUsers + "/presence"
 	apiReset           = apiRoot + "resetcodes"
 	apiPasswords       = apiRoot + "passwords/"
 	apiChannels        = apiRoot + "channels"
@@ -38,11 +51,27 @@ const (
 	apiMessages        = apiRoot + "messages"
 	apiSpecificMessage = apiRoot + "messages/"
 	apiWebsocket       = apiRoot + "websocket"
+	apiEvents          = apiRoot + "events"
 	apiBot             = apiRoot + "bot"
+	apiModeration      = apiRoot + "moderation/"
+	apiWebhooks        = apiRoot + "webhooks"
+	apiSpecificWebhook = apiRoot + "webhooks/"
+	apiHooks           = apiRoot + "hooks/"
 )
 
 //main is the main entry point for this program
 func main() {
+	// `apiserver migrate` migrates the databases named by DBBACKEND and DBADDR
+	// and exits, so migrations can be run before new servers are deployed.
+	// Otherwise they are run when the server starts.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if _, _, err := openStores(os.Getenv("DBBACKEND"), os.Getenv("DBADDR")); err != nil {
+			log.Fatalf("error migrating: %v", err)
+		}
+		fmt.Println("migrations are up to date")
+		return
+	}
+
 	//read and use the following environment variables
 	//when initializing and starting your web server
 	// PORT - port number to listen on for HTTP requests (if not set, use defaultPort)
@@ -66,40 +95,53 @@ func main() {
 	// read and use the following environment variables
 	// when initalizing the handlers context for authorization
 	//     SESSIONKEY: a string to use as the session ID signing key
-	//     REDISADDR: the address of your redis session store
+	//     REDISADDR: the address of your redis session store, if not set the
+	//                stores are kept in memory
 	//     DBADDR: the address of your database server
 
 	sessionKey := os.Getenv("SESSIONKEY")
 	if len(sessionKey) == 0 {
 		log.Fatal("no SESSIONKEY env variable set")
 	}
-	// Use the REDISADDR to create a new redis Client
+	// Use the REDISADDR to create a new redis Client. Without one the
+	// stores that would be shared in redis are kept in memory instead,
+	// which only works for a single server but means that with the sqlite
+	// backend the whole API runs in one process. The client doesn't
+	// connect to redis until a store uses it
 	reddisAddr := os.Getenv("REDISADDR")
-	fmt.Printf("connecting to redis server at %s...\n", reddisAddr)
+	inMemory := len(reddisAddr) == 0
+	if inMemory {
+		fmt.Println("no REDISADDR set, keeping shared state in memory...")
+	} else {
+		fmt.Printf("connecting to redis server at %s...\n", reddisAddr)
+	}
 	roptions := redis.Options{
 		Addr: reddisAddr,
 	}
 	reddisClient := redis.NewClient(&roptions)
 
 	// pass the client to a new redis store -1 session duration for default duration
-	sesStore := sessions.NewRedisStore(reddisClient, -1)
-
-	// Use the DBADDR to dial your MongoDB server
-	dbAddr := os.Getenv("DBADDR")
-	fmt.Printf("dialing mongo server at %s...\n", dbAddr)
-	mongoSession, err := mgo.Dial(dbAddr)
-	if err != nil {
-		log.Fatalf("error dialing mongo: %v", err)
+	var sesStore sessions.Store = sessions.NewRedisStore(reddisClient, -1)
+	if inMemory {
+		sesStore = sessions.NewMemStore(-1)
 	}
 
-	// use the mongo session to create a new user store
-	userStore, err := users.NewMongoStore(mongoSession, "production")
+	// DBBACKEND chooses the database for the user and message stores,
+	// either mongo (the default), postgres or sqlite. DBADDR is the
+	// address of the mongo server, the postgres connection string or
+	// the sqlite database file
+	dbBackend := os.Getenv("DBBACKEND")
+	dbAddr := os.Getenv("DBADDR")
+	userStore, messageStore, err := openStores(dbBackend, dbAddr)
 	if err != nil {
-		log.Fatalf("error creating user store: %v", err)
+		log.Fatalf("error creating stores: %v", err)
 	}
 
 	// EXTRA CREDIT password reset functionality
-	resetStore := passwordreset.NewRedisResetStore(reddisClient, -1)
+	var resetStore passwordreset.Store = passwordreset.NewRedisResetStore(reddisClient, -1)
+	if inMemory {
+		resetStore = passwordreset.NewMemStore(-1)
+	}
 
 	// get the email password from EMAILPASS
 	emailPass := os.Getenv("EMAILPASS")
@@ -107,14 +149,58 @@ func main() {
 		log.Fatal("no EMAILPASS env variable set")
 	}
 
-	// get the message store
-	messageStore, err := messages.NewMongoStore(mongoSession, "production")
-	if err != nil {
-		log.Fatalf("error creating message store: %v", err)
+	// message drafts are kept in redis so they expire on their own
+	var draftStore drafts.Store = drafts.NewRedisStore(reddisClient, -1)
+	if inMemory {
+		draftStore = drafts.NewMemStore(-1)
+	}
+
+	// read markers are kept in redis alongside the drafts
+	var readMarkerStore readmarkers.Store = readmarkers.NewRedisStore(reddisClient)
+	if inMemory {
+		readMarkerStore = readmarkers.NewMemStore()
+	}
+
+	// idempotency keys for retried message POSTs are kept in redis so they expire on their own
+	var idempotencyStore idempotency.Store = idempotency.NewRedisStore(reddisClient, -1)
+	if inMemory {
+		idempotencyStore = idempotency.NewMemStore(-1)
 	}
 
 	// get the Notifier for websockets
-	notifier := events.NewNotifier()
+	notifier := events.NewNotifier(messageStore)
+	// events are shared with the other servers over redis, which
+	// also keeps the latest ones for clients that reconnect. Without
+	// redis the Notifier's own in-memory bus and log are used
+	if !inMemory {
+		notifier.UseBus(events.NewRedisBus(reddisClient, events.NewRedisLog(reddisClient, events.DefaultLogSize)))
+	}
+
+	// presence is kept in redis so every server sees the same status,
+	// and follows the websocket connections each server has open
+	var presenceStore presence.Store = presence.NewRedisStore(reddisClient)
+	if inMemory {
+		presenceStore = presence.NewMemStore()
+	}
+	tracker := presence.NewTracker(presenceStore, func(p *presence.Presence) {
+		notifier.Notify(events.New(&events.PresenceChange{Presence: p}))
+	})
+	notifier.Observe(tracker)
+
+	// webhooks are kept in redis and sent the events this server publishes,
+	// so each event is delivered once however many servers there are
+	var webhookStore webhooks.Store = webhooks.NewRedisStore(reddisClient)
+	if inMemory {
+		webhookStore = webhooks.NewMemStore()
+	}
+	dispatcher := webhooks.NewDispatcher(webhookStore, notifier, nil)
+	notifier.Listen(dispatcher)
+
+	// incoming webhooks are kept in redis alongside the outgoing ones
+	var hookStore hooks.Store = hooks.NewRedisStore(reddisClient)
+	if inMemory {
+		hookStore = hooks.NewMemStore()
+	}
 
 	// get the bot service's address
 	// and add a ReverseProxy handler for it
@@ -123,21 +209,44 @@ func main() {
 		log.Fatal("you must supply BOTSVCADDR")
 	}
 
+	// MODERATORS is a comma separated list of the IDs of the users
+	// who are allowed to use the moderation APIs
+	var moderators []string
+	if len(os.Getenv("MODERATORS")) > 0 {
+		moderators = strings.Split(os.Getenv("MODERATORS"), ",")
+	}
+
 	// Create and initialize a new handlers.Context with the signing key,
 	// the session store, and the user store.
 	hctx := &handlers.Context{
-		SessionKey:   sessionKey,
-		SessionStore: sesStore,
-		UserStore:    userStore,
-		MessageStore: messageStore,
-		ResetStore:   resetStore,
-		EmailPass:    emailPass,
-		Notifier:     notifier,
-		SvcAddr:      botSvcAddr,
+		SessionKey:       sessionKey,
+		SessionStore:     sesStore,
+		UserStore:        userStore,
+		MessageStore:     messageStore,
+		ResetStore:       resetStore,
+		DraftStore:       draftStore,
+		ReadMarkerStore:  readMarkerStore,
+		IdempotencyStore: idempotencyStore,
+		WebhookStore:     webhookStore,
+		HookStore:        hookStore,
+		EmailPass:        emailPass,
+		Notifier:         notifier,
+		Presence:         tracker,
+		SvcAddr:          botSvcAddr,
+		Moderators:       moderators,
+		Jobs:             jobs.NewRegistry(-1),
 	}
 
 	// start the websocket notifier
 	go hctx.Notifier.Start()
+	// and close the connections of sessions that expire
+	go hctx.Notifier.WatchSessions(func(sessionID string) (bool, error) {
+		return sesStore.Exists(sessions.SessionID(sessionID))
+	})
+	// and the presence tracker that marks idle users away
+	go tracker.Start()
+	// and the workers that deliver webhooks
+	dispatcher.Start(webhookWorkers)
 
 	// Create a new mux handlers to it
 	mux := http.NewServeMux()
@@ -145,6 +254,7 @@ func main() {
 	mux.HandleFunc(apiSessions, hctx.SessionsHandler)
 	mux.HandleFunc(apiSessionsMine, hctx.SessionsMineHandler)
 	mux.HandleFunc(apiUsersMe, hctx.UsersMeHanlder)
+	mux.HandleFunc(apiUsersPresence, hctx.PresenceHandler)
 
 	// EXTRA CREDIT reset handler
 	mux.HandleFunc(apiReset, hctx.ResetCodesHandler)
@@ -162,8 +272,19 @@ func main() {
 	mux.HandleFunc(apiMessages, hctx.MessagesHandler)
 	mux.HandleFunc(apiSpecificMessage, hctx.SpecificMessageHandler)
 
+	// add the moderation handler
+	mux.HandleFunc(apiModeration, hctx.ModerationHandler)
+
+	// add the webhooks handlers
+	mux.HandleFunc(apiWebhooks, hctx.WebhooksHandler)
+	mux.HandleFunc(apiSpecificWebhook, hctx.SpecificWebhookHandler)
+	// and the incoming webhooks tools post to without a session
+	mux.HandleFunc(apiHooks, hctx.IncomingHookHandler)
+
 	// add the websocket upgrade handler
 	http.HandleFunc(apiWebsocket, hctx.WebSocketUpgradeHandler)
+	// and the server-sent events stream of the same events
+	mux.HandleFunc(apiEvents, hctx.EventStreamHandler)
 
 	// add the chatbot handler
 	mux.HandleFunc(apiBot, hctx.ChatbotHandler)
@@ -198,3 +319,42 @@ func main() {
 	fmt.Printf("server is listening at %s...\n", addr)
 	log.Fatal(http.ListenAndServeTLS(addr, tlsCertPath, tlsKeyPath, nil))
 }
+
+// openStores opens the user and message stores on the database backend
+func openStores(backend string, dbAddr string) (users.Store, messages.Store, error) {
+	switch backend {
+	case "", "mongo":
+		// Use the DBADDR to dial your MongoDB server
+		fmt.Printf("dialing mongo server at %s...\n", dbAddr)
+		mongoSession, err := mgo.Dial(dbAddr)
+		if err != nil {
+			return nil, nil, err
+		}
+		// use the mongo session to create a new user store
+		userStore, err := users.NewMongoStore(mongoSession, "production")
+		if err != nil {
+			return nil, nil, err
+		}
+		messageStore, err := messages.NewMongoStore(mongoSession, "production")
+		if err != nil {
+			return nil, nil, err
+		}
+		return userStore, messageStore, nil
+	case sqldb.Postgres, sqldb.SQLite:
+		fmt.Printf("opening %s database...\n", backend)
+		db, err := sqldb.Open(backend, dbAddr)
+		if err != nil {
+			return nil, nil, err
+		}
+		userStore, err := users.NewSQLStore(db)
+		if err != nil {
+			return nil, nil, err
+		}
+		messageStore, err := messages.NewSQLStore(db)
+		if err != nil {
+			return nil, nil, err
+		}
+		return userStore, messageStore, nil
+	}
+	return nil, nil, fmt.Errorf("unknown DBBACKEND %q", backend)
+}
@@ -1,7 +1,10 @@
 package middleware
 
 import (
+	"bufio"
+	"errors"
 	"log"
+	"net"
 	"net/http"
 	"time"
 )
@@ -38,3 +41,26 @@ func (lrw *LoggingResponseWriter) WriteHeader(code int) {
 	lrw.statusCode = code
 	lrw.ResponseWriter.WriteHeader(code)
 }
+
+// Flush sends any buffered data to the client, so streaming handlers still work behind the logger
+func (lrw *LoggingResponseWriter) Flush() {
+	if f, ok := lrw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets the handler take over the connection, so websocket upgrades still work behind the logger
+func (lrw *LoggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := lrw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not implement http.Hijacker")
+	}
+	// the connection is the handler's now, so the response is the switch of protocols
+	lrw.statusCode = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+// Unwrap returns the wrapped ResponseWriter, so http.ResponseController can set its deadlines
+func (lrw *LoggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
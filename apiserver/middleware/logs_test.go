@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestLogsWebsocket(t *testing.T) {
+	//create a handler that upgrades to a websocket and echoes one message
+	upgrader := websocket.Upgrader{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, buf, err := conn.ReadMessage(); err == nil {
+			conn.WriteMessage(websocket.TextMessage, buf)
+		}
+	})
+
+	//adapt handler with Logs(), the upgrade needs to hijack the connection through it
+	buf := &bytes.Buffer{}
+	srv := httptest.NewServer(Adapt(handler, Logs(log.New(buf, "", 0))))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("error upgrading through the logger: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("hi")); err != nil {
+		t.Fatalf("error writing message: %v", err)
+	}
+	if _, msg, err := conn.ReadMessage(); err != nil || string(msg) != "hi" {
+		t.Errorf("expected the message echoed but got %q, %v", msg, err)
+	}
+}
+
+func TestLogsResponseController(t *testing.T) {
+	//the logger must let handlers set deadlines on the connection
+	var deadlineErr error
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadlineErr = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Second))
+	})
+	srv := httptest.NewServer(Adapt(handler, Logs(log.New(&bytes.Buffer{}, "", 0))))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("error making request: %v", err)
+	}
+	resp.Body.Close()
+	if deadlineErr != nil {
+		t.Errorf("expected to set the write deadline through the logger but got %v", deadlineErr)
+	}
+}
@@ -0,0 +1,142 @@
+package messages
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
+)
+
+// limits on the number of top posters in channel analytics
+const (
+	defaultTopPosters = 10
+	maxTopPosters     = 100
+)
+
+// AnalyticsQuery selects the time range and number of top posters
+// for channel analytics. A nil Since or Until leaves that end open.
+type AnalyticsQuery struct {
+	Since *time.Time `json:"since,omitempty"`
+	Until *time.Time `json:"until,omitempty"`
+	Top   int        `json:"top,omitempty"`
+}
+
+// DayCount is the number of messages posted on a day (UTC, as YYYY-MM-DD)
+type DayCount struct {
+	Day   string `json:"day" bson:"_id"`
+	Count int    `json:"count"`
+}
+
+// HourCount is the number of messages posted during an hour of the day (UTC, 0-23)
+type HourCount struct {
+	Hour  int `json:"hour" bson:"_id"`
+	Count int `json:"count"`
+}
+
+// MemberActivity is how many messages a user posted and when they last posted
+type MemberActivity struct {
+	UserID     users.UserID `json:"userID" bson:"_id"`
+	Count      int          `json:"count"`
+	LastPostAt *time.Time   `json:"lastPostAt,omitempty" bson:"lastpostat"`
+}
+
+// ChannelAnalytics summarizes the activity in a channel over the query's time range
+type ChannelAnalytics struct {
+	ChannelID ChannelID  `json:"channelID"`
+	Since     *time.Time `json:"since,omitempty"`
+	Until     *time.Time `json:"until,omitempty"`
+	Total     int        `json:"total"`
+	// MessagesPerDay only has the days that had messages, oldest first
+	MessagesPerDay []*DayCount `json:"messagesPerDay"`
+	// BusiestHours has every hour of the day, busiest first
+	BusiestHours []*HourCount `json:"busiestHours"`
+	// TopPosters may include users who have since left the channel
+	TopPosters []*MemberActivity `json:"topPosters"`
+	// Members has the activity of every current member of the channel
+	Members     []*MemberActivity `json:"members"`
+	NeverPosted []users.UserID    `json:"neverPosted"`
+}
+
+// Validate validates the query and fills in the default number of top posters
+func (q *AnalyticsQuery) Validate() error {
+	if q.Since != nil && q.Until != nil && q.Until.Before(*q.Since) {
+		return errors.New("Error: time range ends before it starts")
+	}
+	if q.Top < 0 || q.Top > maxTopPosters {
+		return errors.New("Error: top must be between 1 and 100")
+	}
+	if q.Top == 0 {
+		q.Top = defaultTopPosters
+	}
+	return nil
+}
+
+// NewChannelAnalytics puts together the analytics for the channel from the
+// messages counted by day, by hour and by poster. Stores do the counting in
+// whatever way suits their database and leave the rest to this.
+func NewChannelAnalytics(channel *Channel, query *AnalyticsQuery, days []*DayCount, hours []*HourCount, posters []*MemberActivity) *ChannelAnalytics {
+	analytics := &ChannelAnalytics{
+		ChannelID:      channel.ID,
+		Since:          query.Since,
+		Until:          query.Until,
+		MessagesPerDay: days,
+		BusiestHours:   make([]*HourCount, 24),
+		TopPosters:     []*MemberActivity{},
+		Members:        make([]*MemberActivity, 0, len(channel.Members)),
+		NeverPosted:    []users.UserID{},
+	}
+
+	sort.Slice(days, func(i, j int) bool { return days[i].Day < days[j].Day })
+	for _, d := range days {
+		analytics.Total += d.Count
+	}
+
+	// include the quiet hours too so clients can draw the whole day
+	for h := range analytics.BusiestHours {
+		analytics.BusiestHours[h] = &HourCount{Hour: h}
+	}
+	for _, h := range hours {
+		if h.Hour >= 0 && h.Hour < 24 {
+			analytics.BusiestHours[h.Hour].Count = h.Count
+		}
+	}
+	sort.SliceStable(analytics.BusiestHours, func(i, j int) bool {
+		return analytics.BusiestHours[i].Count > analytics.BusiestHours[j].Count
+	})
+
+	// most messages first, and the most recent poster wins a tie
+	sort.Slice(posters, func(i, j int) bool {
+		if posters[i].Count != posters[j].Count {
+			return posters[i].Count > posters[j].Count
+		}
+		return lastPost(posters[i]).After(lastPost(posters[j]))
+	})
+	top := query.Top
+	if top == 0 || top > len(posters) {
+		top = len(posters)
+	}
+	analytics.TopPosters = append(analytics.TopPosters, posters[:top]...)
+
+	byUser := make(map[string]*MemberActivity, len(posters))
+	for _, p := range posters {
+		byUser[IDString(p.UserID)] = p
+	}
+	for _, m := range channel.Members {
+		activity, found := byUser[IDString(m)]
+		if !found {
+			activity = &MemberActivity{UserID: m}
+			analytics.NeverPosted = append(analytics.NeverPosted, m)
+		}
+		analytics.Members = append(analytics.Members, activity)
+	}
+	return analytics
+}
+
+// lastPost returns when the user last posted, or the zero time if they never did
+func lastPost(a *MemberActivity) time.Time {
+	if a.LastPostAt == nil {
+		return time.Time{}
+	}
+	return *a.LastPostAt
+}
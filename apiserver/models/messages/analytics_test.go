@@ -0,0 +1,60 @@
+package messages
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
+)
+
+func TestNewChannelAnalytics(t *testing.T) {
+	quiet, busy, chatty, gone := bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId()
+	channel := &Channel{
+		ID:      bson.NewObjectId(),
+		Members: []users.UserID{quiet, busy, chatty},
+	}
+	earlier := time.Now().Add(-time.Hour)
+	later := time.Now()
+
+	query := &AnalyticsQuery{Top: 2}
+	if err := query.Validate(); err != nil {
+		t.Fatalf("error validating query: %v", err)
+	}
+	days := []*DayCount{{Day: "2017-05-02", Count: 4}, {Day: "2017-05-01", Count: 3}}
+	hours := []*HourCount{{Hour: 9, Count: 2}, {Hour: 14, Count: 5}}
+	posters := []*MemberActivity{
+		{UserID: busy, Count: 3, LastPostAt: &earlier},
+		{UserID: chatty, Count: 3, LastPostAt: &later},
+		// someone who posted and then left the channel
+		{UserID: gone, Count: 1, LastPostAt: &earlier},
+	}
+
+	a := NewChannelAnalytics(channel, query, days, hours, posters)
+
+	if a.Total != 7 {
+		t.Errorf("incorrect total: expected 7 but got %d", a.Total)
+	}
+	if a.MessagesPerDay[0].Day != "2017-05-01" {
+		t.Errorf("days not sorted oldest first: got %s first", a.MessagesPerDay[0].Day)
+	}
+	if len(a.BusiestHours) != 24 || a.BusiestHours[0].Hour != 14 || a.BusiestHours[1].Hour != 9 {
+		t.Errorf("incorrect busiest hours: expected 24 hours starting with 14 then 9 but got %d starting with %d", len(a.BusiestHours), a.BusiestHours[0].Hour)
+	}
+	// the tie between busy and chatty goes to whoever posted last
+	if len(a.TopPosters) != 2 || a.TopPosters[0].UserID != chatty || a.TopPosters[1].UserID != busy {
+		t.Errorf("incorrect top posters: %v", a.TopPosters)
+	}
+	if len(a.Members) != 3 {
+		t.Errorf("incorrect number of members: expected 3 but got %d", len(a.Members))
+	}
+	if len(a.NeverPosted) != 1 || a.NeverPosted[0] != quiet {
+		t.Errorf("incorrect members who never posted: expected only %v but got %v", quiet, a.NeverPosted)
+	}
+
+	bad := &AnalyticsQuery{Since: &later, Until: &earlier}
+	if err := bad.Validate(); err == nil {
+		t.Errorf("expected error validating a backwards time range")
+	}
+}
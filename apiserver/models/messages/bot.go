@@ -0,0 +1,68 @@
+package messages
+
+import (
+	"errors"
+	"net/url"
+)
+
+// the limits on what a bot message can carry
+const (
+	// MaxBotNameLength is the longest name a bot can post under
+	MaxBotNameLength = 80
+	// MaxAttachments is the most attachments a message can have
+	MaxAttachments = 20
+)
+
+// BotAuthor is who a message posted through an incoming webhook is shown as
+// being from, instead of the user who created the webhook
+type BotAuthor struct {
+	HookID string `json:"hookID"`
+	Name   string `json:"name"`
+}
+
+// Attachment is extra content posted with a bot message, such as
+// a build result or an alert, shown as a card below the body
+type Attachment struct {
+	Title     string `json:"title,omitempty"`
+	TitleLink string `json:"titleLink,omitempty"`
+	Text      string `json:"text,omitempty"`
+	// Color is the color of the card's edge, e.g. #36a64f
+	Color    string `json:"color,omitempty"`
+	ImageURL string `json:"imageURL,omitempty"`
+}
+
+// Validate validates an attachment
+func (a *Attachment) Validate() error {
+	if len(a.Title) == 0 && len(a.Text) == 0 && len(a.ImageURL) == 0 {
+		return errors.New("Error: attachment has no title, text or image")
+	}
+	if len(a.TitleLink) > 0 && !isWebURL(a.TitleLink) {
+		return errors.New("Error: attachment titleLink must be an http or https URL")
+	}
+	if len(a.ImageURL) > 0 && !isWebURL(a.ImageURL) {
+		return errors.New("Error: attachment imageURL must be an http or https URL")
+	}
+	return nil
+}
+
+// validateBot validates the bot author and attachments of a new message
+func (nm *NewMessage) validateBot() error {
+	if nm.Bot != nil && (len(nm.Bot.Name) == 0 || len([]rune(nm.Bot.Name)) > MaxBotNameLength) {
+		return errors.New("Error: bot name must be between 1 and 80 characters")
+	}
+	if len(nm.Attachments) > MaxAttachments {
+		return errors.New("Error: too many attachments")
+	}
+	for _, a := range nm.Attachments {
+		if err := a.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isWebURL reports whether the value is an absolute http or https URL
+func isWebURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && len(u.Host) > 0
+}
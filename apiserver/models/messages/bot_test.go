@@ -0,0 +1,45 @@
+package messages
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
+)
+
+func TestBotMessageValidate(t *testing.T) {
+	channelID := bson.NewObjectId()
+	bot := &BotAuthor{HookID: "hook1", Name: "CI"}
+	cases := []struct {
+		name  string
+		nm    *NewMessage
+		valid bool
+	}{
+		{"text", &NewMessage{ChannelID: channelID, Body: "build passed", Bot: bot}, true},
+		{"attachments only", &NewMessage{ChannelID: channelID, Bot: bot, Attachments: []*Attachment{{Title: "build #12"}}}, true},
+		{"empty", &NewMessage{ChannelID: channelID, Bot: bot}, false},
+		{"no name", &NewMessage{ChannelID: channelID, Body: "hi", Bot: &BotAuthor{HookID: "hook1"}}, false},
+		{"long name", &NewMessage{ChannelID: channelID, Body: "hi", Bot: &BotAuthor{HookID: "hook1", Name: strings.Repeat("a", MaxBotNameLength+1)}}, false},
+		{"empty attachment", &NewMessage{ChannelID: channelID, Body: "hi", Bot: bot, Attachments: []*Attachment{{Color: "#fff"}}}, false},
+		{"bad link", &NewMessage{ChannelID: channelID, Body: "hi", Bot: bot, Attachments: []*Attachment{{Title: "x", TitleLink: "javascript:alert(1)"}}}, false},
+		{"bad image", &NewMessage{ChannelID: channelID, Body: "hi", Bot: bot, Attachments: []*Attachment{{ImageURL: "/relative.png"}}}, false},
+		{"good urls", &NewMessage{ChannelID: channelID, Body: "hi", Bot: bot, Attachments: []*Attachment{{Title: "x", TitleLink: "https://ci.example.com/12", ImageURL: "http://ci.example.com/badge.png"}}}, true},
+		{"too many", &NewMessage{ChannelID: channelID, Body: "hi", Bot: bot, Attachments: make([]*Attachment, MaxAttachments+1)}, false},
+	}
+	for _, c := range cases {
+		if err := c.nm.Validate(); (err == nil) != c.valid {
+			t.Errorf("%s: expected valid to be %t but got error %v", c.name, c.valid, err)
+		}
+	}
+
+	// the bot author and attachments are kept on the message
+	m, err := cases[1].nm.ToMessage(&users.User{ID: 1234})
+	if err != nil {
+		t.Fatalf("error converting bot message: %v", err)
+	}
+	if m.Type != MessageTypeText || m.Bot != bot || len(m.Attachments) != 1 {
+		t.Errorf("expected a text message from the bot with 1 attachment but got %+v", m)
+	}
+}
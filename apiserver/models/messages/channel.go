@@ -1,6 +1,7 @@
 package messages
 
 import (
+	"fmt"
 	"time"
 
 	"gopkg.in/mgo.v2/bson"
@@ -21,6 +22,9 @@ type Channel struct {
 	CreatorID   users.UserID   `json:"creatorID"`
 	Members     []users.UserID `json:"members"`
 	Private     bool           `json:"private"`
+	Version     int            `json:"version"`
+	// JoinedAt maps the ID of each member to when they joined
+	JoinedAt map[string]time.Time `json:"-"`
 }
 
 type NewChannel struct {
@@ -33,6 +37,8 @@ type NewChannel struct {
 type ChannelUpdates struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	// Version is the version the updates are based on, 0 for any version
+	Version int `json:"-" bson:"-"`
 }
 
 // Validate validates a new channel
@@ -44,12 +50,9 @@ func (nc *NewChannel) Validate() error {
 	return nil
 }
 
-// ToChannel converst the NewChannel to a Channel
+// ToChannel converst the NewChannel to a Channel.
+// IDs are left as they are, it is up to each store to convert them.
 func (nc *NewChannel) ToChannel(creator *users.User) (*Channel, error) {
-	// make sure that the creatorID is a bson ID
-	if sID, ok := creator.ID.(string); ok {
-		creator.ID = bson.ObjectIdHex(sID)
-	}
 	// create a new Channel struct to convert to
 	channel := &Channel{
 		Name:        nc.Name,
@@ -57,6 +60,7 @@ func (nc *NewChannel) ToChannel(creator *users.User) (*Channel, error) {
 		CreatedAt:   time.Now(),
 		CreatorID:   creator.ID,
 		Private:     nc.Private,
+		Version:     1,
 	}
 	// Initialize the members slice
 	var members []users.UserID
@@ -68,6 +72,40 @@ func (nc *NewChannel) ToChannel(creator *users.User) (*Channel, error) {
 		members = nc.Members
 	}
 	channel.Members = members
+	channel.JoinedAt = make(map[string]time.Time, len(members))
+	for _, m := range members {
+		channel.JoinedAt[IDString(m)] = channel.CreatedAt
+	}
 
 	return channel, nil
 }
+
+// CanView reports whether the user is allowed to see the channel and its messages
+func (c *Channel) CanView(userID users.UserID) bool {
+	return !c.Private || c.IsMember(userID)
+}
+
+// IsMember reports whether the user is in the channel's members list
+func (c *Channel) IsMember(userID users.UserID) bool {
+	for _, m := range c.Members {
+		if IDString(m) == IDString(userID) {
+			return true
+		}
+	}
+	return false
+}
+
+// IDString returns a comparable string form of a user, channel or message ID.
+// IDs read from mongo are bson.ObjectIds, but the same IDs come back as hex
+// strings once they have been through JSON (e.g. in the session state).
+func IDString(id interface{}) string {
+	switch v := id.(type) {
+	case bson.ObjectId:
+		return v.Hex()
+	case string:
+		return v
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(id)
+}
@@ -0,0 +1,48 @@
+package messages_test
+
+import (
+	"testing"
+
+	mgo "gopkg.in/mgo.v2"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages/messagestest"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/sqldb"
+)
+
+func TestSQLStoreConformance(t *testing.T) {
+	messagestest.TestStore(t, func(t *testing.T) messages.Store {
+		db, err := sqldb.Open(sqldb.SQLite, ":memory:")
+		if err != nil {
+			t.Fatalf("error opening database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		store, err := messages.NewSQLStore(db)
+		if err != nil {
+			t.Fatalf("error creating store: %v", err)
+		}
+		return store
+	})
+}
+
+// NOTE: this test needs a local instance of mongo, to start one using Docker run
+// docker run -d -p 27017:27017 mongo
+func TestMongoStoreConformance(t *testing.T) {
+	messagestest.TestStore(t, func(t *testing.T) messages.Store {
+		session, err := mgo.Dial("127.0.0.1:27017")
+		if err != nil {
+			t.Fatalf("error dialing mongo: %v", err)
+		}
+		db := session.DB("conformance")
+		db.DropDatabase()
+		t.Cleanup(func() {
+			db.DropDatabase()
+			session.Close()
+		})
+		store, err := messages.NewMongoStore(session, db.Name)
+		if err != nil {
+			t.Fatalf("error creating store: %v", err)
+		}
+		return store
+	})
+}
@@ -0,0 +1,59 @@
+package messages
+
+import (
+	"time"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
+)
+
+// MessageTypeForward is the type of messages that forward another message
+const MessageTypeForward = "forward"
+
+// ForwardRef is a reference to the original message that a forwarded message
+// was shared from. The original body is kept with the reference, but must
+// only be shown to readers who can see the source channel, see Redact.
+type ForwardRef struct {
+	MessageID MessageID    `json:"messageID"`
+	ChannelID ChannelID    `json:"channelID"`
+	CreatorID users.UserID `json:"creatorID"`
+	CreatedAt time.Time    `json:"createdAt"`
+	Body      string       `json:"body,omitempty"`
+	Blocks    []*Block     `json:"blocks,omitempty"`
+	// Hidden is set when the body has been redacted for the reader
+	Hidden bool `json:"hidden,omitempty" bson:"-"`
+}
+
+// ForwardMessage represents a request to forward a message into another channel
+type ForwardMessage struct {
+	ChannelID ChannelID `json:"channelID"`
+	Comment   string    `json:"comment,omitempty"`
+}
+
+// NewForwardRef creates a reference to the original message
+func NewForwardRef(original *Message) *ForwardRef {
+	return &ForwardRef{
+		MessageID: original.ID,
+		ChannelID: original.ChannelID,
+		CreatorID: original.CreatorID,
+		CreatedAt: original.CreatedAt,
+		Body:      original.Body,
+		Blocks:    original.Blocks,
+	}
+}
+
+// ToNewMessage converts the forward request to a NewMessage that
+// references the original message
+func (fm *ForwardMessage) ToNewMessage(original *Message) *NewMessage {
+	return &NewMessage{
+		ChannelID: fm.ChannelID,
+		Body:      fm.Comment,
+		Forward:   NewForwardRef(original),
+	}
+}
+
+// Redact hides the original message's content, leaving only who posted it, where and when
+func (fr *ForwardRef) Redact() {
+	fr.Body = ""
+	fr.Blocks = nil
+	fr.Hidden = true
+}
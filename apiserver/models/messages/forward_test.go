@@ -0,0 +1,51 @@
+package messages
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
+)
+
+func TestForwardToMessage(t *testing.T) {
+	original := &Message{
+		ID:        bson.NewObjectId(),
+		ChannelID: bson.NewObjectId(),
+		Body:      "*secret* plans",
+		Blocks:    ParseMarkup("*secret* plans"),
+		CreatedAt: time.Now(),
+		CreatorID: "author",
+	}
+
+	// the comment is optional when forwarding
+	fm := &ForwardMessage{ChannelID: bson.NewObjectId()}
+	nm := fm.ToNewMessage(original)
+	if err := nm.Validate(); err != nil {
+		t.Fatalf("error validating forwarded message: %v", err)
+	}
+
+	m, err := nm.ToMessage(&users.User{ID: 1234})
+	if err != nil {
+		t.Fatalf("error converting forwarded message: %v", err)
+	}
+	if m.Type != MessageTypeForward {
+		t.Errorf("incorrect message type: expected %s but got %s", MessageTypeForward, m.Type)
+	}
+	if m.Forward.MessageID != original.ID || m.Forward.ChannelID != original.ChannelID || m.Forward.CreatorID != original.CreatorID {
+		t.Errorf("forward doesn't reference the original message: got %+v", m.Forward)
+	}
+	if m.Forward.Body != original.Body {
+		t.Errorf("incorrect forwarded body: expected `%s` but got `%s`", original.Body, m.Forward.Body)
+	}
+
+	m.Forward.Redact()
+	if len(m.Forward.Body) != 0 || m.Forward.Blocks != nil || !m.Forward.Hidden {
+		t.Errorf("forward not redacted: got %+v", m.Forward)
+	}
+	// who posted it, where and when is still visible
+	if m.Forward.CreatorID != original.CreatorID || !m.Forward.CreatedAt.Equal(original.CreatedAt) {
+		t.Errorf("redact removed the original's author or time: got %+v", m.Forward)
+	}
+}
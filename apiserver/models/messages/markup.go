@@ -0,0 +1,309 @@
+package messages
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// block types produced by ParseMarkup
+const (
+	BlockText      = "text"
+	BlockBold      = "bold"
+	BlockItalic    = "italic"
+	BlockCode      = "code"
+	BlockCodeBlock = "codeblock"
+	BlockLink      = "link"
+	BlockMention   = "mention"
+	BlockChannel   = "channel"
+)
+
+// codeFence opens and closes a multi-line code block
+const codeFence = "```"
+
+// allowedSchemes are the only URL schemes that will be turned into links,
+// anything else (javascript:, data:, etc.) is left as plain text
+var allowedSchemes = []string{"http://", "https://", "mailto:"}
+
+// Block is a single piece of structured message content.
+// Bold and italic blocks hold their formatted content in Children,
+// every other block type keeps its content in Text.
+type Block struct {
+	Type     string   `json:"type"`
+	Text     string   `json:"text,omitempty"`
+	URL      string   `json:"url,omitempty"`
+	ID       string   `json:"id,omitempty"`
+	Children []*Block `json:"children,omitempty"`
+}
+
+// ParseMarkup parses a message body written in our Slack-like markup
+// into a slice of blocks. Supported markup:
+//
+//	*bold*  _italic_  `code`  ```code block```
+//	<https://example.com|label>  <https://example.com>  https://example.com
+//	<@userID>  <#channelID>  <#channelID|name>
+//
+// Anything that doesn't parse as markup is kept as plain text.
+func ParseMarkup(body string) []*Block {
+	blocks := []*Block{}
+	// pull out the fenced code blocks first since nothing inside them is formatted
+	for {
+		start := strings.Index(body, codeFence)
+		if start < 0 {
+			break
+		}
+		end := strings.Index(body[start+len(codeFence):], codeFence)
+		if end < 0 {
+			break
+		}
+		blocks = appendBlocks(blocks, parseInline(body[:start])...)
+		code := body[start+len(codeFence) : start+len(codeFence)+end]
+		blocks = append(blocks, &Block{Type: BlockCodeBlock, Text: strings.Trim(code, "\n")})
+		body = body[start+end+2*len(codeFence):]
+	}
+	return appendBlocks(blocks, parseInline(body)...)
+}
+
+// parseInline parses everything except code fences
+func parseInline(s string) []*Block {
+	blocks := []*Block{}
+	// text is the index where the current run of plain text began
+	text := 0
+	for i := 0; i < len(s); {
+		var block *Block
+		next := i
+		switch s[i] {
+		case '`':
+			if end := strings.IndexByte(s[i+1:], '`'); end > 0 {
+				block = &Block{Type: BlockCode, Text: s[i+1 : i+1+end]}
+				next = i + end + 2
+			}
+		case '*', '_':
+			if end := closingDelim(s, i); end > 0 {
+				bType := BlockBold
+				if s[i] == '_' {
+					bType = BlockItalic
+				}
+				block = &Block{Type: bType, Children: parseInline(s[i+1 : end])}
+				next = end + 1
+			}
+		case '<':
+			if end := strings.IndexByte(s[i+1:], '>'); end > 0 {
+				block = parseAngle(s[i+1 : i+1+end])
+				next = i + end + 2
+			}
+		case 'h':
+			if url := bareURL(s, i); len(url) > 0 {
+				block = &Block{Type: BlockLink, URL: url, Text: url}
+				next = i + len(url)
+			}
+		}
+
+		if block == nil {
+			_, size := utf8.DecodeRuneInString(s[i:])
+			i += size
+			continue
+		}
+		// flush the plain text that came before this block
+		if text < i {
+			blocks = appendBlocks(blocks, &Block{Type: BlockText, Text: s[text:i]})
+		}
+		blocks = appendBlocks(blocks, block)
+		i = next
+		text = next
+	}
+	if text < len(s) {
+		blocks = appendBlocks(blocks, &Block{Type: BlockText, Text: s[text:]})
+	}
+	return blocks
+}
+
+// closingDelim returns the index of the delimiter that closes the
+// one opened at s[start], or -1 if s[start] doesn't open a span.
+// Spans must hug their content and sit on a word boundary so that
+// things like snake_case_names and 2*3*4 aren't formatted.
+func closingDelim(s string, start int) int {
+	delim := s[start]
+	if start > 0 && isWordByte(s[start-1]) {
+		return -1
+	}
+	if start+1 >= len(s) || isSpaceByte(s[start+1]) || s[start+1] == delim {
+		return -1
+	}
+	for j := start + 2; j < len(s); j++ {
+		if s[j] == '\n' {
+			return -1
+		}
+		if s[j] != delim || isSpaceByte(s[j-1]) {
+			continue
+		}
+		if j+1 < len(s) && isWordByte(s[j+1]) {
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+// parseAngle parses the inside of a <...> reference
+func parseAngle(ref string) *Block {
+	target, label := ref, ""
+	if bar := strings.IndexByte(ref, '|'); bar >= 0 {
+		target, label = ref[:bar], ref[bar+1:]
+	}
+	switch {
+	case strings.HasPrefix(target, "@") && len(target) > 1:
+		return &Block{Type: BlockMention, ID: target[1:], Text: label}
+	case strings.HasPrefix(target, "#") && len(target) > 1:
+		return &Block{Type: BlockChannel, ID: target[1:], Text: label}
+	case allowedURL(target):
+		if len(label) == 0 {
+			label = target
+		}
+		return &Block{Type: BlockLink, URL: target, Text: label}
+	}
+	return nil
+}
+
+// bareURL returns the URL starting at s[start] if there is one
+func bareURL(s string, start int) string {
+	if start > 0 && isWordByte(s[start-1]) {
+		return ""
+	}
+	if !strings.HasPrefix(s[start:], "http://") && !strings.HasPrefix(s[start:], "https://") {
+		return ""
+	}
+	end := strings.IndexFunc(s[start:], func(r rune) bool {
+		return unicode.IsSpace(r) || r == '<' || r == '>'
+	})
+	if end < 0 {
+		end = len(s) - start
+	}
+	// trailing punctuation almost always belongs to the sentence, not the URL
+	url := strings.TrimRight(s[start:start+end], ".,;:!?)'\"")
+	if strings.HasSuffix(url, "://") {
+		return ""
+	}
+	return url
+}
+
+// allowedURL reports whether the url uses one of the allowedSchemes
+func allowedURL(url string) bool {
+	lower := strings.ToLower(url)
+	for _, scheme := range allowedSchemes {
+		if strings.HasPrefix(lower, scheme) && len(url) > len(scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendBlocks appends blocks, merging neighbouring text blocks together
+func appendBlocks(blocks []*Block, more ...*Block) []*Block {
+	for _, b := range more {
+		if n := len(blocks); n > 0 && b.Type == BlockText && blocks[n-1].Type == BlockText {
+			blocks[n-1] = &Block{Type: BlockText, Text: blocks[n-1].Text + b.Text}
+			continue
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+func isSpaceByte(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+// WalkBlocks calls fn for every block, including nested children
+func WalkBlocks(blocks []*Block, fn func(*Block)) {
+	for _, b := range blocks {
+		fn(b)
+		WalkBlocks(b.Children, fn)
+	}
+}
+
+// RenderHTML renders the blocks as HTML that is safe to insert into a page.
+// All text is escaped, and links only ever use the allowedSchemes.
+func RenderHTML(blocks []*Block) string {
+	buf := &strings.Builder{}
+	renderHTML(buf, blocks)
+	return buf.String()
+}
+
+func renderHTML(buf *strings.Builder, blocks []*Block) {
+	for _, b := range blocks {
+		switch b.Type {
+		case BlockText:
+			buf.WriteString(strings.Replace(html.EscapeString(b.Text), "\n", "<br>", -1))
+		case BlockBold:
+			buf.WriteString("<strong>")
+			renderHTML(buf, b.Children)
+			buf.WriteString("</strong>")
+		case BlockItalic:
+			buf.WriteString("<em>")
+			renderHTML(buf, b.Children)
+			buf.WriteString("</em>")
+		case BlockCode:
+			buf.WriteString("<code>" + html.EscapeString(b.Text) + "</code>")
+		case BlockCodeBlock:
+			buf.WriteString("<pre><code>" + html.EscapeString(b.Text) + "</code></pre>")
+		case BlockLink:
+			// blocks may have come from the database, so check the scheme again
+			if !allowedURL(b.URL) {
+				buf.WriteString(html.EscapeString(b.Text))
+				continue
+			}
+			buf.WriteString(`<a href="` + html.EscapeString(b.URL) + `" rel="nofollow noopener noreferrer" target="_blank">`)
+			buf.WriteString(html.EscapeString(b.Text) + "</a>")
+		case BlockMention:
+			buf.WriteString(`<span class="mention" data-user-id="` + html.EscapeString(b.ID) + `">`)
+			buf.WriteString("@" + html.EscapeString(displayText(b)) + "</span>")
+		case BlockChannel:
+			buf.WriteString(`<span class="channel" data-channel-id="` + html.EscapeString(b.ID) + `">`)
+			buf.WriteString("#" + html.EscapeString(displayText(b)) + "</span>")
+		}
+	}
+}
+
+// RenderPlainText renders the blocks without any formatting,
+// for use in notifications and clients that can't display markup
+func RenderPlainText(blocks []*Block) string {
+	buf := &strings.Builder{}
+	renderPlainText(buf, blocks)
+	return buf.String()
+}
+
+func renderPlainText(buf *strings.Builder, blocks []*Block) {
+	for _, b := range blocks {
+		switch b.Type {
+		case BlockText, BlockCode, BlockCodeBlock:
+			buf.WriteString(b.Text)
+		case BlockBold, BlockItalic:
+			renderPlainText(buf, b.Children)
+		case BlockLink:
+			if b.Text == b.URL {
+				buf.WriteString(b.URL)
+			} else {
+				buf.WriteString(b.Text + " (" + b.URL + ")")
+			}
+		case BlockMention:
+			buf.WriteString("@" + displayText(b))
+		case BlockChannel:
+			buf.WriteString("#" + displayText(b))
+		}
+	}
+}
+
+// displayText returns the text to show for a mention or channel reference,
+// falling back to the raw ID if it was never resolved to a name
+func displayText(b *Block) string {
+	if len(b.Text) > 0 {
+		return b.Text
+	}
+	return b.ID
+}
@@ -0,0 +1,140 @@
+package messages
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMarkup(t *testing.T) {
+	cases := []struct {
+		body     string
+		expected []*Block
+	}{
+		{
+			body:     "just text",
+			expected: []*Block{{Type: BlockText, Text: "just text"}},
+		},
+		{
+			body: "a *bold* and _italic_ word",
+			expected: []*Block{
+				{Type: BlockText, Text: "a "},
+				{Type: BlockBold, Children: []*Block{{Type: BlockText, Text: "bold"}}},
+				{Type: BlockText, Text: " and "},
+				{Type: BlockItalic, Children: []*Block{{Type: BlockText, Text: "italic"}}},
+				{Type: BlockText, Text: " word"},
+			},
+		},
+		{
+			body: "*_both_*",
+			expected: []*Block{
+				{Type: BlockBold, Children: []*Block{
+					{Type: BlockItalic, Children: []*Block{{Type: BlockText, Text: "both"}}},
+				}},
+			},
+		},
+		{
+			body:     "snake_case_name and 2*3*4",
+			expected: []*Block{{Type: BlockText, Text: "snake_case_name and 2*3*4"}},
+		},
+		{
+			body: "run `go test` now",
+			expected: []*Block{
+				{Type: BlockText, Text: "run "},
+				{Type: BlockCode, Text: "go test"},
+				{Type: BlockText, Text: " now"},
+			},
+		},
+		{
+			body: "look:\n```\n*not bold*\n```",
+			expected: []*Block{
+				{Type: BlockText, Text: "look:\n"},
+				{Type: BlockCodeBlock, Text: "*not bold*"},
+			},
+		},
+		{
+			body: "see <https://example.com|the docs> or https://golang.org.",
+			expected: []*Block{
+				{Type: BlockText, Text: "see "},
+				{Type: BlockLink, URL: "https://example.com", Text: "the docs"},
+				{Type: BlockText, Text: " or "},
+				{Type: BlockLink, URL: "https://golang.org", Text: "https://golang.org"},
+				{Type: BlockText, Text: "."},
+			},
+		},
+		{
+			body: "hey <@1234> check <#5678|general>",
+			expected: []*Block{
+				{Type: BlockText, Text: "hey "},
+				{Type: BlockMention, ID: "1234"},
+				{Type: BlockText, Text: " check "},
+				{Type: BlockChannel, ID: "5678", Text: "general"},
+			},
+		},
+		{
+			body:     "<javascript:alert(1)|click>",
+			expected: []*Block{{Type: BlockText, Text: "<javascript:alert(1)|click>"}},
+		},
+	}
+
+	for _, c := range cases {
+		blocks := ParseMarkup(c.body)
+		if !reflect.DeepEqual(blocks, c.expected) {
+			t.Errorf("incorrect blocks for `%s`:\n got %s\n expected %s", c.body, dumpBlocks(blocks), dumpBlocks(c.expected))
+		}
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	cases := []struct {
+		body     string
+		expected string
+	}{
+		{
+			body:     "<script>alert('hi')</script>",
+			expected: "&lt;script&gt;alert(&#39;hi&#39;)&lt;/script&gt;",
+		},
+		{
+			body:     "*bold* `<b>`\nnext",
+			expected: "<strong>bold</strong> <code>&lt;b&gt;</code><br>next",
+		},
+		{
+			body:     `<https://example.com/?a="b"|x>`,
+			expected: `<a href="https://example.com/?a=&#34;b&#34;" rel="nofollow noopener noreferrer" target="_blank">x</a>`,
+		},
+		{
+			body:     "<@1234>",
+			expected: `<span class="mention" data-user-id="1234">@1234</span>`,
+		},
+	}
+
+	for _, c := range cases {
+		actual := RenderHTML(ParseMarkup(c.body))
+		if actual != c.expected {
+			t.Errorf("incorrect HTML for `%s`:\n got %s\n expected %s", c.body, actual, c.expected)
+		}
+	}
+
+	// links loaded from the store are checked again before rendering
+	blocks := []*Block{{Type: BlockLink, URL: "javascript:alert(1)", Text: "x"}}
+	if actual := RenderHTML(blocks); actual != "x" {
+		t.Errorf("unsafe link was rendered: got %s", actual)
+	}
+}
+
+func TestRenderPlainText(t *testing.T) {
+	blocks := ParseMarkup("*hi* <@1234>, see <https://example.com|docs>")
+	// pretend the handler resolved the mention
+	blocks[2].Text = "jim"
+	expected := "hi @jim, see docs (https://example.com)"
+	if actual := RenderPlainText(blocks); actual != expected {
+		t.Errorf("incorrect plain text: got `%s` expected `%s`", actual, expected)
+	}
+}
+
+func dumpBlocks(blocks []*Block) string {
+	s := "["
+	for _, b := range blocks {
+		s += "{" + b.Type + " " + b.Text + " " + b.URL + " " + b.ID + " " + dumpBlocks(b.Children) + "}"
+	}
+	return s + "]"
+}
@@ -0,0 +1,76 @@
+package messages
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
+)
+
+// member roles
+const (
+	MemberRoleOwner  = "owner"
+	MemberRoleMember = "member"
+)
+
+// ChannelMember is a member of a channel along with their public profile.
+// Email is left out on purpose since anyone who can see the channel can list its members.
+type ChannelMember struct {
+	ID        users.UserID `json:"id"`
+	UserName  string       `json:"userName"`
+	FirstName string       `json:"firstName"`
+	LastName  string       `json:"lastName"`
+	PhotoURL  string       `json:"photoURL"`
+	Role      string       `json:"role"`
+	JoinedAt  time.Time    `json:"joinedAt"`
+	Online    bool         `json:"online"`
+	// Status is the member's presence, online, away, dnd or offline
+	Status     string     `json:"status"`
+	LastSeenAt *time.Time `json:"lastSeenAt,omitempty"`
+}
+
+// Member returns the user's profile as a member of the channel
+func (c *Channel) Member(user *users.User) *ChannelMember {
+	role := MemberRoleMember
+	if IDString(user.ID) == IDString(c.CreatorID) {
+		role = MemberRoleOwner
+	}
+	return &ChannelMember{
+		ID:        user.ID,
+		UserName:  user.UserName,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		PhotoURL:  user.PhotoURL,
+		Role:      role,
+		JoinedAt:  c.JoinDate(user.ID),
+	}
+}
+
+// JoinDate returns when the user joined the channel. Channels created before
+// join dates were tracked fall back to when the channel was created.
+func (c *Channel) JoinDate(userID users.UserID) time.Time {
+	if joined, found := c.JoinedAt[IDString(userID)]; found {
+		return joined
+	}
+	return c.CreatedAt
+}
+
+// MatchesPrefix reports whether the member's user name, first name or last
+// name starts with the prefix, ignoring case. Used for mention autocomplete.
+func (m *ChannelMember) MatchesPrefix(prefix string) bool {
+	prefix = strings.ToLower(prefix)
+	for _, name := range []string{m.UserName, m.FirstName, m.LastName} {
+		if strings.HasPrefix(strings.ToLower(name), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// SortMembers sorts members by user name so pages stay stable
+func SortMembers(members []*ChannelMember) {
+	sort.Slice(members, func(i, j int) bool {
+		return strings.ToLower(members[i].UserName) < strings.ToLower(members[j].UserName)
+	})
+}
@@ -0,0 +1,55 @@
+package messages
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
+)
+
+func TestChannelMember(t *testing.T) {
+	created := time.Now().Add(-time.Hour)
+	joined := time.Now()
+	owner := &users.User{ID: bson.NewObjectId(), UserName: "owner", FirstName: "Olive"}
+	member := &users.User{ID: bson.NewObjectId(), UserName: "member", LastName: "Smith"}
+	channel := &Channel{
+		CreatedAt: created,
+		CreatorID: owner.ID,
+		Members:   []users.UserID{owner.ID, member.ID},
+		JoinedAt:  map[string]time.Time{IDString(member.ID): joined},
+	}
+
+	m := channel.Member(owner)
+	if m.Role != MemberRoleOwner {
+		t.Errorf("incorrect role for the creator: expected `%s` but got `%s`", MemberRoleOwner, m.Role)
+	}
+	// the owner has no join date so it falls back to when the channel was made
+	if !m.JoinedAt.Equal(created) {
+		t.Errorf("incorrect join date for the creator: expected %v but got %v", created, m.JoinedAt)
+	}
+
+	m = channel.Member(member)
+	if m.Role != MemberRoleMember {
+		t.Errorf("incorrect role for a member: expected `%s` but got `%s`", MemberRoleMember, m.Role)
+	}
+	if !m.JoinedAt.Equal(joined) {
+		t.Errorf("incorrect join date for a member: expected %v but got %v", joined, m.JoinedAt)
+	}
+
+	cases := []struct {
+		prefix   string
+		expected bool
+	}{
+		{prefix: "", expected: true},
+		{prefix: "mem", expected: true},
+		{prefix: "SMI", expected: true},
+		{prefix: "olive", expected: false},
+	}
+	for _, c := range cases {
+		if actual := m.MatchesPrefix(c.prefix); actual != c.expected {
+			t.Errorf("incorrect match for prefix `%s`: expected %v but got %v", c.prefix, c.expected, actual)
+		}
+	}
+}
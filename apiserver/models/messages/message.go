@@ -4,8 +4,6 @@ import (
 	"errors"
 	"time"
 
-	"gopkg.in/mgo.v2/bson"
-
 	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
 )
 
@@ -16,26 +14,50 @@ type MessageID interface{}
 type Message struct {
 	ID        MessageID    `json:"id" bson:"_id"`
 	ChannelID ChannelID    `json:"channelID"`
+	Type      string       `json:"type"`
 	Body      string       `json:"body"`
+	Blocks    []*Block     `json:"blocks"`
+	PlainText string       `json:"plainText,omitempty" bson:"-"`
 	CreatedAt time.Time    `json:"createdAt"`
 	CreatorID users.UserID `json:"creatorID"`
 	EditedAt  time.Time    `json:"editedAt"`
+	Poll      *Poll        `json:"poll,omitempty"`
+	Forward   *ForwardRef  `json:"forward,omitempty"`
+	Version   int          `json:"version"`
+	// Nonce is the client's nonce from the NewMessage, echoed back
+	// so the sender can match the message to the one it displayed
+	Nonce string `json:"nonce,omitempty" bson:"nonce,omitempty"`
+	// Bot is set on messages posted through an incoming webhook
+	Bot         *BotAuthor    `json:"bot,omitempty" bson:"bot,omitempty"`
+	Attachments []*Attachment `json:"attachments,omitempty" bson:"attachments,omitempty"`
 }
 
 // NewMessage represents a new message when created
 type NewMessage struct {
 	ChannelID ChannelID `json:"channelID"`
 	Body      string    `json:"body"`
+	Poll      *NewPoll  `json:"poll,omitempty"`
+	// Nonce is an optional client generated value used to spot retries
+	Nonce string `json:"nonce,omitempty"`
+	// Forward is set by the forward handler and can't be sent by clients
+	Forward *ForwardRef `json:"-"`
+	// Bot and Attachments are set by the incoming webhook handler and can't be sent by clients
+	Bot         *BotAuthor    `json:"-"`
+	Attachments []*Attachment `json:"-"`
 }
 
 // MessageUpdates represents message updates that can be applied to a message
 type MessageUpdates struct {
-	Body string `json:"body"`
+	Body   string   `json:"body"`
+	Blocks []*Block `json:"-"`
+	// Version is the version the updates are based on, 0 for any version
+	Version int `json:"-" bson:"-"`
 }
 
 // Validate validates a new message
 func (nm *NewMessage) Validate() error {
-	if len(nm.Body) == 0 {
+	// the comment on a forwarded message and the text of a bot message with attachments are optional
+	if len(nm.Body) == 0 && nm.Forward == nil && len(nm.Attachments) == 0 {
 		return errors.New("Error: body is zero length")
 	}
 
@@ -43,27 +65,44 @@ func (nm *NewMessage) Validate() error {
 		return errors.New("Error: no channel specified")
 	}
 
-	return nil
-}
-
-// ToMessage converts a NewMessage to a Message
-func (nm *NewMessage) ToMessage(creator *users.User) (*Message, error) {
-	// make sure that the creatorID is a bson ID
-	if sID, ok := creator.ID.(string); ok {
-		creator.ID = bson.ObjectIdHex(sID)
+	if err := nm.validateBot(); err != nil {
+		return err
 	}
 
-	// make sure that the ChannelID is a bson ID
-	if sID, ok := nm.ChannelID.(string); ok {
-		nm.ChannelID = bson.ObjectIdHex(sID)
+	if nm.Poll != nil {
+		return nm.Poll.Validate()
 	}
 
+	return nil
+}
+
+// ToMessage converts a NewMessage to a Message.
+// IDs are left as they are, it is up to each store to convert them.
+func (nm *NewMessage) ToMessage(creator *users.User) (*Message, error) {
 	// return a new message
 	// EditedAt will be null and then can be used to check to display *(edited sym)
-	return &Message{
+	message := &Message{
 		ChannelID: nm.ChannelID,
+		Type:      MessageTypeText,
 		Body:      nm.Body,
+		Blocks:    ParseMarkup(nm.Body),
 		CreatedAt: time.Now(),
 		CreatorID: creator.ID,
-	}, nil
+		Version:   1,
+		Nonce:     nm.Nonce,
+		Bot:       nm.Bot,
+	}
+	if len(nm.Attachments) > 0 {
+		message.Attachments = nm.Attachments
+	}
+	// the body of a poll message is the question
+	if nm.Poll != nil {
+		message.Type = MessageTypePoll
+		message.Poll = nm.Poll.ToPoll()
+	}
+	if nm.Forward != nil {
+		message.Type = MessageTypeForward
+		message.Forward = nm.Forward
+	}
+	return message, nil
 }
@@ -0,0 +1,836 @@
+// Package messagestest is a conformance test suite for messages.Store
+// implementations, so every backend is held to the same contract.
+package messagestest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/messages"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
+)
+
+// NewStoreFunc returns a new, empty store for a test. It should
+// use t.Cleanup to release anything the store holds on to.
+type NewStoreFunc func(t *testing.T) messages.Store
+
+// TestStore runs the conformance suite against the stores returned
+// by newStore, each test gets its own store
+func TestStore(t *testing.T, newStore NewStoreFunc) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store messages.Store)
+	}{
+		{"Channels", testChannels},
+		{"ChannelVisibility", testChannelVisibility},
+		{"UpdateChannel", testUpdateChannel},
+		{"DeleteChannel", testDeleteChannel},
+		{"Membership", testMembership},
+		{"Messages", testMessages},
+		{"BotMessages", testBotMessages},
+		{"RecentMessages", testRecentMessages},
+		{"UpdateMessage", testUpdateMessage},
+		{"DeleteMessage", testDeleteMessage},
+		{"Polls", testPolls},
+		{"Moderation", testModeration},
+		{"Analytics", testAnalytics},
+		{"ConcurrentChannelUpdates", testConcurrentChannelUpdates},
+		{"ConcurrentChannelInserts", testConcurrentChannelInserts},
+		{"ConcurrentMessages", testConcurrentMessages},
+		{"ConcurrentVotes", testConcurrentVotes},
+	}
+	for _, tt := range tests {
+		test := tt.test
+		t.Run(tt.name, func(t *testing.T) {
+			test(t, newStore(t))
+		})
+	}
+}
+
+// newID returns an ID that is valid for every backend
+func newID() string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// newUser returns a user with a new ID, users are
+// kept in a separate store so only the ID matters
+func newUser() *users.User {
+	return &users.User{ID: newID()}
+}
+
+// sameID reports whether the IDs are the same, whatever type the store uses for them
+func sameID(a, b interface{}) bool {
+	return messages.IDString(a) == messages.IDString(b)
+}
+
+// insertChannel inserts a channel and fails the test on error
+func insertChannel(t *testing.T, store messages.Store, name string, private bool, creator *users.User) *messages.Channel {
+	t.Helper()
+	c, err := store.InsertChannel(&messages.NewChannel{Name: name, Description: name, Private: private}, creator)
+	if err != nil {
+		t.Fatalf("error inserting channel %s: %v", name, err)
+	}
+	return c
+}
+
+// addUser adds the user to the channel and fails the test on error
+func addUser(t *testing.T, store messages.Store, user *users.User, channel *messages.Channel, adder *users.User) {
+	t.Helper()
+	if err := store.AddUserToChannel(user.ID, channel.ID, adder.ID); err != nil {
+		t.Fatalf("error adding user to channel: %v", err)
+	}
+}
+
+// insertMessage posts a message and fails the test on error
+func insertMessage(t *testing.T, store messages.Store, channel *messages.Channel, body string, creator *users.User) *messages.Message {
+	t.Helper()
+	m, err := store.InsertMessage(&messages.NewMessage{ChannelID: channel.ID, Body: body}, creator)
+	if err != nil {
+		t.Fatalf("error inserting message: %v", err)
+	}
+	return m
+}
+
+// getChannel gets the channel by ID and fails the test on error
+func getChannel(t *testing.T, store messages.Store, id interface{}) *messages.Channel {
+	t.Helper()
+	c, err := store.GetChannelByID(id)
+	if err != nil {
+		t.Fatalf("error getting channel: %v", err)
+	}
+	return c
+}
+
+// getMessage gets the message by ID and fails the test on error
+func getMessage(t *testing.T, store messages.Store, id interface{}) *messages.Message {
+	t.Helper()
+	m, err := store.GetMessageByID(id)
+	if err != nil {
+		t.Fatalf("error getting message: %v", err)
+	}
+	return m
+}
+
+// hasChannel reports whether the channel is in the list
+func hasChannel(channels []*messages.Channel, channel *messages.Channel) bool {
+	for _, c := range channels {
+		if sameID(c.ID, channel.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+func testChannels(t *testing.T, store messages.Store) {
+	owner := newUser()
+	c := insertChannel(t, store, "chan", false, owner)
+	if len(messages.IDString(c.ID)) == 0 {
+		t.Fatalf("new channel has no ID")
+	}
+	if !sameID(c.CreatorID, owner.ID) || !c.IsMember(owner.ID) || len(c.Members) != 1 {
+		t.Errorf("expected the creator to be the only member but got creator %v and members %v", c.CreatorID, c.Members)
+	}
+	if c.Version != 1 {
+		t.Errorf("expected a new channel to be at version 1 but got %d", c.Version)
+	}
+
+	for name, get := range map[string]func() (*messages.Channel, error){
+		"ID":   func() (*messages.Channel, error) { return store.GetChannelByID(c.ID) },
+		"name": func() (*messages.Channel, error) { return store.GetChannelByName("chan") },
+	} {
+		c2, err := get()
+		if err != nil {
+			t.Errorf("error getting channel by %s: %v", name, err)
+			continue
+		}
+		if !sameID(c2.ID, c.ID) || c2.Name != "chan" || c2.Description != "chan" || c2.Private {
+			t.Errorf("channel fetched by %s doesn't match: %+v", name, c2)
+		}
+		if !c2.IsMember(owner.ID) {
+			t.Errorf("channel fetched by %s lost its members: %v", name, c2.Members)
+		}
+	}
+
+	if _, err := store.GetChannelByID(newID()); err != messages.ErrChannelNotFound {
+		t.Errorf("expected ErrChannelNotFound getting a missing ID but got %v", err)
+	}
+	if _, err := store.GetChannelByID("general"); err != messages.ErrChannelNotFound {
+		t.Errorf("expected ErrChannelNotFound getting a malformed ID but got %v", err)
+	}
+	if _, err := store.GetChannelByName("missing"); err != messages.ErrChannelNotFound {
+		t.Errorf("expected ErrChannelNotFound getting a missing name but got %v", err)
+	}
+	if _, err := store.InsertChannel(&messages.NewChannel{Name: "chan"}, newUser()); err != messages.ErrDuplicateKey {
+		t.Errorf("expected ErrDuplicateKey inserting a taken name but got %v", err)
+	}
+	if _, err := store.InsertChannel(&messages.NewChannel{}, owner); err == nil {
+		t.Errorf("expected an error inserting a channel without a name")
+	}
+
+	// the initial members can be given
+	member := newUser()
+	c = getChannel(t, store, insertChannelWithMembers(t, store, owner, member).ID)
+	if !c.IsMember(owner.ID) || !c.IsMember(member.ID) || len(c.Members) != 2 {
+		t.Errorf("expected the given members but got %v", c.Members)
+	}
+}
+
+// insertChannelWithMembers inserts a private channel with the creator and member in it
+func insertChannelWithMembers(t *testing.T, store messages.Store, creator *users.User, member *users.User) *messages.Channel {
+	t.Helper()
+	nc := &messages.NewChannel{
+		Name:    "members",
+		Members: []users.UserID{messages.IDString(creator.ID), messages.IDString(member.ID)},
+		Private: true,
+	}
+	c, err := store.InsertChannel(nc, creator)
+	if err != nil {
+		t.Fatalf("error inserting channel with members: %v", err)
+	}
+	// the members can post straight away
+	insertMessage(t, store, c, "hello", member)
+	return c
+}
+
+func testChannelVisibility(t *testing.T, store messages.Store) {
+	owner := newUser()
+	member := newUser()
+	other := newUser()
+	public := insertChannel(t, store, "public", false, owner)
+	private := insertChannel(t, store, "private", true, owner)
+	addUser(t, store, member, private, owner)
+
+	for _, tt := range []struct {
+		name    string
+		user    *users.User
+		private bool
+	}{
+		{"owner", owner, true},
+		{"member", member, true},
+		{"other", other, false},
+	} {
+		channels, err := store.GetAllUserChannels(tt.user)
+		if err != nil {
+			t.Fatalf("error getting the %s's channels: %v", tt.name, err)
+		}
+		if !hasChannel(channels, public) {
+			t.Errorf("expected the %s to see the public channel", tt.name)
+		}
+		if hasChannel(channels, private) != tt.private {
+			t.Errorf("expected the %s seeing the private channel to be %t", tt.name, tt.private)
+		}
+	}
+}
+
+func testUpdateChannel(t *testing.T, store messages.Store) {
+	owner := newUser()
+	other := newUser()
+	c := insertChannel(t, store, "chan", false, owner)
+	insertChannel(t, store, "taken", false, owner)
+
+	updates := &messages.ChannelUpdates{Name: "renamed", Description: "new", Version: 1}
+	if err := store.UpdateChannel(updates, c.ID, other); err != messages.ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized updating someone else's channel but got %v", err)
+	}
+	if err := store.UpdateChannel(updates, newID(), owner); err != messages.ErrChannelNotFound {
+		t.Errorf("expected ErrChannelNotFound updating a missing channel but got %v", err)
+	}
+	if err := store.UpdateChannel(updates, c.ID, owner); err != nil {
+		t.Fatalf("error updating channel: %v", err)
+	}
+	c2 := getChannel(t, store, c.ID)
+	if c2.Name != "renamed" || c2.Description != "new" || c2.Version != 2 {
+		t.Errorf("channel not updated: got %s, %s at version %d", c2.Name, c2.Description, c2.Version)
+	}
+	if !c2.IsMember(owner.ID) || !sameID(c2.CreatorID, owner.ID) {
+		t.Errorf("update changed the channel's creator or members: %+v", c2)
+	}
+
+	// the update was based on version 1, which is stale now
+	if err := store.UpdateChannel(updates, c.ID, owner); err != messages.ErrVersionMismatch {
+		t.Errorf("expected ErrVersionMismatch for a stale version but got %v", err)
+	}
+	// version 0 matches any version
+	if err := store.UpdateChannel(&messages.ChannelUpdates{Name: "renamed"}, c.ID, owner); err != nil {
+		t.Errorf("error updating channel at any version: %v", err)
+	}
+	if err := store.UpdateChannel(&messages.ChannelUpdates{Name: "taken"}, c.ID, owner); err != messages.ErrDuplicateKey {
+		t.Errorf("expected ErrDuplicateKey renaming to a taken name but got %v", err)
+	}
+}
+
+func testDeleteChannel(t *testing.T, store messages.Store) {
+	owner := newUser()
+	other := newUser()
+	c := insertChannel(t, store, "chan", false, owner)
+	keep := insertChannel(t, store, "keep", false, owner)
+	m := insertMessage(t, store, c, "hello", owner)
+	kept := insertMessage(t, store, keep, "hello", owner)
+
+	if err := store.DeleteChannel(c.ID, other, 0); err != messages.ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized deleting someone else's channel but got %v", err)
+	}
+	if err := store.DeleteChannel(newID(), owner, 0); err != messages.ErrChannelNotFound {
+		t.Errorf("expected ErrChannelNotFound deleting a missing channel but got %v", err)
+	}
+	if err := store.DeleteChannel(c.ID, owner, 2); err != messages.ErrVersionMismatch {
+		t.Errorf("expected ErrVersionMismatch for the wrong version but got %v", err)
+	}
+	if err := store.DeleteChannel(c.ID, owner, 1); err != nil {
+		t.Fatalf("error deleting channel: %v", err)
+	}
+
+	if _, err := store.GetChannelByID(c.ID); err != messages.ErrChannelNotFound {
+		t.Errorf("expected ErrChannelNotFound for the deleted channel but got %v", err)
+	}
+	if _, err := store.GetMessageByID(m.ID); err != messages.ErrMessageNotFound {
+		t.Errorf("expected the deleted channel's messages to be deleted but got %v", err)
+	}
+	getChannel(t, store, keep.ID)
+	getMessage(t, store, kept.ID)
+}
+
+func testMembership(t *testing.T, store messages.Store) {
+	owner := newUser()
+	member := newUser()
+	other := newUser()
+	private := insertChannel(t, store, "private", true, owner)
+	public := insertChannel(t, store, "public", false, owner)
+
+	// only the creator can add people to a private channel
+	if err := store.AddUserToChannel(member.ID, private.ID, member.ID); err != messages.ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized joining a private channel but got %v", err)
+	}
+	addUser(t, store, member, private, owner)
+	if err := store.AddUserToChannel(member.ID, private.ID, owner.ID); err != messages.ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized adding a member twice but got %v", err)
+	}
+	if err := store.AddUserToChannel(member.ID, newID(), owner.ID); err != messages.ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized joining a missing channel but got %v", err)
+	}
+	c := getChannel(t, store, private.ID)
+	if !c.IsMember(member.ID) || len(c.Members) != 2 {
+		t.Errorf("member not added to channel: %v", c.Members)
+	}
+
+	// anyone can join a public channel
+	addUser(t, store, other, public, other)
+	if c := getChannel(t, store, public.ID); !c.IsMember(other.ID) {
+		t.Errorf("user didn't join the public channel: %v", c.Members)
+	}
+
+	// only the creator can remove people from a private channel
+	if err := store.RemoveUserFromChannel(member.ID, private.ID, member.ID); err != messages.ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized leaving a private channel but got %v", err)
+	}
+	if err := store.RemoveUserFromChannel(member.ID, newID(), owner.ID); err != messages.ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized leaving a missing channel but got %v", err)
+	}
+	if err := store.RemoveUserFromChannel(member.ID, private.ID, owner.ID); err != nil {
+		t.Fatalf("error removing user from channel: %v", err)
+	}
+	c = getChannel(t, store, private.ID)
+	if c.IsMember(member.ID) || !c.IsMember(owner.ID) {
+		t.Errorf("wrong members after removing a user: %v", c.Members)
+	}
+	if _, err := store.InsertMessage(&messages.NewMessage{ChannelID: private.ID, Body: "hi"}, member); err != messages.ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized posting after being removed but got %v", err)
+	}
+
+	// anyone can leave a public channel
+	if err := store.RemoveUserFromChannel(other.ID, public.ID, other.ID); err != nil {
+		t.Fatalf("error leaving public channel: %v", err)
+	}
+	if c := getChannel(t, store, public.ID); c.IsMember(other.ID) {
+		t.Errorf("user didn't leave the public channel: %v", c.Members)
+	}
+}
+
+func testMessages(t *testing.T, store messages.Store) {
+	owner := newUser()
+	other := newUser()
+	c := insertChannel(t, store, "chan", false, owner)
+
+	// only members can post, even to public channels
+	if _, err := store.InsertMessage(&messages.NewMessage{ChannelID: c.ID, Body: "hi"}, other); err != messages.ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized posting without being a member but got %v", err)
+	}
+	if _, err := store.InsertMessage(&messages.NewMessage{ChannelID: newID(), Body: "hi"}, owner); err != messages.ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized posting to a missing channel but got %v", err)
+	}
+	if _, err := store.InsertMessage(&messages.NewMessage{ChannelID: c.ID}, owner); err == nil {
+		t.Errorf("expected an error posting a message without a body")
+	}
+
+	m, err := store.InsertMessage(&messages.NewMessage{ChannelID: c.ID, Body: "hello *world*", Nonce: "abc"}, owner)
+	if err != nil {
+		t.Fatalf("error inserting message: %v", err)
+	}
+	if len(messages.IDString(m.ID)) == 0 {
+		t.Fatalf("new message has no ID")
+	}
+	if m.Version != 1 || m.Type != messages.MessageTypeText {
+		t.Errorf("expected a version 1 text message but got version %d of type %s", m.Version, m.Type)
+	}
+
+	m2 := getMessage(t, store, m.ID)
+	if !sameID(m2.ID, m.ID) || !sameID(m2.ChannelID, c.ID) || !sameID(m2.CreatorID, owner.ID) {
+		t.Errorf("message IDs don't match: %+v", m2)
+	}
+	if m2.Body != "hello *world*" || len(m2.Blocks) == 0 || m2.Nonce != "abc" || m2.Version != 1 {
+		t.Errorf("message fields don't match: %+v", m2)
+	}
+	if m2.CreatedAt.IsZero() || !m2.EditedAt.IsZero() {
+		t.Errorf("expected a created time and no edited time but got %v and %v", m2.CreatedAt, m2.EditedAt)
+	}
+	if _, err := store.GetMessageByID(newID()); err != messages.ErrMessageNotFound {
+		t.Errorf("expected ErrMessageNotFound getting a missing message but got %v", err)
+	}
+	if _, err := store.GetMessageByID("not-an-id"); err != messages.ErrMessageNotFound {
+		t.Errorf("expected ErrMessageNotFound getting a malformed ID but got %v", err)
+	}
+}
+
+func testBotMessages(t *testing.T, store messages.Store) {
+	owner := newUser()
+	c := insertChannel(t, store, "alerts", false, owner)
+
+	nm := &messages.NewMessage{
+		ChannelID: c.ID,
+		Bot:       &messages.BotAuthor{HookID: "hook1", Name: "Monitoring"},
+		Attachments: []*messages.Attachment{
+			{Title: "disk full", TitleLink: "https://status.example.com/1", Text: "/var is at 98%", Color: "#d00000"},
+		},
+	}
+	m, err := store.InsertMessage(nm, owner)
+	if err != nil {
+		t.Fatalf("error inserting bot message: %v", err)
+	}
+
+	// the bot author and attachments are stored with the message
+	m2 := getMessage(t, store, m.ID)
+	if m2.Bot == nil || m2.Bot.HookID != "hook1" || m2.Bot.Name != "Monitoring" {
+		t.Errorf("expected the bot author to be stored but got %+v", m2.Bot)
+	}
+	if len(m2.Attachments) != 1 || *m2.Attachments[0] != *nm.Attachments[0] {
+		t.Errorf("expected the attachment to be stored but got %+v", m2.Attachments)
+	}
+
+	// and left off other messages
+	m3 := getMessage(t, store, insertMessage(t, store, c, "hi", owner).ID)
+	if m3.Bot != nil || len(m3.Attachments) != 0 {
+		t.Errorf("expected a message without a bot author or attachments but got %+v", m3)
+	}
+}
+
+func testRecentMessages(t *testing.T, store messages.Store) {
+	owner := newUser()
+	member := newUser()
+	other := newUser()
+	public := insertChannel(t, store, "public", false, owner)
+	private := insertChannel(t, store, "private", true, owner)
+	addUser(t, store, member, private, owner)
+	insertMessage(t, store, private, "secret", owner)
+
+	var posted []*messages.Message
+	for i := 0; i < 5; i++ {
+		posted = append(posted, insertMessage(t, store, public, fmt.Sprintf("message %d", i), owner))
+		// keep the created times apart for stores that only keep milliseconds
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	recent, err := store.GetRecentMessages(public.ID, other, 3)
+	if err != nil {
+		t.Fatalf("error getting recent messages: %v", err)
+	}
+	if len(recent) != 3 {
+		t.Fatalf("expected 3 messages but got %d", len(recent))
+	}
+	// newest first
+	for i, m := range recent {
+		if !sameID(m.ID, posted[4-i].ID) {
+			t.Errorf("expected message %d to be %q but got %q", i, posted[4-i].Body, m.Body)
+		}
+	}
+
+	if _, err := store.GetRecentMessages(private.ID, other, 10); err != messages.ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized reading a private channel but got %v", err)
+	}
+	if _, err := store.GetRecentMessages(newID(), owner, 10); err != messages.ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized reading a missing channel but got %v", err)
+	}
+	recent, err = store.GetRecentMessages(private.ID, member, 10)
+	if err != nil || len(recent) != 1 || recent[0].Body != "secret" {
+		t.Errorf("expected the member to read only the private channel's message but got %v, %v", recent, err)
+	}
+}
+
+func testUpdateMessage(t *testing.T, store messages.Store) {
+	owner := newUser()
+	member := newUser()
+	c := insertChannel(t, store, "chan", false, owner)
+	addUser(t, store, member, c, member)
+	m := insertMessage(t, store, c, "hello", owner)
+	theirs := insertMessage(t, store, c, "theirs", member)
+
+	updates := &messages.MessageUpdates{Body: "edited *body*", Version: 1}
+	if err := store.UpdateMessage(updates, m.ID, member); err != messages.ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized editing someone else's message but got %v", err)
+	}
+	if err := store.UpdateMessage(updates, newID(), owner); err != messages.ErrMessageNotFound {
+		t.Errorf("expected ErrMessageNotFound editing a missing message but got %v", err)
+	}
+	if err := store.UpdateMessage(updates, "not-an-id", owner); err != messages.ErrMessageNotFound {
+		t.Errorf("expected ErrMessageNotFound editing a malformed ID but got %v", err)
+	}
+	if err := store.UpdateMessage(updates, m.ID, owner); err != nil {
+		t.Fatalf("error updating message: %v", err)
+	}
+	m2 := getMessage(t, store, m.ID)
+	if m2.Body != "edited *body*" || m2.Version != 2 || len(m2.Blocks) == 0 {
+		t.Errorf("message not updated: got %q at version %d with blocks %v", m2.Body, m2.Version, m2.Blocks)
+	}
+	if err := store.UpdateMessage(updates, m.ID, owner); err != messages.ErrVersionMismatch {
+		t.Errorf("expected ErrVersionMismatch for a stale version but got %v", err)
+	}
+	if err := store.UpdateMessage(&messages.MessageUpdates{Body: "again"}, m.ID, owner); err != nil {
+		t.Errorf("error updating message at any version: %v", err)
+	}
+
+	// only that message is changed
+	if theirs2 := getMessage(t, store, theirs.ID); theirs2.Body != "theirs" || theirs2.Version != 1 {
+		t.Errorf("update changed another message: %+v", theirs2)
+	}
+}
+
+func testDeleteMessage(t *testing.T, store messages.Store) {
+	owner := newUser()
+	member := newUser()
+	c := insertChannel(t, store, "chan", false, owner)
+	addUser(t, store, member, c, member)
+	m := insertMessage(t, store, c, "hello", owner)
+	theirs := insertMessage(t, store, c, "theirs", member)
+
+	if err := store.DeleteMessage(m.ID, member, 0); err != messages.ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized deleting someone else's message but got %v", err)
+	}
+	if err := store.DeleteMessage(newID(), owner, 0); err != messages.ErrMessageNotFound {
+		t.Errorf("expected ErrMessageNotFound deleting a missing message but got %v", err)
+	}
+	if err := store.DeleteMessage(m.ID, owner, 2); err != messages.ErrVersionMismatch {
+		t.Errorf("expected ErrVersionMismatch for the wrong version but got %v", err)
+	}
+	if err := store.DeleteMessage(m.ID, owner, 1); err != nil {
+		t.Fatalf("error deleting message: %v", err)
+	}
+	if _, err := store.GetMessageByID(m.ID); err != messages.ErrMessageNotFound {
+		t.Errorf("expected ErrMessageNotFound for the deleted message but got %v", err)
+	}
+	getMessage(t, store, theirs.ID)
+}
+
+func testPolls(t *testing.T, store messages.Store) {
+	owner := newUser()
+	member := newUser()
+	other := newUser()
+	c := insertChannel(t, store, "chan", false, owner)
+	addUser(t, store, member, c, member)
+
+	np := &messages.NewMessage{
+		ChannelID: c.ID,
+		Body:      "lunch?",
+		Poll:      &messages.NewPoll{Options: []string{"pizza", "tacos"}},
+	}
+	poll, err := store.InsertMessage(np, owner)
+	if err != nil {
+		t.Fatalf("error inserting poll: %v", err)
+	}
+	if poll.Type != messages.MessageTypePoll || poll.Poll == nil {
+		t.Fatalf("expected a poll message but got %+v", poll)
+	}
+	text := insertMessage(t, store, c, "not a poll", owner)
+
+	if _, err := store.CastVote(text.ID, owner, &messages.Vote{Options: []int{0}}); err != messages.ErrNotAPoll {
+		t.Errorf("expected ErrNotAPoll voting on a text message but got %v", err)
+	}
+	if _, err := store.CastVote(poll.ID, other, &messages.Vote{Options: []int{0}}); err != messages.ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized voting without being a member but got %v", err)
+	}
+	if _, err := store.CastVote(newID(), owner, &messages.Vote{Options: []int{0}}); err != messages.ErrMessageNotFound {
+		t.Errorf("expected ErrMessageNotFound voting on a missing poll but got %v", err)
+	}
+	if _, err := store.CastVote(poll.ID, owner, &messages.Vote{Options: []int{5}}); err == nil {
+		t.Errorf("expected an error voting for a missing option")
+	}
+
+	if _, err := store.CastVote(poll.ID, owner, &messages.Vote{Options: []int{0}}); err != nil {
+		t.Fatalf("error voting: %v", err)
+	}
+	if _, err := store.CastVote(poll.ID, member, &messages.Vote{Options: []int{0}}); err != nil {
+		t.Fatalf("error voting: %v", err)
+	}
+	// voting again replaces the old vote
+	m, err := store.CastVote(poll.ID, member, &messages.Vote{Options: []int{1}})
+	if err != nil {
+		t.Fatalf("error changing vote: %v", err)
+	}
+	if m.Poll.Options[0].Votes != 1 || m.Poll.Options[1].Votes != 1 {
+		t.Errorf("expected one vote each but got %d and %d", m.Poll.Options[0].Votes, m.Poll.Options[1].Votes)
+	}
+	// the tally is the same when the poll is read back
+	m = getMessage(t, store, poll.ID)
+	if m.Poll.Options[0].Votes != 1 || m.Poll.Options[1].Votes != 1 {
+		t.Errorf("expected one vote each when read back but got %d and %d", m.Poll.Options[0].Votes, m.Poll.Options[1].Votes)
+	}
+
+	// an empty vote withdraws it
+	m, err = store.CastVote(poll.ID, owner, &messages.Vote{})
+	if err != nil {
+		t.Fatalf("error withdrawing vote: %v", err)
+	}
+	if m.Poll.Options[0].Votes != 0 || m.Poll.Options[1].Votes != 1 {
+		t.Errorf("expected the vote to be withdrawn but got %d and %d", m.Poll.Options[0].Votes, m.Poll.Options[1].Votes)
+	}
+}
+
+func testModeration(t *testing.T, store messages.Store) {
+	owner := newUser()
+	spammer := newUser()
+	c := insertChannel(t, store, "chan", false, owner)
+	dest := insertChannel(t, store, "dest", false, owner)
+	addUser(t, store, spammer, c, spammer)
+	var spam []messages.MessageID
+	for i := 0; i < 3; i++ {
+		spam = append(spam, insertMessage(t, store, c, "spam", spammer).ID)
+	}
+	good := insertMessage(t, store, c, "good", owner)
+
+	refs, err := store.FindMessageRefs(&messages.MessageQuery{CreatorID: spammer.ID})
+	if err != nil {
+		t.Fatalf("error finding messages: %v", err)
+	}
+	if len(refs) != 3 {
+		t.Fatalf("expected 3 messages by the spammer but got %d", len(refs))
+	}
+	for _, ref := range refs {
+		if !sameID(ref.ChannelID, c.ID) {
+			t.Errorf("expected the message to be in %v but got %v", c.ID, ref.ChannelID)
+		}
+	}
+	refs, err = store.FindMessageRefs(&messages.MessageQuery{IDs: spam[:1]})
+	if err != nil || len(refs) != 1 || !sameID(refs[0].ID, spam[0]) {
+		t.Errorf("expected to find only the message with the ID but got %v, %v", refs, err)
+	}
+
+	n, err := store.MoveMessages(spam[:1], dest.ID)
+	if err != nil || n != 1 {
+		t.Fatalf("expected to move 1 message but got %d, %v", n, err)
+	}
+	moved := getMessage(t, store, spam[0])
+	if !sameID(moved.ChannelID, dest.ID) || moved.Version != 2 {
+		t.Errorf("expected the message to be in %v at version 2 but got %v at version %d", dest.ID, moved.ChannelID, moved.Version)
+	}
+
+	n, err = store.DeleteMessages(append(spam, newID()))
+	if err != nil || n != 3 {
+		t.Fatalf("expected to delete 3 messages but got %d, %v", n, err)
+	}
+	for _, id := range spam {
+		if _, err := store.GetMessageByID(id); err != messages.ErrMessageNotFound {
+			t.Errorf("expected ErrMessageNotFound for a deleted message but got %v", err)
+		}
+	}
+	getMessage(t, store, good.ID)
+}
+
+func testAnalytics(t *testing.T, store messages.Store) {
+	owner := newUser()
+	member := newUser()
+	lurker := newUser()
+	c := insertChannel(t, store, "chan", false, owner)
+	addUser(t, store, member, c, member)
+	addUser(t, store, lurker, c, lurker)
+	for i := 0; i < 3; i++ {
+		insertMessage(t, store, c, "hello", member)
+	}
+	insertMessage(t, store, c, "hello", owner)
+	// messages in other channels don't count
+	other := insertChannel(t, store, "other", false, owner)
+	insertMessage(t, store, other, "hello", owner)
+
+	query := &messages.AnalyticsQuery{}
+	if err := query.Validate(); err != nil {
+		t.Fatalf("error validating query: %v", err)
+	}
+	a, err := store.GetChannelAnalytics(getChannel(t, store, c.ID), query)
+	if err != nil {
+		t.Fatalf("error getting analytics: %v", err)
+	}
+	if a.Total != 4 || len(a.Members) != 3 {
+		t.Errorf("expected 4 messages by 3 members but got %d by %d", a.Total, len(a.Members))
+	}
+	if len(a.TopPosters) != 2 || !sameID(a.TopPosters[0].UserID, member.ID) || a.TopPosters[0].Count != 3 {
+		t.Errorf("expected the member to be the top poster with 3 messages but got %v", a.TopPosters)
+	}
+	if len(a.NeverPosted) != 1 || !sameID(a.NeverPosted[0], lurker.ID) {
+		t.Errorf("expected only the lurker to have never posted but got %v", a.NeverPosted)
+	}
+	days := 0
+	for _, d := range a.MessagesPerDay {
+		days += d.Count
+	}
+	if days != 4 {
+		t.Errorf("expected 4 messages across the days but got %d", days)
+	}
+}
+
+func testConcurrentChannelUpdates(t *testing.T, store messages.Store) {
+	owner := newUser()
+	c := insertChannel(t, store, "chan", false, owner)
+
+	// every update is based on version 1, so only one of them can win
+	const n = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	updated := 0
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			updates := &messages.ChannelUpdates{Name: fmt.Sprintf("chan%d", i), Version: 1}
+			err := store.UpdateChannel(updates, c.ID, &users.User{ID: messages.IDString(owner.ID)})
+			mu.Lock()
+			defer mu.Unlock()
+			switch err {
+			case nil:
+				updated++
+			case messages.ErrVersionMismatch:
+			default:
+				t.Errorf("expected ErrVersionMismatch but got %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if updated != 1 {
+		t.Errorf("expected exactly one update to win but %d did", updated)
+	}
+	if c2 := getChannel(t, store, c.ID); c2.Version != 2 {
+		t.Errorf("expected the channel to be at version 2 but got %d", c2.Version)
+	}
+}
+
+func testConcurrentChannelInserts(t *testing.T, store messages.Store) {
+	const n = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	inserted := 0
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.InsertChannel(&messages.NewChannel{Name: "chan"}, newUser())
+			mu.Lock()
+			defer mu.Unlock()
+			switch err {
+			case nil:
+				inserted++
+			case messages.ErrDuplicateKey:
+			default:
+				t.Errorf("expected ErrDuplicateKey but got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if inserted != 1 {
+		t.Errorf("expected exactly one channel named chan to be inserted but %d were", inserted)
+	}
+}
+
+func testConcurrentMessages(t *testing.T, store messages.Store) {
+	owner := newUser()
+	c := insertChannel(t, store, "chan", false, owner)
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// each poster joins and posts at the same time as the others
+			poster := newUser()
+			if err := store.AddUserToChannel(poster.ID, c.ID, poster.ID); err != nil {
+				errs <- err
+				return
+			}
+			if _, err := store.InsertMessage(&messages.NewMessage{ChannelID: c.ID, Body: fmt.Sprint(i)}, poster); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("error posting concurrently: %v", err)
+	}
+
+	if c2 := getChannel(t, store, c.ID); len(c2.Members) != n+1 {
+		t.Errorf("expected %d members but got %d", n+1, len(c2.Members))
+	}
+	recent, err := store.GetRecentMessages(c.ID, owner, 2*n)
+	if err != nil {
+		t.Fatalf("error getting recent messages: %v", err)
+	}
+	if len(recent) != n {
+		t.Errorf("expected %d messages but got %d", n, len(recent))
+	}
+}
+
+func testConcurrentVotes(t *testing.T, store messages.Store) {
+	owner := newUser()
+	c := insertChannel(t, store, "chan", false, owner)
+	np := &messages.NewMessage{
+		ChannelID: c.ID,
+		Body:      "lunch?",
+		Poll:      &messages.NewPoll{Options: []string{"pizza", "tacos"}},
+	}
+	poll, err := store.InsertMessage(np, owner)
+	if err != nil {
+		t.Fatalf("error inserting poll: %v", err)
+	}
+
+	const n = 10
+	voters := make([]*users.User, n)
+	for i := range voters {
+		voters[i] = newUser()
+		addUser(t, store, voters[i], c, voters[i])
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i, voter := range voters {
+		wg.Add(1)
+		go func(option int, voter *users.User) {
+			defer wg.Done()
+			if _, err := store.CastVote(poll.ID, voter, &messages.Vote{Options: []int{option}}); err != nil {
+				errs <- err
+			}
+		}(i%2, voter)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("error voting concurrently: %v", err)
+	}
+
+	// no vote is lost
+	m := getMessage(t, store, poll.ID)
+	if m.Poll.Options[0].Votes != n/2 || m.Poll.Options[1].Votes != n/2 {
+		t.Errorf("expected %d votes each but got %d and %d", n/2, m.Poll.Options[0].Votes, m.Poll.Options[1].Votes)
+	}
+}
@@ -2,7 +2,11 @@ package messages
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/aethanol/challenges-aethanol/apiserver/models/mongomigrate"
 	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
 	mgo "gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -36,58 +40,140 @@ func NewMongoStore(session *mgo.Session, databaseName string) (*MongoStore, erro
 	if databaseName == "" {
 		databaseName = "production"
 	}
-	// return a new mongo store and no error
 	store := &MongoStore{
 		Session:           session,
 		DatabaseName:      databaseName,
 		MessageCollection: "messages",
 		ChannelCollection: "channels",
 	}
-	// create the index for the name field
-	createIndexes(store)
-	// add general channel
-	addGeneral(store)
+	// create the indexes and add the General channel if they aren't there yet
+	if err := mongomigrate.Migrate(session.DB(databaseName), "messages", store.migrations()); err != nil {
+		return nil, err
+	}
 
 	return store, nil
 }
 
-// add a general channel when starting up
-func addGeneral(ms *MongoStore) {
-	newG := &NewChannel{
-		Name: "General",
+// migrations are the migrations for the channel and message collections,
+// new migrations must only ever be added to the end
+func (ms *MongoStore) migrations() []mongomigrate.Migration {
+	return []mongomigrate.Migration{
+		{
+			Description: "rename channels whose names only differ by case",
+			Up:          ms.renameDuplicateChannels,
+		},
+		{
+			// older servers have a case sensitive index called name_1 that stops
+			// a collated index on the same key being created, so it goes first
+			Description: "case insensitive unique index on channel names",
+			Up: mongomigrate.Steps(
+				mongomigrate.DropIndex(ms.ChannelCollection, "name_1"),
+				mongomigrate.CreateIndex(ms.ChannelCollection, mgo.Index{
+					Key:    []string{"name"},
+					Name:   "name_ci",
+					Unique: true,
+					Collation: &mgo.Collation{
+						Locale:   "en",
+						Strength: 2,
+					},
+				}),
+			),
+		},
+		{
+			Description: "index messages by channel and time for recent messages and analytics",
+			Up: mongomigrate.CreateIndex(ms.MessageCollection, mgo.Index{
+				Key:        []string{"channelid", "createdat"},
+				Background: true,
+			}),
+		},
+		{
+			Description: "index channels by members for listing a user's channels",
+			Up: mongomigrate.CreateIndex(ms.ChannelCollection, mgo.Index{
+				Key:        []string{"members"},
+				Background: true,
+			}),
+		},
+		{
+			Description: "backfill versions of channels and messages from before versioning",
+			Up: mongomigrate.Steps(
+				mongomigrate.SetMissing(ms.ChannelCollection, "version", 1),
+				mongomigrate.SetMissing(ms.MessageCollection, "version", 1),
+			),
+		},
+		{
+			Description: "backfill join dates of members from before join dates were kept",
+			Up:          ms.backfillJoinDates,
+		},
+		{
+			Description: "add the General channel",
+			Up:          ms.addGeneral,
+		},
+	}
+}
+
+// renameDuplicateChannels adds a number to the names of channels that only
+// differ by case from an older channel, so the names can be uniquely indexed
+func (ms *MongoStore) renameDuplicateChannels(db *mgo.Database) error {
+	col := db.C(ms.ChannelCollection)
+	channels := []*Channel{}
+	if err := col.Find(nil).Select(bson.M{"name": 1}).Sort("createdat").All(&channels); err != nil {
+		return err
 	}
-	leet := &users.User{
-		ID: bson.ObjectId("000000001337"),
+	taken := map[string]bool{}
+	for _, c := range channels {
+		taken[strings.ToLower(c.Name)] = true
 	}
-	ms.InsertChannel(newG, leet)
+	seen := map[string]bool{}
+	for _, c := range channels {
+		lower := strings.ToLower(c.Name)
+		if !seen[lower] {
+			seen[lower] = true
+			continue
+		}
+		// find a number that makes the name unique
+		name := c.Name
+		for n := 2; taken[strings.ToLower(name)]; n++ {
+			name = c.Name + "-" + strconv.Itoa(n)
+		}
+		taken[strings.ToLower(name)] = true
+		if err := col.UpdateId(c.ID, bson.M{"$set": bson.M{"name": name}}); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// create unique indexes for the name of channels
-// and case insensitive index on the channel
-func createIndexes(ms *MongoStore) {
-	// ensure index on the channel name
-	chIndex := mgo.Index{
-		Key:        []string{"name"},
-		Unique:     true,
-		Background: true,
-		Sparse:     false,
-		Collation: &mgo.Collation{ // <------ this is broke??? idk I hacked it with a regex instead
-			Locale:   "en",
-			Strength: 1,
-		},
+// backfillJoinDates sets the join date of members who don't have one to when the channel was created
+func (ms *MongoStore) backfillJoinDates(db *mgo.Database) error {
+	col := db.C(ms.ChannelCollection)
+	channels := []*Channel{}
+	if err := col.Find(bson.M{"joinedat": bson.M{"$exists": false}}).All(&channels); err != nil {
+		return err
 	}
-	ms.Session.DB(ms.DatabaseName).C(ms.ChannelCollection).EnsureIndex(chIndex)
+	for _, c := range channels {
+		joinedAt := bson.M{}
+		for _, m := range c.Members {
+			joinedAt[IDString(m)] = c.CreatedAt
+		}
+		// only set it if it's still missing, in case a member joined in the meantime
+		err := col.Update(bson.M{"_id": c.ID, "joinedat": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"joinedat": joinedAt}})
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
 
-	// ensure case insensitive index on the channel
-	// THIS IS WRONG, UNIQUE INDEX ON AN ARRAY IS FOR THE ENTIRE COL, NOT THE ONE ARRAY
-	// // ensure index on the members array
-	// memIndex := mgo.Index{
-	// 	Key:        []string{"members"},
-	// 	Unique:     true,
-	// 	Background: true,
-	// 	Sparse:     true,
-	// }
-	// ms.Session.DB(ms.DatabaseName).C(ms.ChannelCollection).EnsureIndex(memIndex)
+// addGeneral adds the General channel everyone can join, if there isn't one
+func (ms *MongoStore) addGeneral(db *mgo.Database) error {
+	// the general channel is public so it doesn't need a real creator
+	creator := &users.User{ID: bson.ObjectIdHex(generalCreatorID)}
+	_, err := ms.InsertChannel(&NewChannel{Name: "General"}, creator)
+	if err == ErrDuplicateKey {
+		return nil
+	}
+	return err
 }
 
 func authorized(collection *mgo.Collection, query bson.M) error {
@@ -95,13 +181,35 @@ func authorized(collection *mgo.Collection, query bson.M) error {
 	if err == mgo.ErrNotFound {
 		return ErrUnauthorized
 	}
+	return err
+}
+
+// ownedBy checks that the document exists and was created by the user
+func ownedBy(col *mgo.Collection, id interface{}, userID interface{}, notFound error) error {
+	doc := struct {
+		CreatorID interface{} `bson:"creatorid"`
+	}{}
+	err := col.FindId(id).Select(bson.M{"creatorid": 1}).One(&doc)
+	if err == mgo.ErrNotFound {
+		return notFound
+	}
+	if err != nil {
+		return err
+	}
+	if IDString(doc.CreatorID) != IDString(userID) {
+		return ErrUnauthorized
+	}
 	return nil
 }
 
 // GetChannelByID returns a channel by a given ID
 func (ms *MongoStore) GetChannelByID(id interface{}) (*Channel, error) {
-	// convert the ID into it's object ID so we can look up in the database
+	// convert the ID into it's object ID so we can look up in the database,
+	// a string that isn't an object ID can't match a channel
 	if sID, ok := id.(string); ok {
+		if !bson.IsObjectIdHex(sID) {
+			return nil, ErrChannelNotFound
+		}
 		id = bson.ObjectIdHex(sID)
 	}
 
@@ -137,9 +245,7 @@ func (ms *MongoStore) GetChannelByName(name string) (*Channel, error) {
 // GetAllUserChannels returns all channels a given user is allowed to see
 func (ms *MongoStore) GetAllUserChannels(user *users.User) ([]*Channel, error) {
 	// convert the user ID into it's object ID so we can look up in the database
-	if sID, ok := user.ID.(string); ok {
-		user.ID = bson.ObjectIdHex(sID)
-	}
+	user.ID = toObjectID(user.ID)
 	// create a slice of pointers to channel structs
 	channels := []*Channel{}
 	// search the store
@@ -160,9 +266,7 @@ func (ms *MongoStore) GetAllUserChannels(user *users.User) ([]*Channel, error) {
 func (ms *MongoStore) InsertChannel(newChannel *NewChannel, creator *users.User) (*Channel, error) {
 
 	// convert the creator ID into it's object ID so we can look up in the database
-	if sID, ok := creator.ID.(string); ok {
-		creator.ID = bson.ObjectIdHex(sID)
-	}
+	creator.ID = toObjectID(creator.ID)
 
 	// validate the new channel
 	err := newChannel.Validate()
@@ -175,6 +279,10 @@ func (ms *MongoStore) InsertChannel(newChannel *NewChannel, creator *users.User)
 	if err != nil {
 		return nil, err
 	}
+	// convert the member IDs so they match the IDs in membership queries
+	for i, m := range channel.Members {
+		channel.Members[i] = toObjectID(m)
+	}
 	// create a new objectID for the _id
 	channel.ID = bson.NewObjectId()
 	// insert the chanenl to the database/collection if the channel name doesn't exist
@@ -191,58 +299,96 @@ func (ms *MongoStore) InsertChannel(newChannel *NewChannel, creator *users.User)
 	return channel, nil
 }
 
+// versionQuery returns a query for the document with the given ID at the expected
+// version. A version of 0 matches the document at any version.
+func versionQuery(id interface{}, version int) bson.M {
+	query := bson.M{"_id": id}
+	if version > 0 {
+		query["version"] = version
+	}
+	return query
+}
+
+// versionError works out why a versioned write matched nothing, either the
+// document no longer exists or it has moved on to another version
+func versionError(col *mgo.Collection, id interface{}, notFound error) error {
+	n, err := col.FindId(id).Count()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return ErrVersionMismatch
+}
+
+// casUpdate applies the update to the document if it is at the expected version
+// and bumps the version, so concurrent writers can't overwrite each other
+func casUpdate(col *mgo.Collection, id interface{}, version int, update bson.M, notFound error) error {
+	update["$inc"] = bson.M{"version": 1}
+	err := col.Update(versionQuery(id, version), update)
+	if err == mgo.ErrNotFound {
+		return versionError(col, id, notFound)
+	}
+	return err
+}
+
+// casRemove removes the document if it is at the expected version
+func casRemove(col *mgo.Collection, id interface{}, version int, notFound error) error {
+	err := col.Remove(versionQuery(id, version))
+	if err == mgo.ErrNotFound {
+		return versionError(col, id, notFound)
+	}
+	return err
+}
+
 // UpdateChannel applies ChannelUpdates to a given Channel
 func (ms *MongoStore) UpdateChannel(updates *ChannelUpdates, channelID interface{}, user *users.User) error {
 	// convert the channel ID into it's object ID so we can look up in the database
-	if sID, ok := channelID.(string); ok {
-		channelID = bson.ObjectIdHex(sID)
-	}
+	channelID = toObjectID(channelID)
 
 	// convert the channel ID into it's object ID so we can look up in the database
-	if sID, ok := user.ID.(string); ok {
-		user.ID = bson.ObjectIdHex(sID)
-	}
+	user.ID = toObjectID(user.ID)
 
 	// check if the user is authorized to update the channel (if they are the creator)
-	authQ := bson.M{"creatorid": user.ID}
 	col := ms.Session.DB(ms.DatabaseName).C(ms.ChannelCollection)
-	err := authorized(col, authQ)
+	err := ownedBy(col, channelID, user.ID, ErrChannelNotFound)
 	// return the unauth error if we got one
 	if err != nil {
 		return err
 	}
 
-	// otherwise update the channel
+	// otherwise update the channel if it is still at the version the user last saw
 	bUpdates := bson.M{"$set": updates}
-	return col.UpdateId(channelID, bUpdates)
+	err = casUpdate(col, channelID, updates.Version, bUpdates, ErrChannelNotFound)
+	// the name has a unique index
+	if mgo.IsDup(err) {
+		return ErrDuplicateKey
+	}
+	return err
 }
 
 // DeleteChannel deletes a channel as well as all messages posted to that channel if they are the creator
-func (ms *MongoStore) DeleteChannel(channelID interface{}, user *users.User) error {
+func (ms *MongoStore) DeleteChannel(channelID interface{}, user *users.User, version int) error {
 	// convert the channel ID into it's object ID so we can look up in the database
-	if sID, ok := channelID.(string); ok {
-		channelID = bson.ObjectIdHex(sID)
-	}
+	channelID = toObjectID(channelID)
 	// convert the user ID into it's object ID so we can look up in the database
-	if sID, ok := user.ID.(string); ok {
-		user.ID = bson.ObjectIdHex(sID)
-	}
-	// check if the user is authorized to update the channel (if they are the creator)
-	authQ := bson.M{"creatorid": user.ID}
+	user.ID = toObjectID(user.ID)
+	// check if the user is authorized to delete the channel (if they are the creator)
 	col := ms.Session.DB(ms.DatabaseName).C(ms.ChannelCollection)
-	err := authorized(col, authQ)
+	err := ownedBy(col, channelID, user.ID, ErrChannelNotFound)
 	// return the unauth error if we got one
 	if err != nil {
 		return err
 	}
 
-	// delete all messages that are in the channel from the messages collection
-	_, err = ms.Session.DB(ms.DatabaseName).C(ms.MessageCollection).RemoveAll(bson.M{"channelid": channelID})
+	// delete the channel from the channel collection if it is still at the version the user last saw
+	err = casRemove(col, channelID, version, ErrChannelNotFound)
 	if err != nil {
 		return err
 	}
-	// delete the channel from the channel collection
-	err = ms.Session.DB(ms.DatabaseName).C(ms.ChannelCollection).RemoveId(channelID)
+	// delete all messages that are in the channel from the messages collection
+	_, err = ms.Session.DB(ms.DatabaseName).C(ms.MessageCollection).RemoveAll(bson.M{"channelid": channelID})
 	if err != nil {
 		return err
 	}
@@ -252,18 +398,12 @@ func (ms *MongoStore) DeleteChannel(channelID interface{}, user *users.User) err
 // AddUserToChannel adds a user to a channels Members list
 func (ms *MongoStore) AddUserToChannel(userID interface{}, channelID interface{}, creatorID interface{}) error {
 	// convert the user ID into it's object ID so we can look up in the database
-	if sID, ok := userID.(string); ok {
-		userID = bson.ObjectIdHex(sID)
-	}
+	userID = toObjectID(userID)
 	// convert the channel ID into it's object ID so we can look up in the database
-	if sID, ok := channelID.(string); ok {
-		channelID = bson.ObjectIdHex(sID)
-	}
+	channelID = toObjectID(channelID)
 
 	// convert the channel ID into it's object ID so we can look up in the database
-	if sID, ok := creatorID.(string); ok {
-		creatorID = bson.ObjectIdHex(sID)
-	}
+	creatorID = toObjectID(creatorID)
 
 	// check the authorization of the creator if they are the creator AND the user isn't in the memberslist OR if the channel is public
 	authQ := bson.M{"$and": []bson.M{bson.M{"_id": channelID}, bson.M{"members": bson.M{"$ne": userID}}, bson.M{"$or": []bson.M{bson.M{"creatorid": creatorID}, bson.M{"private": false}}}}}
@@ -276,7 +416,10 @@ func (ms *MongoStore) AddUserToChannel(userID interface{}, channelID interface{}
 	// // check that the user isn't already in the channel
 	// _, err = ms.Session.DB(ms.DatabaseName).C(ms.ChannelCollection).Find()
 	// upsert the user to the array in the mongostore
-	_, err = ms.Session.DB(ms.DatabaseName).C(ms.ChannelCollection).UpsertId(channelID, bson.M{"$addToSet": bson.M{"members": userID}})
+	_, err = ms.Session.DB(ms.DatabaseName).C(ms.ChannelCollection).UpsertId(channelID, bson.M{
+		"$addToSet": bson.M{"members": userID},
+		"$set":      bson.M{"joinedat." + IDString(userID): time.Now()},
+	})
 	if err != nil {
 		return err
 	}
@@ -286,25 +429,26 @@ func (ms *MongoStore) AddUserToChannel(userID interface{}, channelID interface{}
 // RemoveUserFromChannel deletes a user from a Channels member list
 func (ms *MongoStore) RemoveUserFromChannel(userID interface{}, channelID interface{}, creatorID interface{}) error {
 	// convert the user ID into it's object ID so we can look up in the database
-	if sID, ok := userID.(string); ok {
-		userID = bson.ObjectIdHex(sID)
-	}
+	userID = toObjectID(userID)
 	// convert the channel ID into it's object ID so we can look up in the database
-	if sID, ok := channelID.(string); ok {
-		channelID = bson.ObjectIdHex(sID)
-	}
+	channelID = toObjectID(channelID)
 	// convert the channel ID into it's object ID so we can look up in the database
-	if sID, ok := creatorID.(string); ok {
-		creatorID = bson.ObjectIdHex(sID)
-	}
+	creatorID = toObjectID(creatorID)
 
 	// check the authorization of the creator if they are the creator OR if the channel is public
-	authQ := bson.M{"$and": []bson.M{bson.M{"_id": channelID}, bson.M{"$or": []bson.M{bson.M{"creatorid": userID}, bson.M{"private": false}}}}}
+	authQ := bson.M{"$and": []bson.M{bson.M{"_id": channelID}, bson.M{"$or": []bson.M{bson.M{"creatorid": creatorID}, bson.M{"private": false}}}}}
 	col := ms.Session.DB(ms.DatabaseName).C(ms.ChannelCollection)
 	err := authorized(col, authQ)
+	// return the unauth error if we got one
+	if err != nil {
+		return err
+	}
 
 	// pull the user from the list of members
-	err = ms.Session.DB(ms.DatabaseName).C(ms.ChannelCollection).UpdateId(channelID, bson.M{"$pull": bson.M{"members": userID}})
+	err = ms.Session.DB(ms.DatabaseName).C(ms.ChannelCollection).UpdateId(channelID, bson.M{
+		"$pull":  bson.M{"members": userID},
+		"$unset": bson.M{"joinedat." + IDString(userID): ""},
+	})
 	if err != nil {
 		return err
 	}
@@ -315,19 +459,15 @@ func (ms *MongoStore) RemoveUserFromChannel(userID interface{}, channelID interf
 // posted to a particular channel if it is public or the user is a member
 func (ms *MongoStore) GetRecentMessages(channelID interface{}, user *users.User, N int) ([]*Message, error) {
 	// convert the channel ID into it's object ID so we can look up in the database
-	if sID, ok := channelID.(string); ok {
-		channelID = bson.ObjectIdHex(sID)
-	}
+	channelID = toObjectID(channelID)
 
 	// convert the user ID into it's object ID so we can look up in the database
-	if sID, ok := user.ID.(string); ok {
-		user.ID = bson.ObjectIdHex(sID)
-	}
+	user.ID = toObjectID(user.ID)
 
 	// query mongo for the messages for the given channel and where the user is a member
 	col := ms.Session.DB(ms.DatabaseName).C(ms.ChannelCollection)
 	// check if the user is a member of the channel OR if it is public
-	err := col.Find(bson.M{"$or": []bson.M{bson.M{"members": user.ID}, bson.M{"private": false}}}).One(nil)
+	err := col.Find(bson.M{"_id": channelID, "$or": []bson.M{bson.M{"members": user.ID}, bson.M{"private": false}}}).One(nil)
 	if err != nil {
 		if err == mgo.ErrNotFound {
 			return nil, ErrUnauthorized
@@ -336,7 +476,8 @@ func (ms *MongoStore) GetRecentMessages(channelID interface{}, user *users.User,
 	}
 	messages := []*Message{}
 	col = ms.Session.DB(ms.DatabaseName).C(ms.MessageCollection)
-	col.Find(bson.M{"channelid": channelID}).Sort("-createdat").Limit(N).All(&messages)
+	err = col.Find(bson.M{"channelid": channelID}).Sort("-createdat").Limit(N).All(&messages)
+	tallyPolls(messages...)
 
 	// KEEPING THIS COMMENTED CODE HERE AS A GRAVEYARD FOR MY DUMB EFFORT OF DOING THIS AS A
 	// PIPELINE FRAMEWORK. IT'S SLOW AND NOT WHAT IT SHOULD BE USED FOR
@@ -365,9 +506,7 @@ func (ms *MongoStore) GetRecentMessages(channelID interface{}, user *users.User,
 func (ms *MongoStore) InsertMessage(newMessage *NewMessage, creator *users.User) (*Message, error) {
 
 	// convert the creator ID into it's object ID so we can look up in the database
-	if sID, ok := creator.ID.(string); ok {
-		creator.ID = bson.ObjectIdHex(sID)
-	}
+	creator.ID = toObjectID(creator.ID)
 
 	// validate the new message
 	err := newMessage.Validate()
@@ -375,6 +514,9 @@ func (ms *MongoStore) InsertMessage(newMessage *NewMessage, creator *users.User)
 		return nil, err
 	}
 
+	// convert the channel ID into it's object ID so we can look up in the database
+	newMessage.ChannelID = toObjectID(newMessage.ChannelID)
+
 	// convert the message by passing the creator and channel
 	message, err := newMessage.ToMessage(creator)
 	if err != nil {
@@ -400,8 +542,12 @@ func (ms *MongoStore) InsertMessage(newMessage *NewMessage, creator *users.User)
 
 // GetMessageByID returns a message by a given ID
 func (ms *MongoStore) GetMessageByID(id interface{}) (*Message, error) {
-	// convert the ID into it's object ID so we can look up in the database
+	// convert the ID into it's object ID so we can look up in the database,
+	// a string that isn't an object ID can't match a message
 	if sID, ok := id.(string); ok {
+		if !bson.IsObjectIdHex(sID) {
+			return nil, ErrMessageNotFound
+		}
 		id = bson.ObjectIdHex(sID)
 	}
 
@@ -411,57 +557,260 @@ func (ms *MongoStore) GetMessageByID(id interface{}) (*Message, error) {
 	// return the error and check if it's ErrNotFound
 	if err != nil {
 		if err == mgo.ErrNotFound {
-			return nil, ErrChannelNotFound
+			return nil, ErrMessageNotFound
 		}
 		return nil, err
 	}
+	tallyPolls(message)
 	return message, nil
 }
 
 // UpdateMessage applies MessageUpdates to a given Message
 func (ms *MongoStore) UpdateMessage(updates *MessageUpdates, messageID interface{}, user *users.User) error {
 	// convert the message ID into it's object ID so we can look up in the database
-	if sID, ok := messageID.(string); ok {
-		messageID = bson.ObjectIdHex(sID)
-	}
+	messageID = toObjectID(messageID)
 	// convert the user ID into it's object ID so we can look up in the database
-	if sID, ok := user.ID.(string); ok {
-		user.ID = bson.ObjectIdHex(sID)
-	}
+	user.ID = toObjectID(user.ID)
 	// check if the user is authorized to update the message (if they are the creator)
-	authQ := bson.M{"creatorid": user.ID}
 	col := ms.Session.DB(ms.DatabaseName).C(ms.MessageCollection)
-	err := authorized(col, authQ)
+	err := ownedBy(col, messageID, user.ID, ErrMessageNotFound)
 	// return the unauth error if we got one
 	if err != nil {
 		return err
 	}
 
-	// otherwise apply the updates
+	// re-parse the markup so the stored blocks match the new body
+	updates.Blocks = ParseMarkup(updates.Body)
+
+	// otherwise apply the updates if it is still at the version the user last saw
 	bUpdates := bson.M{"$set": updates}
-	return col.UpdateId(messageID, bUpdates)
+	return casUpdate(col, messageID, updates.Version, bUpdates, ErrMessageNotFound)
 }
 
 //DeleteMessage removes a message from the store
-func (ms *MongoStore) DeleteMessage(messageID interface{}, user *users.User) error {
+func (ms *MongoStore) DeleteMessage(messageID interface{}, user *users.User, version int) error {
 	//convert the message ID into it's object ID so we can look up in the database
-	if sID, ok := messageID.(string); ok {
-		messageID = bson.ObjectIdHex(sID)
-	}
+	messageID = toObjectID(messageID)
 	//convert the iser ID into it's object ID so we can look up in the database
-	if sID, ok := user.ID.(string); ok {
-		user.ID = bson.ObjectIdHex(sID)
-	}
+	user.ID = toObjectID(user.ID)
 
 	// check if the user is authorized to delete the message (if they are the creator)
-	authQ := bson.M{"creatorid": user.ID}
 	col := ms.Session.DB(ms.DatabaseName).C(ms.MessageCollection)
-	err := authorized(col, authQ)
+	err := ownedBy(col, messageID, user.ID, ErrMessageNotFound)
 	// return the unauth error if we got one
 	if err != nil {
 		return err
 	}
 
-	// delete it by it's id
-	return ms.Session.DB(ms.DatabaseName).C(ms.MessageCollection).RemoveId(messageID)
+	// delete it by it's id if it is still at the version the user last saw
+	return casRemove(col, messageID, version, ErrMessageNotFound)
+}
+
+// CastVote records a user's vote on a poll message, replacing any vote they
+// already cast, and returns the message with the poll results tallied.
+// Only members of the poll's channel may vote.
+func (ms *MongoStore) CastVote(messageID interface{}, user *users.User, vote *Vote) (*Message, error) {
+	// convert the message ID into it's object ID so we can look up in the database
+	messageID = toObjectID(messageID)
+	// convert the user ID into it's object ID so we can look up in the database
+	user.ID = toObjectID(user.ID)
+
+	// get the poll so we can validate the vote against it
+	message, err := ms.GetMessageByID(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message.Poll == nil {
+		return nil, ErrNotAPoll
+	}
+	if message.Poll.Closed(time.Now()) {
+		return nil, ErrPollClosed
+	}
+	if err := message.Poll.ValidateVote(vote); err != nil {
+		return nil, err
+	}
+
+	// check that the user is a member of the channel the poll was posted to
+	cCol := ms.Session.DB(ms.DatabaseName).C(ms.ChannelCollection)
+	authQ := bson.M{"$and": []bson.M{bson.M{"_id": message.ChannelID}, bson.M{"members": user.ID}}}
+	if err := authorized(cCol, authQ); err != nil {
+		return nil, err
+	}
+
+	// each user has a single ballot, so setting it replaces their old vote in one
+	// atomic update. The query makes sure the poll didn't close in the meantime.
+	ballot := "poll.ballots." + IDString(user.ID)
+	update := bson.M{"$set": bson.M{ballot: vote.Options}}
+	if len(vote.Options) == 0 {
+		update = bson.M{"$unset": bson.M{ballot: ""}}
+	}
+	query := bson.M{"_id": messageID, "$or": []bson.M{bson.M{"poll.closesat": nil}, bson.M{"poll.closesat": bson.M{"$gt": time.Now()}}}}
+	change := mgo.Change{
+		Update:    update,
+		ReturnNew: true,
+	}
+	message = &Message{}
+	if _, err := ms.Session.DB(ms.DatabaseName).C(ms.MessageCollection).Find(query).Apply(change, message); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, ErrPollClosed
+		}
+		return nil, err
+	}
+
+	tallyPolls(message)
+	return message, nil
+}
+
+// tallyPolls counts the votes of any polls in the messages
+func tallyPolls(messages ...*Message) {
+	for _, m := range messages {
+		if m.Poll != nil {
+			m.Poll.Tally()
+		}
+	}
+}
+
+// FindMessageRefs returns references to all the messages that match the query.
+// It doesn't check authorization, so it is only for moderators.
+func (ms *MongoStore) FindMessageRefs(query *MessageQuery) ([]*MessageRef, error) {
+	// build up the mongo query from the criteria that were set
+	bQuery := bson.M{}
+	if query.CreatorID != nil {
+		bQuery["creatorid"] = toObjectID(query.CreatorID)
+	}
+	if len(query.ChannelIDs) > 0 {
+		bQuery["channelid"] = bson.M{"$in": toObjectIDs(query.ChannelIDs)}
+	}
+	if len(query.IDs) > 0 {
+		bQuery["_id"] = bson.M{"$in": toObjectIDs(query.IDs)}
+	}
+	createdAt := bson.M{}
+	if query.Since != nil {
+		createdAt["$gte"] = *query.Since
+	}
+	if query.Until != nil {
+		createdAt["$lt"] = *query.Until
+	}
+	if len(createdAt) > 0 {
+		bQuery["createdat"] = createdAt
+	}
+
+	// only read the fields the references need
+	refs := []*MessageRef{}
+	err := ms.Session.DB(ms.DatabaseName).C(ms.MessageCollection).Find(bQuery).Select(bson.M{"_id": 1, "channelid": 1}).All(&refs)
+	if err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// DeleteMessages removes the messages with the given IDs and returns how many were removed.
+// It doesn't check authorization, so it is only for moderators.
+func (ms *MongoStore) DeleteMessages(messageIDs []MessageID) (int, error) {
+	info, err := ms.Session.DB(ms.DatabaseName).C(ms.MessageCollection).RemoveAll(bson.M{"_id": bson.M{"$in": toObjectIDs(messageIDs)}})
+	if err != nil {
+		return 0, err
+	}
+	return info.Removed, nil
+}
+
+// MoveMessages moves the messages with the given IDs into the channel and returns
+// how many were moved. It doesn't check authorization, so it is only for moderators.
+func (ms *MongoStore) MoveMessages(messageIDs []MessageID, channelID interface{}) (int, error) {
+	// make sure the channel exists before moving anything into it
+	channel, err := ms.GetChannelByID(channelID)
+	if err != nil {
+		return 0, err
+	}
+	info, err := ms.Session.DB(ms.DatabaseName).C(ms.MessageCollection).UpdateAll(bson.M{"_id": bson.M{"$in": toObjectIDs(messageIDs)}}, bson.M{"$set": bson.M{"channelid": channel.ID}, "$inc": bson.M{"version": 1}})
+	if err != nil {
+		return 0, err
+	}
+	return info.Updated, nil
+}
+
+// toObjectID converts a hex string ID into it's object ID so we can look it up in the database.
+// IDs that aren't valid hex are left alone, they just won't match anything, so a
+// malformed ID from a client is not found instead of panicking in bson.ObjectIdHex.
+func toObjectID(id interface{}) interface{} {
+	if sID, ok := id.(string); ok && bson.IsObjectIdHex(sID) {
+		return bson.ObjectIdHex(sID)
+	}
+	return id
+}
+
+// toObjectIDs converts a slice of IDs with toObjectID
+func toObjectIDs(ids interface{}) []interface{} {
+	converted := []interface{}{}
+	switch v := ids.(type) {
+	case []MessageID:
+		for _, id := range v {
+			converted = append(converted, toObjectID(id))
+		}
+	case []ChannelID:
+		for _, id := range v {
+			converted = append(converted, toObjectID(id))
+		}
+	}
+	return converted
+}
+
+// GetChannelAnalytics summarizes the activity in the channel over the query's time range.
+// It doesn't check authorization, callers must check the user can view the channel.
+func (ms *MongoStore) GetChannelAnalytics(channel *Channel, query *AnalyticsQuery) (*ChannelAnalytics, error) {
+	// only aggregate the channel's messages in the time range
+	match := bson.M{"channelid": toObjectID(channel.ID)}
+	createdAt := bson.M{}
+	if query.Since != nil {
+		createdAt["$gte"] = *query.Since
+	}
+	if query.Until != nil {
+		createdAt["$lt"] = *query.Until
+	}
+	if len(createdAt) > 0 {
+		match["createdat"] = createdAt
+	}
+	col := ms.Session.DB(ms.DatabaseName).C(ms.MessageCollection)
+
+	// count the messages on each day
+	days := []*DayCount{}
+	err := col.Pipe([]bson.M{
+		{"$match": match},
+		{"$group": bson.M{
+			"_id":   bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$createdat"}},
+			"count": bson.M{"$sum": 1},
+		}},
+	}).All(&days)
+	if err != nil {
+		return nil, err
+	}
+
+	// count the messages in each hour of the day
+	hours := []*HourCount{}
+	err = col.Pipe([]bson.M{
+		{"$match": match},
+		{"$group": bson.M{
+			"_id":   bson.M{"$hour": "$createdat"},
+			"count": bson.M{"$sum": 1},
+		}},
+	}).All(&hours)
+	if err != nil {
+		return nil, err
+	}
+
+	// count the messages and find the last post of everyone who posted
+	posters := []*MemberActivity{}
+	err = col.Pipe([]bson.M{
+		{"$match": match},
+		{"$group": bson.M{
+			"_id":        "$creatorid",
+			"count":      bson.M{"$sum": 1},
+			"lastpostat": bson.M{"$max": "$createdat"},
+		}},
+	}).All(&posters)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewChannelAnalytics(channel, query, days, hours, posters), nil
 }
@@ -116,6 +116,25 @@ func TestMongoStoreUpdateChannel(t *testing.T) {
 	if channel.Description != "UPDATEDdesc" {
 		t.Errorf("Description field not updated, got: %v, expected: `UPDATEDdesc`", channel.Description)
 	}
+	if channel.Version != 2 {
+		t.Errorf("Version not incremented, got: %v, expected: 2", channel.Version)
+	}
+
+	// an update based on the old version should be rejected
+	update = &ChannelUpdates{
+		Name:    "staleName",
+		Version: 1,
+	}
+	err = messageStore.UpdateChannel(update, c.ID, u)
+	if err != ErrVersionMismatch {
+		t.Errorf("expected version mismatch updating a stale channel, got: %v", err)
+	}
+	// and one based on the current version should go through
+	update.Version = 2
+	err = messageStore.UpdateChannel(update, c.ID, u)
+	if err != nil {
+		t.Errorf("error updating channel at the current version: %v", err)
+	}
 	cleanup(userStore, messageStore)
 }
 
@@ -168,7 +187,7 @@ func TestMongoStoreDeleteChannel(t *testing.T) {
 	}
 
 	// delete the channel
-	err = messageStore.DeleteChannel(channel.ID, u)
+	err = messageStore.DeleteChannel(channel.ID, u, 0)
 	if err != nil {
 		t.Errorf("error deleting channel: %v", err.Error())
 	}
@@ -549,7 +568,7 @@ func TestMongoStoreDeleteMessage(t *testing.T) {
 	}
 
 	// test deleting the message with the user that created it
-	err = messageStore.DeleteMessage(message.ID, u)
+	err = messageStore.DeleteMessage(message.ID, u, 0)
 	_, err = messageStore.GetMessageByID(message.ID)
 	if err == nil {
 		t.Errorf("error deleting message: %v", err.Error())
@@ -572,7 +591,7 @@ func TestMongoStoreDeleteMessage(t *testing.T) {
 		t.Errorf("error adding user: %v", err.Error())
 	}
 
-	err = messageStore.DeleteMessage(message.ID, u2)
+	err = messageStore.DeleteMessage(message.ID, u2, 0)
 	if err == nil {
 		t.Errorf("error: users can delete others messages : %v", err.Error())
 	}
@@ -0,0 +1,146 @@
+package messages
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// message types
+const (
+	MessageTypeText = "text"
+	MessageTypePoll = "poll"
+)
+
+// limits on the number of options in a poll
+const (
+	minPollOptions = 2
+	maxPollOptions = 20
+)
+
+// ErrNotAPoll is returned when voting on a message that isn't a poll
+var ErrNotAPoll = errors.New("message is not a poll")
+
+// ErrPollClosed is returned when voting on a poll after its close time
+var ErrPollClosed = errors.New("poll is closed")
+
+// the errors ValidateVote returns for votes the poll doesn't allow
+var (
+	ErrSingleChoice   = errors.New("Error: poll only allows a single choice")
+	ErrNoSuchOption   = errors.New("Error: poll option doesn't exist")
+	ErrOptionRepeated = errors.New("Error: poll option chosen more than once")
+)
+
+// Poll is a vote that is attached to a poll message,
+// the message body holds the question
+type Poll struct {
+	Options     []*PollOption `json:"options"`
+	MultiChoice bool          `json:"multiChoice"`
+	Anonymous   bool          `json:"anonymous"`
+	ClosesAt    *time.Time    `json:"closesAt,omitempty"`
+	// Ballots maps the ID of each voter to the options they chose,
+	// it is never sent to clients so anonymous polls stay anonymous
+	Ballots map[string][]int `json:"-"`
+}
+
+// PollOption is one of the choices in a poll.
+// Votes and Voters are filled in by Tally and aren't stored.
+type PollOption struct {
+	ID     int      `json:"id"`
+	Text   string   `json:"text"`
+	Votes  int      `json:"votes" bson:"-"`
+	Voters []string `json:"voters,omitempty" bson:"-"`
+}
+
+// NewPoll represents a poll when it is created
+type NewPoll struct {
+	Options     []string   `json:"options"`
+	MultiChoice bool       `json:"multiChoice,omitempty"`
+	Anonymous   bool       `json:"anonymous,omitempty"`
+	ClosesAt    *time.Time `json:"closesAt,omitempty"`
+}
+
+// Vote is the set of options a user is voting for,
+// an empty set of options withdraws the user's vote
+type Vote struct {
+	Options []int `json:"options"`
+}
+
+// Validate validates a new poll
+func (np *NewPoll) Validate() error {
+	if len(np.Options) < minPollOptions || len(np.Options) > maxPollOptions {
+		return errors.New("Error: polls must have between 2 and 20 options")
+	}
+	for _, o := range np.Options {
+		if len(o) == 0 {
+			return errors.New("Error: poll option is zero length")
+		}
+	}
+	if np.ClosesAt != nil && np.ClosesAt.Before(time.Now()) {
+		return errors.New("Error: poll close time is in the past")
+	}
+	return nil
+}
+
+// ToPoll converts the NewPoll to a Poll
+func (np *NewPoll) ToPoll() *Poll {
+	poll := &Poll{
+		Options:     make([]*PollOption, len(np.Options)),
+		MultiChoice: np.MultiChoice,
+		Anonymous:   np.Anonymous,
+		ClosesAt:    np.ClosesAt,
+		Ballots:     map[string][]int{},
+	}
+	for i, o := range np.Options {
+		poll.Options[i] = &PollOption{ID: i, Text: o}
+	}
+	return poll
+}
+
+// Closed reports whether the poll has stopped accepting votes
+func (p *Poll) Closed(now time.Time) bool {
+	return p.ClosesAt != nil && !now.Before(*p.ClosesAt)
+}
+
+// ValidateVote checks that the vote is allowed by the poll
+func (p *Poll) ValidateVote(vote *Vote) error {
+	if !p.MultiChoice && len(vote.Options) > 1 {
+		return ErrSingleChoice
+	}
+	seen := map[int]bool{}
+	for _, id := range vote.Options {
+		if id < 0 || id >= len(p.Options) {
+			return ErrNoSuchOption
+		}
+		if seen[id] {
+			return ErrOptionRepeated
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// Tally counts the votes for each option from the ballots, and lists
+// who voted for each option unless the poll is anonymous
+func (p *Poll) Tally() {
+	for _, o := range p.Options {
+		o.Votes = 0
+		o.Voters = nil
+	}
+	for voter, choices := range p.Ballots {
+		for _, id := range choices {
+			if id < 0 || id >= len(p.Options) {
+				continue
+			}
+			o := p.Options[id]
+			o.Votes++
+			if !p.Anonymous {
+				o.Voters = append(o.Voters, voter)
+			}
+		}
+	}
+	// map iteration order is random, so sort to keep responses stable
+	for _, o := range p.Options {
+		sort.Strings(o.Voters)
+	}
+}
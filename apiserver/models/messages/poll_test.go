@@ -0,0 +1,91 @@
+package messages
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewPollValidate(t *testing.T) {
+	np := &NewPoll{
+		Options: []string{"yes"},
+	}
+	if err := np.Validate(); err == nil {
+		t.Errorf("should have gotten an error about too few options")
+	}
+
+	np.Options = []string{"yes", ""}
+	if err := np.Validate(); err == nil {
+		t.Errorf("should have gotten an error about an empty option")
+	}
+
+	np.Options = []string{"yes", "no"}
+	past := time.Now().Add(-time.Hour)
+	np.ClosesAt = &past
+	if err := np.Validate(); err == nil {
+		t.Errorf("should have gotten an error about the close time being in the past")
+	}
+
+	np.ClosesAt = nil
+	if err := np.Validate(); err != nil {
+		t.Errorf("unexpected error validating poll: %v", err)
+	}
+}
+
+func TestPollValidateVote(t *testing.T) {
+	poll := (&NewPoll{Options: []string{"a", "b", "c"}}).ToPoll()
+
+	cases := []struct {
+		options     []int
+		multiChoice bool
+		expected    error
+	}{
+		{options: []int{0}},
+		{options: []int{}},
+		{options: []int{3}, expected: ErrNoSuchOption},
+		{options: []int{-1}, expected: ErrNoSuchOption},
+		{options: []int{0, 1}, expected: ErrSingleChoice},
+		{options: []int{0, 1}, multiChoice: true},
+		{options: []int{1, 1}, multiChoice: true, expected: ErrOptionRepeated},
+	}
+	for _, c := range cases {
+		poll.MultiChoice = c.multiChoice
+		if err := poll.ValidateVote(&Vote{Options: c.options}); err != c.expected {
+			t.Errorf("vote %v (multi choice %v): expected %v but got %v", c.options, c.multiChoice, c.expected, err)
+		}
+	}
+}
+
+func TestPollTally(t *testing.T) {
+	poll := (&NewPoll{Options: []string{"a", "b"}, MultiChoice: true}).ToPoll()
+	poll.Ballots = map[string][]int{
+		"jim":  {0, 1},
+		"anne": {1},
+	}
+
+	poll.Tally()
+	if poll.Options[0].Votes != 1 || poll.Options[1].Votes != 2 {
+		t.Errorf("incorrect vote counts: got %d and %d", poll.Options[0].Votes, poll.Options[1].Votes)
+	}
+	if !reflect.DeepEqual(poll.Options[1].Voters, []string{"anne", "jim"}) {
+		t.Errorf("incorrect voters: got %v", poll.Options[1].Voters)
+	}
+
+	// anonymous polls only have counts
+	poll.Anonymous = true
+	poll.Tally()
+	if poll.Options[1].Votes != 2 || poll.Options[1].Voters != nil {
+		t.Errorf("anonymous poll tallied incorrectly: got %d votes from %v", poll.Options[1].Votes, poll.Options[1].Voters)
+	}
+}
+
+func TestPollClosed(t *testing.T) {
+	closes := time.Now().Add(time.Hour)
+	poll := (&NewPoll{Options: []string{"a", "b"}, ClosesAt: &closes}).ToPoll()
+	if poll.Closed(time.Now()) {
+		t.Errorf("poll closed before its close time")
+	}
+	if !poll.Closed(closes) {
+		t.Errorf("poll still open at its close time")
+	}
+}
@@ -0,0 +1,36 @@
+package messages
+
+import (
+	"errors"
+	"time"
+)
+
+// MessageQuery selects messages by author, channel, time range or ID.
+// Every criterion that is set must match.
+type MessageQuery struct {
+	CreatorID  interface{} `json:"creatorID,omitempty"`
+	ChannelIDs []ChannelID `json:"channelIDs,omitempty"`
+	Since      *time.Time  `json:"since,omitempty"`
+	Until      *time.Time  `json:"until,omitempty"`
+	IDs        []MessageID `json:"ids,omitempty"`
+}
+
+// MessageRef identifies a message and the channel it is in
+type MessageRef struct {
+	ID        MessageID `json:"id" bson:"_id"`
+	ChannelID ChannelID `json:"channelID"`
+}
+
+// Validate validates the query. It must select an author, a list of IDs, or
+// a time range in some channels, otherwise it is far too easy to match every
+// message in the workspace by accident. A time range needs at least one bound.
+func (q *MessageQuery) Validate() error {
+	timeRange := q.Since != nil || q.Until != nil
+	if q.CreatorID == nil && len(q.IDs) == 0 && !(timeRange && len(q.ChannelIDs) > 0) {
+		return errors.New("Error: query must select an author, message IDs, or a time range in some channels")
+	}
+	if q.Since != nil && q.Until != nil && q.Until.Before(*q.Since) {
+		return errors.New("Error: query time range ends before it starts")
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package messages
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMessageQueryValidate(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Hour)
+	channels := []ChannelID{"channel1"}
+	cases := []struct {
+		name  string
+		query *MessageQuery
+		valid bool
+	}{
+		{"empty", &MessageQuery{}, false},
+		{"author", &MessageQuery{CreatorID: "user1"}, true},
+		{"IDs", &MessageQuery{IDs: []MessageID{"message1"}}, true},
+		{"channels only", &MessageQuery{ChannelIDs: channels}, false},
+		{"time range without channels", &MessageQuery{Since: &earlier, Until: &now}, false},
+		{"time range in channels", &MessageQuery{ChannelIDs: channels, Since: &earlier, Until: &now}, true},
+		{"since in channels", &MessageQuery{ChannelIDs: channels, Since: &earlier}, true},
+		{"until in channels", &MessageQuery{ChannelIDs: channels, Until: &now}, true},
+		{"backwards time range", &MessageQuery{ChannelIDs: channels, Since: &now, Until: &earlier}, false},
+	}
+	for _, c := range cases {
+		if err := c.query.Validate(); (err == nil) != c.valid {
+			t.Errorf("%s: expected valid to be %t but got error %v", c.name, c.valid, err)
+		}
+	}
+}
@@ -0,0 +1,779 @@
+package messages
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/sqldb"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
+)
+
+// sqlMigrations are the schema migrations for the channel and message tables,
+// new migrations must only ever be added to the end
+var sqlMigrations = []string{
+	`CREATE TABLE channels (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL,
+		createdat TIMESTAMP NOT NULL,
+		creatorid TEXT NOT NULL,
+		private BOOLEAN NOT NULL,
+		version INTEGER NOT NULL
+	);
+	CREATE UNIQUE INDEX channels_name ON channels (lower(name));
+
+	CREATE TABLE channel_members (
+		channelid TEXT NOT NULL REFERENCES channels (id) ON DELETE CASCADE,
+		userid TEXT NOT NULL,
+		joinedat TIMESTAMP NOT NULL,
+		PRIMARY KEY (channelid, userid)
+	);
+	CREATE INDEX channel_members_userid ON channel_members (userid);
+
+	CREATE TABLE messages (
+		id TEXT PRIMARY KEY,
+		channelid TEXT NOT NULL REFERENCES channels (id) ON DELETE CASCADE,
+		type TEXT NOT NULL,
+		body TEXT NOT NULL,
+		blocks TEXT NOT NULL,
+		createdat TIMESTAMP NOT NULL,
+		creatorid TEXT NOT NULL,
+		editedat TIMESTAMP NOT NULL,
+		poll TEXT,
+		forward TEXT,
+		version INTEGER NOT NULL,
+		nonce TEXT NOT NULL
+	);
+	CREATE INDEX messages_channelid_createdat ON messages (channelid, createdat);
+	CREATE INDEX messages_creatorid ON messages (creatorid);
+
+	CREATE TABLE poll_ballots (
+		messageid TEXT NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+		userid TEXT NOT NULL,
+		choices TEXT NOT NULL,
+		PRIMARY KEY (messageid, userid)
+	);`,
+	`ALTER TABLE messages ADD COLUMN bot TEXT;
+	ALTER TABLE messages ADD COLUMN attachments TEXT;`,
+}
+
+// generalCreatorID is who the General channel is created by,
+// the same ID the mongo store uses
+const generalCreatorID = "303030303030303031333337"
+
+// the columns scanned by scanChannel and scanMessage, in order
+const (
+	channelColumns = `id, name, description, createdat, creatorid, private, version`
+	messageColumns = `id, channelid, type, body, blocks, createdat, creatorid, editedat, poll, forward, version, nonce, bot, attachments`
+)
+
+// SQLStore is an implementation of Store backed by
+// a PostgreSQL or SQLite database
+type SQLStore struct {
+	DB *sqldb.DB
+}
+
+// NewSQLStore returns a new SQLStore, migrating the database's
+// schema if needed and adding the General channel
+func NewSQLStore(db *sqldb.DB) (*SQLStore, error) {
+	if err := db.Migrate("messages", sqlMigrations); err != nil {
+		return nil, err
+	}
+	store := &SQLStore{DB: db}
+	_, err := store.InsertChannel(&NewChannel{Name: "General"}, &users.User{ID: generalCreatorID})
+	if err != nil && err != ErrDuplicateKey {
+		return nil, err
+	}
+	return store, nil
+}
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanChannel scans the channelColumns of a row into a Channel
+func scanChannel(row scanner) (*Channel, error) {
+	channel := &Channel{}
+	var id, creatorID string
+	err := row.Scan(&id, &channel.Name, &channel.Description, &channel.CreatedAt, &creatorID, &channel.Private, &channel.Version)
+	if err != nil {
+		return nil, err
+	}
+	channel.ID = id
+	channel.CreatorID = creatorID
+	channel.Members = []users.UserID{}
+	channel.JoinedAt = map[string]time.Time{}
+	return channel, nil
+}
+
+// scanMessage scans the messageColumns of a row into a Message
+func scanMessage(row scanner) (*Message, error) {
+	message := &Message{}
+	var id, channelID, creatorID, blocks string
+	var poll, forward, bot, attachments sql.NullString
+	err := row.Scan(&id, &channelID, &message.Type, &message.Body, &blocks, &message.CreatedAt, &creatorID,
+		&message.EditedAt, &poll, &forward, &message.Version, &message.Nonce, &bot, &attachments)
+	if err != nil {
+		return nil, err
+	}
+	message.ID = id
+	message.ChannelID = channelID
+	message.CreatorID = creatorID
+	if err := json.Unmarshal([]byte(blocks), &message.Blocks); err != nil {
+		return nil, err
+	}
+	if poll.Valid {
+		message.Poll = &Poll{}
+		if err := json.Unmarshal([]byte(poll.String), message.Poll); err != nil {
+			return nil, err
+		}
+		message.Poll.Ballots = map[string][]int{}
+	}
+	if forward.Valid {
+		message.Forward = &ForwardRef{}
+		if err := json.Unmarshal([]byte(forward.String), message.Forward); err != nil {
+			return nil, err
+		}
+	}
+	if bot.Valid {
+		message.Bot = &BotAuthor{}
+		if err := json.Unmarshal([]byte(bot.String), message.Bot); err != nil {
+			return nil, err
+		}
+	}
+	if attachments.Valid {
+		if err := json.Unmarshal([]byte(attachments.String), &message.Attachments); err != nil {
+			return nil, err
+		}
+	}
+	return message, nil
+}
+
+// jsonColumn encodes a value for a JSON text column, nil values are stored as NULL
+func jsonColumn(v interface{}, isNil bool) (interface{}, error) {
+	if isNil {
+		return nil, nil
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(buf), nil
+}
+
+// idArgs returns the string form of each ID to use as query arguments
+func idArgs(ids ...interface{}) []interface{} {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = IDString(id)
+	}
+	return args
+}
+
+// messageIDArgs returns the string form of each message ID to use as query arguments
+func messageIDArgs(ids []MessageID) []interface{} {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = IDString(id)
+	}
+	return args
+}
+
+// getChannels returns the channels from the query along with their members
+func (ss *SQLStore) getChannels(query string, args ...interface{}) ([]*Channel, error) {
+	rows, err := ss.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	channels := []*Channel{}
+	byID := map[string]*Channel{}
+	for rows.Next() {
+		channel, err := scanChannel(rows)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, channel)
+		byID[IDString(channel.ID)] = channel
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(channels) == 0 {
+		return channels, nil
+	}
+
+	// get the members of all the channels in one go
+	ids := make([]interface{}, 0, len(byID))
+	for id := range byID {
+		ids = append(ids, id)
+	}
+	mRows, err := ss.DB.Query(`SELECT channelid, userid, joinedat FROM channel_members WHERE channelid IN (`+
+		sqldb.Params(1, len(ids))+`) ORDER BY joinedat`, ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer mRows.Close()
+	for mRows.Next() {
+		var channelID, userID string
+		var joinedAt time.Time
+		if err := mRows.Scan(&channelID, &userID, &joinedAt); err != nil {
+			return nil, err
+		}
+		channel := byID[channelID]
+		channel.Members = append(channel.Members, userID)
+		channel.JoinedAt[userID] = joinedAt
+	}
+	return channels, mRows.Err()
+}
+
+// getChannel returns the single channel matching the where clause
+func (ss *SQLStore) getChannel(where string, arg interface{}) (*Channel, error) {
+	channels, err := ss.getChannels(`SELECT `+channelColumns+` FROM channels WHERE `+where, arg)
+	if err != nil {
+		return nil, err
+	}
+	if len(channels) == 0 {
+		return nil, ErrChannelNotFound
+	}
+	return channels[0], nil
+}
+
+// getMessages returns the messages from the query with their polls tallied
+func (ss *SQLStore) getMessages(query string, args ...interface{}) ([]*Message, error) {
+	rows, err := ss.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	messages := []*Message{}
+	polls := map[string]*Poll{}
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+		if message.Poll != nil {
+			polls[IDString(message.ID)] = message.Poll
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// get the ballots of all the polls in one go
+	if len(polls) > 0 {
+		ids := make([]interface{}, 0, len(polls))
+		for id := range polls {
+			ids = append(ids, id)
+		}
+		bRows, err := ss.DB.Query(`SELECT messageid, userid, choices FROM poll_ballots WHERE messageid IN (`+
+			sqldb.Params(1, len(ids))+`)`, ids...)
+		if err != nil {
+			return nil, err
+		}
+		defer bRows.Close()
+		for bRows.Next() {
+			var messageID, userID, choices string
+			if err := bRows.Scan(&messageID, &userID, &choices); err != nil {
+				return nil, err
+			}
+			var options []int
+			if err := json.Unmarshal([]byte(choices), &options); err != nil {
+				return nil, err
+			}
+			polls[messageID].Ballots[userID] = options
+		}
+		if err := bRows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	tallyPolls(messages...)
+	return messages, nil
+}
+
+// isMember reports whether the user is a member of the channel
+func (ss *SQLStore) isMember(channelID interface{}, userID interface{}) (bool, error) {
+	var n int
+	err := ss.DB.QueryRow(`SELECT COUNT(*) FROM channel_members WHERE channelid = $1 AND userid = $2`,
+		idArgs(channelID, userID)...).Scan(&n)
+	return n > 0, err
+}
+
+// notWritten works out why a conditional write to a channel or message by
+// the user matched no rows: it doesn't exist, the user isn't its creator,
+// or it has moved on from the expected version
+func (ss *SQLStore) notWritten(table string, id interface{}, user *users.User, notFound error) error {
+	var creatorID string
+	err := ss.DB.QueryRow(`SELECT creatorid FROM `+table+` WHERE id = $1`, IDString(id)).Scan(&creatorID)
+	if err == sql.ErrNoRows {
+		return notFound
+	}
+	if err != nil {
+		return err
+	}
+	if creatorID != IDString(user.ID) {
+		return ErrUnauthorized
+	}
+	return ErrVersionMismatch
+}
+
+// versionCondition returns the condition on the version column for a
+// conditional write, the version parameter being 0 matches any version
+func versionCondition(param int) string {
+	p := "$" + strconv.Itoa(param)
+	return " AND (" + p + " = 0 OR version = " + p + ")"
+}
+
+// GetAllUserChannels returns all channels a given user is allowed to see
+func (ss *SQLStore) GetAllUserChannels(user *users.User) ([]*Channel, error) {
+	return ss.getChannels(`SELECT `+channelColumns+` FROM channels
+		WHERE private = $1 OR id IN (SELECT channelid FROM channel_members WHERE userid = $2)
+		ORDER BY createdat`, false, IDString(user.ID))
+}
+
+// InsertChannel inserts a new channel into the store
+// returns a Channel with a newly assigned ID
+func (ss *SQLStore) InsertChannel(newChannel *NewChannel, creator *users.User) (*Channel, error) {
+	if err := newChannel.Validate(); err != nil {
+		return nil, err
+	}
+	channel, err := newChannel.ToChannel(creator)
+	if err != nil {
+		return nil, err
+	}
+	channel.ID = sqldb.NewID()
+	channel.CreatorID = IDString(creator.ID)
+	channel.CreatedAt = sqldb.StoreTime(channel.CreatedAt)
+
+	tx, err := ss.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`INSERT INTO channels (`+channelColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		channel.ID, channel.Name, channel.Description, channel.CreatedAt, channel.CreatorID, channel.Private, channel.Version)
+	if err != nil {
+		if sqldb.IsUniqueViolation(err) {
+			return nil, ErrDuplicateKey
+		}
+		return nil, err
+	}
+	members := make([]users.UserID, 0, len(channel.Members))
+	for _, m := range channel.Members {
+		_, err := tx.Exec(`INSERT INTO channel_members (channelid, userid, joinedat) VALUES ($1, $2, $3)
+			ON CONFLICT (channelid, userid) DO NOTHING`, channel.ID, IDString(m), channel.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, IDString(m))
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	channel.Members = members
+	return channel, nil
+}
+
+// GetChannelByName returns a channel by a given name
+func (ss *SQLStore) GetChannelByName(name string) (*Channel, error) {
+	return ss.getChannel(`name = $1`, name)
+}
+
+// GetChannelByID returns a channel by a given ID
+func (ss *SQLStore) GetChannelByID(id interface{}) (*Channel, error) {
+	return ss.getChannel(`id = $1`, IDString(id))
+}
+
+// UpdateChannel applies ChannelUpdates to a given Channel if the user is the creator
+func (ss *SQLStore) UpdateChannel(updates *ChannelUpdates, channelID interface{}, user *users.User) error {
+	res, err := ss.DB.Exec(`UPDATE channels SET name = $1, description = $2, version = version + 1
+		WHERE id = $3 AND creatorid = $4`+versionCondition(5),
+		updates.Name, updates.Description, IDString(channelID), IDString(user.ID), updates.Version)
+	if err != nil {
+		if sqldb.IsUniqueViolation(err) {
+			return ErrDuplicateKey
+		}
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ss.notWritten("channels", channelID, user, ErrChannelNotFound)
+	}
+	return nil
+}
+
+// DeleteChannel deletes a channel as well as all messages posted to that channel if they are the creator
+func (ss *SQLStore) DeleteChannel(channelID interface{}, user *users.User, version int) error {
+	// the members and messages are deleted along with it by the foreign keys
+	res, err := ss.DB.Exec(`DELETE FROM channels WHERE id = $1 AND creatorid = $2`+versionCondition(3),
+		IDString(channelID), IDString(user.ID), version)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ss.notWritten("channels", channelID, user, ErrChannelNotFound)
+	}
+	return nil
+}
+
+// AddUserToChannel adds a user to a channel's members if the adder is
+// the channel's creator or the channel is public
+func (ss *SQLStore) AddUserToChannel(userID interface{}, channelID interface{}, creatorID interface{}) error {
+	channel, err := ss.GetChannelByID(channelID)
+	if err == ErrChannelNotFound {
+		return ErrUnauthorized
+	} else if err != nil {
+		return err
+	}
+	if channel.IsMember(userID) || (channel.Private && IDString(channel.CreatorID) != IDString(creatorID)) {
+		return ErrUnauthorized
+	}
+	_, err = ss.DB.Exec(`INSERT INTO channel_members (channelid, userid, joinedat) VALUES ($1, $2, $3)
+		ON CONFLICT (channelid, userid) DO NOTHING`, IDString(channelID), IDString(userID), sqldb.StoreTime(time.Now()))
+	return err
+}
+
+// RemoveUserFromChannel deletes a user from a channel's members if the remover is
+// the channel's creator or the channel is public
+func (ss *SQLStore) RemoveUserFromChannel(userID interface{}, channelID interface{}, creatorID interface{}) error {
+	channel, err := ss.GetChannelByID(channelID)
+	if err == ErrChannelNotFound {
+		return ErrUnauthorized
+	} else if err != nil {
+		return err
+	}
+	if channel.Private && IDString(channel.CreatorID) != IDString(creatorID) {
+		return ErrUnauthorized
+	}
+	_, err = ss.DB.Exec(`DELETE FROM channel_members WHERE channelid = $1 AND userid = $2`,
+		idArgs(channelID, userID)...)
+	return err
+}
+
+// GetRecentMessages gets the most recent N messages
+// posted to a particular channel if it is public or the user is a member
+func (ss *SQLStore) GetRecentMessages(channelID interface{}, user *users.User, N int) ([]*Message, error) {
+	channel, err := ss.GetChannelByID(channelID)
+	if err == ErrChannelNotFound {
+		return nil, ErrUnauthorized
+	} else if err != nil {
+		return nil, err
+	}
+	if !channel.CanView(user.ID) {
+		return nil, ErrUnauthorized
+	}
+	return ss.getMessages(`SELECT `+messageColumns+` FROM messages WHERE channelid = $1
+		ORDER BY createdat DESC LIMIT $2`, IDString(channelID), N)
+}
+
+// InsertMessage adds a new message to the database if the creator is a member of the channel
+func (ss *SQLStore) InsertMessage(newMessage *NewMessage, creator *users.User) (*Message, error) {
+	if err := newMessage.Validate(); err != nil {
+		return nil, err
+	}
+	message, err := newMessage.ToMessage(creator)
+	if err != nil {
+		return nil, err
+	}
+	message.ID = sqldb.NewID()
+	message.ChannelID = IDString(message.ChannelID)
+	message.CreatorID = IDString(creator.ID)
+	message.CreatedAt = sqldb.StoreTime(message.CreatedAt)
+
+	member, err := ss.isMember(message.ChannelID, creator.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !member {
+		return nil, ErrUnauthorized
+	}
+
+	blocks, err := jsonColumn(message.Blocks, false)
+	if err != nil {
+		return nil, err
+	}
+	poll, err := jsonColumn(message.Poll, message.Poll == nil)
+	if err != nil {
+		return nil, err
+	}
+	forward, err := jsonColumn(message.Forward, message.Forward == nil)
+	if err != nil {
+		return nil, err
+	}
+	bot, err := jsonColumn(message.Bot, message.Bot == nil)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := jsonColumn(message.Attachments, len(message.Attachments) == 0)
+	if err != nil {
+		return nil, err
+	}
+	_, err = ss.DB.Exec(`INSERT INTO messages (`+messageColumns+`) VALUES (`+sqldb.Params(1, 14)+`)`,
+		message.ID, message.ChannelID, message.Type, message.Body, blocks, message.CreatedAt, message.CreatorID,
+		sqldb.StoreTime(message.EditedAt), poll, forward, message.Version, message.Nonce, bot, attachments)
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// GetMessageByID returns a message by a given ID
+func (ss *SQLStore) GetMessageByID(id interface{}) (*Message, error) {
+	messages, err := ss.getMessages(`SELECT `+messageColumns+` FROM messages WHERE id = $1`, IDString(id))
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrMessageNotFound
+	}
+	return messages[0], nil
+}
+
+// UpdateMessage applies MessageUpdates to a given Message if the user is the creator
+func (ss *SQLStore) UpdateMessage(updates *MessageUpdates, messageID interface{}, user *users.User) error {
+	// re-parse the markup so the stored blocks match the new body
+	updates.Blocks = ParseMarkup(updates.Body)
+	blocks, err := jsonColumn(updates.Blocks, false)
+	if err != nil {
+		return err
+	}
+	res, err := ss.DB.Exec(`UPDATE messages SET body = $1, blocks = $2, version = version + 1
+		WHERE id = $3 AND creatorid = $4`+versionCondition(5),
+		updates.Body, blocks, IDString(messageID), IDString(user.ID), updates.Version)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ss.notWritten("messages", messageID, user, ErrMessageNotFound)
+	}
+	return nil
+}
+
+// DeleteMessage removes a message from the store if the user is the creator
+func (ss *SQLStore) DeleteMessage(messageID interface{}, user *users.User, version int) error {
+	res, err := ss.DB.Exec(`DELETE FROM messages WHERE id = $1 AND creatorid = $2`+versionCondition(3),
+		IDString(messageID), IDString(user.ID), version)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ss.notWritten("messages", messageID, user, ErrMessageNotFound)
+	}
+	return nil
+}
+
+// CastVote records a user's vote on a poll message, replacing any vote they
+// already cast, and returns the message with the poll results tallied.
+// Only members of the poll's channel may vote.
+func (ss *SQLStore) CastVote(messageID interface{}, user *users.User, vote *Vote) (*Message, error) {
+	message, err := ss.GetMessageByID(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message.Poll == nil {
+		return nil, ErrNotAPoll
+	}
+	if message.Poll.Closed(time.Now()) {
+		return nil, ErrPollClosed
+	}
+	if err := message.Poll.ValidateVote(vote); err != nil {
+		return nil, err
+	}
+	member, err := ss.isMember(message.ChannelID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !member {
+		return nil, ErrUnauthorized
+	}
+
+	// each user has a single ballot row, so replacing it replaces their old vote
+	if len(vote.Options) == 0 {
+		_, err = ss.DB.Exec(`DELETE FROM poll_ballots WHERE messageid = $1 AND userid = $2`,
+			idArgs(messageID, user.ID)...)
+	} else {
+		choices, jerr := jsonColumn(vote.Options, false)
+		if jerr != nil {
+			return nil, jerr
+		}
+		_, err = ss.DB.Exec(`INSERT INTO poll_ballots (messageid, userid, choices) VALUES ($1, $2, $3)
+			ON CONFLICT (messageid, userid) DO UPDATE SET choices = excluded.choices`,
+			IDString(messageID), IDString(user.ID), choices)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ss.GetMessageByID(messageID)
+}
+
+// messageQueryWhere builds the where clause and arguments for a MessageQuery
+func messageQueryWhere(query *MessageQuery) (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+	in := func(column string, ids []interface{}) {
+		conditions = append(conditions, column+` IN (`+sqldb.Params(len(args)+1, len(ids))+`)`)
+		args = append(args, idArgs(ids...)...)
+	}
+	if query.CreatorID != nil {
+		in("creatorid", []interface{}{query.CreatorID})
+	}
+	if len(query.ChannelIDs) > 0 {
+		ids := make([]interface{}, len(query.ChannelIDs))
+		for i, id := range query.ChannelIDs {
+			ids[i] = id
+		}
+		in("channelid", ids)
+	}
+	if len(query.IDs) > 0 {
+		ids := make([]interface{}, len(query.IDs))
+		for i, id := range query.IDs {
+			ids[i] = id
+		}
+		in("id", ids)
+	}
+	if query.Since != nil {
+		args = append(args, sqldb.StoreTime(*query.Since))
+		conditions = append(conditions, `createdat >= $`+strconv.Itoa(len(args)))
+	}
+	if query.Until != nil {
+		args = append(args, sqldb.StoreTime(*query.Until))
+		conditions = append(conditions, `createdat < $`+strconv.Itoa(len(args)))
+	}
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return ` WHERE ` + strings.Join(conditions, ` AND `), args
+}
+
+// FindMessageRefs returns references to all the messages that match the query.
+// It doesn't check authorization, so it is only for moderators.
+func (ss *SQLStore) FindMessageRefs(query *MessageQuery) ([]*MessageRef, error) {
+	where, args := messageQueryWhere(query)
+	rows, err := ss.DB.Query(`SELECT id, channelid FROM messages`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	refs := []*MessageRef{}
+	for rows.Next() {
+		var id, channelID string
+		if err := rows.Scan(&id, &channelID); err != nil {
+			return nil, err
+		}
+		refs = append(refs, &MessageRef{ID: id, ChannelID: channelID})
+	}
+	return refs, rows.Err()
+}
+
+// DeleteMessages removes the messages with the given IDs and returns how many were removed.
+// It doesn't check authorization, so it is only for moderators.
+func (ss *SQLStore) DeleteMessages(messageIDs []MessageID) (int, error) {
+	if len(messageIDs) == 0 {
+		return 0, nil
+	}
+	res, err := ss.DB.Exec(`DELETE FROM messages WHERE id IN (`+sqldb.Params(1, len(messageIDs))+`)`,
+		messageIDArgs(messageIDs)...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// MoveMessages moves the messages with the given IDs into the channel and returns
+// how many were moved. It doesn't check authorization, so it is only for moderators.
+func (ss *SQLStore) MoveMessages(messageIDs []MessageID, channelID interface{}) (int, error) {
+	// make sure the channel exists before moving anything into it
+	if _, err := ss.GetChannelByID(channelID); err != nil {
+		return 0, err
+	}
+	if len(messageIDs) == 0 {
+		return 0, nil
+	}
+	args := append([]interface{}{IDString(channelID)}, messageIDArgs(messageIDs)...)
+	res, err := ss.DB.Exec(`UPDATE messages SET channelid = $1, version = version + 1
+		WHERE id IN (`+sqldb.Params(2, len(messageIDs))+`)`, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// GetChannelAnalytics summarizes the activity in the channel over the query's time range.
+// It doesn't check authorization, callers must check the user can view the channel.
+func (ss *SQLStore) GetChannelAnalytics(channel *Channel, query *AnalyticsQuery) (*ChannelAnalytics, error) {
+	where, args := messageQueryWhere(&MessageQuery{
+		ChannelIDs: []ChannelID{channel.ID},
+		Since:      query.Since,
+		Until:      query.Until,
+	})
+
+	// count the messages on each day
+	days := []*DayCount{}
+	rows, err := ss.DB.Query(`SELECT `+ss.DB.DayExpr("createdat")+`, COUNT(*) FROM messages`+where+` GROUP BY 1`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		d := &DayCount{}
+		if err := rows.Scan(&d.Day, &d.Count); err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// count the messages in each hour of the day
+	hours := []*HourCount{}
+	rows, err = ss.DB.Query(`SELECT `+ss.DB.HourExpr("createdat")+`, COUNT(*) FROM messages`+where+` GROUP BY 1`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		h := &HourCount{}
+		if err := rows.Scan(&h.Hour, &h.Count); err != nil {
+			return nil, err
+		}
+		hours = append(hours, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// count the messages and find the last post of everyone who posted
+	posters := []*MemberActivity{}
+	rows, err = ss.DB.Query(`SELECT creatorid, COUNT(*), MAX(createdat) FROM messages`+where+` GROUP BY creatorid`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var creatorID string
+		var last sqldb.ScanTime
+		p := &MemberActivity{}
+		if err := rows.Scan(&creatorID, &p.Count, &last); err != nil {
+			return nil, err
+		}
+		p.UserID = creatorID
+		if last.Valid {
+			p.LastPostAt = &last.Time
+		}
+		posters = append(posters, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewChannelAnalytics(channel, query, days, hours, posters), nil
+}
@@ -0,0 +1,185 @@
+package messages
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/sqldb"
+	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
+)
+
+// newSQLTestStore returns a SQLStore on a fresh in-memory SQLite database
+func newSQLTestStore(t *testing.T) *SQLStore {
+	db, err := sqldb.Open(sqldb.SQLite, ":memory:")
+	if err != nil {
+		t.Fatalf("error opening database: %v", err)
+	}
+	store, err := NewSQLStore(db)
+	if err != nil {
+		t.Fatalf("error creating store: %v", err)
+	}
+	return store
+}
+
+func TestSQLStoreChannels(t *testing.T) {
+	store := newSQLTestStore(t)
+	defer store.DB.Close()
+	owner := &users.User{ID: sqldb.NewID()}
+	other := &users.User{ID: sqldb.NewID()}
+
+	// the General channel is added when the store is created
+	if _, err := store.GetChannelByName("General"); err != nil {
+		t.Errorf("error getting the General channel: %v", err)
+	}
+
+	c, err := store.InsertChannel(&NewChannel{Name: "chan", Private: true}, owner)
+	if err != nil {
+		t.Fatalf("error inserting channel: %v", err)
+	}
+	if _, err := store.InsertChannel(&NewChannel{Name: "CHAN"}, owner); err != ErrDuplicateKey {
+		t.Errorf("expected ErrDuplicateKey for a name that differs in case but got %v", err)
+	}
+
+	// only members can see private channels
+	channels, err := store.GetAllUserChannels(other)
+	if err != nil || len(channels) != 1 {
+		t.Errorf("expected the other user to only see General but got %d channels, %v", len(channels), err)
+	}
+	if err := store.AddUserToChannel(other.ID, c.ID, other.ID); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized joining a private channel but got %v", err)
+	}
+	if err := store.AddUserToChannel(other.ID, c.ID, owner.ID); err != nil {
+		t.Fatalf("error adding user to channel: %v", err)
+	}
+	channel, err := store.GetChannelByID(c.ID)
+	if err != nil {
+		t.Fatalf("error getting channel: %v", err)
+	}
+	if !channel.IsMember(other.ID) || len(channel.Members) != 2 {
+		t.Errorf("user not added to channel: %v", channel.Members)
+	}
+
+	// updates are checked against the creator and version
+	updates := &ChannelUpdates{Name: "renamed", Version: 1}
+	if err := store.UpdateChannel(updates, c.ID, other); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized updating someone else's channel but got %v", err)
+	}
+	if err := store.UpdateChannel(updates, c.ID, owner); err != nil {
+		t.Fatalf("error updating channel: %v", err)
+	}
+	if err := store.UpdateChannel(updates, c.ID, owner); err != ErrVersionMismatch {
+		t.Errorf("expected ErrVersionMismatch for a stale update but got %v", err)
+	}
+	channel, _ = store.GetChannelByID(c.ID)
+	if channel.Name != "renamed" || channel.Version != 2 {
+		t.Errorf("channel not updated: got name %s version %d", channel.Name, channel.Version)
+	}
+
+	if err := store.RemoveUserFromChannel(other.ID, c.ID, owner.ID); err != nil {
+		t.Fatalf("error removing user from channel: %v", err)
+	}
+	channel, _ = store.GetChannelByID(c.ID)
+	if channel.IsMember(other.ID) {
+		t.Errorf("user not removed from channel")
+	}
+
+	if err := store.DeleteChannel(c.ID, owner, 0); err != nil {
+		t.Fatalf("error deleting channel: %v", err)
+	}
+	if _, err := store.GetChannelByID(c.ID); err != ErrChannelNotFound {
+		t.Errorf("expected ErrChannelNotFound after delete but got %v", err)
+	}
+}
+
+func TestSQLStoreMessages(t *testing.T) {
+	store := newSQLTestStore(t)
+	defer store.DB.Close()
+	owner := &users.User{ID: sqldb.NewID()}
+	other := &users.User{ID: sqldb.NewID()}
+	c, err := store.InsertChannel(&NewChannel{Name: "chan"}, owner)
+	if err != nil {
+		t.Fatalf("error inserting channel: %v", err)
+	}
+
+	if _, err := store.InsertMessage(&NewMessage{ChannelID: c.ID, Body: "hi"}, other); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized posting to a channel the user isn't in but got %v", err)
+	}
+	m, err := store.InsertMessage(&NewMessage{ChannelID: c.ID, Body: "*hi*", Nonce: "n1"}, owner)
+	if err != nil {
+		t.Fatalf("error inserting message: %v", err)
+	}
+	m2, err := store.GetMessageByID(m.ID)
+	if err != nil {
+		t.Fatalf("error getting message: %v", err)
+	}
+	if m2.Body != "*hi*" || m2.Nonce != "n1" || len(m2.Blocks) != 1 || m2.Blocks[0].Type != BlockBold {
+		t.Errorf("message not stored correctly: %+v", m2)
+	}
+
+	// updates are checked against the creator and version
+	if err := store.UpdateMessage(&MessageUpdates{Body: "edited"}, m.ID, other); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized updating someone else's message but got %v", err)
+	}
+	if err := store.UpdateMessage(&MessageUpdates{Body: "edited", Version: 1}, m.ID, owner); err != nil {
+		t.Fatalf("error updating message: %v", err)
+	}
+	if err := store.DeleteMessage(m.ID, owner, 1); err != ErrVersionMismatch {
+		t.Errorf("expected ErrVersionMismatch deleting a stale message but got %v", err)
+	}
+
+	// polls
+	closes := time.Now().Add(time.Hour)
+	poll, err := store.InsertMessage(&NewMessage{ChannelID: c.ID, Body: "lunch?", Poll: &NewPoll{
+		Options:  []string{"pizza", "tacos"},
+		ClosesAt: &closes,
+	}}, owner)
+	if err != nil {
+		t.Fatalf("error inserting poll: %v", err)
+	}
+	if _, err := store.CastVote(poll.ID, owner, &Vote{Options: []int{0}}); err != nil {
+		t.Fatalf("error voting: %v", err)
+	}
+	voted, err := store.CastVote(poll.ID, owner, &Vote{Options: []int{1}})
+	if err != nil {
+		t.Fatalf("error changing vote: %v", err)
+	}
+	if voted.Poll.Options[0].Votes != 0 || voted.Poll.Options[1].Votes != 1 {
+		t.Errorf("vote not replaced: got %d and %d votes", voted.Poll.Options[0].Votes, voted.Poll.Options[1].Votes)
+	}
+	if _, err := store.CastVote(m.ID, owner, &Vote{Options: []int{0}}); err != ErrNotAPoll {
+		t.Errorf("expected ErrNotAPoll but got %v", err)
+	}
+
+	recent, err := store.GetRecentMessages(c.ID, owner, 10)
+	if err != nil || len(recent) != 2 || recent[0].ID != poll.ID {
+		t.Errorf("incorrect recent messages, expected the poll then the message: %v, %v", recent, err)
+	}
+
+	// analytics
+	analytics, err := store.GetChannelAnalytics(c, &AnalyticsQuery{Top: 5})
+	if err != nil {
+		t.Fatalf("error getting analytics: %v", err)
+	}
+	if analytics.Total != 2 || len(analytics.MessagesPerDay) != 1 || analytics.BusiestHours[0].Count != 2 {
+		t.Errorf("incorrect analytics: %+v", analytics)
+	}
+	if len(analytics.TopPosters) != 1 || analytics.TopPosters[0].LastPostAt == nil {
+		t.Errorf("incorrect top posters: %+v", analytics.TopPosters)
+	}
+
+	// moderation
+	other2, err := store.InsertChannel(&NewChannel{Name: "other"}, owner)
+	if err != nil {
+		t.Fatalf("error inserting channel: %v", err)
+	}
+	refs, err := store.FindMessageRefs(&MessageQuery{CreatorID: owner.ID, ChannelIDs: []ChannelID{c.ID}})
+	if err != nil || len(refs) != 2 {
+		t.Fatalf("incorrect message refs: %v, %v", refs, err)
+	}
+	if n, err := store.MoveMessages([]MessageID{refs[0].ID}, other2.ID); err != nil || n != 1 {
+		t.Errorf("incorrect number of messages moved: %d, %v", n, err)
+	}
+	if n, err := store.DeleteMessages([]MessageID{refs[0].ID, refs[1].ID}); err != nil || n != 2 {
+		t.Errorf("incorrect number of messages deleted: %d, %v", n, err)
+	}
+}
@@ -18,6 +18,10 @@ var ErrDuplicateKey = errors.New("duplicate key")
 // ErrUnauthorized is returned when a user is unable to see a field
 var ErrUnauthorized = errors.New("user unauthorized")
 
+// ErrVersionMismatch is returned when a channel or message has been
+// changed since the version the update or delete was based on
+var ErrVersionMismatch = errors.New("version mismatch")
+
 // Store represents an abstract store for messages.Channel and messages.Message objects.
 // This interface is used by the HTTP handlers to insert new Messages, channels
 // get and update. This interface can be implemented for any persistent database.
@@ -39,11 +43,13 @@ type Store interface {
 	// posted to a particular channel if a user is authorized
 	GetRecentMessages(channelID interface{}, user *users.User, N int) ([]*Message, error)
 
-	// UpdateChannel applies ChannelUpdates to a given Channel
+	// UpdateChannel applies ChannelUpdates to a given Channel and increments its version.
+	// If updates.Version isn't 0 the channel must be at that version, or ErrVersionMismatch is returned.
 	UpdateChannel(updates *ChannelUpdates, channelID interface{}, user *users.User) error
 
-	// DeleteChannel deletes a channel as well as all messages posted to that channel if authorized
-	DeleteChannel(channelID interface{}, user *users.User) error
+	// DeleteChannel deletes a channel as well as all messages posted to that channel if authorized.
+	// If version isn't 0 the channel must be at that version, or ErrVersionMismatch is returned.
+	DeleteChannel(channelID interface{}, user *users.User, version int) error
 
 	// AddUserToChannel adds a user to a channels Members list if authorized
 	AddUserToChannel(userID interface{}, channelID interface{}, creatorID interface{}) error
@@ -57,9 +63,32 @@ type Store interface {
 	// InsertMessage adds a message to a channel
 	InsertMessage(newMessage *NewMessage, creator *users.User) (*Message, error)
 
-	// UpdateMessage applies MessageUpdates to a given Message
+	// UpdateMessage applies MessageUpdates to a given Message and increments its version.
+	// If updates.Version isn't 0 the message must be at that version, or ErrVersionMismatch is returned.
 	UpdateMessage(updates *MessageUpdates, messageID interface{}, user *users.User) error
 
-	//DeleteMessage removes a message from the store
-	DeleteMessage(messageID interface{}, user *users.User) error
+	//DeleteMessage removes a message from the store.
+	//If version isn't 0 the message must be at that version, or ErrVersionMismatch is returned.
+	DeleteMessage(messageID interface{}, user *users.User, version int) error
+
+	// CastVote records a user's vote on a poll message, replacing any vote they
+	// already cast, and returns the message with the poll results tallied.
+	// Only members of the poll's channel may vote.
+	CastVote(messageID interface{}, user *users.User, vote *Vote) (*Message, error)
+
+	// FindMessageRefs returns references to all the messages that match the query.
+	// It doesn't check authorization, so it is only for moderators.
+	FindMessageRefs(query *MessageQuery) ([]*MessageRef, error)
+
+	// DeleteMessages removes the messages with the given IDs and returns how many were removed.
+	// It doesn't check authorization, so it is only for moderators.
+	DeleteMessages(messageIDs []MessageID) (int, error)
+
+	// MoveMessages moves the messages with the given IDs into the channel and returns
+	// how many were moved. It doesn't check authorization, so it is only for moderators.
+	MoveMessages(messageIDs []MessageID, channelID interface{}) (int, error)
+
+	// GetChannelAnalytics summarizes the activity in the channel over the query's time range.
+	// It doesn't check authorization, callers must check the user can view the channel.
+	GetChannelAnalytics(channel *Channel, query *AnalyticsQuery) (*ChannelAnalytics, error)
 }
@@ -0,0 +1,65 @@
+package mongomigrate
+
+import (
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// error codes mongo returns when dropping something that isn't there
+const (
+	codeNamespaceNotFound = 26
+	codeIndexNotFound     = 27
+)
+
+// CreateIndex returns a migration step that creates the index on the collection
+func CreateIndex(collection string, index mgo.Index) func(db *mgo.Database) error {
+	return func(db *mgo.Database) error {
+		return db.C(collection).EnsureIndex(index)
+	}
+}
+
+// DropIndex returns a migration step that drops the index with the given name
+// from the collection, it isn't an error if the index doesn't exist
+func DropIndex(collection string, name string) func(db *mgo.Database) error {
+	return func(db *mgo.Database) error {
+		err := db.C(collection).DropIndexName(name)
+		if qerr, ok := err.(*mgo.QueryError); ok {
+			if qerr.Code == codeNamespaceNotFound || qerr.Code == codeIndexNotFound {
+				return nil
+			}
+		}
+		return err
+	}
+}
+
+// RenameField returns a migration step that renames a field
+// in every document in the collection that has it
+func RenameField(collection string, from string, to string) func(db *mgo.Database) error {
+	return func(db *mgo.Database) error {
+		_, err := db.C(collection).UpdateAll(bson.M{from: bson.M{"$exists": true}},
+			bson.M{"$rename": bson.M{from: to}})
+		return err
+	}
+}
+
+// SetMissing returns a migration step that backfills a field with
+// the value in every document in the collection that doesn't have it
+func SetMissing(collection string, field string, value interface{}) func(db *mgo.Database) error {
+	return func(db *mgo.Database) error {
+		_, err := db.C(collection).UpdateAll(bson.M{field: bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{field: value}})
+		return err
+	}
+}
+
+// Steps returns a migration step that runs each of the steps in order
+func Steps(steps ...func(db *mgo.Database) error) func(db *mgo.Database) error {
+	return func(db *mgo.Database) error {
+		for _, step := range steps {
+			if err := step(db); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,175 @@
+// Package mongomigrate runs versioned migrations against a mongo database, such as
+// creating indexes, backfilling data and renaming fields. The versions that have been
+// applied are recorded in the database, so each migration runs once per database,
+// and a lock in the database stops several servers starting at once from racing.
+package mongomigrate
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// the collections migrations are tracked and locked in
+const (
+	MigrationsCollection = "schema_migrations"
+	LocksCollection      = "schema_migrations_locks"
+)
+
+// LockLease is how long a lock is held before another server may take it over,
+// in case the server holding it died. It is renewed after each migration.
+var LockLease = 5 * time.Minute
+
+// LockWait is how long to wait for another server to finish migrating
+var LockWait = 10 * time.Minute
+
+// lockPollInterval is how often a waiting server checks if the lock is free
+var lockPollInterval = 500 * time.Millisecond
+
+// ErrLocked is returned when another server held the lock for longer than LockWait
+var ErrLocked = errors.New("migrations are locked by another server")
+
+// ErrLockLost is returned when the lock's lease ran out part way through
+// and another server took it over
+var ErrLockLost = errors.New("lost the migrations lock to another server")
+
+// Migration is a single change to the database. Mongo can't run a migration
+// and record it in one transaction, so Up must be idempotent in case the
+// server stops before it is recorded and the migration runs again.
+type Migration struct {
+	Description string
+	Up          func(db *mgo.Database) error
+}
+
+// Applied is the record of a migration that has been run
+type Applied struct {
+	ID          string    `bson:"_id"`
+	Component   string    `bson:"component"`
+	Version     int       `bson:"version"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"appliedat"`
+}
+
+// lock is the document that is held while a server migrates a component
+type lock struct {
+	Component string    `bson:"_id"`
+	Owner     string    `bson:"owner"`
+	ExpiresAt time.Time `bson:"expiresat"`
+}
+
+// Migrate brings a component (e.g. "users") of the database up to date by running
+// each of its migrations that hasn't been run before, in order. Migrations are
+// only ever appended to, never edited, since the index of each one is its version.
+func Migrate(db *mgo.Database, component string, migrations []Migration) error {
+	owner, err := newOwner()
+	if err != nil {
+		return err
+	}
+	if err := acquire(db, component, owner); err != nil {
+		return err
+	}
+	defer release(db, component, owner)
+
+	col := db.C(MigrationsCollection)
+	for i, migration := range migrations {
+		version := i + 1
+		id := applicationID(component, version)
+		n, err := col.FindId(id).Count()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+
+		if err := migration.Up(db); err != nil {
+			return fmt.Errorf("error running %s migration %d (%s): %v", component, version, migration.Description, err)
+		}
+		err = col.Insert(&Applied{
+			ID:          id,
+			Component:   component,
+			Version:     version,
+			Description: migration.Description,
+			AppliedAt:   time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		if err := renew(db, component, owner); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AppliedVersions returns the records of the migrations that have been run for the component
+func AppliedVersions(db *mgo.Database, component string) ([]*Applied, error) {
+	applied := []*Applied{}
+	err := db.C(MigrationsCollection).Find(bson.M{"component": component}).Sort("version").All(&applied)
+	if err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// applicationID returns the ID of the record of a migration
+func applicationID(component string, version int) string {
+	return fmt.Sprintf("%s:%d", component, version)
+}
+
+// newOwner returns a random ID for the server taking the lock
+func newOwner() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// acquire takes the lock on the component, waiting for up
+// to LockWait for another server to release it
+func acquire(db *mgo.Database, component string, owner string) error {
+	col := db.C(LocksCollection)
+	deadline := time.Now().Add(LockWait)
+	for {
+		// the lock can be taken if nobody holds it or the holder's lease has run out,
+		// otherwise the upsert tries to insert a second lock and gets a duplicate key
+		now := time.Now()
+		query := bson.M{"_id": component, "expiresat": bson.M{"$lt": now}}
+		_, err := col.Upsert(query, &lock{Component: component, Owner: owner, ExpiresAt: now.Add(LockLease)})
+		if err == nil {
+			return nil
+		}
+		if !mgo.IsDup(err) {
+			return err
+		}
+		if now.After(deadline) {
+			return ErrLocked
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// renew extends the lease on the lock
+func renew(db *mgo.Database, component string, owner string) error {
+	err := db.C(LocksCollection).Update(bson.M{"_id": component, "owner": owner},
+		bson.M{"$set": bson.M{"expiresat": time.Now().Add(LockLease)}})
+	if err == mgo.ErrNotFound {
+		return ErrLockLost
+	}
+	return err
+}
+
+// release gives up the lock if it is still held by the owner
+func release(db *mgo.Database, component string, owner string) error {
+	err := db.C(LocksCollection).Remove(bson.M{"_id": component, "owner": owner})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,166 @@
+package mongomigrate
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// NOTE: these tests need a local instance of mongo, to start one using Docker run
+// docker run -d -p 27017:27017 mongo
+
+// newMongoTestDB returns an empty database and drops it when the test is done
+func newMongoTestDB(t *testing.T) *mgo.Database {
+	session, err := mgo.Dial("127.0.0.1:27017")
+	if err != nil {
+		t.Fatalf("error dialing mongo: %v", err)
+	}
+	db := session.DB("migrations_test")
+	db.DropDatabase()
+	t.Cleanup(func() {
+		db.DropDatabase()
+		session.Close()
+	})
+	return db
+}
+
+// counter returns a migration that counts how many times it is run
+func counter(runs *int, mu *sync.Mutex) Migration {
+	return Migration{
+		Description: "count",
+		Up: func(db *mgo.Database) error {
+			mu.Lock()
+			defer mu.Unlock()
+			*runs++
+			return nil
+		},
+	}
+}
+
+func TestMongoMigrate(t *testing.T) {
+	db := newMongoTestDB(t)
+	var mu sync.Mutex
+	var order []int
+	step := func(i int) Migration {
+		return Migration{
+			Description: "step",
+			Up: func(db *mgo.Database) error {
+				order = append(order, i)
+				return nil
+			},
+		}
+	}
+
+	if err := Migrate(db, "test", []Migration{step(1), step(2)}); err != nil {
+		t.Fatalf("error migrating: %v", err)
+	}
+	// adding a migration only runs the new one
+	if err := Migrate(db, "test", []Migration{step(1), step(2), step(3)}); err != nil {
+		t.Fatalf("error migrating: %v", err)
+	}
+	if len(order) != 3 || order[0] != 1 || order[1] != 2 || order[2] != 3 {
+		t.Errorf("expected the migrations to run once each in order but got %v", order)
+	}
+
+	applied, err := AppliedVersions(db, "test")
+	if err != nil {
+		t.Fatalf("error getting applied versions: %v", err)
+	}
+	if len(applied) != 3 || applied[2].Version != 3 {
+		t.Errorf("expected 3 applied versions but got %v", applied)
+	}
+
+	// components are migrated separately
+	runs := 0
+	if err := Migrate(db, "other", []Migration{counter(&runs, &mu)}); err != nil {
+		t.Fatalf("error migrating: %v", err)
+	}
+	if runs != 1 {
+		t.Errorf("expected the other component's migration to run once but it ran %d times", runs)
+	}
+}
+
+func TestMongoMigrateFailure(t *testing.T) {
+	db := newMongoTestDB(t)
+	var mu sync.Mutex
+	runs := 0
+	failing := Migration{
+		Description: "fail",
+		Up:          func(db *mgo.Database) error { return errors.New("failed") },
+	}
+
+	if err := Migrate(db, "test", []Migration{counter(&runs, &mu), failing, counter(&runs, &mu)}); err == nil {
+		t.Fatalf("expected an error from the failing migration")
+	}
+	if runs != 1 {
+		t.Errorf("expected the migrations after the failure not to run but %d ran", runs)
+	}
+	applied, _ := AppliedVersions(db, "test")
+	if len(applied) != 1 {
+		t.Errorf("expected only the first migration to be recorded but got %v", applied)
+	}
+	// the lock is released after a failure
+	if err := Migrate(db, "test", []Migration{counter(&runs, &mu)}); err != nil {
+		t.Errorf("error migrating after a failure: %v", err)
+	}
+}
+
+func TestMongoMigrateConcurrent(t *testing.T) {
+	db := newMongoTestDB(t)
+	var mu sync.Mutex
+	runs := 0
+	migrations := []Migration{counter(&runs, &mu), counter(&runs, &mu)}
+
+	// several servers starting at once only run each migration once
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			session := db.Session.Copy()
+			defer session.Close()
+			if err := Migrate(db.With(session), "test", migrations); err != nil {
+				t.Errorf("error migrating: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if runs != len(migrations) {
+		t.Errorf("expected %d migrations to run but %d did", len(migrations), runs)
+	}
+}
+
+func TestMongoMigrateLock(t *testing.T) {
+	db := newMongoTestDB(t)
+	defer func(wait time.Duration) { LockWait = wait }(LockWait)
+	LockWait = time.Second
+	var mu sync.Mutex
+	runs := 0
+
+	// another server is holding the lock
+	err := db.C(LocksCollection).Insert(&lock{Component: "test", Owner: "other", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("error inserting lock: %v", err)
+	}
+	if err := Migrate(db, "test", []Migration{counter(&runs, &mu)}); err != ErrLocked {
+		t.Errorf("expected ErrLocked but got %v", err)
+	}
+	if runs != 0 {
+		t.Errorf("expected no migrations to run without the lock but %d did", runs)
+	}
+
+	// its lease runs out, so it is taken over
+	err = db.C(LocksCollection).UpdateId("test", &lock{Component: "test", Owner: "other", ExpiresAt: time.Now().Add(-time.Second)})
+	if err != nil {
+		t.Fatalf("error expiring lock: %v", err)
+	}
+	if err := Migrate(db, "test", []Migration{counter(&runs, &mu)}); err != nil {
+		t.Errorf("error migrating after the lock expired: %v", err)
+	}
+	if runs != 1 {
+		t.Errorf("expected the migration to run once but it ran %d times", runs)
+	}
+}
@@ -0,0 +1,63 @@
+package sqldb
+
+import "time"
+
+// Migrate brings the schema of a component (e.g. "users") up to date by running
+// each of its migrations that hasn't been run before, in order. Migrations are
+// only ever appended to, never edited, since the index of each one is its version.
+// Each migration runs in its own transaction along with recording that it ran.
+func (db *DB) Migrate(component string, migrations []string) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		component TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		appliedat TIMESTAMP NOT NULL,
+		PRIMARY KEY (component, version)
+	)`)
+	if err != nil {
+		return err
+	}
+
+	for i, migration := range migrations {
+		if err := db.migrate(component, i+1, migration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrate runs a single migration if it hasn't been run yet
+func (db *DB) migrate(component string, version int, migration string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// stop several servers starting at once from running the same migration,
+	// SQLite doesn't need this since it only has one writer at a time
+	if db.Backend == Postgres {
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('schema_migrations'))`); err != nil {
+			return err
+		}
+	}
+
+	var n int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE component = $1 AND version = $2`,
+		component, version).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	if _, err := tx.Exec(migration); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO schema_migrations (component, version, appliedat) VALUES ($1, $2, $3)`,
+		component, version, StoreTime(time.Now()))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,161 @@
+// Package sqldb opens the SQL databases that the SQL implementations of
+// users.Store and messages.Store run on, and applies their schema migrations.
+// PostgreSQL and SQLite are supported. SQLite runs in-process using a pure Go
+// driver, so the whole API can run from a single static binary.
+package sqldb
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// supported backends
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// DB is a SQL database along with the backend it is running on, for the
+// few places where the SQL has to differ between backends.
+// All queries use $1, $2, ... placeholders, which both backends accept.
+type DB struct {
+	*sql.DB
+	Backend string
+}
+
+// Open opens and pings the database for the backend. For SQLite the dsn is a
+// file name, or :memory: for a database that only lasts as long as the process.
+func Open(backend string, dsn string) (*DB, error) {
+	var db *sql.DB
+	var err error
+	switch backend {
+	case Postgres:
+		db, err = sql.Open("postgres", dsn)
+	case SQLite:
+		// store times in a format SQLite's date functions understand, and
+		// turn on foreign keys which SQLite leaves off by default
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		db, err = sql.Open("sqlite", "file:"+strings.TrimPrefix(dsn, "file:")+sep+
+			"_time_format=sqlite&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+		if err == nil {
+			// SQLite only allows one writer at a time, and every connection
+			// to :memory: would otherwise get its own empty database
+			db.SetMaxOpenConns(1)
+		}
+	default:
+		return nil, fmt.Errorf("unknown SQL backend %q", backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &DB{DB: db, Backend: backend}, nil
+}
+
+// NewID returns a new random ID. IDs are 24 hex characters,
+// the same shape as the mongo ObjectIds clients already handle.
+func NewID() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		panic("sqldb: unable to read random bytes: " + err.Error())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Params returns a list of n placeholders starting at $start, e.g. "$2, $3, $4"
+func Params(start int, n int) string {
+	params := make([]string, n)
+	for i := range params {
+		params[i] = "$" + strconv.Itoa(start+i)
+	}
+	return strings.Join(params, ", ")
+}
+
+// DayExpr returns an expression for the UTC day (as YYYY-MM-DD) of a time column
+func (db *DB) DayExpr(column string) string {
+	if db.Backend == Postgres {
+		return "to_char(" + column + ", 'YYYY-MM-DD')"
+	}
+	return "strftime('%Y-%m-%d', " + column + ")"
+}
+
+// HourExpr returns an expression for the UTC hour of the day (0-23) of a time column
+func (db *DB) HourExpr(column string) string {
+	if db.Backend == Postgres {
+		return "CAST(EXTRACT(HOUR FROM " + column + ") AS INTEGER)"
+	}
+	return "CAST(strftime('%H', " + column + ") AS INTEGER)"
+}
+
+// IsUniqueViolation reports whether the error is from breaking a unique constraint
+func IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE ||
+			sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+	return false
+}
+
+// StoreTime converts a time to how it is stored. Times are always stored in UTC
+// so that they compare and group by day the same way on every backend.
+func StoreTime(t time.Time) time.Time {
+	return t.UTC()
+}
+
+// sqliteTimeLayouts are the layouts SQLite times can come back as text in
+var sqliteTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999Z07:00",
+}
+
+// ScanTime is a sql.Scanner for times that may come back as text,
+// like aggregates of time columns in SQLite which lose the column's type
+type ScanTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+// Scan implements sql.Scanner
+func (st *ScanTime) Scan(value interface{}) error {
+	st.Time, st.Valid = time.Time{}, false
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case time.Time:
+		st.Time, st.Valid = v, true
+		return nil
+	case []byte:
+		return st.Scan(string(v))
+	case string:
+		for _, layout := range sqliteTimeLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				st.Time, st.Valid = t, true
+				return nil
+			}
+		}
+		return fmt.Errorf("unable to parse time %q", v)
+	}
+	return fmt.Errorf("unable to scan %T into a time", value)
+}
@@ -0,0 +1,79 @@
+package sqldb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMigrate(t *testing.T) {
+	db, err := Open(SQLite, ":memory:")
+	if err != nil {
+		t.Fatalf("error opening database: %v", err)
+	}
+	defer db.Close()
+
+	migrations := []string{
+		`CREATE TABLE things (id TEXT PRIMARY KEY)`,
+		`ALTER TABLE things ADD COLUMN name TEXT`,
+	}
+	if err := db.Migrate("things", migrations); err != nil {
+		t.Fatalf("error migrating: %v", err)
+	}
+	// running them again must skip the ones that already ran
+	if err := db.Migrate("things", migrations); err != nil {
+		t.Fatalf("error migrating a second time: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO things (id, name) VALUES ($1, $2)`, NewID(), "thing"); err != nil {
+		t.Errorf("error using the migrated table: %v", err)
+	}
+
+	// a bad migration isn't recorded so it is tried again next time
+	migrations = append(migrations, `NOT SQL`)
+	if err := db.Migrate("things", migrations); err == nil {
+		t.Errorf("expected error from a bad migration")
+	}
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE component = $1`, "things").Scan(&n)
+	if n != 2 {
+		t.Errorf("incorrect number of recorded migrations: expected 2 but got %d", n)
+	}
+}
+
+func TestUniqueViolation(t *testing.T) {
+	db, err := Open(SQLite, ":memory:")
+	if err != nil {
+		t.Fatalf("error opening database: %v", err)
+	}
+	defer db.Close()
+
+	db.Exec(`CREATE TABLE things (id TEXT PRIMARY KEY)`)
+	db.Exec(`INSERT INTO things (id) VALUES ($1)`, "a")
+	_, err = db.Exec(`INSERT INTO things (id) VALUES ($1)`, "a")
+	if !IsUniqueViolation(err) {
+		t.Errorf("expected a unique violation but got %v", err)
+	}
+}
+
+func TestScanTime(t *testing.T) {
+	expected := time.Date(2017, 5, 2, 13, 4, 5, 123456789, time.UTC)
+	cases := []interface{}{
+		expected,
+		"2017-05-02 13:04:05.123456789+00:00",
+		[]byte("2017-05-02 13:04:05.123456789+00:00"),
+	}
+	for _, c := range cases {
+		st := &ScanTime{}
+		if err := st.Scan(c); err != nil {
+			t.Errorf("error scanning %v: %v", c, err)
+			continue
+		}
+		if !st.Valid || !st.Time.Equal(expected) {
+			t.Errorf("incorrect time scanned from %v: got %v", c, st.Time)
+		}
+	}
+
+	st := &ScanTime{}
+	if err := st.Scan(nil); err != nil || st.Valid {
+		t.Errorf("expected an invalid time from NULL but got %v, %v", st, err)
+	}
+}
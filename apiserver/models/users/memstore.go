@@ -4,13 +4,16 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"sync"
 )
 
 //MemStore is an implementation of UserStore
 //backed by an in-memory slice. This should only
-//be used for automated testing. This is not
-//safe for concurrent access
+//be used for automated testing. The users it
+//returns are copies, so they can be used
+//without holding the lock
 type MemStore struct {
+	mu      sync.RWMutex
 	entries []*User
 }
 
@@ -23,39 +26,40 @@ func NewMemStore() *MemStore {
 
 //GetAll returns all users
 func (mus *MemStore) GetAll() ([]*User, error) {
+	mus.mu.RLock()
+	defer mus.mu.RUnlock()
 	users := make([]*User, len(mus.entries))
-	copy(users, mus.entries)
+	for i, u := range mus.entries {
+		users[i] = u.copy()
+	}
 	return users, nil
 }
 
 //GetByID returns the User with the given ID
 func (mus *MemStore) GetByID(id interface{}) (*User, error) {
-	for _, u := range mus.entries {
-		if u.ID == id {
-			return u, nil
+	return mus.find(func(u *User) bool { return u.ID == id })
+}
+
+//GetByIDs returns the Users with the given IDs,
+//IDs that don't match a user are skipped
+func (mus *MemStore) GetByIDs(ids []interface{}) ([]*User, error) {
+	users := []*User{}
+	for _, id := range ids {
+		if u, err := mus.GetByID(id); err == nil {
+			users = append(users, u)
 		}
 	}
-	return nil, ErrUserNotFound
+	return users, nil
 }
 
 //GetByEmail returns the User with the given email
 func (mus *MemStore) GetByEmail(email string) (*User, error) {
-	for _, u := range mus.entries {
-		if u.Email == email {
-			return u, nil
-		}
-	}
-	return nil, ErrUserNotFound
+	return mus.find(func(u *User) bool { return u.Email == email })
 }
 
 //GetByUserName returns the User with the given user name
 func (mus *MemStore) GetByUserName(name string) (*User, error) {
-	for _, u := range mus.entries {
-		if u.UserName == name {
-			return u, nil
-		}
-	}
-	return nil, ErrUserNotFound
+	return mus.find(func(u *User) bool { return u.UserName == name })
 }
 
 //Insert inserts a new NewUser into the database
@@ -74,23 +78,64 @@ func (mus *MemStore) Insert(newUser *NewUser) (*User, error) {
 		return nil, err
 	}
 	u.ID = id
+
+	mus.mu.Lock()
+	defer mus.mu.Unlock()
+	//emails and user names are unique
+	for _, e := range mus.entries {
+		if e.Email == u.Email || e.UserName == u.UserName {
+			return nil, ErrDuplicateKey
+		}
+	}
 	mus.entries = append(mus.entries, u)
-	return u, nil
+	return u.copy(), nil
 }
 
 //Update applies UserUpdates to the currentUser
 func (mus *MemStore) Update(updates *UserUpdates, currentuser *User) error {
-	u, err := mus.GetByID(currentuser.ID)
-	if err != nil {
-		return err
+	mus.mu.Lock()
+	defer mus.mu.Unlock()
+	u := mus.entry(func(u *User) bool { return u.ID == currentuser.ID })
+	if u == nil {
+		return ErrUserNotFound
 	}
 	u.FirstName = updates.FirstName
 	u.LastName = updates.LastName
+	currentuser.FirstName = updates.FirstName
+	currentuser.LastName = updates.LastName
 	return nil
 }
 
 // ResetPassword applies password resets to the user with the given email
 func (mus *MemStore) ResetPassword(email, newPassword string) error {
+	mus.mu.Lock()
+	defer mus.mu.Unlock()
+	u := mus.entry(func(u *User) bool { return u.Email == email })
+	if u == nil {
+		return ErrUserNotFound
+	}
+	return u.SetPassword(newPassword)
+}
+
+//find returns a copy of the first user that matches
+func (mus *MemStore) find(match func(u *User) bool) (*User, error) {
+	mus.mu.RLock()
+	defer mus.mu.RUnlock()
+	u := mus.entry(match)
+	if u == nil {
+		return nil, ErrUserNotFound
+	}
+	return u.copy(), nil
+}
+
+//entry returns the first stored user that matches,
+//the caller must hold the lock
+func (mus *MemStore) entry(match func(u *User) bool) *User {
+	for _, u := range mus.entries {
+		if match(u) {
+			return u
+		}
+	}
 	return nil
 }
 
@@ -101,3 +146,9 @@ func (mus *MemStore) newID() (UserID, error) {
 	}
 	return UserID(hex.EncodeToString(buf)), nil
 }
+
+//copy returns a copy of the user
+func (u *User) copy() *User {
+	c := *u
+	return &c
+}
@@ -35,6 +35,14 @@ func TestMemStore(t *testing.T) {
 		t.Errorf("ID of user fetched by id didn't match: expected %s but got %s\n", u.ID, u2.ID)
 	}
 
+	found, err := store.GetByIDs([]interface{}{u.ID, "missing"})
+	if err != nil {
+		t.Errorf("error getting users by IDs: %v\n", err)
+	}
+	if len(found) != 1 || found[0].ID != u.ID {
+		t.Errorf("incorrect users fetched by IDs: expected only %s but got %v\n", u.ID, found)
+	}
+
 	u2, err = store.GetByEmail(nu.Email)
 	if err != nil {
 		t.Errorf("error getting new user by email: %v\n", err)
@@ -3,6 +3,8 @@ package users
 import (
 	mgo "gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/mongomigrate"
 )
 
 const defaultAddr = "127.0.0.1:27017"
@@ -32,12 +34,36 @@ func NewMongoStore(session *mgo.Session, databaseName string) (*MongoStore, erro
 	if databaseName == "" {
 		databaseName = "production"
 	}
-	// return a new mongo store and no error
-	return &MongoStore{
+	store := &MongoStore{
 		Session:        session,
 		DatabaseName:   databaseName,
 		CollectionName: "users",
-	}, nil
+	}
+	// create the indexes if they aren't there yet
+	if err := mongomigrate.Migrate(session.DB(databaseName), "users", store.migrations()); err != nil {
+		return nil, err
+	}
+	// return a new mongo store and no error
+	return store, nil
+}
+
+//migrations are the migrations for the users collection,
+//new migrations must only ever be added to the end
+func (ms *MongoStore) migrations() []mongomigrate.Migration {
+	return []mongomigrate.Migration{
+		{
+			Description: "unique index on emails",
+			Up:          mongomigrate.CreateIndex(ms.CollectionName, mgo.Index{Key: []string{"email"}, Unique: true}),
+		},
+		{
+			Description: "unique index on user names",
+			Up:          mongomigrate.CreateIndex(ms.CollectionName, mgo.Index{Key: []string{"username"}, Unique: true}),
+		},
+		{
+			Description: "rename passHash to passhash like the other fields",
+			Up:          mongomigrate.RenameField(ms.CollectionName, "passHash", "passhash"),
+		},
+	}
 }
 
 //GetAll returns all users
@@ -54,8 +80,12 @@ func (ms *MongoStore) GetAll() ([]*User, error) {
 
 //GetByID returns the User with the given ID
 func (ms *MongoStore) GetByID(id interface{}) (*User, error) {
-	// check if the ID needs to be converted to bson
+	// check if the ID needs to be converted to bson,
+	// a string that isn't an object ID can't match a user
 	if sID, ok := id.(string); ok {
+		if !bson.IsObjectIdHex(sID) {
+			return nil, ErrUserNotFound
+		}
 		id = bson.ObjectIdHex(sID)
 	}
 	// create empty user struct
@@ -73,6 +103,28 @@ func (ms *MongoStore) GetByID(id interface{}) (*User, error) {
 	return user, nil
 }
 
+//GetByIDs returns the Users with the given IDs,
+//IDs that don't match a user are skipped
+func (ms *MongoStore) GetByIDs(ids []interface{}) ([]*User, error) {
+	// convert any hex string IDs to bson, skipping ones that can't be an ID
+	bIDs := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		if sID, ok := id.(string); ok {
+			if !bson.IsObjectIdHex(sID) {
+				continue
+			}
+			id = bson.ObjectIdHex(sID)
+		}
+		bIDs = append(bIDs, id)
+	}
+	users := []*User{}
+	err := ms.Session.DB(ms.DatabaseName).C(ms.CollectionName).Find(bson.M{"_id": bson.M{"$in": bIDs}}).All(&users)
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 //GetByEmail returns the User with the given email
 func (ms *MongoStore) GetByEmail(email string) (*User, error) {
 	// create empty user struct
@@ -118,6 +170,9 @@ func (ms *MongoStore) Insert(newUser *NewUser) (*User, error) {
 	// write to the database/collection
 	err = ms.Session.DB(ms.DatabaseName).C(ms.CollectionName).Insert(user)
 	if err != nil {
+		if mgo.IsDup(err) {
+			return nil, ErrDuplicateKey
+		}
 		return nil, err
 	}
 	return user, nil
@@ -130,7 +185,16 @@ func (ms *MongoStore) Update(updates *UserUpdates, currentuser *User) error {
 	}
 	col := ms.Session.DB(ms.DatabaseName).C(ms.CollectionName)
 	bUpdates := bson.M{"$set": updates}
-	return col.UpdateId(currentuser.ID, bUpdates)
+	err := col.UpdateId(currentuser.ID, bUpdates)
+	if err == mgo.ErrNotFound {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	currentuser.FirstName = updates.FirstName
+	currentuser.LastName = updates.LastName
+	return nil
 }
 
 // ResetPassword set's the password of the user with the specified email returns error if not successful
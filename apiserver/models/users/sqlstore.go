@@ -0,0 +1,179 @@
+package users
+
+import (
+	"database/sql"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/sqldb"
+)
+
+// sqlMigrations are the schema migrations for the users tables,
+// new migrations must only ever be added to the end
+var sqlMigrations = []string{
+	`CREATE TABLE users (
+		id TEXT PRIMARY KEY,
+		email TEXT NOT NULL,
+		passhash TEXT NOT NULL,
+		username TEXT NOT NULL,
+		firstname TEXT NOT NULL,
+		lastname TEXT NOT NULL,
+		photourl TEXT NOT NULL
+	);
+	CREATE UNIQUE INDEX users_email ON users (email);
+	CREATE UNIQUE INDEX users_username ON users (username);`,
+}
+
+// userColumns are the columns scanned by scanUser, in order
+const userColumns = `id, email, passhash, username, firstname, lastname, photourl`
+
+//SQLStore is an implementation of Store backed by a
+//PostgreSQL or SQLite database
+type SQLStore struct {
+	DB *sqldb.DB
+}
+
+//NewSQLStore returns a new SQLStore, migrating the
+//database's schema if needed
+func NewSQLStore(db *sqldb.DB) (*SQLStore, error) {
+	if err := db.Migrate("users", sqlMigrations); err != nil {
+		return nil, err
+	}
+	return &SQLStore{DB: db}, nil
+}
+
+//scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+//scanUser scans the userColumns of a row into a User
+func scanUser(row scanner) (*User, error) {
+	user := &User{}
+	var id, passHash string
+	err := row.Scan(&id, &user.Email, &passHash, &user.UserName, &user.FirstName, &user.LastName, &user.PhotoURL)
+	if err != nil {
+		return nil, err
+	}
+	user.ID = id
+	user.PassHash = []byte(passHash)
+	return user, nil
+}
+
+//getOne returns the single user matching the where clause
+func (ss *SQLStore) getOne(where string, arg interface{}) (*User, error) {
+	user, err := scanUser(ss.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE `+where, arg))
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	return user, err
+}
+
+//getMany returns all the users from the query
+func (ss *SQLStore) getMany(query string, args ...interface{}) ([]*User, error) {
+	rows, err := ss.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []*User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+//idString returns the string form of a user ID,
+//IDs can come back from JSON as strings or be set by other stores
+func idString(id interface{}) string {
+	if s, ok := id.(string); ok {
+		return s
+	}
+	if s, ok := id.(interface{ Hex() string }); ok {
+		return s.Hex()
+	}
+	return ""
+}
+
+//GetAll returns all users
+func (ss *SQLStore) GetAll() ([]*User, error) {
+	return ss.getMany(`SELECT ` + userColumns + ` FROM users ORDER BY username`)
+}
+
+//GetByID returns the User with the given ID
+func (ss *SQLStore) GetByID(id interface{}) (*User, error) {
+	return ss.getOne(`id = $1`, idString(id))
+}
+
+//GetByIDs returns the Users with the given IDs,
+//IDs that don't match a user are skipped
+func (ss *SQLStore) GetByIDs(ids []interface{}) ([]*User, error) {
+	if len(ids) == 0 {
+		return []*User{}, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = idString(id)
+	}
+	return ss.getMany(`SELECT `+userColumns+` FROM users WHERE id IN (`+sqldb.Params(1, len(ids))+`)`, args...)
+}
+
+//GetByEmail returns the User with the given email
+func (ss *SQLStore) GetByEmail(email string) (*User, error) {
+	return ss.getOne(`email = $1`, email)
+}
+
+//GetByUserName returns the User with the given user name
+func (ss *SQLStore) GetByUserName(name string) (*User, error) {
+	return ss.getOne(`username = $1`, name)
+}
+
+//Insert inserts a new NewUser into the store
+//and returns a User with a newly-assigned ID
+func (ss *SQLStore) Insert(newUser *NewUser) (*User, error) {
+	user, err := newUser.ToUser()
+	if err != nil {
+		return nil, err
+	}
+	id := sqldb.NewID()
+	_, err = ss.DB.Exec(`INSERT INTO users (`+userColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		id, user.Email, string(user.PassHash), user.UserName, user.FirstName, user.LastName, user.PhotoURL)
+	if err != nil {
+		if sqldb.IsUniqueViolation(err) {
+			return nil, ErrDuplicateKey
+		}
+		return nil, err
+	}
+	user.ID = id
+	return user, nil
+}
+
+//Update applies UserUpdates to the currentUser
+func (ss *SQLStore) Update(updates *UserUpdates, currentuser *User) error {
+	res, err := ss.DB.Exec(`UPDATE users SET firstname = $1, lastname = $2 WHERE id = $3`,
+		updates.FirstName, updates.LastName, idString(currentuser.ID))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	currentuser.FirstName = updates.FirstName
+	currentuser.LastName = updates.LastName
+	return nil
+}
+
+// ResetPassword set's the password of the user with the specified email returns error if not successful
+func (ss *SQLStore) ResetPassword(email, newPassword string) error {
+	user, err := ss.GetByEmail(email)
+	if err != nil {
+		return err
+	}
+	if err := user.SetPassword(newPassword); err != nil {
+		return err
+	}
+	_, err = ss.DB.Exec(`UPDATE users SET passhash = $1 WHERE id = $2`, string(user.PassHash), idString(user.ID))
+	return err
+}
@@ -0,0 +1,79 @@
+package users
+
+import (
+	"testing"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/sqldb"
+)
+
+func TestSQLStore(t *testing.T) {
+	db, err := sqldb.Open(sqldb.SQLite, ":memory:")
+	if err != nil {
+		t.Fatalf("error opening database: %v", err)
+	}
+	defer db.Close()
+	store, err := NewSQLStore(db)
+	if err != nil {
+		t.Fatalf("error creating store: %v", err)
+	}
+
+	nu := &NewUser{
+		Email:        "test@test.com",
+		UserName:     "tester",
+		FirstName:    "Test",
+		LastName:     "Tester",
+		Password:     "password",
+		PasswordConf: "password",
+	}
+	u, err := store.Insert(nu)
+	if err != nil {
+		t.Fatalf("error inserting user: %v", err)
+	}
+	if len(u.ID.(string)) != 24 {
+		t.Errorf("new ID isn't 24 characters: %v", u.ID)
+	}
+
+	// the same email can't be used twice
+	if _, err := store.Insert(nu); err == nil {
+		t.Errorf("expected error inserting a duplicate user")
+	}
+
+	for name, get := range map[string]func() (*User, error){
+		"ID":       func() (*User, error) { return store.GetByID(u.ID) },
+		"email":    func() (*User, error) { return store.GetByEmail(nu.Email) },
+		"username": func() (*User, error) { return store.GetByUserName(nu.UserName) },
+	} {
+		u2, err := get()
+		if err != nil {
+			t.Errorf("error getting user by %s: %v", name, err)
+			continue
+		}
+		if u2.ID != u.ID {
+			t.Errorf("ID of user fetched by %s didn't match: expected %v but got %v", name, u.ID, u2.ID)
+		}
+	}
+	if _, err := store.GetByID("missing"); err != ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound but got %v", err)
+	}
+
+	found, err := store.GetByIDs([]interface{}{u.ID, "missing"})
+	if err != nil || len(found) != 1 {
+		t.Errorf("incorrect users fetched by IDs: %v, %v", found, err)
+	}
+
+	if err := store.Update(&UserUpdates{FirstName: "New", LastName: "Name"}, u); err != nil {
+		t.Fatalf("error updating user: %v", err)
+	}
+	u2, _ := store.GetByID(u.ID)
+	if u2.FirstName != "New" || u2.LastName != "Name" {
+		t.Errorf("user not updated: got %s %s", u2.FirstName, u2.LastName)
+	}
+
+	if err := store.ResetPassword(nu.Email, "newpassword"); err != nil {
+		t.Fatalf("error resetting password: %v", err)
+	}
+	u2, _ = store.GetByID(u.ID)
+	if err := u2.Authenticate("newpassword"); err != nil {
+		t.Errorf("new password doesn't authenticate: %v", err)
+	}
+}
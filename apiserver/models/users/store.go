@@ -5,6 +5,10 @@ import "errors"
 //ErrUserNotFound is returned when the requested user is not found in the store
 var ErrUserNotFound = errors.New("user not found")
 
+//ErrDuplicateKey is returned when inserting a user whose
+//email or user name is already taken
+var ErrDuplicateKey = errors.New("email or user name already taken")
+
 //Store represents an abstract store for model.User objects.
 //This interface is used by the HTTP handlers to insert new users,
 //get users, and update users. This interface can be implemented
@@ -16,6 +20,10 @@ type Store interface {
 	//GetByID returns the User with the given ID
 	GetByID(id interface{}) (*User, error)
 
+	//GetByIDs returns the Users with the given IDs,
+	//IDs that don't match a user are skipped
+	GetByIDs(ids []interface{}) ([]*User, error)
+
 	//GetByEmail returns the User with the given email
 	GetByEmail(email string) (*User, error)
 
@@ -23,12 +31,15 @@ type Store interface {
 	GetByUserName(name string) (*User, error)
 
 	//Insert inserts a new NewUser into the store
-	//and returns a User with a newly-assigned ID
+	//and returns a User with a newly-assigned ID,
+	//or ErrDuplicateKey if the email or user name is taken
 	Insert(newUser *NewUser) (*User, error)
 
-	//Update applies UserUpdates to the currentUser
+	//Update applies UserUpdates to the currentUser, both in the store
+	//and the given User, or returns ErrUserNotFound if they aren't in the store
 	Update(updates *UserUpdates, currentuser *User) error
 
-	// ResetPassword applies password resets to the user with the given email
+	// ResetPassword applies password resets to the user with the given email,
+	// or returns ErrUserNotFound if there is no such user
 	ResetPassword(email, newPassword string) error
 }
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net/mail"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -20,11 +21,14 @@ type UserID interface{}
 type User struct {
 	ID        UserID `json:"id" bson:"_id"`
 	Email     string `json:"email"`
-	PassHash  []byte `json:"-" bson:"passHash"` //stored in mongo, but never encoded to clients
+	PassHash  []byte `json:"-" bson:"passhash"` //stored in mongo, but never encoded to clients
 	UserName  string `json:"userName"`
 	FirstName string `json:"firstName"`
 	LastName  string `json:"lastName"`
 	PhotoURL  string `json:"photoURL"`
+	//LastSeenAt is when the user was last active, it comes from
+	//the presence store rather than being stored with the user
+	LastSeenAt *time.Time `json:"lastSeenAt,omitempty" bson:"-"`
 }
 
 //Credentials represents user sign-in credentials
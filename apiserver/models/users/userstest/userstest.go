@@ -0,0 +1,303 @@
+//Package userstest is a conformance test suite for users.Store
+//implementations, so every backend is held to the same contract.
+package userstest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/models/users"
+)
+
+//NewStoreFunc returns a new, empty store for a test. It should
+//use t.Cleanup to release anything the store holds on to.
+type NewStoreFunc func(t *testing.T) users.Store
+
+//TestStore runs the conformance suite against the stores returned
+//by newStore, each test gets its own store
+func TestStore(t *testing.T, newStore NewStoreFunc) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store users.Store)
+	}{
+		{"InsertAndGet", testInsertAndGet},
+		{"NotFound", testNotFound},
+		{"Duplicates", testDuplicates},
+		{"GetByIDs", testGetByIDs},
+		{"Update", testUpdate},
+		{"ResetPassword", testResetPassword},
+		{"ConcurrentInserts", testConcurrentInserts},
+		{"ConcurrentDuplicates", testConcurrentDuplicates},
+	}
+	for _, tt := range tests {
+		test := tt.test
+		t.Run(tt.name, func(t *testing.T) {
+			test(t, newStore(t))
+		})
+	}
+}
+
+//newUser returns a valid NewUser with the given name
+func newUser(name string) *users.NewUser {
+	return &users.NewUser{
+		Email:        name + "@test.com",
+		UserName:     name,
+		FirstName:    "First " + name,
+		LastName:     "Last " + name,
+		Password:     "password",
+		PasswordConf: "password",
+	}
+}
+
+//insert inserts a user with the given name and fails the test on error
+func insert(t *testing.T, store users.Store, name string) *users.User {
+	t.Helper()
+	u, err := store.Insert(newUser(name))
+	if err != nil {
+		t.Fatalf("error inserting user %s: %v", name, err)
+	}
+	return u
+}
+
+//missingID returns an ID that is valid for every backend
+//but doesn't belong to any user
+func missingID() string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func testInsertAndGet(t *testing.T, store users.Store) {
+	nu := newUser("tester")
+	u, err := store.Insert(nu)
+	if err != nil {
+		t.Fatalf("error inserting user: %v", err)
+	}
+	if u.ID == nil || len(fmt.Sprint(u.ID)) == 0 {
+		t.Fatalf("new user has no ID")
+	}
+	if u.Email != nu.Email || u.UserName != nu.UserName || u.FirstName != nu.FirstName || u.LastName != nu.LastName {
+		t.Errorf("inserted user doesn't match the new user: %+v", u)
+	}
+
+	for name, get := range map[string]func() (*users.User, error){
+		"ID":       func() (*users.User, error) { return store.GetByID(u.ID) },
+		"email":    func() (*users.User, error) { return store.GetByEmail(nu.Email) },
+		"username": func() (*users.User, error) { return store.GetByUserName(nu.UserName) },
+	} {
+		u2, err := get()
+		if err != nil {
+			t.Errorf("error getting user by %s: %v", name, err)
+			continue
+		}
+		if u2.ID != u.ID {
+			t.Errorf("ID of user fetched by %s didn't match: expected %v but got %v", name, u.ID, u2.ID)
+		}
+		if !bytes.Equal(u2.PassHash, u.PassHash) {
+			t.Errorf("password hash of user fetched by %s didn't match", name)
+		}
+	}
+	if err := u.Authenticate(nu.Password); err != nil {
+		t.Errorf("password doesn't authenticate: %v", err)
+	}
+
+	all, err := store.GetAll()
+	if err != nil {
+		t.Fatalf("error getting all users: %v", err)
+	}
+	if len(all) != 1 || all[0].ID != u.ID {
+		t.Errorf("expected GetAll to return only %v but got %v", u.ID, all)
+	}
+}
+
+func testNotFound(t *testing.T, store users.Store) {
+	insert(t, store, "tester")
+
+	if _, err := store.GetByID(missingID()); err != users.ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound getting a missing ID but got %v", err)
+	}
+	if _, err := store.GetByID("missing"); err != users.ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound getting a malformed ID but got %v", err)
+	}
+	if _, err := store.GetByEmail("missing@test.com"); err != users.ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound getting a missing email but got %v", err)
+	}
+	if _, err := store.GetByUserName("missing"); err != users.ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound getting a missing user name but got %v", err)
+	}
+	updates := &users.UserUpdates{FirstName: "New", LastName: "Name"}
+	if err := store.Update(updates, &users.User{ID: missingID()}); err != users.ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound updating a missing user but got %v", err)
+	}
+	if err := store.ResetPassword("missing@test.com", "newpassword"); err != users.ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound resetting a missing user's password but got %v", err)
+	}
+}
+
+func testDuplicates(t *testing.T, store users.Store) {
+	insert(t, store, "tester")
+
+	sameEmail := newUser("other")
+	sameEmail.Email = "tester@test.com"
+	if _, err := store.Insert(sameEmail); err != users.ErrDuplicateKey {
+		t.Errorf("expected ErrDuplicateKey inserting a taken email but got %v", err)
+	}
+	sameName := newUser("other")
+	sameName.UserName = "tester"
+	if _, err := store.Insert(sameName); err != users.ErrDuplicateKey {
+		t.Errorf("expected ErrDuplicateKey inserting a taken user name but got %v", err)
+	}
+
+	all, err := store.GetAll()
+	if err != nil {
+		t.Fatalf("error getting all users: %v", err)
+	}
+	if len(all) != 1 {
+		t.Errorf("expected the duplicates not to be inserted but there are %d users", len(all))
+	}
+}
+
+func testGetByIDs(t *testing.T, store users.Store) {
+	u1 := insert(t, store, "one")
+	u2 := insert(t, store, "two")
+	insert(t, store, "three")
+
+	found, err := store.GetByIDs([]interface{}{u1.ID, missingID(), "missing", u2.ID})
+	if err != nil {
+		t.Fatalf("error getting users by IDs: %v", err)
+	}
+	if len(found) != 2 {
+		t.Fatalf("expected 2 users but got %d", len(found))
+	}
+	for _, u := range found {
+		if u.ID != u1.ID && u.ID != u2.ID {
+			t.Errorf("got a user that wasn't asked for: %v", u.ID)
+		}
+	}
+
+	found, err = store.GetByIDs([]interface{}{})
+	if err != nil || len(found) != 0 {
+		t.Errorf("expected no users for no IDs but got %v, %v", found, err)
+	}
+}
+
+func testUpdate(t *testing.T, store users.Store) {
+	u := insert(t, store, "tester")
+	other := insert(t, store, "other")
+
+	if err := store.Update(&users.UserUpdates{FirstName: "New", LastName: "Name"}, u); err != nil {
+		t.Fatalf("error updating user: %v", err)
+	}
+	if u.FirstName != "New" || u.LastName != "Name" {
+		t.Errorf("given user not updated: got %s %s", u.FirstName, u.LastName)
+	}
+	u2, err := store.GetByID(u.ID)
+	if err != nil {
+		t.Fatalf("error getting updated user: %v", err)
+	}
+	if u2.FirstName != "New" || u2.LastName != "Name" {
+		t.Errorf("user not updated: got %s %s", u2.FirstName, u2.LastName)
+	}
+	if u2.Email != u.Email || u2.UserName != u.UserName {
+		t.Errorf("update changed other fields: %+v", u2)
+	}
+	if !bytes.Equal(u2.PassHash, u.PassHash) {
+		t.Errorf("update changed the password")
+	}
+
+	// only that user is changed
+	o2, err := store.GetByID(other.ID)
+	if err != nil {
+		t.Fatalf("error getting other user: %v", err)
+	}
+	if o2.FirstName != other.FirstName || o2.LastName != other.LastName {
+		t.Errorf("update changed another user: got %s %s", o2.FirstName, o2.LastName)
+	}
+}
+
+func testResetPassword(t *testing.T, store users.Store) {
+	u := insert(t, store, "tester")
+
+	if err := store.ResetPassword(u.Email, "newpassword"); err != nil {
+		t.Fatalf("error resetting password: %v", err)
+	}
+	u2, err := store.GetByID(u.ID)
+	if err != nil {
+		t.Fatalf("error getting user: %v", err)
+	}
+	if err := u2.Authenticate("newpassword"); err != nil {
+		t.Errorf("new password doesn't authenticate: %v", err)
+	}
+	if err := u2.Authenticate("password"); err == nil {
+		t.Errorf("old password still authenticates")
+	}
+	if u2.FirstName != u.FirstName || u2.UserName != u.UserName {
+		t.Errorf("password reset changed other fields: %+v", u2)
+	}
+}
+
+func testConcurrentInserts(t *testing.T, store users.Store) {
+	// hashing passwords is slow on purpose, so keep this small
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			u, err := store.Insert(newUser(fmt.Sprintf("user%d", i)))
+			if err != nil {
+				errs <- err
+				return
+			}
+			// readers shouldn't trip over writers
+			if _, err := store.GetByID(u.ID); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("error inserting users concurrently: %v", err)
+	}
+
+	all, err := store.GetAll()
+	if err != nil {
+		t.Fatalf("error getting all users: %v", err)
+	}
+	if len(all) != n {
+		t.Errorf("expected %d users but got %d", n, len(all))
+	}
+}
+
+func testConcurrentDuplicates(t *testing.T, store users.Store) {
+	const n = 4
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	inserted := 0
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.Insert(newUser("tester"))
+			mu.Lock()
+			defer mu.Unlock()
+			switch err {
+			case nil:
+				inserted++
+			case users.ErrDuplicateKey:
+			default:
+				t.Errorf("expected ErrDuplicateKey but got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if inserted != 1 {
+		t.Errorf("expected exactly one of the duplicate users to be inserted but %d were", inserted)
+	}
+}
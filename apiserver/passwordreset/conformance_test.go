@@ -0,0 +1,35 @@
+package passwordreset_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"gopkg.in/redis.v5"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/passwordreset"
+	"github.com/aethanol/challenges-aethanol/apiserver/passwordreset/passwordresettest"
+)
+
+func TestMemStoreConformance(t *testing.T) {
+	passwordresettest.TestStore(t, func(t *testing.T, resetDuration time.Duration) passwordreset.Store {
+		return passwordreset.NewMemStore(resetDuration)
+	})
+}
+
+//NOTE: this test uses the REDISADDR environment variable for the
+//redis server address, if not defined it uses a local instance of redis
+func TestRedisResetStoreConformance(t *testing.T) {
+	redisAddr := os.Getenv("REDISADDR")
+	if len(redisAddr) == 0 {
+		redisAddr = "127.0.0.1:6379"
+	}
+	passwordresettest.TestStore(t, func(t *testing.T, resetDuration time.Duration) passwordreset.Store {
+		client := redis.NewClient(&redis.Options{
+			Addr: redisAddr,
+		})
+		t.Cleanup(func() { client.Close() })
+		//the emails are random, so the tests don't need an empty database
+		return passwordreset.NewRedisResetStore(client, resetDuration)
+	})
+}
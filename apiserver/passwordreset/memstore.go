@@ -0,0 +1,53 @@
+package passwordreset
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+//MemStore represents an in-memory reset store.
+//This should be used only for testing and prototyping.
+//Production systems should use a shared server store like redis
+type MemStore struct {
+	entries *cache.Cache
+}
+
+//NewMemStore constructs and returns a new MemStore
+func NewMemStore(resetDuration time.Duration) *MemStore {
+	if resetDuration < 0 {
+		resetDuration = DefaultResetDuration
+	}
+	return &MemStore{
+		entries: cache.New(resetDuration, time.Minute),
+	}
+}
+
+//Store interface implementation
+
+//Save associates the provided state data with the provided email in the store.
+func (ms *MemStore) Save(email ResetEmail, state interface{}) error {
+	j, err := json.Marshal(state)
+	if nil != err {
+		return err
+	}
+	ms.entries.Set(email.String(), j, cache.DefaultExpiration)
+	return nil
+}
+
+//Get retrieves the previously saved state data for the email,
+//and populates the `state` parameter with it.
+func (ms *MemStore) Get(email ResetEmail, state interface{}) error {
+	j, found := ms.entries.Get(email.String())
+	if !found {
+		return ErrEmailNotFound
+	}
+	return json.Unmarshal(j.([]byte), state)
+}
+
+//Delete deletes all state data associated with the email from the store.
+func (ms *MemStore) Delete(email ResetEmail) error {
+	ms.entries.Delete(email.String())
+	return nil
+}
@@ -0,0 +1,199 @@
+//Package passwordresettest is a conformance test suite for passwordreset.Store
+//implementations, so every backend is held to the same contract.
+package passwordresettest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/passwordreset"
+)
+
+//signingKey is used to sign the reset tokens in the suite
+const signingKey = "conformance signing key"
+
+//NewStoreFunc returns a new store for a test that keeps reset
+//codes for the given duration. It should use t.Cleanup to release
+//anything the store holds on to.
+type NewStoreFunc func(t *testing.T, resetDuration time.Duration) passwordreset.Store
+
+//TestStore runs the conformance suite against the stores returned
+//by newStore, each test gets its own store
+func TestStore(t *testing.T, newStore NewStoreFunc) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, newStore NewStoreFunc)
+	}{
+		{"SaveAndGet", testSaveAndGet},
+		{"NotFound", testNotFound},
+		{"Delete", testDelete},
+		{"Expiry", testExpiry},
+		{"GetDoesNotResetExpiry", testGetDoesNotResetExpiry},
+		{"Concurrency", testConcurrency},
+	}
+	for _, tt := range tests {
+		test := tt.test
+		t.Run(tt.name, func(t *testing.T) {
+			test(t, newStore)
+		})
+	}
+}
+
+//newEmail returns a random email, so tests against
+//a shared server don't see each other's codes
+func newEmail() passwordreset.ResetEmail {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return passwordreset.ResetEmail(hex.EncodeToString(buf) + "@test.com")
+}
+
+//newToken returns a new reset token and fails the test on error
+func newToken(t *testing.T) passwordreset.ResetToken {
+	t.Helper()
+	token, err := passwordreset.NewResetToken(signingKey)
+	if err != nil {
+		t.Fatalf("error creating reset token: %v", err)
+	}
+	return token
+}
+
+func testSaveAndGet(t *testing.T, newStore NewStoreFunc) {
+	store := newStore(t, time.Hour)
+	email := newEmail()
+	token := newToken(t)
+	if err := store.Save(email, token); err != nil {
+		t.Fatalf("error saving token: %v", err)
+	}
+	if err := store.Save(newEmail(), newToken(t)); err != nil {
+		t.Fatalf("error saving token: %v", err)
+	}
+	var got passwordreset.ResetToken
+	if err := store.Get(email, &got); err != nil {
+		t.Fatalf("error getting token: %v", err)
+	}
+	if got != token {
+		t.Errorf("retrieved token did not match saved token: expected %s but got %s", token, got)
+	}
+
+	// asking for a new code replaces the old one
+	token = newToken(t)
+	if err := store.Save(email, token); err != nil {
+		t.Fatalf("error saving token: %v", err)
+	}
+	if err := store.Get(email, &got); err != nil {
+		t.Fatalf("error getting token: %v", err)
+	}
+	if got != token {
+		t.Errorf("retrieved token did not match replaced token: expected %s but got %s", token, got)
+	}
+}
+
+func testNotFound(t *testing.T, newStore NewStoreFunc) {
+	store := newStore(t, time.Hour)
+	var got passwordreset.ResetToken
+	if err := store.Get(newEmail(), &got); err != passwordreset.ErrEmailNotFound {
+		t.Errorf("expected ErrEmailNotFound for a missing email but got %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("token was filled in for a missing email: %s", got)
+	}
+	// deleting a missing email isn't an error
+	if err := store.Delete(newEmail()); err != nil {
+		t.Errorf("error deleting a missing email: %v", err)
+	}
+}
+
+func testDelete(t *testing.T, newStore NewStoreFunc) {
+	store := newStore(t, time.Hour)
+	email := newEmail()
+	other := newEmail()
+	for _, e := range []passwordreset.ResetEmail{email, other} {
+		if err := store.Save(e, newToken(t)); err != nil {
+			t.Fatalf("error saving token: %v", err)
+		}
+	}
+
+	if err := store.Delete(email); err != nil {
+		t.Fatalf("error deleting token: %v", err)
+	}
+	var got passwordreset.ResetToken
+	if err := store.Get(email, &got); err != passwordreset.ErrEmailNotFound {
+		t.Errorf("expected ErrEmailNotFound for a deleted token but got %v", err)
+	}
+	// only that email's token is deleted
+	if err := store.Get(other, &got); err != nil {
+		t.Errorf("error getting another email's token: %v", err)
+	}
+}
+
+func testExpiry(t *testing.T, newStore NewStoreFunc) {
+	store := newStore(t, 200*time.Millisecond)
+	email := newEmail()
+	if err := store.Save(email, newToken(t)); err != nil {
+		t.Fatalf("error saving token: %v", err)
+	}
+	time.Sleep(400 * time.Millisecond)
+	var got passwordreset.ResetToken
+	if err := store.Get(email, &got); err != passwordreset.ErrEmailNotFound {
+		t.Errorf("expected ErrEmailNotFound for an expired token but got %v", err)
+	}
+}
+
+func testGetDoesNotResetExpiry(t *testing.T, newStore NewStoreFunc) {
+	store := newStore(t, 400*time.Millisecond)
+	email := newEmail()
+	if err := store.Save(email, newToken(t)); err != nil {
+		t.Fatalf("error saving token: %v", err)
+	}
+	var got passwordreset.ResetToken
+	time.Sleep(200 * time.Millisecond)
+	if err := store.Get(email, &got); err != nil {
+		t.Fatalf("error getting token before it expired: %v", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if err := store.Get(email, &got); err != passwordreset.ErrEmailNotFound {
+		t.Errorf("expected the token to expire on time but got %v", err)
+	}
+}
+
+func testConcurrency(t *testing.T, newStore NewStoreFunc) {
+	store := newStore(t, time.Hour)
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			email := newEmail()
+			token, err := passwordreset.NewResetToken(signingKey)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err := store.Save(email, token); err != nil {
+				errs <- err
+				return
+			}
+			var got passwordreset.ResetToken
+			if err := store.Get(email, &got); err != nil {
+				errs <- err
+				return
+			}
+			if got != token {
+				t.Errorf("expected token %s but got %s", token, got)
+			}
+			if err := store.Delete(email); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("error using reset codes concurrently: %v", err)
+	}
+}
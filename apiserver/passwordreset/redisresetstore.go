@@ -3,8 +3,6 @@ package passwordreset
 import (
 	"time"
 
-	"github.com/aethanol/challenges-aethanol/apiserver/sessions"
-
 	"encoding/json"
 
 	"gopkg.in/redis.v5"
@@ -84,7 +82,7 @@ func (rs *RedisResetStore) Get(email ResetEmail, state interface{}) error {
 	jbuf, err := rs.Client.Get(email.getRedisKey()).Bytes()
 	if err != nil {
 		if err == redis.Nil {
-			return sessions.ErrStateNotFound
+			return ErrEmailNotFound
 		}
 		return err
 	}
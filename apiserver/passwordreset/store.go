@@ -23,9 +23,10 @@ type Store interface {
 	//Save associates the provided `state`` data with the provided `sid` in the store.
 	Save(email ResetEmail, state interface{}) error
 
-	//Get retrieves the previously saved state data for the session id,
-	//and populates the `state` parameter with it. This will also
-	//reset the data's time to live in the store.
+	//Get retrieves the previously saved state data for the email,
+	//and populates the `state` parameter with it. Unlike sessions
+	//this doesn't reset the time to live, so reset codes always
+	//expire on time. It returns ErrEmailNotFound if there's no data.
 	Get(email ResetEmail, state interface{}) error
 
 	//Delete deletes all state data associated with the session id from the store.
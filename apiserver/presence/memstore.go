@@ -0,0 +1,89 @@
+package presence
+
+import (
+	"sync"
+	"time"
+)
+
+//MemStore represents an in-memory presence store.
+//This should be used only for testing and prototyping.
+//Production systems should use a shared server store like redis
+type MemStore struct {
+	connections map[string]map[string]time.Time
+	overrides   map[string]string
+	lastSeen    map[string]time.Time
+	mu          sync.RWMutex
+}
+
+//NewMemStore constructs and returns a new MemStore
+func NewMemStore() *MemStore {
+	return &MemStore{
+		connections: make(map[string]map[string]time.Time),
+		overrides:   make(map[string]string),
+		lastSeen:    make(map[string]time.Time),
+	}
+}
+
+//Store implementation
+
+//Connect adds or refreshes one of the user's connections,
+//it counts towards them being online until it expires
+func (ms *MemStore) Connect(userID string, connID string, expires time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.connections[userID] == nil {
+		ms.connections[userID] = make(map[string]time.Time)
+	}
+	ms.connections[userID][connID] = expires
+	return nil
+}
+
+//Disconnect removes one of the user's connections
+func (ms *MemStore) Disconnect(userID string, connID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.connections[userID], connID)
+	if len(ms.connections[userID]) == 0 {
+		delete(ms.connections, userID)
+	}
+	return nil
+}
+
+//Touch records that the user was active at the time
+func (ms *MemStore) Touch(userID string, at time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if at.After(ms.lastSeen[userID]) {
+		ms.lastSeen[userID] = at
+	}
+	return nil
+}
+
+//SetOverride sets the status the user chose, or clears it if it is empty
+func (ms *MemStore) SetOverride(userID string, status string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if len(status) == 0 {
+		delete(ms.overrides, userID)
+	} else {
+		ms.overrides[userID] = status
+	}
+	return nil
+}
+
+//Get returns the presence of each of the users at the time, in the same order
+func (ms *MemStore) Get(userIDs []string, now time.Time) ([]*Presence, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	presences := make([]*Presence, 0, len(userIDs))
+	for _, userID := range userIDs {
+		s := &state{override: ms.overrides[userID], lastSeen: ms.lastSeen[userID]}
+		for _, expires := range ms.connections[userID] {
+			if expires.After(now) {
+				s.connections++
+			}
+		}
+		presences = append(presences, s.presence(userID, now))
+	}
+	return presences, nil
+}
@@ -0,0 +1,90 @@
+package presence
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemStore(t *testing.T) {
+	store := NewMemStore()
+	now := time.Now()
+	status := func(userID string, at time.Time) string {
+		presences, err := store.Get([]string{userID}, at)
+		if err != nil {
+			t.Fatalf("error getting presence: %v", err)
+		}
+		return presences[0].Status
+	}
+
+	if s := status("user1", now); s != StatusOffline {
+		t.Errorf("expected a user who never connected to be offline but got %s", s)
+	}
+
+	store.Connect("user1", "conn1", now.Add(ConnectionTTL))
+	store.Touch("user1", now)
+	if s := status("user1", now); s != StatusOnline {
+		t.Errorf("expected a connected user to be online but got %s", s)
+	}
+	if s := status("user1", now.Add(ConnectionTTL+time.Second)); s != StatusOffline {
+		t.Errorf("expected a user whose connection expired to be offline but got %s", s)
+	}
+	// a connection that is still refreshed keeps an idle user away rather than offline
+	idle := now.Add(IdleTimeout + time.Second)
+	store.Connect("user1", "conn1", idle.Add(ConnectionTTL))
+	if s := status("user1", idle); s != StatusAway {
+		t.Errorf("expected an idle user to be away but got %s", s)
+	}
+
+	// the user's choice wins while they are connected
+	store.SetOverride("user1", StatusDND)
+	if s := status("user1", now); s != StatusDND {
+		t.Errorf("expected the user's chosen status but got %s", s)
+	}
+	store.SetOverride("user1", "")
+	if s := status("user1", now); s != StatusOnline {
+		t.Errorf("expected clearing the chosen status to make the user online but got %s", s)
+	}
+
+	// they are online until their last connection goes
+	store.Connect("user1", "conn2", now.Add(ConnectionTTL))
+	store.Disconnect("user1", "conn1")
+	if s := status("user1", now); s != StatusOnline {
+		t.Errorf("expected a user with a connection left to be online but got %s", s)
+	}
+	store.Disconnect("user1", "conn2")
+	presences, _ := store.Get([]string{"user1"}, now)
+	if presences[0].Status != StatusOffline || presences[0].LastSeenAt == nil || !presences[0].LastSeenAt.Equal(now) {
+		t.Errorf("expected a disconnected user to be offline and last seen at %v but got %+v", now, presences[0])
+	}
+}
+
+func TestTracker(t *testing.T) {
+	changes := []string{}
+	tracker := NewTracker(NewMemStore(), func(p *Presence) {
+		changes = append(changes, p.UserID+" "+p.Status)
+	})
+
+	tracker.Connected("user1", "conn1")
+	tracker.Connected("user1", "conn2")
+	tracker.Heartbeat("user1")
+	if err := tracker.SetOverride("user1", "busy"); err != ErrInvalidStatus {
+		t.Errorf("expected ErrInvalidStatus for a status users can't choose but got %v", err)
+	}
+	if err := tracker.SetOverride("user1", StatusAway); err != nil {
+		t.Fatalf("error setting status: %v", err)
+	}
+	tracker.Disconnected("user1", "conn1")
+	tracker.Disconnected("user1", "conn2")
+
+	// only the changes are reported
+	expected := []string{"user1 online", "user1 away", "user1 offline"}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected changes %v but got %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("expected changes %v but got %v", expected, changes)
+			break
+		}
+	}
+}
@@ -0,0 +1,75 @@
+//Package presence tracks whether users are online, away or offline.
+//A user is online while they have a websocket open, goes away when
+//their clients stop sending heartbeats, and can set themselves away
+//or do not disturb by hand. The state is kept in a Store shared by
+//all the servers, so it is the same whichever server a user is on.
+package presence
+
+import (
+	"errors"
+	"time"
+)
+
+//the statuses a user can have
+const (
+	StatusOnline  = "online"
+	StatusAway    = "away"
+	StatusDND     = "dnd"
+	StatusOffline = "offline"
+)
+
+//IdleTimeout is how long after the last heartbeat an online user is shown as away
+var IdleTimeout = 5 * time.Minute
+
+//ConnectionTTL is how long a connection counts towards a user being online
+//without being refreshed, so connections on a server that died time out
+var ConnectionTTL = 90 * time.Second
+
+//ErrInvalidStatus is returned when a user tries to set a status they can't choose
+var ErrInvalidStatus = errors.New("status must be away, dnd or empty")
+
+//Presence is a user's status, and when they were last active
+type Presence struct {
+	UserID     string     `json:"userID"`
+	Status     string     `json:"status"`
+	LastSeenAt *time.Time `json:"lastSeenAt,omitempty"`
+}
+
+//state is what a store keeps about a user
+type state struct {
+	//connections is how many of the user's connections haven't expired
+	connections int
+	//override is the status the user chose, if any
+	override string
+	//lastSeen is when the user was last active, zero if never
+	lastSeen time.Time
+}
+
+//presence works out the user's presence from their state
+func (s *state) presence(userID string, now time.Time) *Presence {
+	p := &Presence{UserID: userID, Status: StatusOffline}
+	if !s.lastSeen.IsZero() {
+		lastSeen := s.lastSeen
+		p.LastSeenAt = &lastSeen
+	}
+	switch {
+	case s.connections == 0:
+	case len(s.override) > 0:
+		p.Status = s.override
+	case now.Sub(s.lastSeen) > IdleTimeout:
+		p.Status = StatusAway
+	default:
+		p.Status = StatusOnline
+	}
+	return p
+}
+
+//ValidateOverride returns an error if the status isn't one a user can choose,
+//the empty status clears the user's choice
+func ValidateOverride(status string) error {
+	switch status {
+	case "", StatusAway, StatusDND:
+		return nil
+	}
+	return ErrInvalidStatus
+}
@@ -0,0 +1,128 @@
+package presence
+
+import (
+	"strconv"
+	"time"
+
+	"gopkg.in/redis.v5"
+)
+
+//the prefixes of the keys we keep presence in. They keep presence
+//keys separate from other keys in the shared redis key namespace.
+const (
+	//a sorted set of each user's connections, scored by when they expire
+	redisConnectionsPrefix = "presence:conns:"
+	//the status each user chose
+	redisOverridePrefix = "presence:override:"
+	//when each user was last active, in unix milliseconds
+	redisLastSeenPrefix = "presence:lastseen:"
+)
+const defaultAddr = "127.0.0.1:6379"
+
+//RedisStore represents a presence.Store backed by redis.
+type RedisStore struct {
+	//Redis client used to talk to redis server.
+	Client *redis.Client
+}
+
+//NewRedisStore constructs a new RedisStore, using the provided client.
+//If the `client` is nil, it will be set to redis.NewClient()
+//pointing at a local redis instance.
+func NewRedisStore(client *redis.Client) *RedisStore {
+	if client == nil {
+		client = redis.NewClient(&redis.Options{
+			Addr: defaultAddr,
+		})
+	}
+	return &RedisStore{
+		Client: client,
+	}
+}
+
+//unixMillis returns the time in unix milliseconds
+func unixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+//Store implementation
+
+//Connect adds or refreshes one of the user's connections,
+//it counts towards them being online until it expires
+func (rs *RedisStore) Connect(userID string, connID string, expires time.Time) error {
+	key := redisConnectionsPrefix + userID
+	// clear out connections from servers that died without removing them
+	max := strconv.FormatInt(unixMillis(time.Now()), 10)
+	if err := rs.Client.ZRemRangeByScore(key, "-inf", max).Err(); err != nil {
+		return err
+	}
+	if err := rs.Client.ZAdd(key, redis.Z{Score: float64(unixMillis(expires)), Member: connID}).Err(); err != nil {
+		return err
+	}
+	// drop the set with the last connection if nobody refreshes it
+	return rs.Client.ExpireAt(key, expires).Err()
+}
+
+//Disconnect removes one of the user's connections
+func (rs *RedisStore) Disconnect(userID string, connID string) error {
+	return rs.Client.ZRem(redisConnectionsPrefix+userID, connID).Err()
+}
+
+//Touch records that the user was active at the time
+func (rs *RedisStore) Touch(userID string, at time.Time) error {
+	return rs.Client.Set(redisLastSeenPrefix+userID, unixMillis(at), 0).Err()
+}
+
+//SetOverride sets the status the user chose, or clears it if it is empty
+func (rs *RedisStore) SetOverride(userID string, status string) error {
+	if len(status) == 0 {
+		return rs.Client.Del(redisOverridePrefix + userID).Err()
+	}
+	return rs.Client.Set(redisOverridePrefix+userID, status, 0).Err()
+}
+
+//Get returns the presence of each of the users at the time, in the same order.
+//It reads all of them in one round trip
+func (rs *RedisStore) Get(userIDs []string, now time.Time) ([]*Presence, error) {
+	if len(userIDs) == 0 {
+		return []*Presence{}, nil
+	}
+	// only count the connections that haven't expired
+	min := "(" + strconv.FormatInt(unixMillis(now), 10)
+	counts := make([]*redis.IntCmd, len(userIDs))
+	overrides := make([]*redis.StringCmd, len(userIDs))
+	lastSeens := make([]*redis.StringCmd, len(userIDs))
+	pipe := rs.Client.Pipeline()
+	for i, userID := range userIDs {
+		counts[i] = pipe.ZCount(redisConnectionsPrefix+userID, min, "+inf")
+		overrides[i] = pipe.Get(redisOverridePrefix + userID)
+		lastSeens[i] = pipe.Get(redisLastSeenPrefix + userID)
+	}
+	// missing keys come back as redis.Nil, which just means no override or last seen
+	if _, err := pipe.Exec(); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	presences := make([]*Presence, 0, len(userIDs))
+	for i, userID := range userIDs {
+		s := &state{}
+		n, err := counts[i].Result()
+		if err != nil {
+			return nil, err
+		}
+		s.connections = int(n)
+
+		s.override, err = overrides[i].Result()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		lastSeen, err := lastSeens[i].Int64()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		if lastSeen > 0 {
+			s.lastSeen = time.Unix(0, lastSeen*int64(time.Millisecond))
+		}
+		presences = append(presences, s.presence(userID, now))
+	}
+	return presences, nil
+}
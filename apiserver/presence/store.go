@@ -0,0 +1,22 @@
+package presence
+
+import "time"
+
+//Store represents a store of presence state, shared by all the servers
+type Store interface {
+	//Connect adds or refreshes one of the user's connections,
+	//it counts towards them being online until it expires
+	Connect(userID string, connID string, expires time.Time) error
+
+	//Disconnect removes one of the user's connections
+	Disconnect(userID string, connID string) error
+
+	//Touch records that the user was active at the time
+	Touch(userID string, at time.Time) error
+
+	//SetOverride sets the status the user chose, or clears it if it is empty
+	SetOverride(userID string, status string) error
+
+	//Get returns the presence of each of the users at the time, in the same order
+	Get(userIDs []string, now time.Time) ([]*Presence, error)
+}
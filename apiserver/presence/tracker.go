@@ -0,0 +1,137 @@
+package presence
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+//refreshInterval is how often the tracker refreshes its connections
+//and checks whether its users have gone idle
+var refreshInterval = 30 * time.Second
+
+//Tracker keeps the store up to date with the connections on this
+//server, and reports when the presence of their users changes
+type Tracker struct {
+	store Store
+	//onChange is called with a user's presence when it changes
+	onChange func(p *Presence)
+	//connections maps the ID of each connection on this server to its user
+	connections map[string]string
+	//published is the last status reported for each user on this server
+	published map[string]string
+	mu        sync.Mutex
+}
+
+//NewTracker constructs a new Tracker that reports changes to onChange
+func NewTracker(store Store, onChange func(p *Presence)) *Tracker {
+	return &Tracker{
+		store:       store,
+		onChange:    onChange,
+		connections: make(map[string]string),
+		published:   make(map[string]string),
+	}
+}
+
+//Start begins a loop that refreshes the connections on this server so
+//they don't expire, and reports users who have gone idle.
+//This function should be called on a new goroutine
+func (t *Tracker) Start() {
+	for range time.Tick(refreshInterval) {
+		t.refresh()
+	}
+}
+
+//Connected records a new connection for the user, which also counts as activity
+func (t *Tracker) Connected(userID string, connID string) {
+	t.mu.Lock()
+	t.connections[connID] = userID
+	t.mu.Unlock()
+	now := time.Now()
+	if err := t.store.Connect(userID, connID, now.Add(ConnectionTTL)); err != nil {
+		log.Printf("error recording connection: %v", err)
+	}
+	t.Heartbeat(userID)
+}
+
+//Disconnected removes one of the user's connections
+func (t *Tracker) Disconnected(userID string, connID string) {
+	t.mu.Lock()
+	delete(t.connections, connID)
+	t.mu.Unlock()
+	if err := t.store.Disconnect(userID, connID); err != nil {
+		log.Printf("error removing connection: %v", err)
+	}
+	t.check(userID)
+}
+
+//Heartbeat records that the user is active
+func (t *Tracker) Heartbeat(userID string) {
+	if err := t.store.Touch(userID, time.Now()); err != nil {
+		log.Printf("error recording heartbeat: %v", err)
+	}
+	t.check(userID)
+}
+
+//SetOverride sets the status the user chose, or clears it if it is empty
+func (t *Tracker) SetOverride(userID string, status string) error {
+	if err := ValidateOverride(status); err != nil {
+		return err
+	}
+	if err := t.store.SetOverride(userID, status); err != nil {
+		return err
+	}
+	t.check(userID)
+	return nil
+}
+
+//Get returns the presence of each of the users, in the same order
+func (t *Tracker) Get(userIDs ...string) ([]*Presence, error) {
+	return t.store.Get(userIDs, time.Now())
+}
+
+//check reports the user's presence if it has changed since it was last reported
+func (t *Tracker) check(userID string) {
+	presences, err := t.Get(userID)
+	if err != nil {
+		log.Printf("error getting presence: %v", err)
+		return
+	}
+	p := presences[0]
+	t.mu.Lock()
+	changed := t.published[userID] != p.Status
+	if p.Status == StatusOffline {
+		delete(t.published, userID)
+	} else {
+		t.published[userID] = p.Status
+	}
+	t.mu.Unlock()
+	// each server reports the changes it sees, so another server may report the
+	// same change again, but the event carries the whole presence so that's harmless
+	if changed {
+		t.onChange(p)
+	}
+}
+
+//refresh renews the connections on this server, and checks
+//whether any of their users have gone idle
+func (t *Tracker) refresh() {
+	t.mu.Lock()
+	connections := make(map[string]string, len(t.connections))
+	for connID, userID := range t.connections {
+		connections[connID] = userID
+	}
+	t.mu.Unlock()
+
+	expires := time.Now().Add(ConnectionTTL)
+	checked := map[string]bool{}
+	for connID, userID := range connections {
+		if err := t.store.Connect(userID, connID, expires); err != nil {
+			log.Printf("error refreshing connection: %v", err)
+		}
+		if !checked[userID] {
+			checked[userID] = true
+			t.check(userID)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package readmarkers
+
+import "time"
+
+//Marker records the last message a user has read in a channel
+type Marker struct {
+	ChannelID string    `json:"channelID"`
+	MessageID string    `json:"messageID"`
+	ReadAt    time.Time `json:"readAt"`
+}
+
+//MarkerUpdates represents the fields a client can set on a marker
+type MarkerUpdates struct {
+	MessageID string `json:"messageID"`
+}
+
+//key returns the key a user's marker for a channel is stored under
+func key(userID string, channelID string) string {
+	return userID + ":" + channelID
+}
@@ -0,0 +1,42 @@
+package readmarkers
+
+import (
+	"sync"
+)
+
+//MemStore represents an in-memory read markers store.
+//This should be used only for testing and prototyping.
+//Production systems should use a shared server store like redis
+type MemStore struct {
+	entries map[string]Marker
+	mu      sync.RWMutex
+}
+
+//NewMemStore constructs and returns a new MemStore
+func NewMemStore() *MemStore {
+	return &MemStore{
+		entries: make(map[string]Marker),
+	}
+}
+
+//Store implementation
+
+//Save saves the marker for the user, replacing any
+//previous marker for the same channel
+func (ms *MemStore) Save(userID string, marker *Marker) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.entries[key(userID, marker.ChannelID)] = *marker
+	return nil
+}
+
+//Get returns the user's marker for the channel
+func (ms *MemStore) Get(userID string, channelID string) (*Marker, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	marker, found := ms.entries[key(userID, channelID)]
+	if !found {
+		return nil, ErrMarkerNotFound
+	}
+	return &marker, nil
+}
@@ -0,0 +1,49 @@
+package readmarkers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemStore(t *testing.T) {
+	store := NewMemStore()
+
+	marker := &Marker{
+		ChannelID: "channel1",
+		MessageID: "message1",
+		ReadAt:    time.Now(),
+	}
+	if err := store.Save("user1", marker); err != nil {
+		t.Fatalf("error saving marker: %v", err)
+	}
+
+	m2, err := store.Get("user1", "channel1")
+	if err != nil {
+		t.Fatalf("error getting marker: %v", err)
+	}
+	if m2.MessageID != marker.MessageID {
+		t.Errorf("incorrect marker message: expected `%s` but got `%s`", marker.MessageID, m2.MessageID)
+	}
+
+	// markers are per user and per channel
+	if _, err := store.Get("user2", "channel1"); err != ErrMarkerNotFound {
+		t.Errorf("expected ErrMarkerNotFound for another user but got %v", err)
+	}
+	if _, err := store.Get("user1", "channel2"); err != ErrMarkerNotFound {
+		t.Errorf("expected ErrMarkerNotFound for another channel but got %v", err)
+	}
+
+	// saving again replaces the marker, and changing the saved marker doesn't change the store
+	marker.MessageID = "message2"
+	if err := store.Save("user1", marker); err != nil {
+		t.Fatalf("error saving marker: %v", err)
+	}
+	marker.MessageID = "message3"
+	m2, err = store.Get("user1", "channel1")
+	if err != nil {
+		t.Fatalf("error getting marker: %v", err)
+	}
+	if m2.MessageID != "message2" {
+		t.Errorf("marker not replaced: expected `message2` but got `%s`", m2.MessageID)
+	}
+}
@@ -0,0 +1,63 @@
+package readmarkers
+
+import (
+	"encoding/json"
+
+	"gopkg.in/redis.v5"
+)
+
+//redisKeyPrefix is the prefix we will use for keys
+//related to read markers. This keeps marker keys separate
+//from other keys in the shared redis key namespace.
+const redisKeyPrefix = "readmarker:"
+const defaultAddr = "127.0.0.1:6379"
+
+//RedisStore represents a readmarkers.Store backed by redis.
+//Markers are kept until they are replaced, they don't expire.
+type RedisStore struct {
+	//Redis client used to talk to redis server.
+	Client *redis.Client
+}
+
+//NewRedisStore constructs a new RedisStore, using the provided client.
+//If the `client` is nil, it will be set to redis.NewClient()
+//pointing at a local redis instance.
+func NewRedisStore(client *redis.Client) *RedisStore {
+	if client == nil {
+		client = redis.NewClient(&redis.Options{
+			Addr: defaultAddr,
+		})
+	}
+	return &RedisStore{
+		Client: client,
+	}
+}
+
+//Store implementation
+
+//Save saves the marker for the user, replacing any
+//previous marker for the same channel
+func (rs *RedisStore) Save(userID string, marker *Marker) error {
+	jbuf, err := json.Marshal(marker)
+	if err != nil {
+		return err
+	}
+	return rs.Client.Set(redisKeyPrefix+key(userID, marker.ChannelID), jbuf, 0).Err()
+}
+
+//Get returns the user's marker for the channel
+func (rs *RedisStore) Get(userID string, channelID string) (*Marker, error) {
+	jbuf, err := rs.Client.Get(redisKeyPrefix + key(userID, channelID)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrMarkerNotFound
+		}
+		return nil, err
+	}
+
+	marker := &Marker{}
+	if err := json.Unmarshal(jbuf, marker); err != nil {
+		return nil, err
+	}
+	return marker, nil
+}
@@ -0,0 +1,18 @@
+package readmarkers
+
+import "errors"
+
+//ErrMarkerNotFound is returned from Store.Get() when the user
+//hasn't marked anything as read in the channel
+var ErrMarkerNotFound = errors.New("read marker not found")
+
+//Store represents a store of read markers, keyed by
+//the user who read the channel and the channel.
+type Store interface {
+	//Save saves the marker for the user, replacing any
+	//previous marker for the same channel
+	Save(userID string, marker *Marker) error
+
+	//Get returns the user's marker for the channel
+	Get(userID string, channelID string) (*Marker, error)
+}
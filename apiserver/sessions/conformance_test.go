@@ -0,0 +1,35 @@
+package sessions_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"gopkg.in/redis.v5"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/sessions"
+	"github.com/aethanol/challenges-aethanol/apiserver/sessions/sessionstest"
+)
+
+func TestMemStoreConformance(t *testing.T) {
+	sessionstest.TestStore(t, func(t *testing.T, sessionDuration time.Duration) sessions.Store {
+		return sessions.NewMemStore(sessionDuration)
+	})
+}
+
+//NOTE: this test uses the REDISADDR environment variable
+//for the redis server address, like the other redis tests
+func TestRedisStoreConformance(t *testing.T) {
+	redisAddr := os.Getenv("REDISADDR")
+	if len(redisAddr) == 0 {
+		redisAddr = "127.0.0.1:6379"
+	}
+	sessionstest.TestStore(t, func(t *testing.T, sessionDuration time.Duration) sessions.Store {
+		client := redis.NewClient(&redis.Options{
+			Addr: redisAddr,
+		})
+		t.Cleanup(func() { client.Close() })
+		//session IDs are random, so the tests don't need an empty database
+		return sessions.NewRedisStore(client, sessionDuration)
+	})
+}
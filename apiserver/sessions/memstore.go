@@ -2,6 +2,7 @@ package sessions
 
 import (
 	"encoding/json"
+	"sync"
 	"time"
 
 	"github.com/patrickmn/go-cache"
@@ -12,6 +13,9 @@ import (
 //Production systems should use a shared server store like redis
 type MemStore struct {
 	entries *cache.Cache
+	//mu stops a Get from putting back a session
+	//that is being deleted at the same time
+	mu sync.Mutex
 }
 
 //NewMemStore constructs and returns a new MemStore
@@ -40,7 +44,13 @@ func (ms *MemStore) Save(sid SessionID, state interface{}) error {
 //and populates the `data` parameter with it. This will also
 //reset the data's time to live in the store.
 func (ms *MemStore) Get(sid SessionID, state interface{}) error {
+	ms.mu.Lock()
 	j, found := ms.entries.Get(sid.String())
+	if found {
+		//set it again to reset the expiration
+		ms.entries.Set(sid.String(), j, cache.DefaultExpiration)
+	}
+	ms.mu.Unlock()
 	if !found {
 		return ErrStateNotFound
 	}
@@ -49,6 +59,15 @@ func (ms *MemStore) Get(sid SessionID, state interface{}) error {
 
 //Delete deletes all state data associated with the session id from the store.
 func (ms *MemStore) Delete(sid SessionID) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
 	ms.entries.Delete(sid.String())
 	return nil
 }
+
+//Exists reports whether the session id is still in the store,
+//without resetting its time to live.
+func (ms *MemStore) Exists(sid SessionID) (bool, error) {
+	_, found := ms.entries.Get(sid.String())
+	return found, nil
+}
@@ -121,6 +121,12 @@ func (rs *RedisStore) Delete(sid SessionID) error {
 	return nil
 }
 
+//Exists reports whether the session id is still in the store,
+//without resetting its time to live.
+func (rs *RedisStore) Exists(sid SessionID) (bool, error) {
+	return rs.Client.Exists(sid.getRedisKey()).Result()
+}
+
 //returns the key to use in redis
 func (sid SessionID) getRedisKey() string {
 	return redisKeyPrefix + sid.String()
@@ -0,0 +1,230 @@
+//Package sessionstest is a conformance test suite for sessions.Store
+//implementations, so every backend is held to the same contract.
+package sessionstest
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/sessions"
+)
+
+//signingKey is used to sign the session IDs in the suite
+const signingKey = "conformance signing key"
+
+//NewStoreFunc returns a new store for a test that keeps session
+//state for the given duration. It should use t.Cleanup to release
+//anything the store holds on to.
+type NewStoreFunc func(t *testing.T, sessionDuration time.Duration) sessions.Store
+
+//TestStore runs the conformance suite against the stores returned
+//by newStore, each test gets its own store
+func TestStore(t *testing.T, newStore NewStoreFunc) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, newStore NewStoreFunc)
+	}{
+		{"SaveAndGet", testSaveAndGet},
+		{"NotFound", testNotFound},
+		{"Delete", testDelete},
+		{"Expiry", testExpiry},
+		{"GetResetsExpiry", testGetResetsExpiry},
+		{"Exists", testExists},
+		{"Concurrency", testConcurrency},
+	}
+	for _, tt := range tests {
+		test := tt.test
+		t.Run(tt.name, func(t *testing.T) {
+			test(t, newStore)
+		})
+	}
+}
+
+//state is the session state saved in the suite
+type state struct {
+	Requests int
+	Name     string
+}
+
+//newSID returns a new session ID and fails the test on error
+func newSID(t *testing.T) sessions.SessionID {
+	t.Helper()
+	sid, err := sessions.NewSessionID(signingKey)
+	if err != nil {
+		t.Fatalf("error creating session ID: %v", err)
+	}
+	return sid
+}
+
+func testSaveAndGet(t *testing.T, newStore NewStoreFunc) {
+	store := newStore(t, time.Hour)
+	sid := newSID(t)
+	other := newSID(t)
+
+	saved := &state{Requests: 1, Name: "first"}
+	if err := store.Save(sid, saved); err != nil {
+		t.Fatalf("error saving state: %v", err)
+	}
+	if err := store.Save(other, &state{Requests: 2, Name: "other"}); err != nil {
+		t.Fatalf("error saving state: %v", err)
+	}
+	got := &state{}
+	if err := store.Get(sid, got); err != nil {
+		t.Fatalf("error getting state: %v", err)
+	}
+	if !reflect.DeepEqual(saved, got) {
+		t.Errorf("retrieved state did not match saved state: expected %v but got %v", saved, got)
+	}
+
+	// saving again replaces the state
+	saved = &state{Requests: 3, Name: "second"}
+	if err := store.Save(sid, saved); err != nil {
+		t.Fatalf("error saving state: %v", err)
+	}
+	got = &state{}
+	if err := store.Get(sid, got); err != nil {
+		t.Fatalf("error getting state: %v", err)
+	}
+	if !reflect.DeepEqual(saved, got) {
+		t.Errorf("retrieved state did not match replaced state: expected %v but got %v", saved, got)
+	}
+}
+
+func testNotFound(t *testing.T, newStore NewStoreFunc) {
+	store := newStore(t, time.Hour)
+	got := &state{}
+	if err := store.Get(newSID(t), got); err != sessions.ErrStateNotFound {
+		t.Errorf("expected ErrStateNotFound for a missing session but got %v", err)
+	}
+	if got.Requests != 0 || got.Name != "" {
+		t.Errorf("state was filled in for a missing session: %v", got)
+	}
+	// deleting a missing session isn't an error
+	if err := store.Delete(newSID(t)); err != nil {
+		t.Errorf("error deleting a missing session: %v", err)
+	}
+}
+
+func testDelete(t *testing.T, newStore NewStoreFunc) {
+	store := newStore(t, time.Hour)
+	sid := newSID(t)
+	other := newSID(t)
+	for _, s := range []sessions.SessionID{sid, other} {
+		if err := store.Save(s, &state{Requests: 1}); err != nil {
+			t.Fatalf("error saving state: %v", err)
+		}
+	}
+
+	if err := store.Delete(sid); err != nil {
+		t.Fatalf("error deleting session: %v", err)
+	}
+	if err := store.Get(sid, &state{}); err != sessions.ErrStateNotFound {
+		t.Errorf("expected ErrStateNotFound for a deleted session but got %v", err)
+	}
+	// only that session is deleted
+	if err := store.Get(other, &state{}); err != nil {
+		t.Errorf("error getting another session: %v", err)
+	}
+}
+
+func testExpiry(t *testing.T, newStore NewStoreFunc) {
+	store := newStore(t, 200*time.Millisecond)
+	sid := newSID(t)
+	if err := store.Save(sid, &state{Requests: 1}); err != nil {
+		t.Fatalf("error saving state: %v", err)
+	}
+	time.Sleep(400 * time.Millisecond)
+	if err := store.Get(sid, &state{}); err != sessions.ErrStateNotFound {
+		t.Errorf("expected ErrStateNotFound for an expired session but got %v", err)
+	}
+}
+
+func testGetResetsExpiry(t *testing.T, newStore NewStoreFunc) {
+	store := newStore(t, 400*time.Millisecond)
+	sid := newSID(t)
+	if err := store.Save(sid, &state{Requests: 1}); err != nil {
+		t.Fatalf("error saving state: %v", err)
+	}
+	// each get is before the session expires, but the
+	// session lasts longer than the duration in total
+	for i := 0; i < 3; i++ {
+		time.Sleep(200 * time.Millisecond)
+		if err := store.Get(sid, &state{}); err != nil {
+			t.Fatalf("expected getting the session to keep it alive but got %v", err)
+		}
+	}
+}
+
+func testExists(t *testing.T, newStore NewStoreFunc) {
+	store := newStore(t, 300*time.Millisecond)
+	sid := newSID(t)
+	if exists, err := store.Exists(sid); err != nil || exists {
+		t.Errorf("expected a missing session not to exist but got %t, %v", exists, err)
+	}
+	if err := store.Save(sid, &state{Requests: 1}); err != nil {
+		t.Fatalf("error saving state: %v", err)
+	}
+
+	// checking on the session doesn't keep it alive
+	time.Sleep(200 * time.Millisecond)
+	if exists, err := store.Exists(sid); err != nil || !exists {
+		t.Errorf("expected the session to exist but got %t, %v", exists, err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if exists, err := store.Exists(sid); err != nil || exists {
+		t.Errorf("expected the session to have expired but got %t, %v", exists, err)
+	}
+
+	deleted := newSID(t)
+	if err := store.Save(deleted, &state{Requests: 1}); err != nil {
+		t.Fatalf("error saving state: %v", err)
+	}
+	if err := store.Delete(deleted); err != nil {
+		t.Fatalf("error deleting session: %v", err)
+	}
+	if exists, err := store.Exists(deleted); err != nil || exists {
+		t.Errorf("expected a deleted session not to exist but got %t, %v", exists, err)
+	}
+}
+
+func testConcurrency(t *testing.T, newStore NewStoreFunc) {
+	store := newStore(t, time.Hour)
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sid, err := sessions.NewSessionID(signingKey)
+			if err != nil {
+				errs <- err
+				return
+			}
+			for r := 1; r <= 5; r++ {
+				if err := store.Save(sid, &state{Requests: r}); err != nil {
+					errs <- err
+					return
+				}
+				got := &state{}
+				if err := store.Get(sid, got); err != nil {
+					errs <- err
+					return
+				}
+				if got.Requests != r {
+					t.Errorf("expected %d requests but got %d", r, got.Requests)
+				}
+			}
+			if err := store.Delete(sid); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("error using sessions concurrently: %v", err)
+	}
+}
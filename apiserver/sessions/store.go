@@ -30,4 +30,9 @@ type Store interface {
 
 	//Delete deletes all state data associated with the session id from the store.
 	Delete(sid SessionID) error
+
+	//Exists reports whether the session id is still in the store, without
+	//resetting its time to live, so a session can be checked on without
+	//keeping it alive.
+	Exists(sid SessionID) (bool, error)
 }
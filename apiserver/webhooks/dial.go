@@ -0,0 +1,75 @@
+package webhooks
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+//ErrPrivateAddress is returned when a webhook URL is, or resolves to,
+//an address on the server's own machine or network
+var ErrPrivateAddress = errors.New("webhook URLs may not point at loopback, link-local or private addresses")
+
+//isPublicIP reports whether the IP is one webhooks may be delivered to,
+//so users can't use them to reach the server's own machine or network
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsPrivate() &&
+		!ip.IsUnspecified()
+}
+
+//checkHost returns ErrPrivateAddress if the URL's host is
+//localhost or an IP literal that isn't public. Host names are
+//checked again once they are resolved, when they are dialed
+func checkHost(hostname string) error {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	if hostname == "localhost" || strings.HasSuffix(hostname, ".localhost") {
+		return ErrPrivateAddress
+	}
+	if ip := net.ParseIP(hostname); ip != nil && !isPublicIP(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+//checkDial refuses connections to addresses that aren't public, it is
+//the Control func of the dialer, so it sees the address after resolution
+func checkDial(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+//newClient returns the client deliveries are made with by default.
+//It only dials public addresses, doesn't use a proxy, and doesn't
+//follow redirects, so a redirect counts as a failed attempt
+func newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: DefaultTimeout,
+		Control: checkDial,
+	}
+	return &http.Client{
+		Timeout: DefaultTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: DefaultTimeout,
+			MaxIdleConnsPerHost: 2,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
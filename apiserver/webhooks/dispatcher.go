@@ -0,0 +1,242 @@
+package webhooks
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/events"
+)
+
+//DefaultMaxAttempts is how many times a delivery is tried
+//before it is put on the dead-letter list
+const DefaultMaxAttempts = 8
+
+//DefaultBackoff is how long to wait before retrying a delivery the first time,
+//the wait doubles after each failed attempt up to DefaultMaxBackoff
+const DefaultBackoff = 10 * time.Second
+
+//DefaultMaxBackoff is the longest wait between attempts
+const DefaultMaxBackoff = 30 * time.Minute
+
+//DefaultTimeout is how long an endpoint has to respond to a delivery
+const DefaultTimeout = 10 * time.Second
+
+//QueueSize is how many deliveries can wait for a worker, and how many
+//published events can wait to be matched to subscriptions. Events past
+//it are dropped and logged, retries past it are put on the dead-letter list
+var QueueSize = 1024
+
+//Audience decides who may see an event, a subscription is only
+//sent the events its owner could see on a websocket
+type Audience interface {
+	CanSee(record *events.Record, userID string) bool
+}
+
+//Dispatcher sends the events a Notifier publishes to the
+//subscriptions that want them, retrying failed deliveries
+type Dispatcher struct {
+	//MaxAttempts is how many times a delivery is tried
+	MaxAttempts int
+	//Backoff is how long to wait before the first retry
+	Backoff time.Duration
+	//MaxBackoff is the longest wait between attempts
+	MaxBackoff time.Duration
+
+	store    Store
+	audience Audience
+	client   *http.Client
+	records  chan *events.Record
+	queue    chan *Delivery
+}
+
+//NewDispatcher constructs a new Dispatcher for the subscriptions in the store,
+//delivering with the client. If the client is nil a client with DefaultTimeout
+//is used, that only dials public addresses and doesn't follow redirects
+func NewDispatcher(store Store, audience Audience, client *http.Client) *Dispatcher {
+	if client == nil {
+		client = newClient()
+	}
+	return &Dispatcher{
+		MaxAttempts: DefaultMaxAttempts,
+		Backoff:     DefaultBackoff,
+		MaxBackoff:  DefaultMaxBackoff,
+		store:       store,
+		audience:    audience,
+		client:      client,
+		records:     make(chan *events.Record, QueueSize),
+		queue:       make(chan *Delivery, QueueSize),
+	}
+}
+
+//Start starts the workers that match events to subscriptions and make the deliveries
+func (d *Dispatcher) Start(workers int) {
+	go d.match()
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+}
+
+//Published queues the event to be matched to the subscriptions that want
+//it, it is an events.Listener so it must not block. Events that can't be
+//queued are dropped and logged
+func (d *Dispatcher) Published(record *events.Record) {
+	if len(record.Event) == 0 {
+		return
+	}
+	select {
+	case d.records <- record:
+	default:
+		log.Printf("webhook queue full, dropping event %d", record.Seq)
+	}
+}
+
+//match queues the deliveries of the published events until the process exits
+func (d *Dispatcher) match() {
+	for record := range d.records {
+		d.deliveries(record)
+	}
+}
+
+//deliveries queues a delivery of the event for every subscription
+//that wants it and whose owner can see it, waiting for room in the queue
+func (d *Dispatcher) deliveries(record *events.Record) {
+	eventType := record.Type()
+	if len(eventType) == 0 {
+		return
+	}
+	subs, err := d.store.Matching(eventType)
+	if err != nil {
+		log.Printf("error finding webhooks for %q event: %v", eventType, err)
+		return
+	}
+	for _, sub := range subs {
+		if !sub.matches(eventType, record.ChannelID) || !d.audience.CanSee(record, sub.OwnerID) {
+			continue
+		}
+		id, err := randomHex(12)
+		if err != nil {
+			log.Printf("error creating webhook delivery ID: %v", err)
+			return
+		}
+		d.queue <- &Delivery{
+			ID:             id,
+			SubscriptionID: sub.ID,
+			EventType:      eventType,
+			Seq:            record.Seq,
+			Payload:        record.Frame(),
+			CreatedAt:      time.Now(),
+		}
+	}
+}
+
+//retry hands the delivery back to the workers without blocking,
+//if there is no room it is put on the dead-letter list so it isn't lost
+func (d *Dispatcher) retry(delivery *Delivery) {
+	select {
+	case d.queue <- delivery:
+	default:
+		delivery.LastError = "webhook queue full, retry not queued after: " + delivery.LastError
+		d.deadLetter(delivery)
+	}
+}
+
+//deadLetter puts the delivery on the dead-letter list
+func (d *Dispatcher) deadLetter(delivery *Delivery) {
+	if err := d.store.AddDeadLetter(delivery); err != nil {
+		log.Printf("error adding webhook dead letter %s to %s: %v", delivery.ID, delivery.SubscriptionID, err)
+	}
+}
+
+//work makes deliveries until the process exits
+func (d *Dispatcher) work() {
+	for delivery := range d.queue {
+		d.attempt(delivery)
+	}
+}
+
+//attempt tries the delivery once, logs the attempt, and
+//schedules a retry or puts it on the dead-letter list if it failed
+func (d *Dispatcher) attempt(delivery *Delivery) {
+	//the subscription may have been deleted since the delivery was queued
+	sub, err := d.store.Get(delivery.SubscriptionID)
+	if err == ErrSubscriptionNotFound {
+		return
+	}
+	if err != nil {
+		log.Printf("error getting webhook %s: %v", delivery.SubscriptionID, err)
+		return
+	}
+
+	delivery.Attempts++
+	start := time.Now()
+	status, err := d.post(sub, delivery)
+	attempt := &Attempt{
+		DeliveryID:     delivery.ID,
+		SubscriptionID: sub.ID,
+		EventType:      delivery.EventType,
+		Attempt:        delivery.Attempts,
+		Delivered:      err == nil,
+		StatusCode:     status,
+		At:             start,
+		DurationMS:     int64(time.Since(start) / time.Millisecond),
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+		delivery.LastError = err.Error()
+	}
+	if err := d.store.LogAttempt(attempt); err != nil {
+		log.Printf("error logging webhook attempt: %v", err)
+	}
+	if attempt.Delivered {
+		return
+	}
+
+	if delivery.Attempts >= d.MaxAttempts {
+		d.deadLetter(delivery)
+		return
+	}
+	time.AfterFunc(d.backoff(delivery.Attempts), func() {
+		d.retry(delivery)
+	})
+}
+
+//backoff returns how long to wait after the attempt before trying again
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.Backoff
+	for i := 1; i < attempts && wait < d.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.MaxBackoff {
+		wait = d.MaxBackoff
+	}
+	return wait
+}
+
+//post sends the delivery to the subscription's URL, returning the status code
+//and an error if the endpoint didn't respond with a 2xx status
+func (d *Dispatcher) post(sub *Subscription, delivery *Delivery) (int, error) {
+	req, err := http.NewRequest("POST", sub.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, errors.New("endpoint responded with " + resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,225 @@
+package webhooks
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/events"
+)
+
+//everyone but the outsider can see every event
+type openAudience struct{}
+
+func (openAudience) CanSee(record *events.Record, userID string) bool {
+	return userID != "outsider"
+}
+
+//waitFor polls until the test passes or a second has gone by
+func waitFor(t *testing.T, what string, test func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !test() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func newTestSubscription(t *testing.T, store Store, ownerID string, url string, channelIDs ...string) *Subscription {
+	ns := &NewSubscription{URL: url, EventTypes: []string{events.TypeNewMessage}, ChannelIDs: channelIDs}
+	sub, err := ns.ToSubscription(ownerID)
+	if err != nil {
+		t.Fatalf("error creating subscription: %v", err)
+	}
+	if err := store.Insert(sub); err != nil {
+		t.Fatalf("error inserting subscription: %v", err)
+	}
+	return sub
+}
+
+func TestDispatcher(t *testing.T) {
+	var received int32
+	var sub *Subscription
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		ts, _ := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		if !Verify(sub.Secret, ts, body, r.Header.Get(HeaderSignature)) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get(HeaderEvent) != events.TypeNewMessage || len(r.Header.Get(HeaderDelivery)) == 0 {
+			http.Error(w, "missing headers", http.StatusBadRequest)
+			return
+		}
+		if string(body) != `{"seq":7,"type":"new message"}` {
+			http.Error(w, "unexpected body "+string(body), http.StatusBadRequest)
+			return
+		}
+		atomic.AddInt32(&received, 1)
+	}))
+	defer srv.Close()
+
+	store := NewMemStore()
+	sub = newTestSubscription(t, store, "user1", srv.URL, "channel1")
+	newTestSubscription(t, store, "user1", srv.URL, "channel2")
+	newTestSubscription(t, store, "outsider", srv.URL)
+
+	d := NewDispatcher(store, openAudience{}, srv.Client())
+	d.Start(2)
+	d.Published(&events.Record{Seq: 7, Event: []byte(`{"type":"new message"}`), ChannelID: "channel1"})
+
+	// only the subscription to the channel whose owner can see it gets the event
+	waitFor(t, "the delivery", func() bool { return atomic.LoadInt32(&received) == 1 })
+	waitFor(t, "the attempt log", func() bool {
+		attempts, _ := store.Attempts(sub.ID)
+		return len(attempts) == 1 && attempts[0].Delivered && attempts[0].StatusCode == http.StatusOK
+	})
+	time.Sleep(20 * time.Millisecond)
+	if n := atomic.LoadInt32(&received); n != 1 {
+		t.Errorf("expected 1 delivery but got %d", n)
+	}
+
+	// records without events aren't delivered
+	d.Published(&events.Record{Control: &events.Control{Op: "joined", ChannelID: "channel1"}})
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	var calls int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// fail the first two attempts
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	store := NewMemStore()
+	sub := newTestSubscription(t, store, "user1", srv.URL)
+	d := NewDispatcher(store, openAudience{}, srv.Client())
+	d.Backoff = time.Millisecond
+	d.Start(1)
+	d.Published(&events.Record{Event: []byte(`{"type":"new message"}`)})
+
+	waitFor(t, "the retries", func() bool {
+		attempts, _ := store.Attempts(sub.ID)
+		return len(attempts) == 3
+	})
+	attempts, _ := store.Attempts(sub.ID)
+	if !attempts[0].Delivered || attempts[0].Attempt != 3 {
+		t.Errorf("expected the third attempt to be delivered but got %+v", attempts[0])
+	}
+	if attempts[1].Delivered || attempts[1].StatusCode != http.StatusServiceUnavailable || attempts[1].DeliveryID != attempts[0].DeliveryID {
+		t.Errorf("expected a failed attempt at the same delivery but got %+v", attempts[1])
+	}
+	if letters, _ := store.DeadLetters(sub.ID); len(letters) != 0 {
+		t.Errorf("expected no dead letters but got %d", len(letters))
+	}
+}
+
+func TestDispatcherDeadLetters(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	store := NewMemStore()
+	sub := newTestSubscription(t, store, "user1", srv.URL)
+	d := NewDispatcher(store, openAudience{}, srv.Client())
+	d.MaxAttempts = 3
+	d.Backoff = time.Millisecond
+	d.Start(1)
+	d.Published(&events.Record{Event: []byte(`{"type":"new message"}`)})
+
+	waitFor(t, "the dead letter", func() bool {
+		letters, _ := store.DeadLetters(sub.ID)
+		return len(letters) == 1
+	})
+	letters, _ := store.DeadLetters(sub.ID)
+	if letters[0].Attempts != 3 || len(letters[0].LastError) == 0 {
+		t.Errorf("expected 3 attempts and the last error but got %+v", letters[0])
+	}
+	if attempts, _ := store.Attempts(sub.ID); len(attempts) != 3 {
+		t.Errorf("expected 3 attempts but got %d", len(attempts))
+	}
+}
+
+func TestDispatcherBackoff(t *testing.T) {
+	d := NewDispatcher(NewMemStore(), openAudience{}, nil)
+	d.Backoff = time.Second
+	d.MaxBackoff = 5 * time.Second
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, wait := range expected {
+		if got := d.backoff(i + 1); got != wait {
+			t.Errorf("attempt %d: expected to wait %v but got %v", i+1, wait, got)
+		}
+	}
+}
+
+func TestDispatcherPrivateAddresses(t *testing.T) {
+	var calls int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer srv.Close()
+
+	// the default client won't dial the test server, which is on loopback
+	store := NewMemStore()
+	sub := newTestSubscription(t, store, "user1", srv.URL)
+	d := NewDispatcher(store, openAudience{}, nil)
+	d.MaxAttempts = 1
+	d.Start(1)
+	d.Published(&events.Record{Event: []byte(`{"type":"new message"}`)})
+
+	waitFor(t, "the dead letter", func() bool {
+		letters, _ := store.DeadLetters(sub.ID)
+		return len(letters) == 1
+	})
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Errorf("expected no requests to a loopback address but got %d", n)
+	}
+	if letters, _ := store.DeadLetters(sub.ID); !strings.Contains(letters[0].LastError, ErrPrivateAddress.Error()) {
+		t.Errorf("expected the private address error but got %q", letters[0].LastError)
+	}
+}
+
+func TestDispatcherRedirects(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://example.com/", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	// redirects count as failed attempts instead of being followed
+	client := srv.Client()
+	client.CheckRedirect = newClient().CheckRedirect
+	store := NewMemStore()
+	sub := newTestSubscription(t, store, "user1", srv.URL)
+	d := NewDispatcher(store, openAudience{}, client)
+	d.MaxAttempts = 1
+	d.Start(1)
+	d.Published(&events.Record{Event: []byte(`{"type":"new message"}`)})
+
+	waitFor(t, "the attempt log", func() bool {
+		attempts, _ := store.Attempts(sub.ID)
+		return len(attempts) == 1 && !attempts[0].Delivered && attempts[0].StatusCode == http.StatusFound
+	})
+}
+
+func TestDispatcherRetryQueueFull(t *testing.T) {
+	// with no workers started nothing takes retries off the queue
+	store := NewMemStore()
+	d := NewDispatcher(store, openAudience{}, nil)
+	for i := 0; i < cap(d.queue); i++ {
+		d.queue <- &Delivery{}
+	}
+	d.retry(&Delivery{ID: "retry", SubscriptionID: "sub", LastError: "timeout"})
+	letters, _ := store.DeadLetters("sub")
+	if len(letters) != 1 || letters[0].ID != "retry" {
+		t.Errorf("expected the retry to be dead-lettered but got %+v", letters)
+	}
+}
@@ -0,0 +1,131 @@
+package webhooks
+
+import (
+	"sort"
+	"sync"
+)
+
+//MemStore represents an in-memory webhooks store.
+//This should be used only for testing and prototyping.
+//Production systems should use a shared server store like redis
+type MemStore struct {
+	subscriptions map[string]*Subscription
+	attempts      map[string][]*Attempt
+	deadLetters   map[string][]*Delivery
+	mu            sync.RWMutex
+}
+
+//NewMemStore constructs and returns a new MemStore
+func NewMemStore() *MemStore {
+	return &MemStore{
+		subscriptions: make(map[string]*Subscription),
+		attempts:      make(map[string][]*Attempt),
+		deadLetters:   make(map[string][]*Delivery),
+	}
+}
+
+//Store implementation
+
+//Insert saves a new subscription
+func (ms *MemStore) Insert(sub *Subscription) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	copied := *sub
+	ms.subscriptions[sub.ID] = &copied
+	return nil
+}
+
+//Get returns the subscription with the ID, or ErrSubscriptionNotFound
+func (ms *MemStore) Get(id string) (*Subscription, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	sub, found := ms.subscriptions[id]
+	if !found {
+		return nil, ErrSubscriptionNotFound
+	}
+	copied := *sub
+	return &copied, nil
+}
+
+//GetByOwner returns the subscriptions the user created
+func (ms *MemStore) GetByOwner(ownerID string) ([]*Subscription, error) {
+	return ms.filter(func(sub *Subscription) bool {
+		return sub.OwnerID == ownerID
+	}), nil
+}
+
+//Matching returns the subscriptions to the event type
+func (ms *MemStore) Matching(eventType string) ([]*Subscription, error) {
+	return ms.filter(func(sub *Subscription) bool {
+		return sub.matches(eventType, "")
+	}), nil
+}
+
+//filter returns copies of the subscriptions that pass the test, oldest first
+func (ms *MemStore) filter(test func(sub *Subscription) bool) []*Subscription {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	subs := []*Subscription{}
+	for _, sub := range ms.subscriptions {
+		if test(sub) {
+			copied := *sub
+			subs = append(subs, &copied)
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].CreatedAt.Before(subs[j].CreatedAt)
+	})
+	return subs
+}
+
+//Delete deletes the subscription and its logs
+func (ms *MemStore) Delete(id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, found := ms.subscriptions[id]; !found {
+		return ErrSubscriptionNotFound
+	}
+	delete(ms.subscriptions, id)
+	delete(ms.attempts, id)
+	delete(ms.deadLetters, id)
+	return nil
+}
+
+//LogAttempt adds the attempt to its subscription's delivery log
+func (ms *MemStore) LogAttempt(attempt *Attempt) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	log := append([]*Attempt{attempt}, ms.attempts[attempt.SubscriptionID]...)
+	if len(log) > MaxLogSize {
+		log = log[:MaxLogSize]
+	}
+	ms.attempts[attempt.SubscriptionID] = log
+	return nil
+}
+
+//Attempts returns the subscription's delivery log, latest first
+func (ms *MemStore) Attempts(subscriptionID string) ([]*Attempt, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return append([]*Attempt{}, ms.attempts[subscriptionID]...), nil
+}
+
+//AddDeadLetter adds a delivery that ran out of attempts
+//to its subscription's dead-letter list
+func (ms *MemStore) AddDeadLetter(delivery *Delivery) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	letters := append([]*Delivery{delivery}, ms.deadLetters[delivery.SubscriptionID]...)
+	if len(letters) > MaxLogSize {
+		letters = letters[:MaxLogSize]
+	}
+	ms.deadLetters[delivery.SubscriptionID] = letters
+	return nil
+}
+
+//DeadLetters returns the subscription's dead-letter list, latest first
+func (ms *MemStore) DeadLetters(subscriptionID string) ([]*Delivery, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return append([]*Delivery{}, ms.deadLetters[subscriptionID]...), nil
+}
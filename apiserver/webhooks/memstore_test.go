@@ -0,0 +1,134 @@
+package webhooks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/events"
+)
+
+func TestMemStore(t *testing.T) {
+	store := NewMemStore()
+
+	ns := &NewSubscription{
+		URL:        "https://example.com/hook",
+		EventTypes: []string{events.TypeNewMessage, events.TypeMessageUpdate},
+		ChannelIDs: []string{"channel1"},
+	}
+	if err := ns.Validate(); err != nil {
+		t.Fatalf("error validating subscription: %v", err)
+	}
+	sub, err := ns.ToSubscription("user1")
+	if err != nil {
+		t.Fatalf("error creating subscription: %v", err)
+	}
+	if len(sub.ID) == 0 || len(sub.Secret) == 0 {
+		t.Fatal("expected the subscription to get an ID and a secret")
+	}
+	if err := store.Insert(sub); err != nil {
+		t.Fatalf("error inserting subscription: %v", err)
+	}
+
+	s2, err := store.Get(sub.ID)
+	if err != nil {
+		t.Fatalf("error getting subscription: %v", err)
+	}
+	if s2.URL != sub.URL || s2.Secret != sub.Secret {
+		t.Errorf("incorrect subscription: expected %+v but got %+v", sub, s2)
+	}
+
+	owned, err := store.GetByOwner("user1")
+	if err != nil || len(owned) != 1 {
+		t.Errorf("expected 1 subscription for the owner but got %d, %v", len(owned), err)
+	}
+	if owned, _ := store.GetByOwner("user2"); len(owned) != 0 {
+		t.Errorf("expected no subscriptions for another user but got %d", len(owned))
+	}
+	if matching, _ := store.Matching(events.TypeMessageUpdate); len(matching) != 1 {
+		t.Errorf("expected 1 subscription to %q but got %d", events.TypeMessageUpdate, len(matching))
+	}
+	if matching, _ := store.Matching(events.TypeNewChannel); len(matching) != 0 {
+		t.Errorf("expected no subscriptions to %q but got %d", events.TypeNewChannel, len(matching))
+	}
+
+	// the delivery log keeps only the latest attempts, latest first
+	for i := 1; i <= MaxLogSize+5; i++ {
+		if err := store.LogAttempt(&Attempt{SubscriptionID: sub.ID, Attempt: i, At: time.Now()}); err != nil {
+			t.Fatalf("error logging attempt: %v", err)
+		}
+	}
+	attempts, err := store.Attempts(sub.ID)
+	if err != nil {
+		t.Fatalf("error getting attempts: %v", err)
+	}
+	if len(attempts) != MaxLogSize || attempts[0].Attempt != MaxLogSize+5 {
+		t.Errorf("expected %d attempts starting with the latest but got %d starting with %d", MaxLogSize, len(attempts), attempts[0].Attempt)
+	}
+
+	if err := store.AddDeadLetter(&Delivery{ID: "delivery1", SubscriptionID: sub.ID}); err != nil {
+		t.Fatalf("error adding dead letter: %v", err)
+	}
+	if letters, _ := store.DeadLetters(sub.ID); len(letters) != 1 || letters[0].ID != "delivery1" {
+		t.Errorf("expected the dead letter but got %+v", letters)
+	}
+
+	// deleting removes the subscription and its logs
+	if err := store.Delete(sub.ID); err != nil {
+		t.Fatalf("error deleting subscription: %v", err)
+	}
+	if _, err := store.Get(sub.ID); err != ErrSubscriptionNotFound {
+		t.Errorf("expected ErrSubscriptionNotFound after delete but got %v", err)
+	}
+	if matching, _ := store.Matching(events.TypeNewMessage); len(matching) != 0 {
+		t.Errorf("expected no matching subscriptions after delete but got %d", len(matching))
+	}
+	if attempts, _ := store.Attempts(sub.ID); len(attempts) != 0 {
+		t.Errorf("expected no attempts after delete but got %d", len(attempts))
+	}
+	if err := store.Delete(sub.ID); err != ErrSubscriptionNotFound {
+		t.Errorf("expected ErrSubscriptionNotFound deleting twice but got %v", err)
+	}
+}
+
+func TestNewSubscriptionValidate(t *testing.T) {
+	cases := []struct {
+		name  string
+		ns    NewSubscription
+		valid bool
+	}{
+		{"valid", NewSubscription{URL: "https://example.com", EventTypes: []string{events.TypeNewMessage}}, true},
+		{"http", NewSubscription{URL: "http://example.com", EventTypes: []string{events.TypeNewMessage}}, false},
+		{"no host", NewSubscription{URL: "https://", EventTypes: []string{events.TypeNewMessage}}, false},
+		{"no types", NewSubscription{URL: "https://example.com"}, false},
+		{"unknown type", NewSubscription{URL: "https://example.com", EventTypes: []string{"nope"}}, false},
+		{"connection type", NewSubscription{URL: "https://example.com", EventTypes: []string{events.TypeConnected}}, false},
+		{"loopback", NewSubscription{URL: "https://127.0.0.1:8443/hook", EventTypes: []string{events.TypeNewMessage}}, false},
+		{"localhost", NewSubscription{URL: "https://localhost/hook", EventTypes: []string{events.TypeNewMessage}}, false},
+		{"link-local", NewSubscription{URL: "https://169.254.169.254/latest", EventTypes: []string{events.TypeNewMessage}}, false},
+		{"private", NewSubscription{URL: "https://10.0.0.5", EventTypes: []string{events.TypeNewMessage}}, false},
+		{"private IPv6", NewSubscription{URL: "https://[fd00::1]", EventTypes: []string{events.TypeNewMessage}}, false},
+		{"public IP", NewSubscription{URL: "https://93.184.216.34/hook", EventTypes: []string{events.TypeNewMessage}}, true},
+	}
+	for _, c := range cases {
+		if err := c.ns.Validate(); (err == nil) != c.valid {
+			t.Errorf("%s: expected valid to be %t but got error %v", c.name, c.valid, err)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"type":"new message"}`)
+	sig := Sign("secret", 1500000000, body)
+	if !Verify("secret", 1500000000, body, sig) {
+		t.Error("expected the signature to verify")
+	}
+	if Verify("other", 1500000000, body, sig) {
+		t.Error("expected the signature not to verify with another secret")
+	}
+	if Verify("secret", 1500000001, body, sig) {
+		t.Error("expected the signature not to verify with another timestamp")
+	}
+	if Verify("secret", 1500000000, []byte(`{}`), sig) {
+		t.Error("expected the signature not to verify with another body")
+	}
+}
@@ -0,0 +1,190 @@
+package webhooks
+
+import (
+	"encoding/json"
+
+	"gopkg.in/redis.v5"
+)
+
+//the prefixes of the keys we keep webhooks in. They keep webhook
+//keys separate from other keys in the shared redis key namespace.
+const (
+	//each subscription, as JSON
+	redisSubscriptionPrefix = "webhook:sub:"
+	//a set of the IDs of each user's subscriptions
+	redisOwnerPrefix = "webhook:owner:"
+	//a set of the IDs of the subscriptions to each event type
+	redisTypePrefix = "webhook:type:"
+	//a list of each subscription's delivery attempts, latest first
+	redisAttemptsPrefix = "webhook:attempts:"
+	//a list of each subscription's dead letters, latest first
+	redisDeadLettersPrefix = "webhook:dead:"
+)
+const defaultAddr = "127.0.0.1:6379"
+
+//RedisStore represents a webhooks.Store backed by redis.
+type RedisStore struct {
+	//Redis client used to talk to redis server.
+	Client *redis.Client
+}
+
+//NewRedisStore constructs a new RedisStore, using the provided client.
+//If the `client` is nil, it will be set to redis.NewClient()
+//pointing at a local redis instance.
+func NewRedisStore(client *redis.Client) *RedisStore {
+	if client == nil {
+		client = redis.NewClient(&redis.Options{
+			Addr: defaultAddr,
+		})
+	}
+	return &RedisStore{
+		Client: client,
+	}
+}
+
+//Store implementation
+
+//Insert saves a new subscription
+func (rs *RedisStore) Insert(sub *Subscription) error {
+	jbuf, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	if err := rs.Client.Set(redisSubscriptionPrefix+sub.ID, jbuf, 0).Err(); err != nil {
+		return err
+	}
+	if err := rs.Client.SAdd(redisOwnerPrefix+sub.OwnerID, sub.ID).Err(); err != nil {
+		return err
+	}
+	for _, t := range sub.EventTypes {
+		if err := rs.Client.SAdd(redisTypePrefix+t, sub.ID).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Get returns the subscription with the ID, or ErrSubscriptionNotFound
+func (rs *RedisStore) Get(id string) (*Subscription, error) {
+	jbuf, err := rs.Client.Get(redisSubscriptionPrefix + id).Bytes()
+	if err == redis.Nil {
+		return nil, ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	sub := &Subscription{}
+	if err := json.Unmarshal(jbuf, sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+//GetByOwner returns the subscriptions the user created
+func (rs *RedisStore) GetByOwner(ownerID string) ([]*Subscription, error) {
+	return rs.members(redisOwnerPrefix + ownerID)
+}
+
+//Matching returns the subscriptions to the event type
+func (rs *RedisStore) Matching(eventType string) ([]*Subscription, error) {
+	return rs.members(redisTypePrefix + eventType)
+}
+
+//members returns the subscriptions whose IDs are in the set,
+//skipping any deleted since they were added to it
+func (rs *RedisStore) members(key string) ([]*Subscription, error) {
+	ids, err := rs.Client.SMembers(key).Result()
+	if err != nil {
+		return nil, err
+	}
+	subs := []*Subscription{}
+	for _, id := range ids {
+		sub, err := rs.Get(id)
+		if err == ErrSubscriptionNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+//Delete deletes the subscription and its logs
+func (rs *RedisStore) Delete(id string) error {
+	sub, err := rs.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := rs.Client.Del(redisSubscriptionPrefix+id, redisAttemptsPrefix+id, redisDeadLettersPrefix+id).Err(); err != nil {
+		return err
+	}
+	if err := rs.Client.SRem(redisOwnerPrefix+sub.OwnerID, id).Err(); err != nil {
+		return err
+	}
+	for _, t := range sub.EventTypes {
+		if err := rs.Client.SRem(redisTypePrefix+t, id).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//LogAttempt adds the attempt to its subscription's delivery log
+func (rs *RedisStore) LogAttempt(attempt *Attempt) error {
+	return rs.push(redisAttemptsPrefix+attempt.SubscriptionID, attempt)
+}
+
+//Attempts returns the subscription's delivery log, latest first
+func (rs *RedisStore) Attempts(subscriptionID string) ([]*Attempt, error) {
+	entries, err := rs.Client.LRange(redisAttemptsPrefix+subscriptionID, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	attempts := make([]*Attempt, 0, len(entries))
+	for _, e := range entries {
+		attempt := &Attempt{}
+		if err := json.Unmarshal([]byte(e), attempt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, nil
+}
+
+//AddDeadLetter adds a delivery that ran out of attempts
+//to its subscription's dead-letter list
+func (rs *RedisStore) AddDeadLetter(delivery *Delivery) error {
+	return rs.push(redisDeadLettersPrefix+delivery.SubscriptionID, delivery)
+}
+
+//DeadLetters returns the subscription's dead-letter list, latest first
+func (rs *RedisStore) DeadLetters(subscriptionID string) ([]*Delivery, error) {
+	entries, err := rs.Client.LRange(redisDeadLettersPrefix+subscriptionID, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	letters := make([]*Delivery, 0, len(entries))
+	for _, e := range entries {
+		delivery := &Delivery{}
+		if err := json.Unmarshal([]byte(e), delivery); err != nil {
+			return nil, err
+		}
+		letters = append(letters, delivery)
+	}
+	return letters, nil
+}
+
+//push adds the value to the front of the list as JSON,
+//dropping the oldest entries past MaxLogSize
+func (rs *RedisStore) push(key string, v interface{}) error {
+	jbuf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := rs.Client.LPush(key, jbuf).Err(); err != nil {
+		return err
+	}
+	return rs.Client.LTrim(key, 0, MaxLogSize-1).Err()
+}
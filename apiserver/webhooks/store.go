@@ -0,0 +1,68 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"time"
+)
+
+//MaxLogSize is how many delivery attempts and dead letters are kept
+//for each subscription, the oldest are dropped first
+const MaxLogSize = 100
+
+//Delivery is an event being delivered to a subscription,
+//it keeps the same ID through all its attempts
+type Delivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscriptionID"`
+	EventType      string          `json:"eventType"`
+	Seq            uint64          `json:"seq,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+	Attempts       int             `json:"attempts"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	//LastError is why the last attempt failed
+	LastError string `json:"lastError,omitempty"`
+}
+
+//Attempt is the result of one attempt at a delivery
+type Attempt struct {
+	DeliveryID     string    `json:"deliveryID"`
+	SubscriptionID string    `json:"subscriptionID"`
+	EventType      string    `json:"eventType"`
+	Attempt        int       `json:"attempt"`
+	Delivered      bool      `json:"delivered"`
+	StatusCode     int       `json:"statusCode,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	At             time.Time `json:"at"`
+	DurationMS     int64     `json:"durationMS"`
+}
+
+//Store represents a store of webhook subscriptions and their delivery logs
+type Store interface {
+	//Insert saves a new subscription
+	Insert(sub *Subscription) error
+
+	//Get returns the subscription with the ID, or ErrSubscriptionNotFound
+	Get(id string) (*Subscription, error)
+
+	//GetByOwner returns the subscriptions the user created
+	GetByOwner(ownerID string) ([]*Subscription, error)
+
+	//Matching returns the subscriptions to the event type
+	Matching(eventType string) ([]*Subscription, error)
+
+	//Delete deletes the subscription and its logs
+	Delete(id string) error
+
+	//LogAttempt adds the attempt to its subscription's delivery log
+	LogAttempt(attempt *Attempt) error
+
+	//Attempts returns the subscription's delivery log, latest first
+	Attempts(subscriptionID string) ([]*Attempt, error)
+
+	//AddDeadLetter adds a delivery that ran out of attempts
+	//to its subscription's dead-letter list
+	AddDeadLetter(delivery *Delivery) error
+
+	//DeadLetters returns the subscription's dead-letter list, latest first
+	DeadLetters(subscriptionID string) ([]*Delivery, error)
+}
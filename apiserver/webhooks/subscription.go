@@ -0,0 +1,153 @@
+//Package webhooks delivers workspace events to HTTPS endpoints that users
+//register, as JSON POSTs signed with a secret only the endpoint knows.
+//Deliveries that fail are retried with exponential backoff, and put on a
+//dead-letter list once they run out of attempts.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/aethanol/challenges-aethanol/apiserver/events"
+)
+
+//the headers sent with every delivery
+const (
+	//HeaderSignature is the signature of the delivery, see Sign
+	HeaderSignature = "X-Webhook-Signature"
+	//HeaderTimestamp is when the delivery was sent, in unix seconds
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	//HeaderDelivery is the ID of the delivery, the same for every attempt
+	HeaderDelivery = "X-Webhook-Delivery"
+	//HeaderEvent is the type of the event delivered
+	HeaderEvent = "X-Webhook-Event"
+)
+
+//signaturePrefix names the algorithm the signature was made with
+const signaturePrefix = "sha256="
+
+//ErrSubscriptionNotFound is returned when there is no subscription with the ID
+var ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+
+//Subscription is an endpoint that is sent the events of the chosen types,
+//from the chosen channels if there are any
+type Subscription struct {
+	ID         string   `json:"id"`
+	OwnerID    string   `json:"ownerID"`
+	URL        string   `json:"url"`
+	EventTypes []string `json:"eventTypes"`
+	ChannelIDs []string `json:"channelIDs,omitempty"`
+	//Secret signs the deliveries, it is only shown when the subscription is created
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+//NewSubscription represents a new webhook subscription
+type NewSubscription struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"eventTypes"`
+	ChannelIDs []string `json:"channelIDs"`
+}
+
+//Validate validates the new subscription
+func (ns *NewSubscription) Validate() error {
+	u, err := url.Parse(ns.URL)
+	if err != nil || u.Scheme != "https" || len(u.Hostname()) == 0 {
+		return errors.New("url must be an https URL")
+	}
+	if err := checkHost(u.Hostname()); err != nil {
+		return err
+	}
+	if len(ns.EventTypes) == 0 {
+		return errors.New("at least one event type must be chosen")
+	}
+	for _, t := range ns.EventTypes {
+		if !isEventType(t) {
+			return errors.New("unknown event type " + t)
+		}
+	}
+	return nil
+}
+
+//isEventType reports whether the type is one of the event types that can be subscribed to
+func isEventType(eventType string) bool {
+	for _, t := range events.Types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+//ToSubscription returns the subscription for the owner, with a new ID and secret
+func (ns *NewSubscription) ToSubscription(ownerID string) (*Subscription, error) {
+	id, err := randomHex(12)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	return &Subscription{
+		ID:         id,
+		OwnerID:    ownerID,
+		URL:        ns.URL,
+		EventTypes: ns.EventTypes,
+		ChannelIDs: ns.ChannelIDs,
+		Secret:     secret,
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+//matches reports whether the subscription wants the event of the type,
+//from the channel if it has one
+func (s *Subscription) matches(eventType string, channelID string) bool {
+	wanted := false
+	for _, t := range s.EventTypes {
+		if t == eventType {
+			wanted = true
+			break
+		}
+	}
+	if !wanted || len(channelID) == 0 || len(s.ChannelIDs) == 0 {
+		return wanted
+	}
+	for _, id := range s.ChannelIDs {
+		if id == channelID {
+			return true
+		}
+	}
+	return false
+}
+
+//randomHex returns n random bytes as hex
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+//Sign returns the signature sent in the X-Webhook-Signature header: the hex
+//HMAC-SHA256 of the timestamp, a period and the body, keyed with the secret.
+//Including the timestamp lets endpoints reject old deliveries being replayed
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+//Verify reports whether the signature is the one for the timestamp and body,
+//for endpoints written in Go
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}